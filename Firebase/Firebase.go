@@ -55,6 +55,8 @@ func Start(ctx context.Context) {
 		// SendAssignment: sendAssignment,
 		AgentDeleteOperation: agentDeleteOperation,
 		DeleteOperation:      deleteOperation,
+		SendPresence:         agentPresence,
+		SendAgentMessage:     sendAgentMessage,
 	})
 
 	fbctx = ctx
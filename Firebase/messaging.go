@@ -79,6 +79,30 @@ func AgentLocation(gid model.GoogleID) {
 	return
 }
 
+// agentPresence lets an agent's teammates know the agent's presence changed
+func agentPresence(g wm.GoogleID) error {
+	if !config.IsFirebaseRunning() {
+		return nil
+	}
+
+	gid := model.GoogleID(g)
+	tokens, err := gid.FirebasePresenceTokens()
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+	if len(tokens) == 0 {
+		return nil
+	}
+
+	data := map[string]string{
+		"gid": string(gid),
+		"cmd": "Agent Presence Change",
+	}
+	genericMulticast(data, tokens)
+	return nil
+}
+
 // AssignLink lets an agent know they have a new assignment on a given operation
 func AssignLink(gid model.GoogleID, linkID model.TaskID, opID model.OperationID, updateID string) error {
 	if !config.IsFirebaseRunning() {
@@ -346,6 +370,32 @@ func sendMessage(g wm.GoogleID, message string) (bool, error) {
 	return true, nil
 }
 
+// sendAgentMessage lets an agent know about a new message in their inbox
+func sendAgentMessage(g wm.GoogleID, m wm.AgentMessage) (bool, error) {
+	if !config.IsFirebaseRunning() {
+		return false, nil
+	}
+
+	gid := model.GoogleID(g)
+	tokens, err := gid.GetFirebaseTokens()
+	if err != nil {
+		log.Error(err)
+		return false, err
+	}
+	if len(tokens) == 0 {
+		return false, nil
+	}
+
+	data := map[string]string{
+		"msgID": m.ID,
+		"from":  string(m.From),
+		"msg":   m.Text,
+		"cmd":   "Agent Message",
+	}
+	genericMulticast(data, tokens)
+	return true, nil
+}
+
 // sendTarget sends a portal name/guid to an agent
 func sendTarget(g wm.GoogleID, t wm.Target) error {
 	if !config.IsFirebaseRunning() {
@@ -450,25 +500,27 @@ func sendAnnounce(teamID wm.TeamID, a wm.Announce) error {
 	if !config.IsFirebaseRunning() {
 		return nil
 	}
+	// fan out by hand so each agent's notification preferences are honored
+	agents, err := model.TeamID(teamID).FirebaseTokensByAgent()
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+
+	var tokens []string
+	for gid, t := range agents {
+		if wm.Wants(wm.GoogleID(gid), "firebase", wm.EventAnnounce, a.OpID) {
+			tokens = append(tokens, t...)
+		}
+	}
+
 	data := map[string]string{
 		"msg":    a.Text,
 		"cmd":    "Generic Message",
 		"opID":   string(a.OpID),
 		"sender": string(a.Sender),
-		"srv":    config.Get().HTTP.Webroot,
-	}
-	m := messaging.Message{
-		Topic: string(teamID),
-		Data:  data,
-	}
-
-	if _, err := msg.Send(fbctx, &m); err != nil {
-		log.Error(err)
-		if messaging.IsTooManyTopics(err) || messaging.IsMessageRateExceeded(err) {
-			slowdown()
-		}
-		return err
 	}
+	genericMulticast(data, tokens)
 	return nil
 }
 
@@ -17,6 +17,7 @@ import (
 
 	"github.com/wasabee-project/Wasabee-Server/auth"
 	"github.com/wasabee-project/Wasabee-Server/config"
+	"github.com/wasabee-project/Wasabee-Server/federation"
 	"github.com/wasabee-project/Wasabee-Server/log"
 	"github.com/wasabee-project/Wasabee-Server/model"
 )
@@ -112,6 +113,7 @@ func Start(ctx context.Context) {
 		case "https://schemas.openid.net/secevent/risc/event-type/sessions-revoked":
 			log.Debugw("sessions revoked", "subsystem", "RISC", "GID", gid, "issuer", e.Issuer, "subject", e.Subject, "reason", e.Reason)
 			_ = gid.RemoveAllFirebaseTokens()
+			revokeSessions(ctx, gid)
 			auth.Logout(gid, e.Reason)
 		case "https://schemas.openid.net/secevent/risc/event-type/tokens-revoked":
 			log.Debugw("tokens revoked", "subsystem", "RISC", "GID", gid, "issuer", e.Issuer, "subject", e.Subject, "reason", e.Reason)
@@ -123,6 +125,7 @@ func Start(ctx context.Context) {
 		case "https://accounts.google.com/risc/event/sessions-revoked":
 			log.Debugw("google sessions revoked", "subsystem", "RISC", "GID", gid, "issuer", e.Issuer, "subject", e.Subject, "reason", e.Reason)
 			_ = gid.RemoveAllFirebaseTokens()
+			revokeSessions(ctx, gid)
 			auth.Logout(gid, e.Reason)
 		default:
 			log.Warnw("unknown event", "subsystem", "RISC", "type", e.Type, "reason", e.Reason)
@@ -130,6 +133,17 @@ func Start(ctx context.Context) {
 	}
 }
 
+// revokeSessions ends every session the agent has on this server, and tells the other servers about the revoked JWTs
+func revokeSessions(ctx context.Context, gid model.GoogleID) {
+	jwts, err := gid.RevokeSessions()
+	if err != nil {
+		log.Error(err)
+	}
+	for _, j := range jwts {
+		_ = federation.RevokeJWT(ctx, j)
+	}
+}
+
 // This is called from the webhook
 func validateToken(rawjwt []byte) error {
 	// log.Debugw("RISC token", "raw", rawjwt)
@@ -71,6 +71,8 @@ func Start(ctx context.Context) {
 		SendTarget:       sendTarget,
 		AddToRemote:      addToChat,
 		RemoveFromRemote: removeFromChat,
+		SendJoinRequest:  sendJoinRequest,
+		SendAgentMessage: sendAgentMessage,
 	})
 
 	// process outgoing messages in a distinct go process
@@ -183,6 +185,15 @@ func sendMessage(g messaging.GoogleID, message string) (bool, error) {
 	return true, nil
 }
 
+// sendAgentMessage lets an agent know about a new message in their Wasabee inbox
+func sendAgentMessage(g messaging.GoogleID, m messaging.AgentMessage) (bool, error) {
+	from := m.FromName
+	if from == "" {
+		from = "Wasabee"
+	}
+	return sendMessage(g, fmt.Sprintf("<b>%s</b>: %s", from, m.Text))
+}
+
 // sendTarget is used to send a formatted target to an agent
 func sendTarget(g messaging.GoogleID, target messaging.Target) error {
 	gid := model.GoogleID(g)
@@ -50,6 +50,8 @@ func callback(update *tgbotapi.Update) (tgbotapi.MessageConfig, error) {
 	// add other commands here
 	case "wasabee":
 		msg.Text = "wasabee rocks"
+	case "join":
+		msg.Text = joinRequestCallback(gid, command)
 	default:
 		resp, err := bot.Request(
 			tgbotapi.CallbackConfig{CallbackQueryID: update.CallbackQuery.ID, Text: "Unknown Callback"},
@@ -35,6 +35,7 @@ func setupCommands() {
 		{Command: "claim", Description: "claim a task (assign to self)", Group: true},
 		{Command: "reject", Description: "reject a task (remove assignment)", Group: true},
 		{Command: "acknowledge", Description: "acknowledge an assignment", Group: true},
+		{Command: "presence", Description: "show or set your availability: available, busy, offline, away [duration], auto", Private: true},
 		{Command: "start", Description: "initial setup and grant bot permission to communicate", Private: true},
 		{Command: "help", Description: "show help info", Group: true, Private: true},
 	}
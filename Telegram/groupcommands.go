@@ -35,7 +35,7 @@ func gcUnlink(inMsg *tgbotapi.Update) {
 		return
 	}
 
-	owns, err := gid.OwnsTeam(teamID)
+	owns, err := gid.AdminsTeam(teamID)
 	if err != nil {
 		log.Error(err)
 		msg.Text = err.Error()
@@ -44,7 +44,7 @@ func gcUnlink(inMsg *tgbotapi.Update) {
 	}
 
 	if !owns {
-		err = fmt.Errorf("only team owner can unlink the team")
+		err = fmt.Errorf("only team owners and admins can unlink the team")
 		log.Error(err)
 		msg.Text = err.Error()
 		sendQueue <- msg
@@ -57,6 +57,7 @@ func gcUnlink(inMsg *tgbotapi.Update) {
 		sendQueue <- msg
 		return
 	}
+	teamID.Audit(gid, model.AuditTelegramUnlinked, fmt.Sprint(inMsg.Message.Chat.ID), "")
 
 	msg.Text, err = templates.ExecuteLang("Unlinked", inMsg.Message.From.LanguageCode, nil)
 	if err != nil {
@@ -88,7 +89,7 @@ func gcLink(inMsg *tgbotapi.Update) {
 		}
 		log.Debugw("linking team and chat", "chatID", inMsg.Message.Chat.ID, "GID", gid, "resource", team, "opID", opID)
 
-		owns, err := gid.OwnsTeam(team)
+		owns, err := gid.AdminsTeam(team)
 		if err != nil {
 			log.Error(err)
 			msg.Text = err.Error()
@@ -108,6 +109,7 @@ func gcLink(inMsg *tgbotapi.Update) {
 			sendQueue <- msg
 			return
 		}
+		team.Audit(gid, model.AuditTelegramLinked, fmt.Sprint(inMsg.Message.Chat.ID), string(opID))
 	} else {
 		msg.Text, _ = templates.ExecuteLang("SingleTeam", inMsg.Message.From.LanguageCode, nil)
 		sendQueue <- msg
@@ -226,6 +228,12 @@ func gcAssigned(inMsg *tgbotapi.Update) {
 			if tg != "" {
 				a = fmt.Sprintf("@%s", tg)
 			}
+			if m.AssignedTo != "" && m.State != "completed" {
+				// let the planner see who may not get to it
+				if pres, err := m.AssignedTo.Presence(); err == nil && pres.Status != model.PresenceAvailable {
+					a = fmt.Sprintf("%s (%s)", a, pres.Status)
+				}
+			}
 			stateIndicatorStart := ""
 			stateIndicatorEnd := ""
 			if m.State == "completed" {
@@ -90,6 +90,7 @@ func chatResponses(inMsg *tgbotapi.Update) error {
 			log.Error(err)
 			return err
 		}
+		teamID.Audit("", model.AuditTelegramUnlinked, fmt.Sprint(inMsg.Message.Chat.ID), "bot removed from chat")
 	}
 
 	// when new people are added to the chat, attempt to add them to the team
@@ -102,8 +103,9 @@ func chatResponses(inMsg *tgbotapi.Update) error {
 				continue
 			}
 			_ = tgid.SetName(new.UserName)
-			if err = teamID.AddAgent(gid); err != nil {
+			if err = teamID.AddAgent(gid, "", "telegram chat join"); err != nil {
 				log.Errorw(err.Error(), "tgid", new.ID, "tg", new.UserName, "resource", teamID, "GID", gid, "opID", opID)
+				continue
 			}
 		}
 	}
@@ -116,7 +118,7 @@ func chatResponses(inMsg *tgbotapi.Update) error {
 		if err != nil {
 			log.Debugw(err.Error(), "tgid", left.ID, "tg", left.UserName, "resource", teamID, "opID", opID)
 		} else {
-			if err := teamID.RemoveAgent(gid); err != nil {
+			if err := teamID.RemoveAgent(gid, "", "telegram chat leave"); err != nil {
 				log.Errorw(err.Error(), "tgid", left.ID, "tg", left.UserName, "resource", teamID, "GID", gid, "opID", opID)
 			}
 		}
@@ -186,6 +188,7 @@ func addToChat(g messaging.GoogleID, t messaging.TeamID) error {
 		log.Errorw(err.Error(), "chatID", chatID, "GID", gid)
 		if err.Error() == "Bad Request: chat not found" {
 			_ = teamID.UnlinkFromTelegramChat()
+			teamID.Audit("", model.AuditTelegramUnlinked, fmt.Sprint(chatID), "chat not found")
 		}
 		return err
 	}
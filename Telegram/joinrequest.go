@@ -0,0 +1,66 @@
+package wtg
+
+import (
+	"fmt"
+
+	"github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"github.com/wasabee-project/Wasabee-Server/log"
+	"github.com/wasabee-project/Wasabee-Server/messaging"
+	"github.com/wasabee-project/Wasabee-Server/model"
+)
+
+// sendJoinRequest asks a team admin to approve or deny a join request with inline buttons
+func sendJoinRequest(g messaging.GoogleID, r messaging.JoinRequest) error {
+	gid := model.GoogleID(g)
+	tgid, err := gid.TelegramID()
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+	tgid64 := int64(tgid)
+	if tgid64 == 0 {
+		log.Debugw("TelegramID not found", "subsystem", "Telegram", "GID", gid)
+		return nil
+	}
+
+	msg := tgbotapi.NewMessage(tgid64, fmt.Sprintf("<b>%s</b> wants to join <b>%s</b> (invite: %s)", r.AgentName, r.TeamName, r.Invite))
+	msg.ParseMode = "HTML"
+	// callback data is in format class/action/id
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("Approve", "join/approve/"+r.ID),
+			tgbotapi.NewInlineKeyboardButtonData("Deny", "join/deny/"+r.ID),
+		),
+	)
+
+	sendQueue <- msg
+	return nil
+}
+
+// joinRequestCallback processes the inline buttons sent by sendJoinRequest
+func joinRequestCallback(gid model.GoogleID, command []string) string {
+	if len(command) != 3 {
+		return "invalid join request"
+	}
+	requestID := model.JoinRequestID(command[2])
+
+	var err error
+	switch command[1] {
+	case "approve":
+		err = requestID.Approve(gid)
+	case "deny":
+		err = requestID.Deny(gid)
+	default:
+		return "invalid join request"
+	}
+	if err != nil {
+		log.Error(err)
+		return err.Error()
+	}
+
+	if command[1] == "approve" {
+		return "join request approved"
+	}
+	return "join request denied"
+}
@@ -3,8 +3,10 @@ package wtg
 import (
 	"context"
 	"fmt"
+	"html"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/go-telegram-bot-api/telegram-bot-api/v5"
 
@@ -91,6 +93,8 @@ func processMessage(inMsg *tgbotapi.Update, gid model.GoogleID) error {
 		case "help":
 			msg.Text, _ = templates.ExecuteLang("default", inMsg.Message.From.LanguageCode, commands)
 			msg.ReplyMarkup = baseKbd
+		case "presence":
+			msg.Text = setPresence(gid, inMsg.Message.CommandArguments())
 		// case "whois":
 		//	whois(inMsg)
 		default:
@@ -120,6 +124,46 @@ func processMessage(inMsg *tgbotapi.Update, gid model.GoogleID) error {
 	return nil
 }
 
+// setPresence handles "/presence [available|busy|offline|away [duration]|auto] [note]"; with no arguments it shows the current presence
+func setPresence(gid model.GoogleID, args string) string {
+	fields := strings.Fields(args)
+	if len(fields) > 0 {
+		status := model.PresenceStatus(strings.ToLower(fields[0]))
+		fields = fields[1:]
+		if status == "auto" {
+			status = ""
+		}
+
+		var until time.Time
+		if status == model.PresenceAway && len(fields) > 0 {
+			if d, err := time.ParseDuration(fields[0]); err == nil {
+				until = time.Now().Add(d)
+				fields = fields[1:]
+			}
+		}
+
+		if err := gid.SetPresence(status, strings.Join(fields, " "), until); err != nil {
+			return err.Error()
+		}
+	}
+
+	p, err := gid.Presence()
+	if err != nil {
+		return err.Error()
+	}
+	out := fmt.Sprintf("Presence: <b>%s</b>", p.Status)
+	if p.Auto {
+		out += " (automatic)"
+	}
+	if p.Until != "" {
+		out += fmt.Sprintf(" until %s", p.Until)
+	}
+	if p.Note != "" {
+		out += fmt.Sprintf("\n%s", html.EscapeString(p.Note))
+	}
+	return out
+}
+
 // checks rocks/v based on tgid, Inits agent if found
 func firstlogin(tgid model.TelegramID, name string) (model.GoogleID, error) {
 	agent, err := rocks.Search(fmt.Sprint(tgid))
@@ -3,26 +3,35 @@ package auth
 import (
 	"context"
 	"fmt"
+	"sync"
+	"time"
 
 	"github.com/wasabee-project/Wasabee-Server/log"
 	"github.com/wasabee-project/Wasabee-Server/model"
 	"github.com/wasabee-project/Wasabee-Server/util"
 )
 
+// MaxJWTLifetime is the longest any JWT this server accepts can have been issued for,
+// used as the expiry of revocations received without one
+const MaxJWTLifetime = time.Hour * 24 * 7
+
+// tokenAuthorizeInterval is how long a personal access token's agent stays authorized without checking again
+const tokenAuthorizeInterval = time.Minute
+
 var logoutlist *util.Safemap
-var revokedjwt *util.Safemap
 
-// Start does initialization and loads/stores the revoked JWT token lists
+// tokenAuthorized holds the time each agent using personal access tokens was last authorized
+var tokenAuthorized sync.Map
+
+// Start does initialization; revoked JWTs are kept in the database
 func Start(ctx context.Context) {
 	log.Infow("startup", "message", "setting up authorization")
 
 	logoutlist = util.NewSafemap()
-	revokedjwt = model.LoadRevokedJWT()
 
 	<-ctx.Done()
 
 	log.Infow("shutdown", "message", "shutting down authorization")
-	model.StoreRevokedJWT(revokedjwt)
 }
 
 // Authorize is called to verify that an agent is permitted to use Wasabee.
@@ -61,6 +70,23 @@ func Authorize(gid model.GoogleID) (bool, error) {
 	return true, nil
 }
 
+// AuthorizeToken is Authorize for agents using personal access tokens, which have no refresh at which to check;
+// an agent is checked again once a minute, a denial is never remembered
+func AuthorizeToken(gid model.GoogleID) (bool, error) {
+	now := time.Now()
+	if last, ok := tokenAuthorized.Load(gid); ok && now.Sub(last.(time.Time)) < tokenAuthorizeInterval {
+		return true, nil
+	}
+
+	authorized, err := Authorize(gid)
+	if !authorized {
+		tokenAuthorized.Delete(gid)
+		return false, err
+	}
+	tokenAuthorized.Store(gid, now)
+	return true, nil
+}
+
 // Logout adds a GoogleID to the list of logged out agents
 func Logout(gid model.GoogleID, reason string) {
 	logoutlist.SetBool(string(gid), true)
@@ -77,13 +103,15 @@ func IsLoggedOut(gid model.GoogleID) bool {
 	return false
 }
 
-// RevokeJWT adds a JWT ID to the revoked list
-func RevokeJWT(tokenID string) {
-	log.Infow("revoking JWT", "id", tokenID)
-	revokedjwt.SetBool(tokenID, true)
+// RevokeJWT adds a JWT ID to the revoked list, it is kept until the token expires
+func RevokeJWT(tokenID string, gid model.GoogleID, expires time.Time) {
+	log.Infow("revoking JWT", "id", tokenID, "GID", gid)
+	if err := model.RevokeJWT(tokenID, gid, expires); err != nil {
+		log.Error(err)
+	}
 }
 
-// IsRevokedJWT checks if a JWT ID is on the revoked list.
-func IsRevokedJWT(tokenID string) bool {
-	return revokedjwt.GetBool(tokenID)
+// IsRevokedJWT checks if a JWT ID is on the revoked list; if the list cannot be checked, the error is returned and the token must be refused
+func IsRevokedJWT(tokenID string) (bool, error) {
+	return model.IsRevokedJWT(tokenID)
 }
@@ -0,0 +1,213 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v2/jwk"
+	"github.com/lestrrat-go/jwx/v2/jws"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+	"golang.org/x/oauth2"
+
+	"github.com/wasabee-project/Wasabee-Server/log"
+)
+
+// a provider whose discovery failed is not asked again for this long
+const oidcDiscoveryBackoff = time.Minute
+
+// OIDCProvider is an OpenID Connect issuer and this server's client registration with it
+type OIDCProvider struct {
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+	SubjectClaim string
+	NameClaim    string
+	PictureClaim string
+}
+
+// OIDCDiscovery is the part of a provider's openid-configuration the server uses
+type OIDCDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// OIDCIdentity is the account an ID token was issued for, read from the provider's mapped claims
+type OIDCIdentity struct {
+	Subject string
+	Name    string
+	Picture string
+}
+
+type oidcDiscoveryResult struct {
+	d    *OIDCDiscovery
+	err  error
+	when time.Time
+}
+
+var oidcDiscovered sync.Map // issuer -> *oidcDiscoveryResult
+var oidcKeys *jwk.Cache
+var oidcKeysOnce sync.Once
+
+// Discover reads the provider's openid-configuration; successes are kept, failures are retried after a backoff
+func (p *OIDCProvider) Discover(ctx context.Context) (*OIDCDiscovery, error) {
+	if r, ok := oidcDiscovered.Load(p.Issuer); ok {
+		r := r.(*oidcDiscoveryResult)
+		if r.err == nil || time.Since(r.when) < oidcDiscoveryBackoff {
+			return r.d, r.err
+		}
+	}
+
+	d, err := p.discover(ctx)
+	oidcDiscovered.Store(p.Issuer, &oidcDiscoveryResult{d: d, err: err, when: time.Now()})
+	return d, err
+}
+
+func (p *OIDCProvider) discover(ctx context.Context) (*OIDCDiscovery, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", strings.TrimSuffix(p.Issuer, "/")+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		err := fmt.Errorf("OIDC discovery failed: %s", resp.Status)
+		log.Errorw(err.Error(), "provider", p.Name, "issuer", p.Issuer)
+		return nil, err
+	}
+
+	var d OIDCDiscovery
+	if err := json.NewDecoder(resp.Body).Decode(&d); err != nil {
+		log.Error(err)
+		return nil, err
+	}
+	if d.Issuer != p.Issuer || d.JWKSURI == "" {
+		err := fmt.Errorf("OIDC discovery document does not match the configured issuer")
+		log.Errorw(err.Error(), "provider", p.Name, "issuer", p.Issuer, "discovered", d.Issuer)
+		return nil, err
+	}
+	return &d, nil
+}
+
+// Exchange trades an authorization code, obtained by a client for this server's client ID, for the ID token
+func (p *OIDCProvider) Exchange(ctx context.Context, code, redirectURI, codeVerifier string) (string, error) {
+	d, err := p.Discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	cfg := oauth2.Config{
+		ClientID:     p.ClientID,
+		ClientSecret: p.ClientSecret,
+		RedirectURL:  redirectURI,
+		Scopes:       p.Scopes,
+		Endpoint: oauth2.Endpoint{
+			AuthURL:  d.AuthorizationEndpoint,
+			TokenURL: d.TokenEndpoint,
+		},
+	}
+	opts := make([]oauth2.AuthCodeOption, 0)
+	if codeVerifier != "" {
+		opts = append(opts, oauth2.SetAuthURLParam("code_verifier", codeVerifier))
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	t, err := cfg.Exchange(ctx, code, opts...)
+	if err != nil {
+		log.Infow(err.Error(), "provider", p.Name)
+		return "", fmt.Errorf("authorization code rejected by the OIDC provider")
+	}
+	idToken, _ := t.Extra("id_token").(string)
+	if idToken == "" {
+		return "", fmt.Errorf("OIDC provider returned no id_token")
+	}
+	return idToken, nil
+}
+
+// Verify checks the ID token's signature against the provider's keys, its issuer, audience and expiry,
+// and that it was issued to this server's client; it returns the identity from the mapped claims
+func (p *OIDCProvider) Verify(ctx context.Context, idToken string) (*OIDCIdentity, error) {
+	d, err := p.Discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	oidcKeysOnce.Do(func() {
+		oidcKeys = jwk.NewCache(context.Background())
+	})
+	if !oidcKeys.IsRegistered(d.JWKSURI) {
+		if err := oidcKeys.Register(d.JWKSURI); err != nil {
+			log.Error(err)
+			return nil, err
+		}
+	}
+	keys, err := oidcKeys.Get(ctx, d.JWKSURI)
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+
+	token, err := jwt.ParseString(idToken,
+		jwt.WithKeySet(keys, jws.WithInferAlgorithmFromKey(true)),
+		jwt.WithValidate(true),
+		jwt.WithIssuer(d.Issuer),
+		jwt.WithAudience(p.ClientID),
+		jwt.WithAcceptableSkew(20*time.Second),
+	)
+	if err != nil {
+		log.Infow(err.Error(), "provider", p.Name)
+		return nil, err
+	}
+
+	// a token for several audiences must name this server's client as the party it was issued to
+	azp := p.claim(token, "azp")
+	if (len(token.Audience()) > 1 || azp != "") && azp != p.ClientID {
+		err := fmt.Errorf("OIDC token was issued to another client")
+		log.Warnw(err.Error(), "provider", p.Name, "azp", azp)
+		return nil, err
+	}
+
+	id := OIDCIdentity{
+		Subject: p.claim(token, p.SubjectClaim),
+		Name:    p.claim(token, p.NameClaim),
+		Picture: p.claim(token, p.PictureClaim),
+	}
+	if id.Subject == "" {
+		err := fmt.Errorf("OIDC token has no %s claim", p.SubjectClaim)
+		log.Warnw(err.Error(), "provider", p.Name)
+		return nil, err
+	}
+	return &id, nil
+}
+
+func (p *OIDCProvider) claim(token jwt.Token, claim string) string {
+	if claim == "" {
+		return ""
+	}
+	if claim == jwt.SubjectKey {
+		return token.Subject()
+	}
+	v, ok := token.Get(claim)
+	if !ok {
+		return ""
+	}
+	s, _ := v.(string)
+	return s
+}
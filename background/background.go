@@ -10,10 +10,14 @@ import (
 	"github.com/wasabee-project/Wasabee-Server/model"
 )
 
-// Start runs the database cleaning tasks such as expiring stale user locations
+// Start runs the database cleaning tasks such as expiring stale user locations, and the scheduled V and rocks team syncs
 func Start(ctx context.Context) {
 	log.Infow("startup", "message", "running initial background tasks")
 	model.LocationClean()
+	opPermissionSchedule()
+
+	minutely := time.NewTicker(time.Minute)
+	defer minutely.Stop()
 
 	hourly := time.NewTicker(time.Hour)
 	defer hourly.Stop()
@@ -25,13 +29,22 @@ func Start(ctx context.Context) {
 		wfb.Resubscribe() // prevent a crash if background starts before firebase
 	}
 
+	go teamSync(ctx)
+
 	for {
 		select {
 		case <-ctx.Done():
 			log.Infow("shutdown", "message", "background tasks shutting down")
 			return
+		case <-minutely.C:
+			opPermissionSchedule()
+			model.PresenceSweep()
 		case <-hourly.C:
 			model.LocationClean()
+			model.TeamSyncClean()
+			model.LocationTrackClean()
+			model.RevokedJWTClean()
+			model.RefreshTokenClean()
 			wfb.ResetDefaultRateLimits()
 		case <-weekly.C:
 			wfb.Resubscribe()
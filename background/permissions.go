@@ -0,0 +1,41 @@
+package background
+
+import (
+	"fmt"
+
+	"github.com/wasabee-project/Wasabee-Server/log"
+	"github.com/wasabee-project/Wasabee-Server/messaging"
+	"github.com/wasabee-project/Wasabee-Server/model"
+)
+
+// opPermissionSchedule opens and closes time-bounded op permissions and lets the teams know
+func opPermissionSchedule() {
+	opened, closed, err := model.OpPermissionSchedule()
+	if err != nil {
+		log.Error(err)
+	}
+
+	for _, p := range opened {
+		announcePermChange(p, "now open to your team")
+	}
+
+	for _, p := range closed {
+		announcePermChange(p, "no longer available to your team")
+	}
+}
+
+func announcePermChange(p model.OpPermission, change string) {
+	stat, err := p.OpID.Stat()
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	log.Infow("op permission schedule", "resource", p.OpID, "teamID", p.TeamID, "role", p.Role, "change", change)
+	messaging.SendAnnounce(messaging.TeamID(p.TeamID), messaging.Announce{
+		Text:   fmt.Sprintf("Operation %s (%s access) is %s", stat.Name, p.Role, change),
+		Sender: messaging.GoogleID(stat.Gid),
+		OpID:   messaging.OperationID(p.OpID),
+		TeamID: messaging.TeamID(p.TeamID),
+	})
+}
@@ -0,0 +1,105 @@
+package background
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/wasabee-project/Wasabee-Server/config"
+	"github.com/wasabee-project/Wasabee-Server/log"
+	"github.com/wasabee-project/Wasabee-Server/model"
+	"github.com/wasabee-project/Wasabee-Server/rocks"
+	"github.com/wasabee-project/Wasabee-Server/v"
+)
+
+// every linked team is pulled once per interval
+const teamSyncInterval = 6 * time.Hour
+
+// teamSync periodically pulls the membership of every team linked to V or a rocks community
+func teamSync(ctx context.Context) {
+	ticker := time.NewTicker(teamSyncInterval)
+	defer ticker.Stop()
+
+	for {
+		syncLinkedTeams(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// syncLinkedTeams spreads the pulls evenly across the interval rather than hitting V and rocks all at once
+func syncLinkedTeams(ctx context.Context) {
+	vteams, rocksteams, err := model.SyncedTeams()
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	type job struct {
+		teamID model.TeamID
+		source string
+	}
+	var jobs []job
+	for _, t := range vteams {
+		jobs = append(jobs, job{t, model.SyncSourceV})
+	}
+	for _, t := range rocksteams {
+		jobs = append(jobs, job{t, model.SyncSourceRocks})
+	}
+	if len(jobs) == 0 {
+		return
+	}
+
+	spacing := teamSyncInterval / time.Duration(len(jobs))
+	log.Infow("team sync", "message", "starting scheduled team sync", "teams", len(jobs), "spacing", spacing.String())
+
+	for _, j := range jobs {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(spacing):
+		}
+
+		SyncTeam(ctx, j.teamID, j.source)
+	}
+}
+
+// SyncTeam pulls one linked team's membership from the source now, if that integration is running;
+// the result, success or failure, is recorded in the team's sync log
+func SyncTeam(ctx context.Context, teamID model.TeamID, source string) {
+	switch source {
+	case model.SyncSourceV:
+		if !config.IsVRunning() {
+			return
+		}
+		syncVTeam(ctx, teamID)
+	case model.SyncSourceRocks:
+		if !config.IsRocksRunning() {
+			return
+		}
+		_ = rocks.CommunityMemberPull(teamID)
+	}
+}
+
+// syncVTeam pulls the team from V using the team owner's V API key
+func syncVTeam(ctx context.Context, teamID model.TeamID) {
+	owner, err := teamID.Owner()
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	key, _ := owner.GetVAPIkey()
+	if key == "" {
+		err := fmt.Errorf("team owner has no V API key set")
+		log.Infow(err.Error(), "resource", teamID, "GID", owner)
+		teamID.RecordSync(model.SyncSourceV, time.Now(), 0, 0, err)
+		return
+	}
+
+	_ = v.Sync(ctx, teamID, key)
+}
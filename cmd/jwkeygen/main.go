@@ -4,44 +4,291 @@ import (
 	"crypto/rand"
 	"crypto/rsa"
 	"encoding/json"
+	"flag"
 	"fmt"
+	"os"
+	"path"
 
 	"github.com/lestrrat-go/jwx/v2/jwk"
 
+	"github.com/wasabee-project/Wasabee-Server/config"
 	"github.com/wasabee-project/Wasabee-Server/util"
 )
 
+const usage = `usage: jwkeygen [-certs dir] [-priv file] [-pub file] [command]
+
+with no command, a new key pair is printed
+
+commands, which change the key files; send the server SIGHUP to reload them:
+  add           create a key; it is published but does not sign until promoted
+  promote kid   sign new tokens with the key
+  retire kid    stop using the key; tokens it signed verify until they expire
+  remove kid    drop a retired key once its tokens have expired
+  list          show the keys
+`
+
 func main() {
+	certs := flag.String("certs", "certs", "directory containing the key files")
+	priv := flag.String("priv", "jwkpriv.json", "private (signing) key file")
+	pub := flag.String("pub", "jwkpub.json", "public (verification) key file")
+	flag.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+	flag.Parse()
+
+	privfile := path.Join(*certs, *priv)
+	pubfile := path.Join(*certs, *pub)
+
+	var err error
+	switch flag.Arg(0) {
+	case "":
+		err = printKey()
+	case "add":
+		err = add(privfile, pubfile)
+	case "promote":
+		err = promote(privfile, flag.Arg(1))
+	case "retire":
+		err = retire(privfile, flag.Arg(1))
+	case "remove":
+		err = remove(privfile, pubfile, flag.Arg(1))
+	case "list":
+		err = list(privfile, pubfile)
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Printf("%s\n", err)
+		os.Exit(1)
+	}
+}
+
+func newKey() (jwk.Key, error) {
 	raw, err := rsa.GenerateKey(rand.Reader, 2048)
 	if err != nil {
-		fmt.Printf("failed to generate new RSA private key: %s\n", err)
-		return
+		return nil, fmt.Errorf("failed to generate new RSA private key: %s", err)
 	}
 
 	key, err := jwk.FromRaw(raw)
 	if err != nil {
-		fmt.Printf("failed to create symmetric key: %s\n", err)
-		return
+		return nil, fmt.Errorf("failed to create symmetric key: %s", err)
 	}
 	if _, ok := key.(jwk.RSAPrivateKey); !ok {
-		fmt.Printf("expected jwk.SymmetricKey, got %T\n", key)
-		return
+		return nil, fmt.Errorf("expected jwk.SymmetricKey, got %T", key)
 	}
 
 	_ = key.Set(jwk.KeyIDKey, util.GenerateID(16))
+	return key, nil
+}
+
+func printKey() error {
+	key, err := newKey()
+	if err != nil {
+		return err
+	}
 
 	buf, err := json.MarshalIndent(key, "", "  ")
 	if err != nil {
-		fmt.Printf("failed to marshal key into JSON: %s\n", err)
-		return
+		return fmt.Errorf("failed to marshal key into JSON: %s", err)
 	}
 	fmt.Printf("%s\n", buf)
 
 	pk, _ := jwk.PublicKeyOf(key)
 	buf, err = json.MarshalIndent(pk, "", "  ")
 	if err != nil {
-		fmt.Printf("failed to marshal public key into JSON: %s\n", err)
-		return
+		return fmt.Errorf("failed to marshal public key into JSON: %s", err)
 	}
 	fmt.Printf("%s\n", buf)
+	return nil
+}
+
+// readSet loads a key file; a missing file is an empty set
+func readSet(file string) (jwk.Set, error) {
+	set, err := jwk.ReadFile(file)
+	if os.IsNotExist(err) {
+		return jwk.NewSet(), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", file, err)
+	}
+	return set, nil
+}
+
+func writeSet(file string, set jwk.Set, perm os.FileMode) error {
+	buf, err := json.MarshalIndent(set, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal keys into JSON: %s", err)
+	}
+	// write then rename, so a running server never reads half a file
+	tmp := file + ".new"
+	if err := os.WriteFile(tmp, append(buf, '\n'), perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp, file)
+}
+
+func isActive(k jwk.Key) bool {
+	v, _ := k.Get(config.JWKActive)
+	b, ok := v.(bool)
+	return ok && b
+}
+
+// add publishes the new key first; promote it once third parties have had time to fetch the key set
+func add(privfile, pubfile string) error {
+	privs, err := readSet(privfile)
+	if err != nil {
+		return err
+	}
+	pubs, err := readSet(pubfile)
+	if err != nil {
+		return err
+	}
+
+	key, err := newKey()
+	if err != nil {
+		return err
+	}
+	// the first key signs right away; a lone key that signed without a marker keeps signing once it has company
+	switch privs.Len() {
+	case 0:
+		_ = key.Set(config.JWKActive, true)
+	case 1:
+		k, _ := privs.Key(0)
+		if !isActive(k) {
+			_ = k.Set(config.JWKActive, true)
+		}
+	}
+	pk, err := jwk.PublicKeyOf(key)
+	if err != nil {
+		return err
+	}
+	_ = pk.Remove(config.JWKActive)
+
+	if err := pubs.AddKey(pk); err != nil {
+		return err
+	}
+	if err := privs.AddKey(key); err != nil {
+		return err
+	}
+	if err := writeSet(pubfile, pubs, 0644); err != nil {
+		return err
+	}
+	if err := writeSet(privfile, privs, 0600); err != nil {
+		return err
+	}
+	fmt.Printf("added %s\n", key.KeyID())
+	return nil
+}
+
+func promote(privfile, kid string) error {
+	privs, err := readSet(privfile)
+	if err != nil {
+		return err
+	}
+	if _, ok := privs.LookupKeyID(kid); !ok {
+		return fmt.Errorf("no signing key %q", kid)
+	}
+
+	for i := 0; i < privs.Len(); i++ {
+		k, _ := privs.Key(i)
+		if k.KeyID() == kid {
+			_ = k.Set(config.JWKActive, true)
+		} else {
+			_ = k.Remove(config.JWKActive)
+		}
+	}
+	if err := writeSet(privfile, privs, 0600); err != nil {
+		return err
+	}
+	fmt.Printf("promoted %s\n", kid)
+	return nil
+}
+
+// retire removes the private key, the public key stays published so tokens it signed still verify
+func retire(privfile, kid string) error {
+	privs, err := readSet(privfile)
+	if err != nil {
+		return err
+	}
+	k, ok := privs.LookupKeyID(kid)
+	if !ok {
+		return fmt.Errorf("no signing key %q", kid)
+	}
+	if isActive(k) || privs.Len() == 1 {
+		return fmt.Errorf("%s is signing tokens, promote another key first", kid)
+	}
+
+	if err := privs.RemoveKey(k); err != nil {
+		return err
+	}
+	if err := writeSet(privfile, privs, 0600); err != nil {
+		return err
+	}
+	fmt.Printf("retired %s, remove it once the tokens it signed have expired\n", kid)
+	return nil
+}
+
+func remove(privfile, pubfile, kid string) error {
+	privs, err := readSet(privfile)
+	if err != nil {
+		return err
+	}
+	if _, ok := privs.LookupKeyID(kid); ok {
+		return fmt.Errorf("%s is a signing key, retire it first", kid)
+	}
+	pubs, err := readSet(pubfile)
+	if err != nil {
+		return err
+	}
+	k, ok := pubs.LookupKeyID(kid)
+	if !ok {
+		return fmt.Errorf("no public key %q", kid)
+	}
+
+	if err := pubs.RemoveKey(k); err != nil {
+		return err
+	}
+	if err := writeSet(pubfile, pubs, 0644); err != nil {
+		return err
+	}
+	fmt.Printf("removed %s\n", kid)
+	return nil
+}
+
+func list(privfile, pubfile string) error {
+	privs, err := readSet(privfile)
+	if err != nil {
+		return err
+	}
+	pubs, err := readSet(pubfile)
+	if err != nil {
+		return err
+	}
+
+	// the same rule the server uses, so what is listed as active is what signs
+	var activeKID string
+	active, activeErr := config.ActiveJWK(privs)
+	if activeErr == nil {
+		activeKID = active.KeyID()
+	}
+
+	for i := 0; i < pubs.Len(); i++ {
+		p, _ := pubs.Key(i)
+		status := "retired"
+		if _, ok := privs.LookupKeyID(p.KeyID()); ok {
+			status = "published"
+			if p.KeyID() == activeKID {
+				status = "active"
+			}
+		}
+		fmt.Printf("%s\t%s\n", p.KeyID(), status)
+	}
+	for i := 0; i < privs.Len(); i++ {
+		k, _ := privs.Key(i)
+		if _, ok := pubs.LookupKeyID(k.KeyID()); !ok {
+			fmt.Printf("%s\tnot published\n", k.KeyID())
+		}
+	}
+	if privs.Len() > 0 && activeErr != nil {
+		fmt.Printf("warning: %s\n", activeErr)
+	}
+	return nil
 }
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jwk"
+	"github.com/lestrrat-go/jwx/v2/jws"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+
+	"github.com/wasabee-project/Wasabee-Server/config"
+	"github.com/wasabee-project/Wasabee-Server/log"
+)
+
+func TestMain(m *testing.M) {
+	log.Start(context.Background(), &log.Configuration{Console: true})
+	os.Exit(m.Run())
+}
+
+// signedBy signs a token with the server's current signing key, as the server does
+func signedBy(t *testing.T) (string, []byte) {
+	t.Helper()
+
+	key, ok := config.JWSigningKey()
+	if !ok {
+		t.Fatal("no signing key")
+	}
+	tok, err := jwt.NewBuilder().Subject("jwkeygen test").Expiration(time.Now().Add(time.Hour)).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed, err := jwt.Sign(tok, jwt.WithKey(jwa.RS256, key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key.KeyID(), signed
+}
+
+// verifies reports if the server's current verification keys accept the token
+func verifies(signed []byte) bool {
+	_, err := jwt.Parse(signed, jwt.WithKeySet(config.JWParsingKeys(), jws.WithInferAlgorithmFromKey(true), jws.WithUseDefault(true)), jwt.WithValidate(true))
+	return err == nil
+}
+
+func kids(t *testing.T, file string) []string {
+	t.Helper()
+
+	set, err := readSet(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := make([]string, 0, set.Len())
+	for i := 0; i < set.Len(); i++ {
+		k, _ := set.Key(i)
+		out = append(out, k.KeyID())
+	}
+	return out
+}
+
+func activeKID(t *testing.T, file string) string {
+	t.Helper()
+
+	set, err := readSet(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	k, err := config.ActiveJWK(set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k.KeyID()
+}
+
+func TestKeyRotation(t *testing.T) {
+	dir := t.TempDir()
+	c := config.Get()
+	c.Certs, c.JWKpriv, c.JWKpub = dir, "jwkpriv.json", "jwkpub.json"
+	privfile := path.Join(dir, c.JWKpriv)
+	pubfile := path.Join(dir, c.JWKpub)
+
+	// the first key signs right away
+	if err := add(privfile, pubfile); err != nil {
+		t.Fatal(err)
+	}
+	if err := config.ReloadJWK(); err != nil {
+		t.Fatal(err)
+	}
+	first, old := signedBy(t)
+	if !verifies(old) {
+		t.Fatal("token from the first key does not verify")
+	}
+
+	// a second key is published, but does not sign until promoted
+	if err := add(privfile, pubfile); err != nil {
+		t.Fatal(err)
+	}
+	privs := kids(t, privfile)
+	if len(privs) != 2 || len(kids(t, pubfile)) != 2 {
+		t.Fatalf("keys after the second add: %v, published %v", privs, kids(t, pubfile))
+	}
+	second := privs[1]
+	if got := activeKID(t, privfile); got != first {
+		t.Errorf("active key %s after adding, want %s", got, first)
+	}
+
+	if err := retire(privfile, first); err == nil {
+		t.Error("the active key was retired")
+	}
+	if err := promote(privfile, "nosuchkey"); err == nil {
+		t.Error("an unknown key was promoted")
+	}
+	if err := promote(privfile, second); err != nil {
+		t.Fatal(err)
+	}
+	if got := activeKID(t, privfile); got != second {
+		t.Errorf("active key %s after promoting, want %s", got, second)
+	}
+
+	// a retired key's tokens still verify
+	if err := remove(privfile, pubfile, first); err == nil {
+		t.Error("a signing key was removed without retiring it")
+	}
+	if err := retire(privfile, first); err != nil {
+		t.Fatal(err)
+	}
+	if got := kids(t, privfile); len(got) != 1 || got[0] != second {
+		t.Errorf("signing keys after retiring: %v", got)
+	}
+	if err := config.ReloadJWK(); err != nil {
+		t.Fatal(err)
+	}
+	kid, current := signedBy(t)
+	if kid != second {
+		t.Errorf("signing with %s, want %s", kid, second)
+	}
+	if !verifies(current) {
+		t.Error("token from the promoted key does not verify")
+	}
+	if !verifies(old) {
+		t.Error("token from the retired key does not verify")
+	}
+
+	// once removed, they no longer do
+	if err := remove(privfile, pubfile, first); err != nil {
+		t.Fatal(err)
+	}
+	if err := config.ReloadJWK(); err != nil {
+		t.Fatal(err)
+	}
+	if verifies(old) {
+		t.Error("token from a removed key verifies")
+	}
+	if !verifies(current) {
+		t.Error("token from the active key no longer verifies")
+	}
+}
+
+func TestReloadKeepsKeysOnError(t *testing.T) {
+	dir := t.TempDir()
+	c := config.Get()
+	c.Certs, c.JWKpriv, c.JWKpub = dir, "jwkpriv.json", "jwkpub.json"
+	privfile := path.Join(dir, c.JWKpriv)
+	pubfile := path.Join(dir, c.JWKpub)
+
+	for i := 0; i < 2; i++ {
+		if err := add(privfile, pubfile); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := config.ReloadJWK(); err != nil {
+		t.Fatal(err)
+	}
+	kid, signed := signedBy(t)
+
+	// two keys marked active by hand
+	privs, err := readSet(privfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < privs.Len(); i++ {
+		k, _ := privs.Key(i)
+		_ = k.Set(config.JWKActive, true)
+	}
+	if err := writeSet(privfile, privs, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := config.ReloadJWK(); err == nil {
+		t.Error("two active keys loaded")
+	}
+	if got, _ := signedBy(t); got != kid || !verifies(signed) {
+		t.Errorf("signing key changed to %s by a failed reload", got)
+	}
+
+	// a key which is in the private file only still verifies its own tokens
+	pubs := jwk.NewSet()
+	if err := writeSet(pubfile, pubs, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := promote(privfile, kid); err != nil {
+		t.Fatal(err)
+	}
+	if err := config.ReloadJWK(); err != nil {
+		t.Fatal(err)
+	}
+	if !verifies(signed) {
+		t.Error("token from a signing key missing from the public keys does not verify")
+	}
+}
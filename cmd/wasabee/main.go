@@ -208,6 +208,14 @@ func run(cargs *cli.Context) error {
 	sigch := make(chan os.Signal, 1)
 	signal.Notify(sigch, syscall.SIGINT, syscall.SIGQUIT, syscall.SIGTERM, syscall.SIGHUP, os.Interrupt)
 	sig := <-sigch
+	// SIGHUP reloads the JWT keys after they are rotated with jwkeygen
+	for sig == syscall.SIGHUP {
+		log.Infow("reloading JWT keys", "requested by signal", sig)
+		if err := config.ReloadJWK(); err != nil {
+			log.Error(err)
+		}
+		sig = <-sigch
+	}
 	log.Infow("shutdown", "requested by signal", sig)
 
 	// shutdown RISC, Telegram, V, Rocks, and Firebase by canceling the context
@@ -3,9 +3,11 @@ package config
 import (
 	// "context"
 	"encoding/json"
+	"fmt"
 	"os"
 	"path"
 	"path/filepath"
+	"strings"
 	"sync"
 
 	"golang.org/x/oauth2"
@@ -27,9 +29,9 @@ type WasabeeConf struct {
 	CertFile          string   // filename (relative to Certs)
 	CertKey           string   // filename (relative to Certs)
 	FirebaseKey       string   // filename (relative to Certs)
-	JWKpriv           string   // filename (relative to Certs)
-	JWKpub            string   // filename (relative to Certs)
-	JKU               string   // URL to well-known JKU (for 3rd parties to verify our JWT)
+	JWKpriv           string   // filename (relative to Certs), the signing keys; manage with jwkeygen
+	JWKpub            string   // filename (relative to Certs), the public keys, including retired keys still in use
+	JKU               string   // URL to well-known JKU (for 3rd parties to verify our JWT), default Webroot + /.well-known/jwks.json
 	DefaultPictureURL string   // URL to a default image for agents
 	WebUIURL          string   // URL of WebUI
 	GRPCPort          uint16   // Port on which to send and receive gRPC messages
@@ -37,6 +39,7 @@ type WasabeeConf struct {
 	GRPCDomain        string   // domain for grpc credentials
 	StoreRevisions    bool     // keep a copy of each upload
 	RevisionsDir      string   // where to keep them
+	Admins            []string // GoogleIDs of the server's administrators
 
 	// configuraiton for various subsystems
 	V        wv
@@ -45,15 +48,19 @@ type WasabeeConf struct {
 	HTTP     whttp
 	RISC     wrisc
 	Apple    apple
+	OIDC     []woidc // generic OpenID Connect login providers
 
 	// not configurable
 	fbRunning bool
 
-	// loaded by LoadFile()
-	jwSigningKeys jwk.Set
+	// loaded by LoadFile(), replaced by ReloadJWK()
+	jwSigningKey  jwk.Key
 	jwParsingKeys jwk.Set
 }
 
+// JWKActive is the private parameter jwkeygen sets on the key which signs new tokens
+const JWKActive = "wasabee_active"
+
 // Configure v.enl.one
 type wv struct {
 	APIKey         string // get from V
@@ -106,6 +113,7 @@ type whttp struct {
 	APIPathURL      string // /api/v1
 	ApTokenURL      string // post Google Oauth token, get JWT/Cookie
 	OneTimeTokenURL string // probably deprecated
+	RefreshURL      string // post a refresh token, get a new JWT and refresh token
 
 	CORS []string // list of sites for which browsers will make API request
 
@@ -120,8 +128,21 @@ type apple struct {
 	Secret   string // from portal
 }
 
+// Configure a generic OpenID Connect login provider (Keycloak, Authentik, ...)
+type woidc struct {
+	Name         string   // short name, used in the login URL /oidc/{Name}
+	Issuer       string   // exactly as the provider's tokens have it; discovery is read from Issuer + "/.well-known/openid-configuration"
+	ClientID     string   // defined by the provider
+	ClientSecret string   // defined by the provider, used to exchange authorization codes
+	Scopes       []string // default openid, profile
+	SubjectClaim string   // claim holding the account's unique ID, default "sub"
+	NameClaim    string   // claim holding the agent name, default "preferred_username"
+	PictureClaim string   // claim holding a picture URL, default "picture"
+}
+
 var once sync.Once
 var c WasabeeConf
+var jwkMu sync.RWMutex
 
 // LoadFile is the primary method for loading the Wasabee config file, setting the defaults
 func LoadFile(filename string) (*WasabeeConf, error) {
@@ -157,6 +178,28 @@ func LoadFile(filename string) (*WasabeeConf, error) {
 	in.Certs = certdir
 	log.Debugw("startup", "Certificate Directory", in.Certs)
 
+	// per-provider defaults, the file replaces the whole list
+	for i := range in.OIDC {
+		o := &in.OIDC[i]
+		if len(o.Scopes) == 0 {
+			o.Scopes = []string{"openid", "profile"}
+		}
+		if o.SubjectClaim == "" {
+			o.SubjectClaim = "sub"
+		}
+		if o.NameClaim == "" {
+			o.NameClaim = "preferred_username"
+		}
+		if o.PictureClaim == "" {
+			o.PictureClaim = "picture"
+		}
+		log.Infow("startup", "OIDC provider", o.Name, "issuer", o.Issuer)
+	}
+
+	if in.JKU == "" {
+		in.JKU = strings.TrimSuffix(in.HTTP.Webroot, "/") + "/.well-known/jwks.json"
+	}
+
 	// make active
 	c = *in
 
@@ -230,29 +273,79 @@ func TelegramBotID() int {
 
 // setupJWK loads the keys used for the JWK signing and verification, set the file paths
 func setupJWK(certdir, signers, parsers string) error {
-	var err error
-	c.jwSigningKeys, err = jwk.ReadFile(path.Join(certdir, signers))
+	signing, err := jwk.ReadFile(path.Join(certdir, signers))
 	if err != nil {
 		log.Error(err)
 		return err
 	}
-	log.Debugw("loaded JWT signing keys", "count", c.jwSigningKeys.Len(), "path", signers)
+	log.Debugw("loaded JWT signing keys", "count", signing.Len(), "path", signers)
 
-	/* for iter := c.jwSigningKeys.Iterate(context.TODO()); iter.Next(context.TODO()); {
-		x := iter.Pair()
-		log.Debugw("jwk signer", "key", x)
-	} */
+	parsing, err := jwk.ReadFile(path.Join(certdir, parsers))
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+	log.Debugw("loaded JWT parsing keys", "count", parsing.Len(), "path", parsers)
 
-	c.jwParsingKeys, err = jwk.ReadFile(path.Join(certdir, parsers))
+	key, err := ActiveJWK(signing)
 	if err != nil {
 		log.Error(err)
 		return err
 	}
-	log.Debugw("loaded JWT parsing keys", "count", c.jwParsingKeys.Len(), "path", parsers)
 
+	// tokens from the active key must always verify, even if jwkpub.json was not updated
+	if kid := key.KeyID(); kid == "" {
+		log.Warnw("JWT signing key has no kid, third parties may not be able to verify tokens", "path", signers)
+	} else if _, ok := parsing.LookupKeyID(kid); !ok {
+		pub, err := jwk.PublicKeyOf(key)
+		if err != nil {
+			log.Error(err)
+			return err
+		}
+		_ = pub.Remove(JWKActive)
+		if err := parsing.AddKey(pub); err != nil {
+			log.Error(err)
+			return err
+		}
+		log.Warnw("JWT signing key missing from the public keys, added", "kid", kid, "path", parsers)
+	}
+	log.Infow("startup", "JWT signing key", key.KeyID(), "verification keys", parsing.Len())
+
+	jwkMu.Lock()
+	c.jwSigningKey = key
+	c.jwParsingKeys = parsing
+	jwkMu.Unlock()
 	return nil
 }
 
+// ActiveJWK finds the key marked active; a file with a single key needs no marking
+func ActiveJWK(set jwk.Set) (jwk.Key, error) {
+	var active jwk.Key
+	for i := 0; i < set.Len(); i++ {
+		k, _ := set.Key(i)
+		v, _ := k.Get(JWKActive)
+		if b, ok := v.(bool); ok && b {
+			if active != nil {
+				return nil, fmt.Errorf("more than one JWT signing key is marked active")
+			}
+			active = k
+		}
+	}
+	if active != nil {
+		return active, nil
+	}
+	if set.Len() == 1 {
+		k, _ := set.Key(0)
+		return k, nil
+	}
+	return nil, fmt.Errorf("no JWT signing key is marked active, use jwkeygen promote")
+}
+
+// ReloadJWK re-reads the key files after they are changed with jwkeygen; on error the current keys stay in use
+func ReloadJWK() error {
+	return setupJWK(c.Certs, c.JWKpriv, c.JWKpub)
+}
+
 // SetVRunning sets the current running state of V integration
 func SetVRunning(v bool) {
 	c.V.running = v
@@ -275,12 +368,21 @@ func IsRocksRunning() bool {
 
 // JWParsingKeys returns the public keys uses to verify the JWT
 func JWParsingKeys() jwk.Set {
+	jwkMu.RLock()
+	defer jwkMu.RUnlock()
 	return c.jwParsingKeys
 }
 
-// JWSigningKeys returns the private keys used to sign the JWT
-func JWSigningKeys() jwk.Set {
-	return c.jwSigningKeys
+// JWSigningKey returns the active private key used to sign the JWT
+func JWSigningKey() (jwk.Key, bool) {
+	jwkMu.RLock()
+	defer jwkMu.RUnlock()
+	return c.jwSigningKey, c.jwSigningKey != nil
+}
+
+// JWKS returns the public keys in the form published at /.well-known/jwks.json
+func JWKS() (jwk.Set, error) {
+	return jwk.PublicSetOf(JWParsingKeys())
 }
 
 // GetWebroot is used by telegram templates
@@ -303,6 +405,26 @@ func IsFirebaseRunning() bool {
 	return c.fbRunning
 }
 
+// IsAdmin reports if the GoogleID is one of the server's administrators
+func IsAdmin(gid string) bool {
+	for _, a := range c.Admins {
+		if a == gid {
+			return true
+		}
+	}
+	return false
+}
+
+// OIDCProvider returns the configured OpenID Connect provider of that name
+func OIDCProvider(name string) (woidc, bool) {
+	for _, o := range c.OIDC {
+		if o.Name == name {
+			return o, true
+		}
+	}
+	return woidc{}, false
+}
+
 // SetFirebaseRunning sets the running state of the Firebase integration
 func SetFirebaseRunning(r bool) {
 	c.fbRunning = r
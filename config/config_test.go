@@ -0,0 +1,77 @@
+package config
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"fmt"
+	"testing"
+
+	"github.com/lestrrat-go/jwx/v2/jwk"
+)
+
+func testKey(t *testing.T, kid string, active bool) jwk.Key {
+	t.Helper()
+
+	raw, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	k, err := jwk.FromRaw(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = k.Set(jwk.KeyIDKey, kid)
+	if active {
+		_ = k.Set(JWKActive, true)
+	}
+	return k
+}
+
+func TestActiveJWK(t *testing.T) {
+	tests := []struct {
+		name   string
+		keys   []bool // whether each key is marked active
+		want   string
+		errors bool
+	}{
+		{"single unmarked key", []bool{false}, "k0", false},
+		{"single marked key", []bool{true}, "k0", false},
+		{"one of several marked", []bool{false, true, false}, "k1", false},
+		{"two marked", []bool{true, false, true}, "", true},
+		{"none of several marked", []bool{false, false}, "", true},
+		{"no keys", nil, "", true},
+	}
+	for _, tc := range tests {
+		set := jwk.NewSet()
+		for i, active := range tc.keys {
+			if err := set.AddKey(testKey(t, fmt.Sprintf("k%d", i), active)); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		k, err := ActiveJWK(set)
+		if tc.errors {
+			if err == nil {
+				t.Errorf("%s: got %s, want an error", tc.name, k.KeyID())
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		if k.KeyID() != tc.want {
+			t.Errorf("%s: got %s, want %s", tc.name, k.KeyID(), tc.want)
+		}
+	}
+
+	// a marker which is not true does not make a key active
+	set := jwk.NewSet()
+	k := testKey(t, "k0", false)
+	_ = k.Set(JWKActive, "true")
+	_ = set.AddKey(k)
+	_ = set.AddKey(testKey(t, "k1", false))
+	if _, err := ActiveJWK(set); err == nil {
+		t.Error("a string marker made a key active")
+	}
+}
@@ -9,7 +9,6 @@ var defaults *WasabeeConf = &WasabeeConf{
 	WordListFile:      "eff_large_wordlist.txt",
 	FrontendPath:      "Wasabee-Frontend",
 	WebUIURL:          "https://webui.wasabee.rocks/",
-	JKU:               "https://cdn2.wasabee.rocks/.well-known/jwks.json",
 	DefaultPictureURL: "https://cdn2.wasabee.rocks/android-chrome-512x512.png",
 
 	Certs:       "certs",
@@ -47,6 +46,7 @@ var defaults *WasabeeConf = &WasabeeConf{
 		APIPathURL:       "/api/v1",
 		ApTokenURL:       "/aptok",
 		OneTimeTokenURL:  "/oneTimeToken",
+		RefreshURL:       "/refresh",
 		OauthUserInfoURL: "https://www.googleapis.com/oauth2/v2/userinfo",
 		OauthAuthURL:     google.Endpoint.AuthURL,
 		OauthTokenURL:    google.Endpoint.TokenURL,
@@ -4,6 +4,7 @@ import (
 	"context"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/wasabee-project/Wasabee-Server/auth"
 	pb "github.com/wasabee-project/Wasabee-Server/federation/pb"
@@ -97,7 +98,8 @@ func (w *wafed) AddFirebaseToken(ctx context.Context, in *pb.FBData) (*pb.Error,
 func (w *wafed) RevokeJWT(ctx context.Context, in *pb.Token) (*pb.Error, error) {
 	var e pb.Error
 
-	auth.RevokeJWT(in.Tokenid)
+	// peers only send the ID, keep it for as long as any token could be valid
+	auth.RevokeJWT(in.Tokenid, "", time.Now().Add(auth.MaxJWTLifetime))
 
 	e.Message = "ok"
 	return &e, nil
@@ -0,0 +1,290 @@
+package wasabeehttps
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/gorilla/mux"
+
+	"github.com/wasabee-project/Wasabee-Server/auth"
+	"github.com/wasabee-project/Wasabee-Server/config"
+	"github.com/wasabee-project/Wasabee-Server/log"
+	"github.com/wasabee-project/Wasabee-Server/messaging"
+	"github.com/wasabee-project/Wasabee-Server/model"
+)
+
+// adminAudit records the action before it is taken; if it cannot be recorded the request fails and the action is not taken
+func adminAudit(res http.ResponseWriter, gid model.GoogleID, action, target, detail string) bool {
+	if err := model.AdminAudit(gid, action, target, detail); err != nil {
+		err := fmt.Errorf("unable to write the audit log, nothing was changed")
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return false
+	}
+	return true
+}
+
+// adminAgentSearchRoute is audited, the results include agents' personal details
+func adminAgentSearchRoute(res http.ResponseWriter, req *http.Request) {
+	gid, ok := adminID(res, req)
+	if !ok {
+		return
+	}
+
+	_, limit, err := pageParams(req, 50, 200)
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusNotAcceptable)
+		return
+	}
+	if !adminAudit(res, gid, model.AdminAgentsSearched, "", req.FormValue("q")) {
+		return
+	}
+
+	agents, err := model.SearchAgents(req.FormValue("q"), limit)
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+	res.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(res).Encode(agents)
+}
+
+// adminAgentLockRoute locks the account the same way a Google RISC account-disabled event does
+func adminAgentLockRoute(res http.ResponseWriter, req *http.Request) {
+	gid, ok := adminID(res, req)
+	if !ok {
+		return
+	}
+
+	target := model.GoogleID(mux.Vars(req)["gid"])
+	if !target.Valid() {
+		err := fmt.Errorf(model.ErrUnknownGID)
+		http.Error(res, jsonError(err), http.StatusNotFound)
+		return
+	}
+	if target == gid || config.IsAdmin(string(target)) {
+		err := fmt.Errorf("server administrators cannot be locked")
+		http.Error(res, jsonError(err), http.StatusNotAcceptable)
+		return
+	}
+
+	reason := req.FormValue("reason")
+	if !adminAudit(res, gid, model.AdminAgentLocked, string(target), reason) {
+		return
+	}
+	if err := target.AdminLock(gid, reason); err != nil {
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+	_ = target.RemoveAllFirebaseTokens()
+	if jwts, err := target.RevokeSessions(); err != nil {
+		log.Error(err)
+	} else {
+		go federateRevokedJWTs(jwts)
+	}
+	auth.Logout(target, reason)
+
+	fmt.Fprint(res, jsonStatusOK)
+}
+
+// adminAgentUnlockRoute clears a lock; a lock set by Google RISC is only cleared with confirm=risc
+func adminAgentUnlockRoute(res http.ResponseWriter, req *http.Request) {
+	gid, ok := adminID(res, req)
+	if !ok {
+		return
+	}
+
+	target := model.GoogleID(mux.Vars(req)["gid"])
+	if !target.Valid() {
+		err := fmt.Errorf(model.ErrUnknownGID)
+		http.Error(res, jsonError(err), http.StatusNotFound)
+		return
+	}
+
+	locked, by, err := target.LockedBy()
+	if err != nil {
+		if err.Error() == model.ErrUnknownGID {
+			http.Error(res, jsonError(err), http.StatusNotFound)
+			return
+		}
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+	if !locked {
+		fmt.Fprint(res, jsonStatusOK)
+		return
+	}
+
+	reason := req.FormValue("reason")
+	if by == "" {
+		if req.FormValue("confirm") != "risc" {
+			err := fmt.Errorf(model.ErrRISCLocked)
+			http.Error(res, jsonError(err), http.StatusConflict)
+			return
+		}
+		reason = "RISC lock overridden: " + reason
+	}
+	if !adminAudit(res, gid, model.AdminAgentUnlocked, string(target), reason) {
+		return
+	}
+	if err := target.AdminUnlock(gid, reason); err != nil {
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+
+	fmt.Fprint(res, jsonStatusOK)
+}
+
+func adminDeleteOpRoute(res http.ResponseWriter, req *http.Request) {
+	gid, ok := adminID(res, req)
+	if !ok {
+		return
+	}
+
+	var op model.Operation
+	op.ID = model.OperationID(mux.Vars(req)["opID"])
+	if !adminAudit(res, gid, model.AdminOpDeleted, string(op.ID), req.FormValue("reason")) {
+		return
+	}
+	if err := op.AdminDelete(gid); err != nil {
+		if err.Error() == model.ErrOpNotFound {
+			http.Error(res, jsonError(err), http.StatusNotFound)
+			return
+		}
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+	messaging.DeleteOperation(messaging.OperationID(op.ID)) // announces to EVERYONE to delete it
+
+	fmt.Fprint(res, jsonStatusOK)
+}
+
+func adminDeleteTeamRoute(res http.ResponseWriter, req *http.Request) {
+	gid, ok := adminID(res, req)
+	if !ok {
+		return
+	}
+
+	team := model.TeamID(mux.Vars(req)["team"])
+	if !team.Valid() {
+		err := fmt.Errorf(model.ErrTeamNotFound)
+		http.Error(res, jsonError(err), http.StatusNotFound)
+		return
+	}
+	name, _ := team.Name()
+	if !adminAudit(res, gid, model.AdminTeamDeleted, string(team), name) {
+		return
+	}
+	if err := team.Delete(); err != nil {
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+
+	fmt.Fprint(res, jsonStatusOK)
+}
+
+func adminStatsRoute(res http.ResponseWriter, req *http.Request) {
+	gid, ok := adminID(res, req)
+	if !ok {
+		return
+	}
+	if !adminAudit(res, gid, model.AdminStatsViewed, "", "") {
+		return
+	}
+
+	stats, err := model.GetServerStats()
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+
+	blocked := 0
+	for _, count := range scanners.Copy() {
+		if count > scannerThreshold {
+			blocked++
+		}
+	}
+
+	res.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(res).Encode(struct {
+		*model.ServerStats
+		Busses     []string        `json:"busses"` // messaging services currently registered
+		Subsystems map[string]bool `json:"subsystems"`
+		Scanners   int             `json:"scanners"` // addresses currently blocked
+	}{
+		ServerStats: stats,
+		Busses:      messaging.Buses(),
+		Subsystems: map[string]bool{
+			"firebase": config.IsFirebaseRunning(),
+			"telegram": config.IsTelegramRunning(),
+			"v":        config.IsVRunning(),
+			"rocks":    config.IsRocksRunning(),
+		},
+		Scanners: blocked,
+	})
+}
+
+func adminScannersRoute(res http.ResponseWriter, req *http.Request) {
+	gid, ok := adminID(res, req)
+	if !ok {
+		return
+	}
+	if !adminAudit(res, gid, model.AdminScannersListed, "", "") {
+		return
+	}
+
+	type scanner struct {
+		IP      string `json:"ip"`
+		Count   uint64 `json:"count"`
+		Blocked bool   `json:"blocked"`
+	}
+	list := make([]scanner, 0)
+	for ip, count := range scanners.Copy() {
+		list = append(list, scanner{IP: ip, Count: count, Blocked: count > scannerThreshold})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Count > list[j].Count })
+
+	res.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(res).Encode(list)
+}
+
+func adminScannerClearRoute(res http.ResponseWriter, req *http.Request) {
+	gid, ok := adminID(res, req)
+	if !ok {
+		return
+	}
+
+	ip := mux.Vars(req)["ip"]
+	if _, ok := scanners.Get(ip); !ok {
+		err := fmt.Errorf("address not on the scanner list")
+		http.Error(res, jsonError(err), http.StatusNotFound)
+		return
+	}
+	if !adminAudit(res, gid, model.AdminScannerCleared, ip, "") {
+		return
+	}
+	scanners.Delete(ip)
+
+	fmt.Fprint(res, jsonStatusOK)
+}
+
+func adminAuditRoute(res http.ResponseWriter, req *http.Request) {
+	if _, ok := adminID(res, req); !ok {
+		return
+	}
+
+	before, limit, err := pageParams(req, 100, 500)
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusNotAcceptable)
+		return
+	}
+
+	entries, err := model.AdminAuditLog(before, limit)
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+	res.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(res).Encode(entries)
+}
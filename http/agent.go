@@ -32,6 +32,9 @@ func agentProfileRoute(res http.ResponseWriter, req *http.Request) {
 		http.Error(res, jsonError(err), http.StatusInternalServerError)
 		return
 	}
+	if tokenLacks(req, model.ScopeLocation) {
+		agent.Lat, agent.Lon = 0, 0
+	}
 
 	res.Header().Add("Cache-Control", "no-store") // location changes frequently
 	json.NewEncoder(res).Encode(&agent)
@@ -57,18 +60,20 @@ func agentMessageRoute(res http.ResponseWriter, req *http.Request) {
 		message = "This is a toast notification"
 	}
 
-	ok, err := messaging.SendMessage(messaging.GoogleID(togid), message)
+	// the message is kept in the recipient's inbox even if no bus could notify them
+	m, delivered, err := gid.SendAgentMessage(togid, message)
 	if err != nil {
+		if err.Error() == messaging.ErrBlocked {
+			http.Error(res, jsonError(err), http.StatusForbidden)
+			return
+		}
 		http.Error(res, jsonError(err), http.StatusInternalServerError)
 		return
 	}
-	if !ok {
-		err := fmt.Errorf("message did not send")
-		log.Warnw(err.Error(), "from", gid, "to", togid, "contents", message)
-		http.Error(res, jsonError(err), http.StatusInternalServerError)
-		return
+	if !delivered {
+		log.Infow("message stored but not delivered", "from", gid, "to", togid, "messageID", m.ID)
 	}
-	fmt.Fprint(res, jsonStatusOK)
+	fmt.Fprintf(res, `{"status":"ok","id":%d,"delivered":%t}`, m.ID, delivered)
 }
 
 func agentTargetRoute(res http.ResponseWriter, req *http.Request) {
@@ -105,8 +110,12 @@ func agentTargetRoute(res http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	err = messaging.SendTarget(messaging.GoogleID(togid), target)
+	err = messaging.SendTarget(messaging.GoogleID(gid), messaging.GoogleID(togid), target)
 	if err != nil {
+		if err.Error() == messaging.ErrBlocked {
+			http.Error(res, jsonError(err), http.StatusForbidden)
+			return
+		}
 		http.Error(res, jsonError(err), http.StatusInternalServerError)
 		return
 	}
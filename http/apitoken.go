@@ -0,0 +1,233 @@
+package wasabeehttps
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"github.com/wasabee-project/Wasabee-Server/config"
+	"github.com/wasabee-project/Wasabee-Server/log"
+	"github.com/wasabee-project/Wasabee-Server/model"
+)
+
+// task status changes only need the tasks scope
+var taskStatusActions = map[string]bool{
+	"acknowledge": true,
+	"claim":       true,
+	"complete":    true,
+	"incomplete":  true,
+	"reject":      true,
+}
+
+// legacy GET routes which change the op
+var drawGetWrites = map[string]bool{
+	"chown":   true,
+	"delete":  true,
+	"delperm": true,
+	"swap":    true,
+}
+
+// team GET routes which change the team, or hand out ways to join it
+var teamGetWrites = map[string]bool{
+	"chown":       true,
+	"delete":      true,
+	"delJoinKey":  true,
+	"genJoinKey":  true,
+	"invite":      true,
+	"new":         true,
+	"rocks":       true,
+	"rockscfg":    true,
+	"v":           true,
+	"vbulkimport": true,
+}
+
+// routeScope returns the scope a personal access token needs for the request
+func routeScope(req *http.Request) (scope model.APITokenScope, ok bool) {
+	route := mux.CurrentRoute(req)
+	if route == nil {
+		return "", false
+	}
+	tpl, err := route.GetPathTemplate()
+	if err != nil {
+		return "", false
+	}
+	return RouteScope(req.Method, strings.TrimPrefix(tpl, config.Get().HTTP.APIPathURL), req.URL.Query())
+}
+
+// RouteScope returns the scope a personal access token needs for a route, given as its path template below the API path;
+// ok is false for routes tokens cannot use at all, an empty scope means any token may use the route
+func RouteScope(method, tpl string, query url.Values) (scope model.APITokenScope, ok bool) {
+	parts := strings.Split(tpl, "/")
+	last := parts[len(parts)-1]
+
+	switch {
+	case tpl == "/me" && query.Get("lat") != "":
+		return model.ScopeLocation, true
+	case tpl == "/me":
+		return "", true
+	case tpl == "/loc":
+		return model.ScopeLocation, true
+	case tpl == "/agent/{id}" || tpl == "/agent/{id}/image":
+		return "", true
+	case tpl == "/team/{team}/track" && method == "GET":
+		return model.ScopeLocation, true
+	case tpl == "/teams": // bulk fetch, a POST which only reads
+		return model.ScopeTeamsRead, true
+	case strings.HasPrefix(tpl, "/team/") && method == "GET" && !teamGetWrites[last] && !strings.HasPrefix(tpl, "/team/{team}/join/"):
+		return model.ScopeTeamsRead, true
+	case strings.HasPrefix(tpl, "/team/"):
+		return model.ScopeTeamsWrite, true
+	case tpl == "/draw/{opID}/share": // the share links work without signing in, treat them like changing the op
+		return model.ScopeOpsWrite, true
+	case strings.HasPrefix(tpl, "/draw/{opID}/") && taskStatusActions[last]:
+		return model.ScopeTasks, true
+	case strings.HasPrefix(tpl, "/draw") && (method == "GET" || method == "HEAD") && !drawGetWrites[last]:
+		return model.ScopeOpsRead, true
+	case strings.HasPrefix(tpl, "/draw"):
+		return model.ScopeOpsWrite, true
+	}
+	// everything about the agent's account, messaging, keys and administration needs the agent to sign in
+	return "", false
+}
+
+// apiTokenAllows checks a personal access token's scopes and op/team limits against the request
+func apiTokenAllows(t *model.APIToken, req *http.Request) bool {
+	scope, ok := routeScope(req)
+	if !ok || (scope != "" && !t.HasScope(scope)) {
+		return false
+	}
+
+	vars := mux.Vars(req)
+	if opID, set := vars["opID"]; set {
+		if !t.AllowsOp(model.OperationID(opID)) {
+			return false
+		}
+	} else if scope == model.ScopeOpsWrite && len(t.Ops) > 0 {
+		// new ops are outside any op limit
+		return false
+	}
+	if teamID, set := vars["team"]; set {
+		if !t.AllowsTeam(model.TeamID(teamID)) {
+			return false
+		}
+	} else if (scope == model.ScopeTeamsRead || scope == model.ScopeTeamsWrite) && len(t.Teams) > 0 {
+		return false
+	}
+	return true
+}
+
+// requestAPIToken returns the personal access token the request was made with, nil when the agent signed in
+func requestAPIToken(req *http.Request) *model.APIToken {
+	t, _ := req.Context().Value("X-Wasabee-APIToken").(*model.APIToken)
+	return t
+}
+
+// tokenLacks reports if the request was made with a personal access token which was not granted the scope
+func tokenLacks(req *http.Request, scope model.APITokenScope) bool {
+	t := requestAPIToken(req)
+	return t != nil && !t.HasScope(scope)
+}
+
+// hideLocations clears the members' locations for personal access tokens without the location scope
+func hideLocations(req *http.Request, members []model.TeamMember) {
+	if !tokenLacks(req, model.ScopeLocation) {
+		return
+	}
+	for i := range members {
+		members[i].Lat = 0
+		members[i].Lon = 0
+	}
+}
+
+func meAPITokensRoute(res http.ResponseWriter, req *http.Request) {
+	gid, err := getAgentID(req)
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusUnauthorized)
+		return
+	}
+
+	tokens, err := gid.APITokens()
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+	res.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(res).Encode(tokens)
+}
+
+func meNewAPITokenRoute(res http.ResponseWriter, req *http.Request) {
+	gid, err := getAgentID(req)
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusUnauthorized)
+		return
+	}
+
+	expires, err := permTime(req.FormValue("expires"))
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusNotAcceptable)
+		return
+	}
+
+	scopes := make([]model.APITokenScope, 0)
+	for _, s := range formList(req, "scopes") {
+		scopes = append(scopes, model.APITokenScope(s))
+	}
+	ops := make([]model.OperationID, 0)
+	for _, o := range formList(req, "ops") {
+		ops = append(ops, model.OperationID(o))
+	}
+	teams := make([]model.TeamID, 0)
+	for _, t := range formList(req, "teams") {
+		teams = append(teams, model.TeamID(t))
+	}
+
+	token, err := gid.NewAPIToken(req.FormValue("name"), scopes, ops, teams, expires)
+	if err != nil {
+		if err.Error() == model.ErrAPITokenInvalid {
+			http.Error(res, jsonError(err), http.StatusNotAcceptable)
+			return
+		}
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+	res.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(res).Encode(token)
+}
+
+func meRevokeAPITokenRoute(res http.ResponseWriter, req *http.Request) {
+	gid, err := getAgentID(req)
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusUnauthorized)
+		return
+	}
+
+	if err := gid.RevokeAPIToken(model.APITokenID(mux.Vars(req)["id"])); err != nil {
+		if err.Error() == model.ErrAPITokenNotFound {
+			http.Error(res, jsonError(err), http.StatusNotFound)
+			return
+		}
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+	fmt.Fprint(res, jsonStatusOK)
+}
+
+// formList reads a form field given either repeatedly or once as a comma separated list
+func formList(req *http.Request, key string) []string {
+	out := make([]string, 0)
+	if err := req.ParseMultipartForm(1 << 20); err != nil && err != http.ErrNotMultipart {
+		log.Info(err)
+	}
+	for _, v := range req.Form[key] {
+		for _, s := range strings.Split(v, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				out = append(out, s)
+			}
+		}
+	}
+	return out
+}
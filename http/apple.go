@@ -66,8 +66,7 @@ func appleRoute(res http.ResponseWriter, req *http.Request) {
 		return
 	}
 	agent.QueryToken = formValidationToken(req)
-	agent.JWT, err = mintjwt(gid)
-	if err != nil {
+	if err := loginTokens(req, agent, gid); err != nil {
 		log.Error(err)
 		http.Error(res, err.Error(), http.StatusInternalServerError)
 		return
@@ -0,0 +1,57 @@
+package wasabeehttps
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/wasabee-project/Wasabee-Server/log"
+	"github.com/wasabee-project/Wasabee-Server/model"
+)
+
+const (
+	auditPageDefault = 50
+	auditPageMax     = 500
+)
+
+func teamAuditRoute(res http.ResponseWriter, req *http.Request) {
+	gid, err := getAgentID(req)
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(req)
+	teamID := model.TeamID(vars["team"])
+
+	if owner, _ := gid.OwnsTeam(teamID); !owner {
+		err = fmt.Errorf("forbidden: only the team owner can read the audit log")
+		log.Warnw(err.Error(), "resource", teamID, "gid", gid)
+		http.Error(res, jsonError(err), http.StatusForbidden)
+		return
+	}
+
+	before, limit, err := pageParams(req, auditPageDefault, auditPageMax)
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusNotAcceptable)
+		return
+	}
+
+	entries, err := teamID.AuditLog(before, limit)
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+
+	type Out struct {
+		Entries []model.TeamAuditEntry `json:"entries"`
+		Next    int64                  `json:"next,omitempty"` // pass as "before" to fetch the next page
+	}
+	o := Out{Entries: entries}
+	if len(entries) == limit {
+		o.Next = entries[len(entries)-1].ID
+	}
+	json.NewEncoder(res).Encode(&o)
+}
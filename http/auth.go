@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	// "net/http/httputil"
 	"os"
@@ -119,6 +120,9 @@ func apTokenRoute(res http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	// a second Google account linked to (or merged into) an existing agent signs in as that agent
+	m.Gid = m.Gid.Canonical()
+
 	authorized, err := auth.Authorize(m.Gid) // V & .rocks authorization takes place here
 	if !authorized {
 		err = fmt.Errorf("access denied: %s", err.Error())
@@ -144,8 +148,7 @@ func apTokenRoute(res http.ResponseWriter, req *http.Request) {
 		return
 	}
 	agent.QueryToken = formValidationToken(req)
-	agent.JWT, err = mintjwt(m.Gid)
-	if err != nil {
+	if err := loginTokens(req, agent, m.Gid); err != nil {
 		log.Error(err)
 		http.Error(res, err.Error(), http.StatusInternalServerError)
 		return
@@ -177,7 +180,25 @@ func apTokenRoute(res http.ResponseWriter, req *http.Request) {
 	fmt.Fprint(res, string(data))
 }
 
-func mintjwt(gid model.GoogleID) (string, error) {
+// access JWTs are short-lived, clients keep the session going with the refresh token
+const accessTokenLifetime = time.Hour
+
+// loginTokens sets a new access JWT and the first of a chain of refresh tokens on the agent, starting a session for the client
+func loginTokens(req *http.Request, agent *model.Agent, gid model.GoogleID) error {
+	jwtID := util.GenerateID(16)
+	expires := time.Now().Add(accessTokenLifetime)
+	ip, _, _ := net.SplitHostPort(req.RemoteAddr)
+
+	var err error
+	agent.RefreshToken, err = gid.NewRefreshToken(jwtID, expires, req.Header.Get("User-Agent"), ip)
+	if err != nil {
+		return err
+	}
+	agent.JWT, err = mintjwt(gid, jwtID, expires)
+	return err
+}
+
+func mintjwt(gid model.GoogleID, jwtID string, expires time.Time) (string, error) {
 	sessionName := config.Get().HTTP.SessionName
 
 	hostname, err := os.Hostname()
@@ -185,22 +206,19 @@ func mintjwt(gid model.GoogleID) (string, error) {
 		return "", err
 	}
 
-	// XXX use last, rather than first?
-	key, ok := config.JWSigningKeys().Key(0)
+	// the kid header is set from the key, so tokens still verify after it is retired
+	key, ok := config.JWSigningKey()
 	if !ok {
 		return "", fmt.Errorf("encryption jwk not set")
 	}
 
-	// keyid, ok := key.Get("kid")
-	// if ok { log.Debug("using kid: ", keyid.(string), " to sign this token") }
-
 	jwts, err := jwt.NewBuilder().
 		IssuedAt(time.Now()).
 		Subject(string(gid)).
 		Issuer(hostname).
-		JwtID(util.GenerateID(16)).
+		JwtID(jwtID).
 		Audience([]string{sessionName}).
-		Expiration(time.Now().Add(time.Hour * 24 * 7)).
+		Expiration(expires).
 		Build()
 	if err != nil {
 		return "", err
@@ -272,8 +290,7 @@ func oneTimeTokenRoute(res http.ResponseWriter, req *http.Request) {
 	}
 	agent.QueryToken = formValidationToken(req)
 
-	agent.JWT, err = mintjwt(gid)
-	if err != nil {
+	if err := loginTokens(req, agent, gid); err != nil {
 		log.Error(err)
 		http.Error(res, err.Error(), http.StatusInternalServerError)
 		return
@@ -301,3 +318,69 @@ func oneTimeTokenRoute(res http.ResponseWriter, req *http.Request) {
 
 	fmt.Fprint(res, string(data))
 }
+
+// refreshRoute exchanges a refresh token for a new access JWT and the next refresh token in the chain
+func refreshRoute(res http.ResponseWriter, req *http.Request) {
+	token := req.FormValue("refreshtoken")
+	if token == "" {
+		err := fmt.Errorf("refresh token not set")
+		log.Warn(err)
+		http.Error(res, jsonError(err), http.StatusNotAcceptable)
+		return
+	}
+
+	jwtID := util.GenerateID(16)
+	expires := time.Now().Add(accessTokenLifetime)
+
+	gid, next, err := model.RotateRefreshToken(token, jwtID, expires)
+	if err != nil {
+		if err.Error() == model.ErrRefreshTokenInvalid || err.Error() == model.ErrRefreshTokenReused {
+			incrementScanner(req)
+			http.Error(res, jsonError(err), http.StatusUnauthorized)
+			return
+		}
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+
+	authorized, err := auth.Authorize(gid) // V & .rocks authorization takes place here
+	if !authorized {
+		err = fmt.Errorf("access denied: %s", err)
+		http.Error(res, jsonError(err), http.StatusForbidden)
+		return
+	}
+
+	signed, err := mintjwt(gid, jwtID, expires)
+	if err != nil {
+		log.Error(err)
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+
+	log.Debugw("jwt refresh", "GID", gid, "token ID", jwtID)
+	res.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(res).Encode(struct {
+		Status       string `json:"status"`
+		JWT          string `json:"jwt"`
+		RefreshToken string `json:"refreshtoken"`
+		Expires      string `json:"expires"`
+	}{
+		Status:       "ok",
+		JWT:          signed,
+		RefreshToken: next,
+		Expires:      expires.UTC().Format(time.RFC1123),
+	})
+}
+
+// jwksRoute publishes the public keys which verify our JWT, including retired keys whose tokens have not yet expired
+func jwksRoute(res http.ResponseWriter, req *http.Request) {
+	set, err := config.JWKS()
+	if err != nil {
+		log.Error(err)
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+	// new keys are added a while before they are promoted, so an hour is short enough
+	res.Header().Set("Cache-Control", "public, max-age=3600")
+	json.NewEncoder(res).Encode(set)
+}
@@ -0,0 +1,90 @@
+package wasabeehttps
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/wasabee-project/Wasabee-Server/model"
+)
+
+func meBlocksRoute(res http.ResponseWriter, req *http.Request) {
+	gid, err := getAgentID(req)
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusUnauthorized)
+		return
+	}
+
+	b, err := gid.BlockList()
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+	res.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(res).Encode(b)
+}
+
+func meSetBlocksRoute(res http.ResponseWriter, req *http.Request) {
+	gid, err := getAgentID(req)
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusUnauthorized)
+		return
+	}
+
+	teamOnly := req.FormValue("teamonly") == "true" || req.FormValue("teamonly") == "on"
+	if err := gid.SetTeamOnlyMessages(teamOnly); err != nil {
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+	fmt.Fprint(res, jsonStatusOK)
+}
+
+func meBlockRoute(res http.ResponseWriter, req *http.Request) {
+	gid, err := getAgentID(req)
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusUnauthorized)
+		return
+	}
+
+	other, err := model.ToGid(mux.Vars(req)["id"])
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusNotFound)
+		return
+	}
+
+	if err := gid.Block(other); err != nil {
+		if err.Error() == model.ErrBlockSelf {
+			http.Error(res, jsonError(err), http.StatusNotAcceptable)
+			return
+		}
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+	fmt.Fprint(res, jsonStatusOK)
+}
+
+func meUnblockRoute(res http.ResponseWriter, req *http.Request) {
+	gid, err := getAgentID(req)
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusUnauthorized)
+		return
+	}
+
+	other, err := model.ToGid(mux.Vars(req)["id"])
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusNotFound)
+		return
+	}
+
+	if err := gid.Unblock(other); err != nil {
+		if err.Error() == model.ErrBlockNotFound {
+			http.Error(res, jsonError(err), http.StatusNotFound)
+			return
+		}
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+	fmt.Fprint(res, jsonStatusOK)
+}
@@ -0,0 +1,96 @@
+package wasabeehttps
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/wasabee-project/Wasabee-Server/log"
+	"github.com/wasabee-project/Wasabee-Server/model"
+	"github.com/wasabee-project/Wasabee-Server/templates"
+)
+
+func drawBriefingRoute(res http.ResponseWriter, req *http.Request) {
+	gid, err := getAgentID(req)
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusUnauthorized)
+		return
+	}
+
+	var o model.Operation
+	vars := mux.Vars(req)
+	o.ID = model.OperationID(vars["opID"])
+
+	if o.ID.IsDeletedOp() {
+		err := fmt.Errorf("requested deleted op")
+		log.Infow(err.Error(), "GID", gid, "resource", o.ID)
+		http.Error(res, jsonError(err), http.StatusGone)
+		return
+	}
+
+	// defaults to the requesting agent's own briefing
+	agent := gid
+	if a := req.FormValue("agent"); a != "" {
+		agent, err = model.ToGid(a)
+		if err != nil {
+			log.Warnw(err.Error(), "GID", gid, "resource", o.ID, "agent", a)
+			http.Error(res, jsonError(err), http.StatusNotAcceptable)
+			return
+		}
+	}
+
+	if agent != gid {
+		if !o.WriteAccess(gid) {
+			err := fmt.Errorf("forbidden: write access required to get another agent's briefing")
+			log.Warnw(err.Error(), "GID", gid, "resource", o.ID, "agent", agent)
+			http.Error(res, jsonError(err), http.StatusForbidden)
+			return
+		}
+	} else {
+		read, _ := o.ReadAccess(gid)
+		if !read && !o.AssignedOnlyAccess(gid) {
+			err := fmt.Errorf("forbidden")
+			log.Warnw(err.Error(), "GID", gid, "resource", o.ID, "message", "no access to operation")
+			http.Error(res, jsonError(err), http.StatusForbidden)
+			return
+		}
+	}
+
+	if err := o.Populate(gid); err != nil {
+		log.Error(err)
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+
+	b, err := o.Briefing(agent)
+	if err != nil {
+		log.Error(err)
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+
+	format := "html"
+	contentType := "text/html; charset=UTF-8"
+	if req.FormValue("format") == "text" {
+		format = "text"
+		contentType = "text/plain; charset=UTF-8"
+	}
+
+	lang := req.FormValue("lang")
+	if lang == "" {
+		lang = "en"
+	}
+
+	out, err := templates.Briefing(b, lang, format)
+	if err != nil {
+		log.Error(err)
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+
+	ext := map[string]string{"html": "html", "text": "txt"}[format]
+	res.Header().Set("Content-Type", contentType)
+	res.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"briefing-%s-%s.%s\"", o.ID, agent, ext))
+	fmt.Fprint(res, out)
+}
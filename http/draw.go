@@ -540,7 +540,21 @@ func drawPermsAddRoute(res http.ResponseWriter, req *http.Request) {
 	// Pass in "Zeta" and get a zone back... defaults to "All"
 	zone := model.ZoneFromString(req.FormValue("zone"))
 
-	err = op.ID.AddPerm(gid, teamID, role, zone)
+	// optional, RFC1123 format
+	notBefore, err := permTime(req.FormValue("notbefore"))
+	if err != nil {
+		log.Warnw(err.Error(), "GID", gid, "resource", op.ID, "notbefore", req.FormValue("notbefore"))
+		http.Error(res, jsonError(err), http.StatusNotAcceptable)
+		return
+	}
+	expires, err := permTime(req.FormValue("expires"))
+	if err != nil {
+		log.Warnw(err.Error(), "GID", gid, "resource", op.ID, "expires", req.FormValue("expires"))
+		http.Error(res, jsonError(err), http.StatusNotAcceptable)
+		return
+	}
+
+	err = op.ID.AddPerm(gid, teamID, role, zone, notBefore, expires)
 	if err != nil {
 		log.Error(err)
 		http.Error(res, jsonError(err), http.StatusInternalServerError)
@@ -590,10 +604,36 @@ func drawPermsDeleteRoute(res http.ResponseWriter, req *http.Request) {
 	fmt.Fprint(res, jsonOKUpdateID(uid))
 }
 
+// permTime parses the optional not-before and expires values, empty is the zero time
+func permTime(in string) (time.Time, error) {
+	if in == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC1123, in)
+}
+
 func jsonOKUpdateID(uid string) string {
 	return fmt.Sprintf("{\"status\":\"ok\", \"updateID\": \"%s\"}", uid)
 }
 
+// jsonOKAssigned is jsonOKUpdateID plus the assigned agents who are not available, so the planner can pick someone else
+func jsonOKAssigned(uid string, assigned []model.GoogleID) string {
+	out, err := json.Marshal(struct {
+		Status      string           `json:"status"`
+		UpdateID    string           `json:"updateID"`
+		Unavailable []model.GoogleID `json:"unavailable,omitempty"`
+	}{
+		Status:      "ok",
+		UpdateID:    uid,
+		Unavailable: model.Unavailable(assigned),
+	})
+	if err != nil {
+		log.Error(err)
+		return jsonOKUpdateID(uid)
+	}
+	return string(out)
+}
+
 func touch(op model.Operation) string {
 	// update the timestamp and updateID
 	uid, err := op.Touch()
@@ -603,14 +643,7 @@ func touch(op model.Operation) string {
 
 	// announce to all relevant teams
 	go func() {
-		teams := make(map[model.TeamID]bool)
-		for _, t := range op.Teams {
-			teams[t.TeamID] = true
-		}
-		var ta []model.TeamID
-		for t := range teams {
-			ta = append(ta, t)
-		}
+		ta := op.AnnounceTeams()
 		if len(ta) > 0 {
 			_ = wfb.MapChange(ta, op.ID, uid)
 		}
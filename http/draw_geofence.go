@@ -0,0 +1,79 @@
+package wasabeehttps
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"github.com/wasabee-project/Wasabee-Server/log"
+	"github.com/wasabee-project/Wasabee-Server/model"
+)
+
+func drawGeofenceRoute(res http.ResponseWriter, req *http.Request) {
+	gid, err := getAgentID(req)
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(req)
+	var op model.Operation
+	op.ID = model.OperationID(vars["opID"])
+
+	read, _ := op.ReadAccess(gid)
+	if !read && !op.AssignedOnlyAccess(gid) {
+		err := fmt.Errorf("forbidden")
+		log.Warnw(err.Error(), "GID", gid, "resource", op.ID, "message", "no access to operation")
+		http.Error(res, jsonError(err), http.StatusForbidden)
+		return
+	}
+
+	g, err := op.ID.Geofence()
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(res).Encode(g)
+}
+
+func drawGeofenceSetRoute(res http.ResponseWriter, req *http.Request) {
+	gid, err := getAgentID(req)
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(req)
+	var op model.Operation
+	op.ID = model.OperationID(vars["opID"])
+
+	if !op.WriteAccess(gid) {
+		err = fmt.Errorf("write access required to set geofence alerts")
+		log.Warnw(err.Error(), "GID", gid, "resource", op.ID)
+		http.Error(res, jsonError(err), http.StatusForbidden)
+		return
+	}
+
+	var radius int
+	if r := req.FormValue("radius"); r != "" {
+		if radius, err = strconv.Atoi(r); err != nil {
+			http.Error(res, jsonError(err), http.StatusNotAcceptable)
+			return
+		}
+	}
+	zones := req.FormValue("zones") == "true"
+	notifyLead := req.FormValue("notifylead") != "false" // on unless turned off
+
+	if err := op.ID.SetGeofence(radius, zones, notifyLead); err != nil {
+		if err.Error() == model.ErrGeofenceRadius {
+			http.Error(res, jsonError(err), http.StatusNotAcceptable)
+			return
+		}
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+	fmt.Fprint(res, jsonStatusOK)
+}
@@ -77,7 +77,7 @@ func drawLinkAssignRoute(res http.ResponseWriter, req *http.Request) {
 	}
 
 	uid := linkAssignTouch(gid, link.ID, op)
-	fmt.Fprint(res, jsonOKUpdateID(uid))
+	fmt.Fprint(res, jsonOKAssigned(uid, []model.GoogleID{agent}))
 }
 
 func drawLinkDescRoute(res http.ResponseWriter, req *http.Request) {
@@ -304,6 +304,11 @@ func drawLinkFetch(res http.ResponseWriter, req *http.Request) {
 		http.Error(res, jsonError(err), http.StatusForbidden)
 		return
 	}
+	if phaseHidden(gid, op, &link.Task) {
+		err := fmt.Errorf(model.ErrLinkNotFound)
+		http.Error(res, jsonError(err), http.StatusNotFound)
+		return
+	}
 	json.NewEncoder(res).Encode(link)
 }
 
@@ -327,14 +332,7 @@ func linkStatusTouch(op *model.Operation, linkID model.LinkID, status string) st
 
 	// announce to all relevant teams
 	go func() {
-		teams := make(map[model.TeamID]bool)
-		for _, t := range op.Teams {
-			teams[t.TeamID] = true
-		}
-		var ta []model.TeamID
-		for t := range teams {
-			ta = append(ta, t)
-		}
+		ta := op.AnnounceTeams()
 		if len(ta) > 0 {
 			_ = wfb.LinkStatus(model.TaskID(linkID), op.ID, ta, status, uid)
 		}
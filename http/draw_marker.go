@@ -77,7 +77,7 @@ func drawMarkerAssignRoute(res http.ResponseWriter, req *http.Request) {
 	}
 
 	uid := markerAssignTouch(gid, marker.ID, op)
-	fmt.Fprint(res, jsonOKUpdateID(uid))
+	fmt.Fprint(res, jsonOKAssigned(uid, []model.GoogleID{agent}))
 }
 
 func drawMarkerClaimRoute(res http.ResponseWriter, req *http.Request) {
@@ -200,6 +200,11 @@ func drawMarkerFetch(res http.ResponseWriter, req *http.Request) {
 		http.Error(res, jsonError(err), http.StatusForbidden)
 		return
 	}
+	if phaseHidden(gid, op, &marker.Task) {
+		err := fmt.Errorf(model.ErrMarkerNotFound)
+		http.Error(res, jsonError(err), http.StatusNotFound)
+		return
+	}
 	json.NewEncoder(res).Encode(marker)
 }
 
@@ -320,14 +325,7 @@ func markerStatusTouch(op *model.Operation, markerID model.MarkerID, status stri
 
 	// announce to all relevant teams
 	go func() {
-		teams := make(map[model.TeamID]bool)
-		for _, t := range op.Teams {
-			teams[t.TeamID] = true
-		}
-		var ta []model.TeamID
-		for t := range teams {
-			ta = append(ta, t)
-		}
+		ta := op.AnnounceTeams()
 		if len(ta) > 0 {
 			_ = wfb.MarkerStatus(model.TaskID(markerID), op.ID, ta, status, uid)
 		}
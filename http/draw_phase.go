@@ -0,0 +1,258 @@
+package wasabeehttps
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"github.com/wasabee-project/Wasabee-Server/log"
+	"github.com/wasabee-project/Wasabee-Server/messaging"
+	"github.com/wasabee-project/Wasabee-Server/model"
+)
+
+func drawPhaseListRoute(res http.ResponseWriter, req *http.Request) {
+	gid, err := getAgentID(req)
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(req)
+	var op model.Operation
+	op.ID = model.OperationID(vars["opID"])
+
+	read, _ := op.ReadAccess(gid)
+	if !read && !op.AssignedOnlyAccess(gid) {
+		err := fmt.Errorf("forbidden")
+		log.Warnw(err.Error(), "GID", gid, "resource", op.ID, "message", "no access to operation")
+		http.Error(res, jsonError(err), http.StatusForbidden)
+		return
+	}
+
+	phases, err := op.ID.Phases()
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(res).Encode(&phases)
+}
+
+func drawPhaseAddRoute(res http.ResponseWriter, req *http.Request) {
+	gid, err := getAgentID(req)
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(req)
+	var op model.Operation
+	op.ID = model.OperationID(vars["opID"])
+
+	if !op.WriteAccess(gid) {
+		err = fmt.Errorf("write access required to add phases")
+		log.Warnw(err.Error(), "GID", gid, "resource", op.ID)
+		http.Error(res, jsonError(err), http.StatusForbidden)
+		return
+	}
+
+	order, err := phaseOrder(req.FormValue("order"))
+	if err != nil {
+		log.Warnw(err.Error(), "GID", gid, "resource", op.ID, "order", req.FormValue("order"))
+		http.Error(res, jsonError(err), http.StatusNotAcceptable)
+		return
+	}
+
+	phase, err := op.ID.AddPhase(req.FormValue("name"), order)
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusNotAcceptable)
+		return
+	}
+	touch(op)
+	json.NewEncoder(res).Encode(&phase)
+}
+
+func drawPhaseUpdateRoute(res http.ResponseWriter, req *http.Request) {
+	gid, err := getAgentID(req)
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(req)
+	var op model.Operation
+	op.ID = model.OperationID(vars["opID"])
+	phaseID := model.PhaseID(vars["phaseID"])
+
+	if !op.WriteAccess(gid) {
+		err = fmt.Errorf("write access required to change phases")
+		log.Warnw(err.Error(), "GID", gid, "resource", op.ID)
+		http.Error(res, jsonError(err), http.StatusForbidden)
+		return
+	}
+
+	order, err := phaseOrder(req.FormValue("order"))
+	if err != nil {
+		log.Warnw(err.Error(), "GID", gid, "resource", op.ID, "order", req.FormValue("order"))
+		http.Error(res, jsonError(err), http.StatusNotAcceptable)
+		return
+	}
+
+	if err := op.ID.UpdatePhase(phaseID, req.FormValue("name"), order); err != nil {
+		http.Error(res, jsonError(err), phaseErrorStatus(err))
+		return
+	}
+	uid := touch(op)
+	fmt.Fprint(res, jsonOKUpdateID(uid))
+}
+
+func drawPhaseDeleteRoute(res http.ResponseWriter, req *http.Request) {
+	gid, err := getAgentID(req)
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(req)
+	var op model.Operation
+	op.ID = model.OperationID(vars["opID"])
+	phaseID := model.PhaseID(vars["phaseID"])
+
+	if !op.WriteAccess(gid) {
+		err = fmt.Errorf("write access required to remove phases")
+		log.Warnw(err.Error(), "GID", gid, "resource", op.ID)
+		http.Error(res, jsonError(err), http.StatusForbidden)
+		return
+	}
+
+	if err := op.ID.DeletePhase(phaseID); err != nil {
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+	uid := touch(op)
+	fmt.Fprint(res, jsonOKUpdateID(uid))
+}
+
+func drawPhaseStartRoute(res http.ResponseWriter, req *http.Request) {
+	drawPhaseTransition(res, req, "started")
+}
+
+func drawPhaseFinishRoute(res http.ResponseWriter, req *http.Request) {
+	drawPhaseTransition(res, req, "finished")
+}
+
+func drawPhaseTransition(res http.ResponseWriter, req *http.Request, change string) {
+	gid, err := getAgentID(req)
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(req)
+	var op model.Operation
+	op.ID = model.OperationID(vars["opID"])
+	phaseID := model.PhaseID(vars["phaseID"])
+
+	if !op.WriteAccess(gid) {
+		err = fmt.Errorf("write access required to start or finish phases")
+		log.Warnw(err.Error(), "GID", gid, "resource", op.ID)
+		http.Error(res, jsonError(err), http.StatusForbidden)
+		return
+	}
+
+	var phase *model.Phase
+	if change == "started" {
+		phase, err = op.ID.StartPhase(phaseID)
+	} else {
+		phase, err = op.ID.FinishPhase(phaseID)
+	}
+	if err != nil {
+		http.Error(res, jsonError(err), phaseErrorStatus(err))
+		return
+	}
+
+	uid := touch(op)
+	fmt.Fprint(res, jsonOKUpdateID(uid))
+	go phaseAnnounce(op.ID, gid, phase, change)
+}
+
+func drawTaskPhaseRoute(res http.ResponseWriter, req *http.Request) {
+	gid, op, task, err := taskRequires(res, req)
+	if err != nil {
+		return
+	}
+
+	if !op.WriteAccess(gid) {
+		err = fmt.Errorf("write access required to set task phase")
+		log.Warnw(err.Error(), "GID", gid, "resource", op.ID)
+		http.Error(res, jsonError(err), http.StatusForbidden)
+		return
+	}
+
+	// empty removes the task from its phase
+	phaseID := model.PhaseID(req.FormValue("phase"))
+	if err := task.SetPhase(phaseID); err != nil {
+		http.Error(res, jsonError(err), phaseErrorStatus(err))
+		return
+	}
+	uid, err := op.Touch()
+	if err != nil {
+		log.Error(err)
+	}
+	fmt.Fprint(res, jsonOKUpdateID(uid))
+	go taskStatusAnnounce(op, task.ID, "phase", uid)
+}
+
+// phaseOrder parses the optional order form value
+func phaseOrder(in string) (int16, error) {
+	if in == "" {
+		return 0, nil
+	}
+	order, err := strconv.ParseInt(in, 10, 16)
+	if err != nil {
+		return 0, err
+	}
+	return int16(order), nil
+}
+
+// phaseHidden reports if the task is in a phase which has not started and the agent cannot change the op
+func phaseHidden(gid model.GoogleID, op *model.Operation, task *model.Task) bool {
+	return !task.PhaseOpen() && !op.WriteAccess(gid)
+}
+
+func phaseErrorStatus(err error) int {
+	switch err.Error() {
+	case model.ErrPhaseNotFound:
+		return http.StatusNotFound
+	case model.ErrPhaseAlreadyStarted, model.ErrPhaseNotStarted, model.ErrPhaseOutOfOrder:
+		return http.StatusConflict
+	case model.ErrEmptyPhaseName:
+		return http.StatusNotAcceptable
+	}
+	return http.StatusInternalServerError
+}
+
+// phaseAnnounce lets every team on the operation know a phase has started or finished
+func phaseAnnounce(opID model.OperationID, gid model.GoogleID, phase *model.Phase, change string) {
+	stat, err := opID.Stat()
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	// permissions granted to a parent team apply to its sub-teams, so they are told as well
+	op := model.Operation{ID: opID}
+	teams := op.AnnounceTeams()
+
+	log.Infow("op phase", "resource", opID, "phase", phase.ID, "name", phase.Name, "change", change, "GID", gid)
+	for _, t := range teams {
+		messaging.SendAnnounce(messaging.TeamID(t), messaging.Announce{
+			Text:   fmt.Sprintf("Operation %s: phase %s has %s", stat.Name, phase.Name, change),
+			Sender: messaging.GoogleID(gid),
+			OpID:   messaging.OperationID(opID),
+			TeamID: messaging.TeamID(t),
+		})
+	}
+}
@@ -54,15 +54,7 @@ func taskRequires(res http.ResponseWriter, req *http.Request) (model.GoogleID, *
 
 // taskStatusAnnounce send the fb annoucen to all relevant teams
 func taskStatusAnnounce(op *model.Operation, taskID model.TaskID, status string, updateID string) {
-	teams := make(map[model.TeamID]bool)
-	for _, t := range op.Teams {
-		teams[t.TeamID] = true
-	}
-	var ta []model.TeamID
-	for t := range teams {
-		ta = append(ta, t)
-	}
-
+	ta := op.AnnounceTeams()
 	if len(ta) > 0 {
 		_ = wfb.TaskStatus(taskID, op.ID, ta, status, updateID)
 	}
@@ -106,7 +98,7 @@ func drawTaskAssignRoute(res http.ResponseWriter, req *http.Request) {
 	if err != nil {
 		log.Error(err)
 	}
-	fmt.Fprint(res, jsonOKUpdateID(uid))
+	fmt.Fprint(res, jsonOKAssigned(uid, assignments))
 
 	go func() {
 		for _, agent := range assignments {
@@ -251,6 +243,11 @@ func drawTaskFetch(res http.ResponseWriter, req *http.Request) {
 		http.Error(res, jsonError(err), http.StatusForbidden)
 		return
 	}
+	if phaseHidden(gid, op, task) {
+		err := fmt.Errorf(model.ErrTaskNotFound)
+		http.Error(res, jsonError(err), http.StatusNotFound)
+		return
+	}
 	json.NewEncoder(res).Encode(task)
 }
 
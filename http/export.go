@@ -0,0 +1,60 @@
+package wasabeehttps
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/wasabee-project/Wasabee-Server/log"
+)
+
+// meExportRoute sends a zip of everything the server holds about the agent, one JSON file per section
+func meExportRoute(res http.ResponseWriter, req *http.Request) {
+	gid, err := getAgentID(req)
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusUnauthorized)
+		return
+	}
+
+	export, err := gid.Export()
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+	log.Infow("personal data export", "GID", gid)
+
+	res.Header().Set("Content-Type", "application/zip")
+	res.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"wasabee-%s.zip\"", gid))
+	res.Header().Set("Cache-Control", "no-store")
+
+	z := zip.NewWriter(res)
+	for section, records := range export.Records {
+		if err := exportFile(z, section+".json", records); err != nil {
+			return
+		}
+	}
+	for _, op := range export.Operations {
+		if err := exportFile(z, fmt.Sprintf("operations/%s.json", op.ID), op); err != nil {
+			return
+		}
+	}
+	if err := z.Close(); err != nil {
+		log.Error(err)
+	}
+}
+
+func exportFile(z *zip.Writer, name string, v interface{}) error {
+	w, err := z.Create(name)
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		log.Error(err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,267 @@
+package wasabeehttps
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/wasabee-project/Wasabee-Server/config"
+	"github.com/wasabee-project/Wasabee-Server/log"
+	"github.com/wasabee-project/Wasabee-Server/model"
+)
+
+func meIdentityRoute(res http.ResponseWriter, req *http.Request) {
+	gid, err := getAgentID(req)
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusUnauthorized)
+		return
+	}
+
+	ids, err := gid.Identities()
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+	res.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(res).Encode(ids)
+}
+
+// meLinkGoogleRoute takes a Google Oauth2 token, as for aptok, for the account to link
+func meLinkGoogleRoute(res http.ResponseWriter, req *http.Request) {
+	gid, err := getAgentID(req)
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusUnauthorized)
+		return
+	}
+
+	if !contentTypeIs(req, jsonTypeShort) {
+		err := fmt.Errorf("invalid request (needs to be application/json)")
+		log.Warnw(err.Error(), "GID", gid)
+		http.Error(res, jsonError(err), http.StatusNotAcceptable)
+		return
+	}
+
+	var t struct {
+		AccessToken string `json:"accessToken"`
+	}
+	if err := json.NewDecoder(req.Body).Decode(&t); err != nil || t.AccessToken == "" {
+		http.Error(res, jsonStatusEmpty, http.StatusNotAcceptable)
+		return
+	}
+
+	contents, err := getOauthUserInfo(t.AccessToken)
+	if err != nil {
+		err = fmt.Errorf("failed getting agent info from Google")
+		log.Error(err)
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+	var m struct {
+		Gid  model.GoogleID `json:"id"`
+		Name string         `json:"name"`
+	}
+	if err := json.Unmarshal(contents, &m); err != nil {
+		log.Error(err)
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+	if m.Gid == "" {
+		err = fmt.Errorf("no GoogleID set")
+		log.Warnw(err.Error(), "GID", gid)
+		http.Error(res, jsonError(err), http.StatusNotAcceptable)
+		return
+	}
+
+	linkIdentity(res, gid, model.IdentityGoogle, string(m.Gid), m.Name, m.Gid.Canonical())
+}
+
+// meLinkAppleRoute takes a Sign in with Apple authorization code, as for the apple login route, for the account to link
+func meLinkAppleRoute(res http.ResponseWriter, req *http.Request) {
+	gid, err := getAgentID(req)
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusUnauthorized)
+		return
+	}
+
+	code, err := io.ReadAll(req.Body)
+	if err != nil {
+		log.Error(err)
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+	if string(code) == "" {
+		http.Error(res, jsonStatusEmpty, http.StatusNotAcceptable)
+		return
+	}
+
+	id, err := appleAuth(string(code))
+	if err != nil {
+		log.Error(err)
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+
+	existing, err := model.AppleIDtoGID(id)
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+
+	linkIdentity(res, gid, model.IdentityApple, id, "", existing)
+}
+
+// linkIdentity links the identity to gid, if existing is another agent a merge is requested instead
+func linkIdentity(res http.ResponseWriter, gid model.GoogleID, provider model.IdentityProvider, subject, name string, existing model.GoogleID) {
+	if existing == gid {
+		fmt.Fprint(res, jsonStatusOK)
+		return
+	}
+
+	if existing.Valid() {
+		id, err := gid.RequestMerge(existing)
+		if err != nil {
+			log.Warnw(err.Error(), "GID", gid, "provider", provider, "existing", existing)
+			http.Error(res, jsonError(err), http.StatusNotAcceptable)
+			return
+		}
+		res.WriteHeader(http.StatusAccepted)
+		fmt.Fprintf(res, "{\"status\":\"ok\",\"merge\":\"%s\"}", id)
+		return
+	}
+
+	if err := gid.LinkIdentity(provider, subject, name); err != nil {
+		switch err.Error() {
+		case model.ErrIdentityLinked, model.ErrIdentityIsAgent, model.ErrIdentityProvider:
+			log.Warnw(err.Error(), "GID", gid, "provider", provider)
+			http.Error(res, jsonError(err), http.StatusNotAcceptable)
+		default:
+			http.Error(res, jsonError(err), http.StatusInternalServerError)
+		}
+		return
+	}
+	fmt.Fprint(res, jsonStatusOK)
+}
+
+func meUnlinkIdentityRoute(res http.ResponseWriter, req *http.Request) {
+	gid, err := getAgentID(req)
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(req)
+	if err := gid.UnlinkIdentity(model.IdentityProvider(vars["provider"]), vars["subject"]); err != nil {
+		if err.Error() == model.ErrIdentityNotFound {
+			http.Error(res, jsonError(err), http.StatusNotFound)
+			return
+		}
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+	fmt.Fprint(res, jsonStatusOK)
+}
+
+// adminID returns the agent making the request if they are a server administrator
+func adminID(res http.ResponseWriter, req *http.Request) (model.GoogleID, bool) {
+	gid, err := getAgentID(req)
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusUnauthorized)
+		return "", false
+	}
+
+	if !config.IsAdmin(string(gid)) {
+		err := fmt.Errorf("server administrators only")
+		log.Warnw(err.Error(), "GID", gid, "resource", req.URL.Path)
+		http.Error(res, jsonError(err), http.StatusForbidden)
+		return "", false
+	}
+	return gid, true
+}
+
+func adminMergeListRoute(res http.ResponseWriter, req *http.Request) {
+	if _, ok := adminID(res, req); !ok {
+		return
+	}
+
+	merges, err := model.AgentMerges()
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+	res.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(res).Encode(merges)
+}
+
+func adminMergeRoute(res http.ResponseWriter, req *http.Request) {
+	gid, ok := adminID(res, req)
+	if !ok {
+		return
+	}
+
+	from := model.GoogleID(req.FormValue("from"))
+	into := model.GoogleID(req.FormValue("into"))
+	if !adminAudit(res, gid, model.AdminAgentsMerged, string(into), string(from)) {
+		return
+	}
+	jwts, err := model.MergeAgents(from, into)
+	go federateRevokedJWTs(jwts)
+	if err != nil {
+		if err.Error() == model.ErrMergeInvalid {
+			http.Error(res, jsonError(err), http.StatusNotAcceptable)
+			return
+		}
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+	fmt.Fprint(res, jsonStatusOK)
+}
+
+func adminMergeApproveRoute(res http.ResponseWriter, req *http.Request) {
+	gid, ok := adminID(res, req)
+	if !ok {
+		return
+	}
+
+	id := model.AgentMergeID(mux.Vars(req)["id"])
+	if !adminAudit(res, gid, model.AdminMergeApproved, string(id), "") {
+		return
+	}
+	jwts, err := id.Approve()
+	go federateRevokedJWTs(jwts)
+	if err != nil {
+		switch err.Error() {
+		case model.ErrMergeNotFound:
+			http.Error(res, jsonError(err), http.StatusNotFound)
+		case model.ErrMergeInvalid:
+			http.Error(res, jsonError(err), http.StatusNotAcceptable)
+		default:
+			http.Error(res, jsonError(err), http.StatusInternalServerError)
+		}
+		return
+	}
+	fmt.Fprint(res, jsonStatusOK)
+}
+
+func adminMergeDenyRoute(res http.ResponseWriter, req *http.Request) {
+	gid, ok := adminID(res, req)
+	if !ok {
+		return
+	}
+
+	id := model.AgentMergeID(mux.Vars(req)["id"])
+	if !adminAudit(res, gid, model.AdminMergeDenied, string(id), "") {
+		return
+	}
+	if err := id.Deny(); err != nil {
+		if err.Error() == model.ErrMergeNotFound {
+			http.Error(res, jsonError(err), http.StatusNotFound)
+			return
+		}
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+	fmt.Fprint(res, jsonStatusOK)
+}
@@ -0,0 +1,177 @@
+package wasabeehttps
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"github.com/wasabee-project/Wasabee-Server/log"
+	"github.com/wasabee-project/Wasabee-Server/model"
+)
+
+func teamInviteListRoute(res http.ResponseWriter, req *http.Request) {
+	gid, err := getAgentID(req)
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(req)
+	teamID := model.TeamID(vars["team"])
+
+	if admin, _ := gid.AdminsTeam(teamID); !admin {
+		err = fmt.Errorf(model.ErrNotTeamAdmin)
+		log.Warnw(err.Error(), "resource", teamID, "gid", gid)
+		http.Error(res, jsonError(err), http.StatusForbidden)
+		return
+	}
+
+	invites, err := teamID.Invites()
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(res).Encode(&invites)
+}
+
+func teamInviteAddRoute(res http.ResponseWriter, req *http.Request) {
+	gid, err := getAgentID(req)
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(req)
+	teamID := model.TeamID(vars["team"])
+
+	if admin, _ := gid.AdminsTeam(teamID); !admin {
+		err = fmt.Errorf(model.ErrNotTeamAdmin)
+		log.Warnw(err.Error(), "resource", teamID, "gid", gid)
+		http.Error(res, jsonError(err), http.StatusForbidden)
+		return
+	}
+
+	// optional, RFC1123 format
+	expires, err := permTime(req.FormValue("expires"))
+	if err != nil {
+		log.Warnw(err.Error(), "GID", gid, "resource", teamID, "expires", req.FormValue("expires"))
+		http.Error(res, jsonError(err), http.StatusNotAcceptable)
+		return
+	}
+
+	var maxUses int
+	if m := req.FormValue("maxuses"); m != "" {
+		if maxUses, err = strconv.Atoi(m); err != nil {
+			log.Warnw(err.Error(), "GID", gid, "resource", teamID, "maxuses", m)
+			http.Error(res, jsonError(err), http.StatusNotAcceptable)
+			return
+		}
+	}
+
+	approval := req.FormValue("approval") == "true" || req.FormValue("approval") == "on"
+
+	invite, err := teamID.NewInvite(gid, req.FormValue("name"), expires, maxUses, approval)
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusNotAcceptable)
+		return
+	}
+	json.NewEncoder(res).Encode(&invite)
+}
+
+func teamInviteDeleteRoute(res http.ResponseWriter, req *http.Request) {
+	gid, err := getAgentID(req)
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(req)
+	teamID := model.TeamID(vars["team"])
+
+	if admin, _ := gid.AdminsTeam(teamID); !admin {
+		err = fmt.Errorf(model.ErrNotTeamAdmin)
+		log.Warnw(err.Error(), "resource", teamID, "gid", gid)
+		http.Error(res, jsonError(err), http.StatusForbidden)
+		return
+	}
+
+	if err := teamID.DeleteInvite(vars["token"]); err != nil {
+		http.Error(res, jsonError(err), http.StatusNotFound)
+		return
+	}
+	teamID.Audit(gid, model.AuditInviteRevoked, vars["token"], "")
+	fmt.Fprint(res, jsonStatusOK)
+}
+
+func teamJoinRequestListRoute(res http.ResponseWriter, req *http.Request) {
+	gid, err := getAgentID(req)
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(req)
+	teamID := model.TeamID(vars["team"])
+
+	if admin, _ := gid.AdminsTeam(teamID); !admin {
+		err = fmt.Errorf(model.ErrNotTeamAdmin)
+		log.Warnw(err.Error(), "resource", teamID, "gid", gid)
+		http.Error(res, jsonError(err), http.StatusForbidden)
+		return
+	}
+
+	requests, err := teamID.JoinRequests()
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(res).Encode(&requests)
+}
+
+func teamJoinRequestApproveRoute(res http.ResponseWriter, req *http.Request) {
+	teamJoinRequestResolve(res, req, true)
+}
+
+func teamJoinRequestDenyRoute(res http.ResponseWriter, req *http.Request) {
+	teamJoinRequestResolve(res, req, false)
+}
+
+func teamJoinRequestResolve(res http.ResponseWriter, req *http.Request, approve bool) {
+	gid, err := getAgentID(req)
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(req)
+	teamID := model.TeamID(vars["team"])
+	requestID := model.JoinRequestID(vars["requestID"])
+
+	// make sure the request is for the team in the URL
+	if t, err := requestID.Team(); err != nil || t != teamID {
+		err = fmt.Errorf(model.ErrJoinRequestNotFound)
+		http.Error(res, jsonError(err), http.StatusNotFound)
+		return
+	}
+
+	if approve {
+		err = requestID.Approve(gid)
+	} else {
+		err = requestID.Deny(gid)
+	}
+	if err != nil {
+		switch err.Error() {
+		case model.ErrNotTeamAdmin:
+			http.Error(res, jsonError(err), http.StatusForbidden)
+		case model.ErrJoinRequestNotFound:
+			http.Error(res, jsonError(err), http.StatusNotFound)
+		default:
+			http.Error(res, jsonError(err), http.StatusInternalServerError)
+		}
+		return
+	}
+	fmt.Fprint(res, jsonStatusOK)
+}
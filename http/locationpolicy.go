@@ -0,0 +1,118 @@
+package wasabeehttps
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/wasabee-project/Wasabee-Server/log"
+	"github.com/wasabee-project/Wasabee-Server/model"
+)
+
+func teamLocationPolicyRoute(res http.ResponseWriter, req *http.Request) {
+	gid, err := getAgentID(req)
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(req)
+	teamID := model.TeamID(vars["team"])
+
+	if onteam, _ := gid.AgentInTeam(teamID); !onteam {
+		err := fmt.Errorf(model.ErrAgentNotOnTeam)
+		log.Warnw(err.Error(), "resource", teamID, "gid", gid)
+		http.Error(res, jsonError(err), http.StatusForbidden)
+		return
+	}
+
+	lp, err := teamID.LocationPolicy()
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(res).Encode(lp)
+}
+
+func teamSetLocationPolicyRoute(res http.ResponseWriter, req *http.Request) {
+	gid, err := getAgentID(req)
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(req)
+	teamID := model.TeamID(vars["team"])
+
+	if admin, _ := gid.AdminsTeam(teamID); !admin {
+		err = fmt.Errorf(model.ErrNotTeamAdmin)
+		log.Warnw(err.Error(), "resource", teamID, "gid", gid)
+		http.Error(res, jsonError(err), http.StatusForbidden)
+		return
+	}
+
+	lp := locationPolicyForm(req)
+	if err := teamID.SetLocationPolicy(lp); err != nil {
+		locationPolicyError(res, err)
+		return
+	}
+	teamID.Audit(gid, model.AuditLocationPolicy, "", fmt.Sprintf("%s %s-%s %s", lp.Precision, lp.Start, lp.End, lp.OpID))
+	fmt.Fprint(res, jsonStatusOK)
+}
+
+func meLocationPolicyRoute(res http.ResponseWriter, req *http.Request) {
+	gid, err := getAgentID(req)
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(req)
+	teamID := model.TeamID(vars["team"])
+
+	lp, err := gid.LocationPolicy(teamID)
+	if err != nil {
+		locationPolicyError(res, err)
+		return
+	}
+	json.NewEncoder(res).Encode(lp)
+}
+
+func meSetLocationPolicyRoute(res http.ResponseWriter, req *http.Request) {
+	gid, err := getAgentID(req)
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(req)
+	teamID := model.TeamID(vars["team"])
+
+	if err := gid.SetLocationPolicy(teamID, locationPolicyForm(req)); err != nil {
+		locationPolicyError(res, err)
+		return
+	}
+	fmt.Fprint(res, jsonStatusOK)
+}
+
+func locationPolicyForm(req *http.Request) model.LocationPolicy {
+	return model.LocationPolicy{
+		Precision: model.LocationPrecision(req.FormValue("precision")),
+		Start:     req.FormValue("start"),
+		End:       req.FormValue("end"),
+		OpID:      model.OperationID(req.FormValue("op")),
+	}
+}
+
+func locationPolicyError(res http.ResponseWriter, err error) {
+	switch err.Error() {
+	case model.ErrLocationPolicyInvalid:
+		http.Error(res, jsonError(err), http.StatusNotAcceptable)
+	case model.ErrAgentNotOnTeam, model.ErrLocationPolicyOp:
+		http.Error(res, jsonError(err), http.StatusForbidden)
+	default:
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+	}
+}
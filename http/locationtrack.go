@@ -0,0 +1,155 @@
+package wasabeehttps
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/wasabee-project/Wasabee-Server/log"
+	"github.com/wasabee-project/Wasabee-Server/model"
+)
+
+// the longest window that may be fetched at once
+const trackMaxWindow = 7 * 24 * time.Hour
+
+type gpx struct {
+	XMLName xml.Name   `xml:"gpx"`
+	XMLNS   string     `xml:"xmlns,attr"`
+	Version string     `xml:"version,attr"`
+	Creator string     `xml:"creator,attr"`
+	Tracks  []gpxTrack `xml:"trk"`
+}
+
+type gpxTrack struct {
+	Name    string     `xml:"name"`
+	Segment []gpxPoint `xml:"trkseg>trkpt"`
+}
+
+type gpxPoint struct {
+	Lat  float64 `xml:"lat,attr"`
+	Lon  float64 `xml:"lon,attr"`
+	Time string  `xml:"time"`
+}
+
+func teamTrackRoute(res http.ResponseWriter, req *http.Request) {
+	gid, err := getAgentID(req)
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(req)
+	teamID := model.TeamID(vars["team"])
+
+	// the history is more revealing than the current location, only the team's admins may see it
+	if admin, _ := gid.AdminsTeam(teamID); !admin {
+		err := fmt.Errorf(model.ErrNotTeamAdmin)
+		log.Warnw(err.Error(), "resource", teamID, "gid", gid)
+		http.Error(res, jsonError(err), http.StatusForbidden)
+		return
+	}
+
+	end, err := permTime(req.FormValue("end"))
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusNotAcceptable)
+		return
+	}
+	if end.IsZero() {
+		end = time.Now()
+	}
+	start, err := permTime(req.FormValue("start"))
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusNotAcceptable)
+		return
+	}
+	if start.IsZero() {
+		start = end.Add(-24 * time.Hour)
+	}
+	if !end.After(start) || end.Sub(start) > trackMaxWindow {
+		err := fmt.Errorf("start must be before end, and the window no longer than 7 days")
+		http.Error(res, jsonError(err), http.StatusNotAcceptable)
+		return
+	}
+
+	var agent model.GoogleID
+	if a := req.FormValue("agent"); a != "" {
+		if agent, err = model.ToGid(a); err != nil {
+			http.Error(res, jsonError(err), http.StatusNotFound)
+			return
+		}
+	}
+
+	tracks, err := teamID.LocationTrack(start, end, agent)
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+
+	switch req.FormValue("format") {
+	case "", "json":
+		json.NewEncoder(res).Encode(&tracks)
+	case "gpx":
+		g := gpx{
+			XMLNS:   "http://www.topografix.com/GPX/1/1",
+			Version: "1.1",
+			Creator: "Wasabee",
+		}
+		for _, t := range tracks {
+			gt := gpxTrack{Name: t.Name}
+			for _, p := range t.Points {
+				gt.Segment = append(gt.Segment, gpxPoint(p))
+			}
+			g.Tracks = append(g.Tracks, gt)
+		}
+		res.Header().Set("Content-Type", "application/gpx+xml")
+		res.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"team-%s-%s.gpx\"", teamID, start.UTC().Format("20060102T1504")))
+		fmt.Fprint(res, xml.Header)
+		enc := xml.NewEncoder(res)
+		enc.Indent("", " ")
+		if err := enc.Encode(&g); err != nil {
+			log.Error(err)
+		}
+	default:
+		err := fmt.Errorf("unknown format: use json or gpx")
+		http.Error(res, jsonError(err), http.StatusNotAcceptable)
+	}
+}
+
+func teamTrackDaysRoute(res http.ResponseWriter, req *http.Request) {
+	gid, err := getAgentID(req)
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(req)
+	teamID := model.TeamID(vars["team"])
+
+	if admin, _ := gid.AdminsTeam(teamID); !admin {
+		err = fmt.Errorf(model.ErrNotTeamAdmin)
+		log.Warnw(err.Error(), "resource", teamID, "gid", gid)
+		http.Error(res, jsonError(err), http.StatusForbidden)
+		return
+	}
+
+	days, err := strconv.Atoi(req.FormValue("days"))
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusNotAcceptable)
+		return
+	}
+	if err := teamID.SetTrackDays(days); err != nil {
+		if err.Error() == model.ErrTrackDaysInvalid {
+			http.Error(res, jsonError(err), http.StatusNotAcceptable)
+			return
+		}
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+	teamID.Audit(gid, model.AuditTrackChanged, "", fmt.Sprintf("%d days", days))
+	fmt.Fprint(res, jsonStatusOK)
+}
@@ -9,14 +9,11 @@ import (
 	"io"
 	"net"
 	"net/http"
-	"os"
 	// "strconv"
-	"time"
 
 	"github.com/gorilla/mux"
 	// "github.com/gorilla/sessions"
 
-	"github.com/lestrrat-go/jwx/v2/jwa"
 	// "github.com/lestrrat-go/jwx/v2/jwk"
 	"github.com/lestrrat-go/jwx/v2/jws"
 	"github.com/lestrrat-go/jwx/v2/jwt"
@@ -46,6 +43,9 @@ func meRoute(res http.ResponseWriter, req *http.Request) {
 		return
 	}
 	agent.QueryToken = formValidationToken(req)
+	if requestAPIToken(req) != nil {
+		agent.RemoveCredentials()
+	}
 
 	res.Header().Set("Cache-Control", "no-store")
 	json.NewEncoder(res).Encode(&agent)
@@ -128,6 +128,28 @@ func meToggleTeamWDLoadRoute(res http.ResponseWriter, req *http.Request) {
 	fmt.Fprint(res, jsonStatusOK)
 }
 
+func meToggleTeamTrackRoute(res http.ResponseWriter, req *http.Request) {
+	gid, err := getAgentID(req)
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(req)
+	team := model.TeamID(vars["team"])
+	state := vars["state"]
+	b := false
+	if state == "On" || state == "on" {
+		b = true
+	}
+
+	if err = gid.SetTrackLoc(team, b); err != nil {
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+	fmt.Fprint(res, jsonStatusOK)
+}
+
 func meRemoveTeamRoute(res http.ResponseWriter, req *http.Request) {
 	gid, err := getAgentID(req)
 	if err != nil {
@@ -138,7 +160,7 @@ func meRemoveTeamRoute(res http.ResponseWriter, req *http.Request) {
 	vars := mux.Vars(req)
 	team := model.TeamID(vars["team"])
 
-	if err = team.RemoveAgent(gid); err != nil {
+	if err = team.RemoveAgent(gid, gid, ""); err != nil {
 		http.Error(res, jsonError(err), http.StatusInternalServerError)
 		return
 	}
@@ -236,6 +258,30 @@ func meLogoutRoute(res http.ResponseWriter, req *http.Request) {
 	}
 	_ = ses.Save(req, res) */
 
+	token, err := requestJWT(req)
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusUnauthorized)
+		return
+	}
+	auth.RevokeJWT(token.JwtID(), gid, token.Expiration())
+	go federation.RevokeJWT(context.Background(), token.JwtID())
+
+	// end the session for this client, or all of them if it did not say which
+	if rt := req.FormValue("refreshtoken"); rt != "" {
+		jwts, err := gid.RevokeRefreshToken(rt)
+		if err != nil {
+			log.Infow(err.Error(), "GID", gid)
+		}
+		go federateRevokedJWTs(jwts)
+	} else {
+		jwts, err := gid.RevokeSessions()
+		if err != nil {
+			http.Error(res, jsonError(err), http.StatusInternalServerError)
+			return
+		}
+		go federateRevokedJWTs(jwts)
+	}
+
 	auth.Logout(gid, "user requested")
 	fmt.Fprint(res, jsonStatusOK)
 }
@@ -321,90 +367,6 @@ func meVAPIkeyRoute(res http.ResponseWriter, req *http.Request) {
 	fmt.Fprint(res, jsonStatusOK)
 }
 
-func meJwtRefreshRoute(res http.ResponseWriter, req *http.Request) {
-	gid, err := getAgentID(req)
-	if err != nil {
-		http.Error(res, jsonError(err), http.StatusInternalServerError)
-		return
-	}
-
-	ok, err := auth.Authorize(gid)
-	if !ok {
-		err := fmt.Errorf("account disabled")
-		http.Error(res, jsonError(err), http.StatusForbidden)
-		return
-	}
-	if err != nil {
-		log.Error(err)
-		http.Error(res, jsonError(err), http.StatusInternalServerError)
-		return
-	}
-
-	key, ok := config.JWSigningKeys().Key(0)
-	if !ok {
-		err := fmt.Errorf("encryption jwk not set")
-		log.Error(err)
-		http.Error(res, jsonError(err), http.StatusInternalServerError)
-		return
-	}
-
-	token, err := jwt.ParseRequest(req, jwt.WithKeySet(config.JWParsingKeys(), jws.WithInferAlgorithmFromKey(true), jws.WithUseDefault(true)))
-	if err != nil {
-		log.Info(err)
-		http.Error(res, err.Error(), http.StatusUnauthorized)
-		return
-	}
-
-	// this was already done in authMW, but double-check it here
-	sessionName := config.Get().HTTP.SessionName
-	if err := jwt.Validate(token, jwt.WithAudience(sessionName)); err != nil {
-		log.Info(err)
-		http.Error(res, err.Error(), http.StatusUnauthorized)
-		return
-	}
-
-	jwtid := token.JwtID()
-
-	hostname, err := os.Hostname()
-	if err != nil {
-		log.Error(err)
-		http.Error(res, jsonError(err), http.StatusInternalServerError)
-		return
-	}
-
-	jwts, err := jwt.NewBuilder().
-		IssuedAt(time.Now()).
-		Subject(string(gid)).
-		Issuer(hostname).
-		JwtID(jwtid).
-		Audience([]string{"wasabee"}).
-		Expiration(time.Now().Add(time.Hour * 24 * 7)).
-		Build()
-	if err != nil {
-		log.Error(err)
-		http.Error(res, jsonError(err), http.StatusInternalServerError)
-		return
-	}
-
-	// get refreshed count from token
-	// increment and set refreshed count
-
-	// let consumers know where to get the keys if they want to verify
-	hdrs := jws.NewHeaders()
-	_ = hdrs.Set(jws.JWKSetURLKey, config.Get().JKU)
-
-	signed, err := jwt.Sign(jwts, jwt.WithKey(jwa.RS256, key, jws.WithProtectedHeaders(hdrs)))
-	if err != nil {
-		log.Error(err)
-		http.Error(res, jsonError(err), http.StatusInternalServerError)
-		return
-	}
-
-	log.Infow("jwt Refresh", "gid", gid, "token ID", jwtid, "message", "jwt Token refreshed for "+gid)
-	s := fmt.Sprintf("{\"status\":\"ok\", \"jwt\":\"%s\"}", string(signed[:]))
-	fmt.Fprint(res, s)
-}
-
 func meCommProofRoute(res http.ResponseWriter, req *http.Request) {
 	gid, err := getAgentID(req)
 	if err != nil {
@@ -481,3 +443,20 @@ func meCommClearRoute(res http.ResponseWriter, req *http.Request) {
 
 	fmt.Fprint(res, jsonStatusOK)
 }
+
+// requestJWT returns the JWT the request was authenticated with
+func requestJWT(req *http.Request) (jwt.Token, error) {
+	token, err := jwt.ParseRequest(req, jwt.WithKeySet(config.JWParsingKeys(), jws.WithInferAlgorithmFromKey(true), jws.WithUseDefault(true)))
+	if err != nil {
+		log.Info(err)
+		return nil, err
+	}
+
+	// this was already done in authMW, but double-check it here
+	sessionName := config.Get().HTTP.SessionName
+	if err := jwt.Validate(token, jwt.WithAudience(sessionName)); err != nil {
+		log.Info(err)
+		return nil, err
+	}
+	return token, nil
+}
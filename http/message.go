@@ -0,0 +1,143 @@
+package wasabeehttps
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"github.com/wasabee-project/Wasabee-Server/model"
+)
+
+const (
+	messagePageDefault = 50
+	messagePageMax     = 200
+)
+
+type messagePage struct {
+	Messages []model.AgentMessage `json:"messages"`
+	Next     int64                `json:"next,omitempty"`   // pass as "before" to fetch the next page
+	Unread   int                  `json:"unread,omitempty"` // inbox only
+}
+
+func meInboxRoute(res http.ResponseWriter, req *http.Request) {
+	gid, err := getAgentID(req)
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusUnauthorized)
+		return
+	}
+
+	before, limit, err := pageParams(req, messagePageDefault, messagePageMax)
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusNotAcceptable)
+		return
+	}
+
+	messages, err := gid.Inbox(before, limit, req.FormValue("unread") == "true")
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+
+	o := messagePage{Messages: messages}
+	if len(messages) == limit {
+		o.Next = messages[len(messages)-1].ID
+	}
+	o.Unread, _ = gid.UnreadMessages()
+
+	res.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(res).Encode(&o)
+}
+
+func meOutboxRoute(res http.ResponseWriter, req *http.Request) {
+	gid, err := getAgentID(req)
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusUnauthorized)
+		return
+	}
+
+	before, limit, err := pageParams(req, messagePageDefault, messagePageMax)
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusNotAcceptable)
+		return
+	}
+
+	messages, err := gid.Outbox(before, limit)
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+
+	o := messagePage{Messages: messages}
+	if len(messages) == limit {
+		o.Next = messages[len(messages)-1].ID
+	}
+
+	res.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(res).Encode(&o)
+}
+
+func meMessageReadRoute(res http.ResponseWriter, req *http.Request) {
+	gid, err := getAgentID(req)
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(req)
+	id, err := strconv.ParseInt(vars["msgID"], 10, 64)
+	if err != nil {
+		err = fmt.Errorf(model.ErrMessageNotFound)
+		http.Error(res, jsonError(err), http.StatusNotFound)
+		return
+	}
+
+	if err := gid.MarkMessageRead(id); err != nil {
+		if err.Error() == model.ErrMessageNotFound {
+			http.Error(res, jsonError(err), http.StatusNotFound)
+			return
+		}
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+	fmt.Fprint(res, jsonStatusOK)
+}
+
+func meMessagesReadRoute(res http.ResponseWriter, req *http.Request) {
+	gid, err := getAgentID(req)
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusUnauthorized)
+		return
+	}
+
+	if err := gid.MarkAllMessagesRead(); err != nil {
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+	fmt.Fprint(res, jsonStatusOK)
+}
+
+// pageParams reads the "before" and "limit" query parameters used by paged lists
+func pageParams(req *http.Request, def, max int) (int64, int, error) {
+	limit := def
+	if l := req.FormValue("limit"); l != "" {
+		var err error
+		if limit, err = strconv.Atoi(l); err != nil || limit < 1 {
+			return 0, 0, fmt.Errorf("invalid limit")
+		}
+		if limit > max {
+			limit = max
+		}
+	}
+
+	var before int64
+	if b := req.FormValue("before"); b != "" {
+		var err error
+		if before, err = strconv.ParseInt(b, 10, 64); err != nil || before < 0 {
+			return 0, 0, fmt.Errorf("invalid before")
+		}
+	}
+	return before, limit, nil
+}
@@ -0,0 +1,57 @@
+package wasabeehttps
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/wasabee-project/Wasabee-Server/log"
+	"github.com/wasabee-project/Wasabee-Server/model"
+)
+
+func meNotifyPrefsRoute(res http.ResponseWriter, req *http.Request) {
+	gid, err := getAgentID(req)
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusUnauthorized)
+		return
+	}
+
+	p, err := gid.NotifyPrefs()
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+	res.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(res).Encode(p)
+}
+
+func meSetNotifyPrefsRoute(res http.ResponseWriter, req *http.Request) {
+	gid, err := getAgentID(req)
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusUnauthorized)
+		return
+	}
+
+	if !contentTypeIs(req, jsonTypeShort) {
+		err := fmt.Errorf("must use content-type: %s", jsonTypeShort)
+		log.Errorw(err.Error(), "GID", gid)
+		http.Error(res, jsonError(err), http.StatusNotAcceptable)
+		return
+	}
+
+	var p model.NotifyPrefs
+	if err := json.NewDecoder(req.Body).Decode(&p); err != nil {
+		http.Error(res, jsonError(err), http.StatusNotAcceptable)
+		return
+	}
+
+	if err := gid.SetNotifyPrefs(p); err != nil {
+		if err.Error() == model.ErrNotifyPrefsInvalid {
+			http.Error(res, jsonError(err), http.StatusNotAcceptable)
+			return
+		}
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+	fmt.Fprint(res, jsonStatusOK)
+}
@@ -0,0 +1,175 @@
+package wasabeehttps
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	wfb "github.com/wasabee-project/Wasabee-Server/Firebase"
+	"github.com/wasabee-project/Wasabee-Server/auth"
+	"github.com/wasabee-project/Wasabee-Server/config"
+	"github.com/wasabee-project/Wasabee-Server/log"
+	"github.com/wasabee-project/Wasabee-Server/model"
+)
+
+// oidcLogin is what clients send: an authorization code obtained for the server's client ID, for the server to exchange
+// ID tokens are not accepted directly, one issued to another client of the same provider could be replayed
+type oidcLogin struct {
+	Code         string `json:"code"`
+	RedirectURI  string `json:"redirect_uri"`
+	CodeVerifier string `json:"code_verifier"` // PKCE, if the client used it
+}
+
+// oidcIdentity exchanges the code the client sent for the named provider and returns the verified identity
+func oidcIdentity(req *http.Request, name string) (*auth.OIDCIdentity, error) {
+	o, ok := config.OIDCProvider(name)
+	if !ok {
+		return nil, fmt.Errorf("unknown OIDC provider")
+	}
+	p := auth.OIDCProvider(o)
+
+	var l oidcLogin
+	if err := json.NewDecoder(req.Body).Decode(&l); err != nil {
+		log.Info(err)
+		return nil, err
+	}
+	if l.Code == "" {
+		return nil, fmt.Errorf("code required")
+	}
+
+	idToken, err := p.Exchange(req.Context(), l.Code, l.RedirectURI, l.CodeVerifier)
+	if err != nil {
+		return nil, err
+	}
+	return p.Verify(req.Context(), idToken)
+}
+
+// oidcProvidersRoute lists the configured providers so clients can start a login
+func oidcProvidersRoute(res http.ResponseWriter, req *http.Request) {
+	type provider struct {
+		Name                  string   `json:"name"`
+		Issuer                string   `json:"issuer"`
+		ClientID              string   `json:"client_id"`
+		AuthorizationEndpoint string   `json:"authorization_endpoint,omitempty"`
+		Scopes                []string `json:"scopes"`
+	}
+
+	list := make([]provider, 0)
+	for _, o := range config.Get().OIDC {
+		p := provider{
+			Name:     o.Name,
+			Issuer:   o.Issuer,
+			ClientID: o.ClientID,
+			Scopes:   o.Scopes,
+		}
+		op := auth.OIDCProvider(o)
+		if d, err := op.Discover(req.Context()); err == nil {
+			p.AuthorizationEndpoint = d.AuthorizationEndpoint
+		}
+		list = append(list, p)
+	}
+	json.NewEncoder(res).Encode(list)
+}
+
+// oidcRoute logs in with a generic OpenID Connect provider
+func oidcRoute(res http.ResponseWriter, req *http.Request) {
+	if !contentTypeIs(req, jsonTypeShort) {
+		err := fmt.Errorf("invalid oidc send (needs to be application/json)")
+		log.Warn(err)
+		http.Error(res, jsonError(err), http.StatusNotAcceptable)
+		return
+	}
+
+	provider := mux.Vars(req)["provider"]
+	id, err := oidcIdentity(req, provider)
+	if err != nil {
+		incrementScanner(req)
+		http.Error(res, jsonError(err), http.StatusUnauthorized)
+		return
+	}
+
+	gid, err := model.OIDCtoGID(provider, id.Subject)
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+
+	authorized, err := auth.Authorize(gid) // V & .rocks authorization takes place here
+	if !authorized {
+		err = fmt.Errorf("access denied: %s", err)
+		log.Error(err)
+		http.Error(res, jsonError(err), http.StatusForbidden)
+		return
+	}
+
+	_ = gid.SetOIDCName(id.Name)
+	if id.Picture != "" {
+		_ = gid.UpdatePicture(id.Picture)
+	}
+
+	agent, err := gid.GetAgent()
+	if err != nil {
+		log.Error(err)
+		http.Error(res, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	agent.QueryToken = formValidationToken(req)
+	if err := loginTokens(req, agent, gid); err != nil {
+		log.Error(err)
+		http.Error(res, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data, err := json.Marshal(agent)
+	if err != nil {
+		log.Error(err)
+		http.Error(res, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	log.Infow("oidc login",
+		"gid", gid,
+		"provider", provider,
+		"agent", agent.Name,
+		"message", agent.Name+" login",
+		"client", req.Header.Get("User-Agent"),
+	)
+
+	// notify other teams of agent login
+	_ = wfb.AgentLogin(gid.TeamListEnabled(), gid)
+
+	fmt.Fprint(res, string(data))
+}
+
+// meLinkOIDCRoute links an OpenID Connect identity, the body is the same as for the login
+func meLinkOIDCRoute(res http.ResponseWriter, req *http.Request) {
+	gid, err := getAgentID(req)
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusUnauthorized)
+		return
+	}
+
+	if !contentTypeIs(req, jsonTypeShort) {
+		err := fmt.Errorf("invalid request (needs to be application/json)")
+		log.Warnw(err.Error(), "GID", gid)
+		http.Error(res, jsonError(err), http.StatusNotAcceptable)
+		return
+	}
+
+	provider := mux.Vars(req)["provider"]
+	id, err := oidcIdentity(req, provider)
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusNotAcceptable)
+		return
+	}
+
+	existing, err := model.OIDCtoGID(provider, id.Subject)
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+
+	linkIdentity(res, gid, model.IdentityOIDC(provider), id.Subject, id.Name, existing)
+}
@@ -20,13 +20,13 @@ func rocksPullTeamRoute(res http.ResponseWriter, req *http.Request) {
 	vars := mux.Vars(req)
 	teamID := model.TeamID(vars["team"])
 
-	safe, err := gid.OwnsTeam(teamID)
+	safe, err := gid.AdminsTeam(teamID)
 	if err != nil {
 		http.Error(res, jsonError(err), http.StatusInternalServerError)
 		return
 	}
 	if !safe {
-		err := fmt.Errorf("forbidden: only the team owner can pull the .rocks community")
+		err := fmt.Errorf("forbidden: only team owners and admins can pull the .rocks community")
 		log.Warnw(err.Error(), "GID", gid.String(), "resource", teamID)
 		http.Error(res, jsonError(err), http.StatusForbidden)
 		return
@@ -51,13 +51,13 @@ func rocksCfgTeamRoute(res http.ResponseWriter, req *http.Request) {
 	rc := vars["rockscomm"]
 	rk := vars["rockskey"]
 
-	safe, err := gid.OwnsTeam(team)
+	safe, err := gid.AdminsTeam(team)
 	if err != nil {
 		http.Error(res, jsonError(err), http.StatusInternalServerError)
 		return
 	}
 	if !safe {
-		err := fmt.Errorf("forbidden: only the team owner can configure the .rocks community")
+		err := fmt.Errorf("forbidden: only team owners and admins can configure the .rocks community")
 		log.Warnw(err.Error(), "GID", gid.String(), "resource", team)
 		http.Error(res, jsonError(err), http.StatusForbidden)
 		return
@@ -67,6 +67,8 @@ func rocksCfgTeamRoute(res http.ResponseWriter, req *http.Request) {
 		http.Error(res, jsonError(err), http.StatusInternalServerError)
 		return
 	}
+	// the key is a secret, only the community is recorded
+	team.Audit(gid, model.AuditRocksChanged, rc, "")
 
 	fmt.Fprint(res, jsonStatusOK)
 }
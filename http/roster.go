@@ -0,0 +1,165 @@
+package wasabeehttps
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"github.com/wasabee-project/Wasabee-Server/log"
+	"github.com/wasabee-project/Wasabee-Server/model"
+)
+
+// rosterCSVHeader doubles as the marker used to skip the header when an export is imported again
+var rosterCSVHeader = []string{"id", "name", "vname", "rocksname", "intelname", "communityname", "enlid", "level", "intelfaction", "Vverified", "blacklisted", "rocks", "smurf", "role", "squad", "state", "lat", "lng", "date"}
+
+func teamExportRoute(res http.ResponseWriter, req *http.Request) {
+	gid, err := getAgentID(req)
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(req)
+	teamID := model.TeamID(vars["team"])
+
+	// the same agents who can see the team can export it
+	isadmin, _ := gid.AdminsTeam(teamID)
+	onteam, _ := gid.AgentInTeam(teamID)
+	if !isadmin && !onteam {
+		err := fmt.Errorf("not on team")
+		log.Infow(err.Error(), "teamID", teamID, "gid", gid)
+		http.Error(res, jsonError(err), http.StatusForbidden)
+		return
+	}
+
+	t, err := teamID.FetchTeam()
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+	hideLocations(req, t.TeamMembers)
+
+	format := req.FormValue("format")
+	switch format {
+	case "", "json":
+		res.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"team-%s.json\"", teamID))
+		json.NewEncoder(res).Encode(&t.TeamMembers)
+	case "csv":
+		res.Header().Set("Content-Type", "text/csv; charset=UTF-8")
+		res.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"team-%s.csv\"", teamID))
+		w := csv.NewWriter(res)
+		_ = w.Write(rosterCSVHeader)
+		for _, m := range t.TeamMembers {
+			_ = w.Write([]string{
+				string(m.Gid),
+				m.Name,
+				m.VName,
+				m.RocksName,
+				m.IntelName,
+				m.CommunityName,
+				m.EnlID,
+				strconv.Itoa(int(m.Level)),
+				m.IntelFaction,
+				strconv.FormatBool(m.Verified),
+				strconv.FormatBool(m.Blacklisted),
+				strconv.FormatBool(m.RocksVerified),
+				strconv.FormatBool(m.RocksSmurf),
+				string(m.Role),
+				m.Comment,
+				strconv.FormatBool(m.ShareLocation),
+				strconv.FormatFloat(m.Lat, 'f', -1, 64),
+				strconv.FormatFloat(m.Lon, 'f', -1, 64),
+				m.Date,
+			})
+		}
+		w.Flush()
+		if err := w.Error(); err != nil {
+			log.Error(err)
+		}
+	default:
+		err := fmt.Errorf("unknown format: use json or csv")
+		http.Error(res, jsonError(err), http.StatusNotAcceptable)
+	}
+}
+
+func teamImportRoute(res http.ResponseWriter, req *http.Request) {
+	gid, err := getAgentID(req)
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(req)
+	teamID := model.TeamID(vars["team"])
+
+	if admin, _ := gid.AdminsTeam(teamID); !admin {
+		err = fmt.Errorf(model.ErrNotTeamAdmin)
+		log.Warnw(err.Error(), "resource", teamID, "gid", gid)
+		http.Error(res, jsonError(err), http.StatusForbidden)
+		return
+	}
+
+	var agents []string
+	if contentTypeIs(req, jsonTypeShort) {
+		var in struct {
+			Agents []string `json:"agents"`
+		}
+		if err := json.NewDecoder(req.Body).Decode(&in); err != nil {
+			log.Info(err)
+			http.Error(res, jsonError(err), http.StatusNotAcceptable)
+			return
+		}
+		agents = in.Agents
+	} else {
+		agents, err = ReadRosterCSV(req.Body)
+		if err != nil {
+			log.Info(err)
+			http.Error(res, jsonError(err), http.StatusNotAcceptable)
+			return
+		}
+	}
+
+	if len(agents) == 0 {
+		err := fmt.Errorf("no agents to import")
+		http.Error(res, jsonError(err), http.StatusNotAcceptable)
+		return
+	}
+
+	result, err := teamID.ImportRoster(gid, agents)
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+	log.Infow("team roster imported", "resource", teamID, "gid", gid, "added", len(result.Added), "ambiguous", len(result.Ambiguous), "unknown", len(result.Unknown))
+	json.NewEncoder(res).Encode(result)
+}
+
+// ReadRosterCSV reads the identifiers to import from CSV or plain text, the first field of each line;
+// the header line of a roster export is skipped so an export can be imported again
+func ReadRosterCSV(in io.Reader) ([]string, error) {
+	agents := make([]string, 0)
+
+	r := csv.NewReader(in)
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+	for {
+		rec, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return agents, err
+		}
+		if len(rec) == 0 || strings.EqualFold(rec[0], rosterCSVHeader[0]) {
+			continue
+		}
+		agents = append(agents, rec[0])
+	}
+	return agents, nil
+}
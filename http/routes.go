@@ -31,15 +31,24 @@ func setupRouter() *mux.Router {
 	// Google Oauth2 stuff (constants defined in server.go)
 	router.HandleFunc(c.ApTokenURL, apTokenRoute).Methods("POST")           // all clients should use this
 	router.HandleFunc(c.OneTimeTokenURL, oneTimeTokenRoute).Methods("POST") // provided for cases where aptok does not work
+	router.HandleFunc(c.RefreshURL, refreshRoute).Methods("POST")           // exchange a refresh token for a new JWT (form-data: refreshtoken)
 
 	// Apple Authentication routes
 	router.HandleFunc("/apple", appleRoute) // need more details, good enough for now
 
+	// generic OpenID Connect providers (Keycloak, Authentik, ...) from the config
+	router.HandleFunc("/oidc", oidcProvidersRoute).Methods("GET")
+	router.HandleFunc("/oidc/{provider}", oidcRoute).Methods("POST") // json: {"code": ..., "redirect_uri": ..., "code_verifier": ...}
+
+	// read-only shared operations, the token is the authorization
+	router.HandleFunc("/share/{token}", shareRoute).Methods("GET")
+
 	// common files that live under /static
 	router.Path("/favicon.ico").Handler(http.RedirectHandler("/static/favicon.ico", http.StatusFound))
 	router.Path("/robots.txt").Handler(http.RedirectHandler("/static/robots.txt", http.StatusFound))
 	router.Path("/sitemap.xml").Handler(http.RedirectHandler("/static/sitemap.xml", http.StatusFound))
 	router.Path("/.well-known/security.txt").Handler(http.RedirectHandler("/static/.well-known/security.txt", http.StatusFound))
+	router.HandleFunc("/.well-known/jwks.json", jwksRoute).Methods("GET") // public keys for third parties to verify our JWT
 
 	// this cannot be a redirect -- sent it raw
 	router.HandleFunc("/firebase-messaging-sw.js", fbmswRoute).Methods("GET")
@@ -79,6 +88,18 @@ func setupAuthRoutes(r *mux.Router) {
 	r.HandleFunc("/draw/{opID}/perms", drawPermsAddRoute).Methods("POST")
 	r.HandleFunc("/draw/{opID}/perms", drawPermsDeleteRoute).Methods("DELETE")
 	r.HandleFunc("/draw/{opID}/delperm", drawPermsDeleteRoute).Methods("GET") // .Queries("team", "{team}", "role", "{role}")
+	r.HandleFunc("/draw/{opID}/briefing", drawBriefingRoute).Methods("GET")
+	r.HandleFunc("/draw/{opID}/phase", drawPhaseListRoute).Methods("GET")
+	r.HandleFunc("/draw/{opID}/phase", drawPhaseAddRoute).Methods("POST")
+	r.HandleFunc("/draw/{opID}/phase/{phaseID}", drawPhaseUpdateRoute).Methods("PUT")
+	r.HandleFunc("/draw/{opID}/phase/{phaseID}", drawPhaseDeleteRoute).Methods("DELETE")
+	r.HandleFunc("/draw/{opID}/phase/{phaseID}/start", drawPhaseStartRoute).Methods("PUT")
+	r.HandleFunc("/draw/{opID}/phase/{phaseID}/finish", drawPhaseFinishRoute).Methods("PUT")
+	r.HandleFunc("/draw/{opID}/share", drawShareListRoute).Methods("GET")
+	r.HandleFunc("/draw/{opID}/share", drawShareAddRoute).Methods("POST")
+	r.HandleFunc("/draw/{opID}/share/{token}", drawShareDeleteRoute).Methods("DELETE")
+	r.HandleFunc("/draw/{opID}/geofence", drawGeofenceRoute).Methods("GET")
+	r.HandleFunc("/draw/{opID}/geofence", drawGeofenceSetRoute).Methods("PUT")
 
 	// links
 	r.HandleFunc("/draw/{opID}/link/{link}", drawLinkFetch).Methods("GET")
@@ -123,25 +144,52 @@ func setupAuthRoutes(r *mux.Router) {
 	r.HandleFunc("/draw/{opID}/task/{taskID}/claim", drawTaskClaimRoute).Methods("PUT")                     // none
 	r.HandleFunc("/draw/{opID}/task/{taskID}/zone", drawTaskZoneRoute).Methods("PUT")                       // zone uint8
 	r.HandleFunc("/draw/{opID}/task/{taskID}/delta", drawTaskDeltaRoute).Methods("PUT")                     // delta int64
+	r.HandleFunc("/draw/{opID}/task/{taskID}/phase", drawTaskPhaseRoute).Methods("PUT")                     // phase PhaseID
 	r.HandleFunc("/draw/{opID}/task/{taskID}/depend/{dependsOn}", drawTaskDependAddRoute).Methods("PUT")    // none
 	r.HandleFunc("/draw/{opID}/task/{taskID}/depend/{dependsOn}", drawTaskDependDelRoute).Methods("DELETE") // none
 
 	r.HandleFunc("/me", meSetAgentLocationRoute).Methods("GET", "PUT").Queries("lat", "{lat}", "lon", "{lon}") // prefer PUT
 	r.HandleFunc("/me", meRoute).Methods("GET", "POST", "HEAD")
-	r.HandleFunc("/me/delete", meDeleteRoute).Methods("DELETE")                                     // purge all info for a agent, requires query token
+	r.HandleFunc("/me/blocks", meBlocksRoute).Methods("GET")
+	r.HandleFunc("/me/blocks", meSetBlocksRoute).Methods("PUT")  // form-data: teamonly, only agents sharing a team may message
+	r.HandleFunc("/me/blocks/{id}", meBlockRoute).Methods("PUT") // refuse messages and targets from the agent (gid/name/enlid)
+	r.HandleFunc("/me/blocks/{id}", meUnblockRoute).Methods("DELETE")
+	r.HandleFunc("/me/delete", meDeleteRoute).Methods("DELETE")                   // purge all info for a agent, requires query token
+	r.HandleFunc("/me/export", meExportRoute).Methods("GET")                      // zip of all data held about the agent
+	r.HandleFunc("/me/identity", meIdentityRoute).Methods("GET")                  // sign-in identities linked to the agent
+	r.HandleFunc("/me/identity/google", meLinkGoogleRoute).Methods("POST")        // json: {"accessToken": ...} for the google account to link
+	r.HandleFunc("/me/identity/apple", meLinkAppleRoute).Methods("POST")          // sign in with apple code for the apple account to link
+	r.HandleFunc("/me/identity/oidc/{provider}", meLinkOIDCRoute).Methods("POST") // same json as the /oidc/{provider} login
+	r.HandleFunc("/me/identity/{provider}/{subject}", meUnlinkIdentityRoute).Methods("DELETE")
+	r.HandleFunc("/me/messages", meInboxRoute).Methods("GET")       // query: before, limit, unread=true
+	r.HandleFunc("/me/messages/sent", meOutboxRoute).Methods("GET") // query: before, limit
+	r.HandleFunc("/me/messages/read", meMessagesReadRoute).Methods("PUT")
+	r.HandleFunc("/me/messages/{msgID}/read", meMessageReadRoute).Methods("PUT")
+	r.HandleFunc("/me/notifications", meNotifyPrefsRoute).Methods("GET")
+	r.HandleFunc("/me/notifications", meSetNotifyPrefsRoute).Methods("PUT") // json NotifyPrefs
+	r.HandleFunc("/me/presence", mePresenceRoute).Methods("GET")
+	r.HandleFunc("/me/presence", meSetPresenceRoute).Methods("PUT") // form-data: status, note, until (RFC1123, away only); empty status reverts to automatic
+	r.HandleFunc("/me/tokens", meAPITokensRoute).Methods("GET")     // personal access tokens, with last use
+	r.HandleFunc("/me/tokens", meNewAPITokenRoute).Methods("POST")  // form-data: name, scopes, ops, teams, expires (RFC1123); the token is only shown once
+	r.HandleFunc("/me/tokens/{id}", meRevokeAPITokenRoute).Methods("DELETE")
+	r.HandleFunc("/me/sessions", meSessionsRoute).Methods("GET")          // devices logged in, with last use
+	r.HandleFunc("/me/sessions", meRevokeSessionsRoute).Methods("DELETE") // log out everywhere
+	r.HandleFunc("/me/sessions/{id}", meRevokeSessionRoute).Methods("DELETE")
 	r.HandleFunc("/me/{team}", meToggleTeamRoute).Methods("GET", "PUT").Queries("state", "{state}") // prefer PUT
 	r.HandleFunc("/me/{team}", meRemoveTeamRoute).Methods("DELETE")
 	r.HandleFunc("/me/{team}/delete", meRemoveTeamRoute).Methods("GET")                                            // deprecated, use DELETE /me/{team}
 	r.HandleFunc("/me/{team}/wdshare", meToggleTeamWDShareRoute).Methods("GET", "PUT").Queries("state", "{state}") // prefer PUT
 	r.HandleFunc("/me/{team}/wdload", meToggleTeamWDLoadRoute).Methods("GET", "PUT").Queries("state", "{state}")   // prefer PUT
-	r.HandleFunc("/me/logout", meLogoutRoute).Methods("GET")                                                       // deprecated, no need with JWT
-	r.HandleFunc("/me/firebase", meFirebaseRoute).Methods("POST")                                                  // post a firebase token generated by google
-	r.HandleFunc("/me/intelid", meIntelIDRoute).Methods("PUT", "POST")                                             // get ID from intel (not trusted)
-	r.HandleFunc("/me/VAPIkey", meVAPIkeyRoute).Methods("POST")                                                    // send an V API key for team sync
-	r.HandleFunc("/me/jwtrefresh", meJwtRefreshRoute).Methods("GET")                                               // returns a new JWT with the current token ID
-	r.HandleFunc("/me/commproof", meCommProofRoute).Methods("GET").Queries("name", "{name}")                       // generate a JWT to post on niantic's community to prove identity
-	r.HandleFunc("/me/commverify", meCommVerifyRoute).Methods("GET").Queries("name", "{name}")                     // fetch and verify the JWT posted on niantic's community
-	r.HandleFunc("/me/commverify", meCommClearRoute).Methods("DELETE")                                             // clear it
+	r.HandleFunc("/me/{team}/track", meToggleTeamTrackRoute).Methods("PUT").Queries("state", "{state}")            // keep my locations in the team's history
+	r.HandleFunc("/me/{team}/location", meLocationPolicyRoute).Methods("GET")
+	r.HandleFunc("/me/{team}/location", meSetLocationPolicyRoute).Methods("PUT")               // form-data: precision, start, end, op
+	r.HandleFunc("/me/logout", meLogoutRoute).Methods("GET", "DELETE")                         // revoke the JWT and refresh tokens (form-data: refreshtoken, otherwise all of them)
+	r.HandleFunc("/me/firebase", meFirebaseRoute).Methods("POST")                              // post a firebase token generated by google
+	r.HandleFunc("/me/intelid", meIntelIDRoute).Methods("PUT", "POST")                         // get ID from intel (not trusted)
+	r.HandleFunc("/me/VAPIkey", meVAPIkeyRoute).Methods("POST")                                // send an V API key for team sync
+	r.HandleFunc("/me/commproof", meCommProofRoute).Methods("GET").Queries("name", "{name}")   // generate a JWT to post on niantic's community to prove identity
+	r.HandleFunc("/me/commverify", meCommVerifyRoute).Methods("GET").Queries("name", "{name}") // fetch and verify the JWT posted on niantic's community
+	r.HandleFunc("/me/commverify", meCommClearRoute).Methods("DELETE")                         // clear it
 
 	// other agents
 	// "profile" page, such as it is
@@ -168,16 +216,55 @@ func setupAuthRoutes(r *mux.Router) {
 	r.HandleFunc("/team/{team}/rockscfg", rocksCfgTeamRoute).Methods("GET").Queries("rockscomm", "{rockscomm}", "rockskey", "{rockskey}") // configure team link to enl.rocks community
 	r.HandleFunc("/team/{team}/v", vPullTeamRoute).Methods("GET")
 	r.HandleFunc("/team/{team}/v", vConfigureTeamRoute).Methods("POST")
+
+	// invite links and join requests
+	r.HandleFunc("/team/{team}/invite", teamInviteListRoute).Methods("GET")                                   // list invite links
+	r.HandleFunc("/team/{team}/invite", teamInviteAddRoute).Methods("POST")                                   // create an invite link (form-data: name, expires, maxuses, approval)
+	r.HandleFunc("/team/{team}/invite/{token}", teamInviteDeleteRoute).Methods("DELETE")                      // revoke an invite link
+	r.HandleFunc("/team/{team}/requests", teamJoinRequestListRoute).Methods("GET")                            // pending join requests
+	r.HandleFunc("/team/{team}/requests/{requestID}/approve", teamJoinRequestApproveRoute).Methods("PUT")     // approve a join request
+	r.HandleFunc("/team/{team}/requests/{requestID}/deny", teamJoinRequestDenyRoute).Methods("PUT", "DELETE") // deny a join request
+
+	r.HandleFunc("/team/{team}/audit", teamAuditRoute).Methods("GET")     // audit log, newest first (query: limit, before)
+	r.HandleFunc("/team/{team}/export", teamExportRoute).Methods("GET")   // roster as json or csv (query: format)
+	r.HandleFunc("/team/{team}/import", teamImportRoute).Methods("POST")  // add agents in bulk (json: {"agents": [...]}, or csv/text, one per line)
+	r.HandleFunc("/team/{team}/sync", teamSyncLogRoute).Methods("GET")    // recent V and rocks sync results
+	r.HandleFunc("/team/{team}/track", teamTrackRoute).Methods("GET")     // location history (query: start, end, agent, format=json|gpx)
+	r.HandleFunc("/team/{team}/track", teamTrackDaysRoute).Methods("PUT") // location history retention (form-data: days, 0 is off)
+	r.HandleFunc("/team/{team}/location", teamLocationPolicyRoute).Methods("GET")
+	r.HandleFunc("/team/{team}/location", teamSetLocationPolicyRoute).Methods("PUT") // form-data: precision, start, end, op
+
 	r.HandleFunc("/team/{team}/announce", announceTeamRoute).Methods("POST")             // broadcast a message to the team (form-data: m)
 	r.HandleFunc("/team/{team}/rename", renameTeamRoute).Methods("PUT")                  // rename the team, (form-data: teamname)
+	r.HandleFunc("/team/{team}/tree", getTeamTreeRoute).Methods("GET")                   // the team and its sub-teams
+	r.HandleFunc("/team/{team}/members", getTeamMergedRoute).Methods("GET")              // agents on the team and all sub-teams
+	r.HandleFunc("/team/{team}/parent", setTeamParentRoute).Methods("PUT")               // place the team below another (form-data: parent)
+	r.HandleFunc("/team/{team}/parent", delTeamParentRoute).Methods("DELETE")            // make the team top-level again
 	r.HandleFunc("/team/{team}/{key}", addAgentToTeamRoute).Methods("GET", "POST")       // key can be gid/name/enlid
 	r.HandleFunc("/team/{team}/{key}", delAgentFmTeamRoute).Methods("DELETE")            // remove agent from team
 	r.HandleFunc("/team/{team}/{key}/delete", delAgentFmTeamRoute).Methods("GET")        // deprecated
 	r.HandleFunc("/team/{team}/{gid}/comment", setAgentTeamCommentRoute).Methods("POST") // set agent comment
+	r.HandleFunc("/team/{team}/{gid}/promote", promoteAgentRoute).Methods("PUT")         // make agent a team admin
+	r.HandleFunc("/team/{team}/{gid}/demote", demoteAgentRoute).Methods("PUT")           // make admin a regular member
 
 	// allow fetching specific teams in bulk - JSON list of teamIDs
 	r.HandleFunc("/teams", bulkTeamFetchRoute).Methods("POST")
 
+	// server administration
+	r.HandleFunc("/admin/merge", adminMergeListRoute).Methods("GET")         // pending agent merge requests
+	r.HandleFunc("/admin/merge", adminMergeRoute).Methods("POST")            // merge directly (form-data: from, into)
+	r.HandleFunc("/admin/merge/{id}", adminMergeApproveRoute).Methods("PUT") // approve a merge request
+	r.HandleFunc("/admin/merge/{id}", adminMergeDenyRoute).Methods("DELETE") // deny a merge request
+	r.HandleFunc("/admin/agents", adminAgentSearchRoute).Methods("GET")      // q: GoogleID or part of any name
+	r.HandleFunc("/admin/agent/{gid}/lock", adminAgentLockRoute).Methods("PUT")
+	r.HandleFunc("/admin/agent/{gid}/lock", adminAgentUnlockRoute).Methods("DELETE")
+	r.HandleFunc("/admin/op/{opID}", adminDeleteOpRoute).Methods("DELETE")
+	r.HandleFunc("/admin/team/{team}", adminDeleteTeamRoute).Methods("DELETE")
+	r.HandleFunc("/admin/stats", adminStatsRoute).Methods("GET")
+	r.HandleFunc("/admin/scanners", adminScannersRoute).Methods("GET")
+	r.HandleFunc("/admin/scanners/{ip}", adminScannerClearRoute).Methods("DELETE")
+	r.HandleFunc("/admin/audit", adminAuditRoute).Methods("GET") // before, limit
+
 	r.HandleFunc("/d", getDefensiveKeys).Methods("GET")
 	r.HandleFunc("/d", setDefensiveKey).Methods("POST")
 	r.HandleFunc("/d/bulk", setDefensiveKeyBulk).Methods("POST")
@@ -219,12 +306,15 @@ func incrementScanner(req *http.Request) {
 	scanners.Increment(ip)
 }
 
+// addresses with more bad requests than this are blocked
+const scannerThreshold = 20
+
 // true == block, false == permit
 func isScanner(req *http.Request) bool {
 	ip, _, _ := net.SplitHostPort(req.RemoteAddr)
 
 	i, ok := scanners.Get(ip)
-	if ok && i > 20 {
+	if ok && i > scannerThreshold {
 		return true
 	}
 	return false
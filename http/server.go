@@ -4,6 +4,7 @@ import (
 	"context"
 	"crypto/tls"
 	"fmt"
+	"net"
 	"net/http"
 	"net/http/httputil"
 	"os"
@@ -37,6 +38,7 @@ const jsonType = "application/json; charset=UTF-8"
 const jsonTypeShort = "application/json"
 const jsonStatusOK = `{"status":"ok"}`
 const jsonStatusEmpty = `{"status":"error","error":"Empty JSON"}`
+const jsonStatusPending = `{"status":"pending"}`
 
 // Start launches the HTTP server which is responsible for the frontend and the HTTP API.
 func Start() {
@@ -158,6 +160,39 @@ func authMW(next http.Handler) http.Handler {
 			return
 		}
 
+		// personal access tokens for bots and integrations, limited by their scopes
+		if secret := strings.TrimPrefix(h, "Bearer "); strings.HasPrefix(secret, model.APITokenPrefix) {
+			gid, t, err := model.APITokenAuth(secret)
+			if err != nil {
+				log.Infow("api token rejected", "error", err)
+				http.Error(res, jsonError(err), http.StatusUnauthorized)
+				return
+			}
+			if !gid.Valid() {
+				err := fmt.Errorf(model.ErrUnknownGID)
+				http.Error(res, jsonError(err), http.StatusUnauthorized)
+				return
+			}
+			// blacklisting at V or .rocks, or a RES intel faction, applies to tokens as it does at each JWT refresh
+			if authorized, err := auth.AuthorizeToken(gid); !authorized {
+				err = fmt.Errorf("access denied: %s", err)
+				log.Infow(err.Error(), "GID", gid, "token", t.ID)
+				http.Error(res, jsonError(err), http.StatusForbidden)
+				return
+			}
+			if !apiTokenAllows(t, req) {
+				err := fmt.Errorf("api token not permitted for this request")
+				log.Infow(err.Error(), "GID", gid, "token", t.ID, "resource", req.URL.Path, "method", req.Method)
+				http.Error(res, jsonError(err), http.StatusForbidden)
+				return
+			}
+
+			ctx := context.WithValue(req.Context(), "X-Wasabee-GID", gid)
+			ctx = context.WithValue(ctx, "X-Wasabee-APIToken", t)
+			next.ServeHTTP(res, req.WithContext(ctx))
+			return
+		}
+
 		token, err := jwt.ParseRequest(req,
 			jwt.WithKeySet(config.JWParsingKeys(), jws.WithInferAlgorithmFromKey(true), jws.WithUseDefault(true)),
 			jwt.WithValidate(true),
@@ -178,23 +213,38 @@ func authMW(next http.Handler) http.Handler {
 			return
 		}
 
-		if auth.IsRevokedJWT(token.JwtID()) {
+		revoked, err := auth.IsRevokedJWT(token.JwtID())
+		if err != nil {
+			// fail closed, a revoked token must not get through while the database is unavailable
+			http.Error(res, jsonError(err), http.StatusServiceUnavailable)
+			return
+		}
+		if revoked {
 			log.Infow("JWT revoked", "sub", token.Subject(), "token ID", token.JwtID())
-			http.Error(res, err.Error(), http.StatusUnauthorized)
+			http.Error(res, "JWT revoked", http.StatusUnauthorized)
 			return
 		}
 
+		ip, _, _ := net.SplitHostPort(req.RemoteAddr)
+		model.SessionSeen(token.JwtID(), ip)
+
 		gid := model.GoogleID(token.Subject())
 		// too db intensive? -- cache it?
 		if !gid.Valid() {
-			// token minted on another server, never logged in to this server
-			if err := gid.FirstLogin(); err != nil {
+			if c := gid.Canonical(); c != gid {
+				// token minted before this agent was merged into another
+				gid = c
+			} else if err := gid.FirstLogin(); err != nil {
+				// token minted on another server, never logged in to this server
 				log.Info(err)
 				http.Error(res, err.Error(), http.StatusUnauthorized)
 				return
 			}
 		}
 
+		// presence is derived from API activity
+		gid.Seen()
+
 		// pass the GoogleID around so subsequent functions can easily access it
 		ctx := context.WithValue(req.Context(), "X-Wasabee-GID", gid)
 		req = req.WithContext(ctx)
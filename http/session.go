@@ -0,0 +1,81 @@
+package wasabeehttps
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/wasabee-project/Wasabee-Server/federation"
+	"github.com/wasabee-project/Wasabee-Server/model"
+)
+
+func meSessionsRoute(res http.ResponseWriter, req *http.Request) {
+	gid, err := getAgentID(req)
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusUnauthorized)
+		return
+	}
+
+	sessions, err := gid.Sessions()
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+
+	// mark the session making this request
+	if token, err := requestJWT(req); err == nil {
+		for i := range sessions {
+			sessions[i].Current = sessions[i].JwtID == token.JwtID()
+		}
+	}
+
+	res.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(res).Encode(sessions)
+}
+
+func meRevokeSessionRoute(res http.ResponseWriter, req *http.Request) {
+	gid, err := getAgentID(req)
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusUnauthorized)
+		return
+	}
+
+	jwts, err := gid.RevokeSession(model.SessionID(mux.Vars(req)["id"]))
+	if err != nil {
+		if err.Error() == model.ErrSessionNotFound {
+			http.Error(res, jsonError(err), http.StatusNotFound)
+			return
+		}
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+	go federateRevokedJWTs(jwts)
+	fmt.Fprint(res, jsonStatusOK)
+}
+
+// meRevokeSessionsRoute logs out everywhere, including the session making the request
+func meRevokeSessionsRoute(res http.ResponseWriter, req *http.Request) {
+	gid, err := getAgentID(req)
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusUnauthorized)
+		return
+	}
+
+	jwts, err := gid.RevokeSessions()
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+	go federateRevokedJWTs(jwts)
+	fmt.Fprint(res, jsonStatusOK)
+}
+
+// federateRevokedJWTs tells the other servers, which accept our JWTs, about the revocations
+func federateRevokedJWTs(jwts []string) {
+	for _, j := range jwts {
+		_ = federation.RevokeJWT(context.Background(), j)
+	}
+}
@@ -0,0 +1,142 @@
+package wasabeehttps
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/wasabee-project/Wasabee-Server/log"
+	"github.com/wasabee-project/Wasabee-Server/model"
+)
+
+func drawShareAddRoute(res http.ResponseWriter, req *http.Request) {
+	gid, err := getAgentID(req)
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(req)
+	opID := model.OperationID(vars["opID"])
+
+	if !opID.IsOwner(gid) {
+		err = fmt.Errorf("forbidden: only the owner can share an operation")
+		log.Warnw(err.Error(), "GID", gid, "resource", opID)
+		http.Error(res, jsonError(err), http.StatusForbidden)
+		return
+	}
+
+	// unset is the whole op, unlike permissions which default to the primary zone
+	zone := model.ZoneAll
+	if z := req.FormValue("zone"); z != "" {
+		zone = model.ZoneFromString(z)
+	}
+
+	// optional, RFC1123 format
+	expires, err := permTime(req.FormValue("expires"))
+	if err != nil {
+		log.Warnw(err.Error(), "GID", gid, "resource", opID, "expires", req.FormValue("expires"))
+		http.Error(res, jsonError(err), http.StatusNotAcceptable)
+		return
+	}
+
+	redact := req.FormValue("redact") == "true" || req.FormValue("redact") == "on"
+
+	share, err := opID.NewShare(gid, zone, expires, redact)
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusNotAcceptable)
+		return
+	}
+	json.NewEncoder(res).Encode(&share)
+}
+
+func drawShareListRoute(res http.ResponseWriter, req *http.Request) {
+	gid, err := getAgentID(req)
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(req)
+	opID := model.OperationID(vars["opID"])
+
+	if !opID.IsOwner(gid) {
+		err = fmt.Errorf("forbidden: only the owner can list an operation's shares")
+		log.Warnw(err.Error(), "GID", gid, "resource", opID)
+		http.Error(res, jsonError(err), http.StatusForbidden)
+		return
+	}
+
+	shares, err := opID.Shares(gid)
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+
+	if len(shares) == 0 {
+		fmt.Fprint(res, "[]")
+		return
+	}
+	res.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(res).Encode(shares)
+}
+
+func drawShareDeleteRoute(res http.ResponseWriter, req *http.Request) {
+	gid, err := getAgentID(req)
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(req)
+	opID := model.OperationID(vars["opID"])
+	token := model.ShareToken(vars["token"])
+
+	if !opID.IsOwner(gid) {
+		err = fmt.Errorf("forbidden: only the owner can revoke an operation's shares")
+		log.Warnw(err.Error(), "GID", gid, "resource", opID)
+		http.Error(res, jsonError(err), http.StatusForbidden)
+		return
+	}
+
+	if err := opID.DeleteShare(gid, token); err != nil {
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+	fmt.Fprint(res, jsonStatusOK)
+}
+
+// shareRoute does not require authentication, the token is the authorization
+func shareRoute(res http.ResponseWriter, req *http.Request) {
+	vars := mux.Vars(req)
+	token := model.ShareToken(vars["token"])
+
+	share, err := token.Share()
+	if err != nil {
+		incrementScanner(req)
+		http.Error(res, jsonError(err), http.StatusNotFound)
+		return
+	}
+
+	if share.OpID.IsDeletedOp() {
+		err := fmt.Errorf("requested deleted op")
+		log.Infow(err.Error(), "resource", share.OpID, "token", token)
+		http.Error(res, jsonError(err), http.StatusGone)
+		return
+	}
+
+	o, err := share.Populate()
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusNotFound)
+		return
+	}
+
+	res.Header().Set("Cache-Control", "no-store")
+	if err = json.NewEncoder(res).Encode(&o); err != nil {
+		log.Errorw("unable to encode & send shared operation", "error", err.Error())
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+}
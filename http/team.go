@@ -29,7 +29,7 @@ func getTeamRoute(res http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	isowner, err := gid.OwnsTeam(team)
+	isadmin, err := gid.AdminsTeam(team)
 	if err != nil {
 		http.Error(res, jsonError(err), http.StatusInternalServerError)
 		return
@@ -40,7 +40,7 @@ func getTeamRoute(res http.ResponseWriter, req *http.Request) {
 		http.Error(res, jsonError(err), http.StatusInternalServerError)
 		return
 	}
-	if !isowner && !onteam {
+	if !isadmin && !onteam {
 		err := fmt.Errorf("not on team")
 		log.Infow(err.Error(), "teamID", team, "gid", gid, "message", err.Error())
 		http.Error(res, jsonError(err), http.StatusForbidden)
@@ -53,11 +53,18 @@ func getTeamRoute(res http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	if !isowner {
+	// tokens which cannot manage the team do not get the ways to join it
+	if isadmin && !tokenLacks(req, model.ScopeTeamsWrite) {
+		if err := teamList.PopulateInvites(); err != nil {
+			http.Error(res, jsonError(err), http.StatusInternalServerError)
+			return
+		}
+	} else {
 		teamList.RocksComm = ""
 		teamList.RocksKey = ""
 		teamList.JoinLinkToken = ""
 	}
+	hideLocations(req, teamList.TeamMembers)
 	json.NewEncoder(res).Encode(&teamList)
 }
 
@@ -143,6 +150,7 @@ func chownTeamRoute(res http.ResponseWriter, req *http.Request) {
 		http.Error(res, jsonError(err), http.StatusInternalServerError)
 		return
 	}
+	team.Audit(gid, model.AuditOwnerChanged, string(togid), "")
 	fmt.Fprint(res, jsonStatusOK)
 }
 
@@ -157,7 +165,7 @@ func addAgentToTeamRoute(res http.ResponseWriter, req *http.Request) {
 	team := model.TeamID(vars["team"])
 	key := vars["key"]
 
-	safe, err := gid.OwnsTeam(team)
+	safe, err := gid.AdminsTeam(team)
 	if err != nil {
 		http.Error(res, jsonError(err), http.StatusInternalServerError)
 		return
@@ -178,7 +186,7 @@ func addAgentToTeamRoute(res http.ResponseWriter, req *http.Request) {
 			http.Error(res, jsonError(err), http.StatusInternalServerError)
 			return
 		}
-		if err = team.AddAgent(togid); err != nil {
+		if err = team.AddAgent(togid, gid, ""); err != nil {
 			http.Error(res, jsonError(err), http.StatusInternalServerError)
 			return
 		}
@@ -200,12 +208,12 @@ func delAgentFmTeamRoute(res http.ResponseWriter, req *http.Request) {
 		http.Error(res, jsonError(err), http.StatusInternalServerError)
 		return
 	}
-	safe, err := gid.OwnsTeam(team)
+	safe, err := gid.AdminsTeam(team)
 	if err != nil {
 		http.Error(res, jsonError(err), http.StatusInternalServerError)
 		return
 	}
-	if gid == togid {
+	if owner, _ := togid.OwnsTeam(team); gid == togid || owner {
 		err := fmt.Errorf("cannot remove owner")
 		log.Warnw(err.Error(), "resource", team, "gid", gid)
 		http.Error(res, jsonError(err), http.StatusForbidden)
@@ -217,7 +225,7 @@ func delAgentFmTeamRoute(res http.ResponseWriter, req *http.Request) {
 		http.Error(res, jsonError(err), http.StatusForbidden)
 		return
 	}
-	if err = team.RemoveAgent(togid); err != nil {
+	if err = team.RemoveAgent(togid, gid, ""); err != nil {
 		http.Error(res, jsonError(err), http.StatusInternalServerError)
 		return
 	}
@@ -233,13 +241,13 @@ func announceTeamRoute(res http.ResponseWriter, req *http.Request) {
 
 	vars := mux.Vars(req)
 	team := model.TeamID(vars["team"])
-	safe, err := gid.OwnsTeam(team)
+	safe, err := gid.AdminsTeam(team)
 	if err != nil {
 		http.Error(res, jsonError(err), http.StatusInternalServerError)
 		return
 	}
 	if !safe {
-		err := fmt.Errorf("forbidden: only team owners can send announcements")
+		err := fmt.Errorf("forbidden: only team owners and admins can send announcements")
 		log.Warnw(err.Error(), "resource", team, "gid", gid)
 		http.Error(res, jsonError(err), http.StatusForbidden)
 		return
@@ -255,6 +263,7 @@ func announceTeamRoute(res http.ResponseWriter, req *http.Request) {
 		Sender: messaging.GoogleID(gid),
 		TeamID: messaging.TeamID(team),
 	})
+	team.Audit(gid, model.AuditAnnouncement, "", message)
 	fmt.Fprint(res, jsonStatusOK)
 }
 
@@ -268,8 +277,8 @@ func setAgentTeamCommentRoute(res http.ResponseWriter, req *http.Request) {
 	vars := mux.Vars(req)
 	teamID := model.TeamID(vars["team"])
 
-	if owns, _ := gid.OwnsTeam(teamID); !owns {
-		err = fmt.Errorf("forbidden: only the team owner can set comments")
+	if admin, _ := gid.AdminsTeam(teamID); !admin {
+		err = fmt.Errorf("forbidden: only team owners and admins can set comments")
 		log.Warnw(err.Error(), "resource", teamID, "gid", gid)
 		http.Error(res, jsonError(err), http.StatusForbidden)
 		return
@@ -281,6 +290,7 @@ func setAgentTeamCommentRoute(res http.ResponseWriter, req *http.Request) {
 		http.Error(res, jsonError(err), http.StatusInternalServerError)
 		return
 	}
+	teamID.Audit(gid, model.AuditCommentChanged, string(inGid), squad)
 	fmt.Fprint(res, jsonStatusOK)
 }
 
@@ -294,8 +304,8 @@ func renameTeamRoute(res http.ResponseWriter, req *http.Request) {
 	vars := mux.Vars(req)
 	teamID := model.TeamID(vars["team"])
 
-	if owns, _ := gid.OwnsTeam(teamID); !owns {
-		err = fmt.Errorf("only the team owner can rename a team")
+	if admin, _ := gid.AdminsTeam(teamID); !admin {
+		err = fmt.Errorf("only team owners and admins can rename a team")
 		log.Warnw(err.Error(), "resource", teamID, "gid", gid)
 		http.Error(res, jsonError(err), http.StatusForbidden)
 		return
@@ -308,10 +318,12 @@ func renameTeamRoute(res http.ResponseWriter, req *http.Request) {
 		http.Error(res, jsonError(err), http.StatusInternalServerError)
 		return
 	}
+	oldname, _ := teamID.Name()
 	if err := teamID.Rename(teamname); err != nil {
 		http.Error(res, jsonError(err), http.StatusInternalServerError)
 		return
 	}
+	teamID.Audit(gid, model.AuditTeamRenamed, "", fmt.Sprintf("%s -> %s", oldname, teamname))
 	fmt.Fprint(res, jsonStatusOK)
 }
 
@@ -326,14 +338,15 @@ func genJoinKeyRoute(res http.ResponseWriter, req *http.Request) {
 	teamID := model.TeamID(vars["team"])
 
 	var key string
-	if owns, _ := gid.OwnsTeam(teamID); owns {
+	if admin, _ := gid.AdminsTeam(teamID); admin {
 		key, err = teamID.GenerateJoinToken()
 		if err != nil {
 			http.Error(res, jsonError(err), http.StatusInternalServerError)
 			return
 		}
+		teamID.Audit(gid, model.AuditJoinKeyCreated, "", "")
 	} else {
-		err = fmt.Errorf("forbidden: only the team owner can create join links")
+		err = fmt.Errorf("forbidden: only team owners and admins can create join links")
 		log.Warnw(err.Error(), "resource", teamID, "gid", gid)
 		http.Error(res, jsonError(err), http.StatusForbidden)
 		return
@@ -360,8 +373,8 @@ func delJoinKeyRoute(res http.ResponseWriter, req *http.Request) {
 	vars := mux.Vars(req)
 	teamID := model.TeamID(vars["team"])
 
-	if owns, _ := gid.OwnsTeam(teamID); !owns {
-		err = fmt.Errorf("forbidden: only the team owner can remove join links")
+	if admin, _ := gid.AdminsTeam(teamID); !admin {
+		err = fmt.Errorf("forbidden: only team owners and admins can remove join links")
 		log.Warnw(err.Error(), "resource", teamID, "gid", gid)
 		http.Error(res, jsonError(err), http.StatusForbidden)
 		return
@@ -371,6 +384,7 @@ func delJoinKeyRoute(res http.ResponseWriter, req *http.Request) {
 		http.Error(res, jsonError(err), http.StatusInternalServerError)
 		return
 	}
+	teamID.Audit(gid, model.AuditJoinKeyRemoved, "", "")
 	fmt.Fprint(res, jsonStatusOK)
 }
 
@@ -386,14 +400,216 @@ func joinLinkRoute(res http.ResponseWriter, req *http.Request) {
 	teamID := model.TeamID(vars["team"])
 	key := vars["key"]
 
-	if err = teamID.JoinToken(gid, key); err != nil {
+	pending, err := teamID.JoinToken(gid, key)
+	if err != nil {
+		if err.Error() == model.ErrInviteNotFound {
+			http.Error(res, jsonError(err), http.StatusNotFound)
+			return
+		}
 		http.Error(res, jsonError(err), http.StatusInternalServerError)
 		return
 	}
 
+	if pending {
+		// a team admin has to approve the request
+		fmt.Fprint(res, jsonStatusPending)
+		return
+	}
 	fmt.Fprint(res, jsonStatusOK) // draw pretty screen
 }
 
+func promoteAgentRoute(res http.ResponseWriter, req *http.Request) {
+	setAgentTeamRole(res, req, model.TeamRoleAdmin)
+}
+
+func demoteAgentRoute(res http.ResponseWriter, req *http.Request) {
+	setAgentTeamRole(res, req, model.TeamRoleMember)
+}
+
+func setAgentTeamRole(res http.ResponseWriter, req *http.Request, role model.TeamRole) {
+	gid, err := getAgentID(req)
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(req)
+	teamID := model.TeamID(vars["team"])
+
+	// admins may not make more admins, or remove each other
+	if owns, _ := gid.OwnsTeam(teamID); !owns {
+		err = fmt.Errorf("forbidden: only the team owner can change roles")
+		log.Warnw(err.Error(), "resource", teamID, "gid", gid)
+		http.Error(res, jsonError(err), http.StatusForbidden)
+		return
+	}
+
+	togid, err := model.ToGid(vars["gid"])
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusNotAcceptable)
+		return
+	}
+
+	if err := teamID.SetRole(togid, role); err != nil {
+		switch err.Error() {
+		case model.ErrAgentNotOnTeam:
+			http.Error(res, jsonError(err), http.StatusNotFound)
+		case model.ErrCannotChangeOwnerRole:
+			http.Error(res, jsonError(err), http.StatusForbidden)
+		default:
+			http.Error(res, jsonError(err), http.StatusInternalServerError)
+		}
+		return
+	}
+	log.Infow("team role changed", "resource", teamID, "gid", gid, "agent", togid, "role", role)
+	teamID.Audit(gid, model.AuditRoleChanged, string(togid), string(role))
+	fmt.Fprint(res, jsonStatusOK)
+}
+
+func getTeamTreeRoute(res http.ResponseWriter, req *http.Request) {
+	gid, err := getAgentID(req)
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+
+	vars := mux.Vars(req)
+	teamID := model.TeamID(vars["team"])
+
+	if !teamTreeVisible(gid, teamID) {
+		err := fmt.Errorf("not on team")
+		log.Infow(err.Error(), "teamID", teamID, "gid", gid)
+		http.Error(res, jsonError(err), http.StatusForbidden)
+		return
+	}
+
+	tree, err := teamID.Tree()
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(res).Encode(&tree)
+}
+
+func getTeamMergedRoute(res http.ResponseWriter, req *http.Request) {
+	gid, err := getAgentID(req)
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+
+	vars := mux.Vars(req)
+	teamID := model.TeamID(vars["team"])
+
+	if !teamTreeVisible(gid, teamID) {
+		err := fmt.Errorf("not on team")
+		log.Infow(err.Error(), "teamID", teamID, "gid", gid)
+		http.Error(res, jsonError(err), http.StatusForbidden)
+		return
+	}
+
+	members, err := teamID.MergedMembers()
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+	hideLocations(req, members)
+	json.NewEncoder(res).Encode(&members)
+}
+
+// teamTreeVisible reports if the agent is on the team, or administers it or a team above it;
+// being on a sub-team does not show the parent's tree, that would reveal the sibling teams
+func teamTreeVisible(gid model.GoogleID, teamID model.TeamID) bool {
+	if inteam, _ := gid.AgentInTeam(teamID); inteam {
+		return true
+	}
+	return gid.AdminsTeamTree(teamID)
+}
+
+func setTeamParentRoute(res http.ResponseWriter, req *http.Request) {
+	gid, err := getAgentID(req)
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+
+	vars := mux.Vars(req)
+	teamID := model.TeamID(vars["team"])
+	parent := model.TeamID(req.FormValue("parent"))
+
+	// the parent's ops flow down to this team's agents, so both sides must agree
+	if admin, _ := gid.AdminsTeam(teamID); !admin {
+		err = fmt.Errorf("forbidden: only team owners and admins can move a team")
+		log.Warnw(err.Error(), "resource", teamID, "gid", gid)
+		http.Error(res, jsonError(err), http.StatusForbidden)
+		return
+	}
+	if parent != "" {
+		if admin, _ := gid.AdminsTeam(parent); !admin {
+			err = fmt.Errorf("forbidden: only owners and admins of the parent team can add sub-teams to it")
+			log.Warnw(err.Error(), "resource", teamID, "parent", parent, "gid", gid)
+			http.Error(res, jsonError(err), http.StatusForbidden)
+			return
+		}
+	}
+
+	if err := teamID.SetParent(parent); err != nil {
+		switch err.Error() {
+		case model.ErrTeamNotFound:
+			http.Error(res, jsonError(err), http.StatusNotFound)
+		case model.ErrTeamCycle:
+			http.Error(res, jsonError(err), http.StatusNotAcceptable)
+		default:
+			http.Error(res, jsonError(err), http.StatusInternalServerError)
+		}
+		return
+	}
+	teamID.Audit(gid, model.AuditParentChanged, string(parent), "")
+	if parent != "" {
+		parent.Audit(gid, model.AuditParentChanged, string(teamID), "sub-team added")
+	}
+	fmt.Fprint(res, jsonStatusOK)
+}
+
+func delTeamParentRoute(res http.ResponseWriter, req *http.Request) {
+	gid, err := getAgentID(req)
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+
+	vars := mux.Vars(req)
+	teamID := model.TeamID(vars["team"])
+
+	parent, err := teamID.Parent()
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+
+	// either side may detach
+	admin, _ := gid.AdminsTeam(teamID)
+	if !admin && parent != "" {
+		admin, _ = gid.AdminsTeam(parent)
+	}
+	if !admin {
+		err = fmt.Errorf("forbidden: only team owners and admins can detach a sub-team")
+		log.Warnw(err.Error(), "resource", teamID, "gid", gid)
+		http.Error(res, jsonError(err), http.StatusForbidden)
+		return
+	}
+
+	if err := teamID.SetParent(""); err != nil {
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+	teamID.Audit(gid, model.AuditParentChanged, "", "detached from "+string(parent))
+	if parent != "" {
+		parent.Audit(gid, model.AuditParentChanged, string(teamID), "sub-team detached")
+	}
+	fmt.Fprint(res, jsonStatusOK)
+}
+
 func getAgentsLocation(res http.ResponseWriter, req *http.Request) {
 	gid, err := getAgentID(req)
 	if err != nil {
@@ -434,7 +650,7 @@ func bulkTeamFetchRoute(res http.ResponseWriter, req *http.Request) {
 
 	var list []model.TeamData
 	for _, team := range requestedteams.TeamIDs {
-		isowner, err := gid.OwnsTeam(team)
+		isadmin, err := gid.AdminsTeam(team)
 		if err != nil {
 			log.Error(err)
 			continue
@@ -444,7 +660,7 @@ func bulkTeamFetchRoute(res http.ResponseWriter, req *http.Request) {
 		if err != nil {
 			continue
 		}
-		if !isowner && !onteam {
+		if !isadmin && !onteam {
 			continue
 		}
 		t, err := team.FetchTeam()
@@ -453,11 +669,17 @@ func bulkTeamFetchRoute(res http.ResponseWriter, req *http.Request) {
 			continue
 		}
 
-		if !isowner {
+		if isadmin && !tokenLacks(req, model.ScopeTeamsWrite) {
+			if err := t.PopulateInvites(); err != nil {
+				log.Errorw(err.Error(), "teamID", team, "gid", gid)
+				continue
+			}
+		} else {
 			t.RocksComm = ""
 			t.RocksKey = ""
 			t.JoinLinkToken = ""
 		}
+		hideLocations(req, t.TeamMembers)
 
 		list = append(list, *t)
 	}
@@ -470,3 +692,28 @@ func bulkTeamFetchRoute(res http.ResponseWriter, req *http.Request) {
 
 	json.NewEncoder(res).Encode(list)
 }
+
+func teamSyncLogRoute(res http.ResponseWriter, req *http.Request) {
+	gid, err := getAgentID(req)
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(req)
+	teamID := model.TeamID(vars["team"])
+
+	if admin, _ := gid.AdminsTeam(teamID); !admin {
+		err = fmt.Errorf(model.ErrNotTeamAdmin)
+		log.Warnw(err.Error(), "resource", teamID, "gid", gid)
+		http.Error(res, jsonError(err), http.StatusForbidden)
+		return
+	}
+
+	syncs, err := teamID.SyncLog(50)
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(res).Encode(&syncs)
+}
@@ -21,13 +21,13 @@ func vPullTeamRoute(res http.ResponseWriter, req *http.Request) {
 	vars := mux.Vars(req)
 	team := model.TeamID(vars["team"])
 
-	owns, err := gid.OwnsTeam(team)
+	owns, err := gid.AdminsTeam(team)
 	if err != nil {
 		http.Error(res, jsonError(err), http.StatusForbidden)
 		return
 	}
 	if !owns {
-		err := fmt.Errorf("attempt to pull V for a team owned by someone else")
+		err := fmt.Errorf("attempt to pull V for a team the agent does not administer")
 		log.Errorw(err.Error(), "GID", gid, "teamID", team)
 		http.Error(res, jsonError(err), http.StatusForbidden)
 		return
@@ -63,13 +63,13 @@ func vConfigureTeamRoute(res http.ResponseWriter, req *http.Request) {
 	vars := mux.Vars(req)
 	team := model.TeamID(vars["team"])
 
-	owns, err := gid.OwnsTeam(team)
+	owns, err := gid.AdminsTeam(team)
 	if err != nil {
 		http.Error(res, jsonError(err), http.StatusForbidden)
 		return
 	}
 	if !owns {
-		err := fmt.Errorf("attempt to configure V for a team owned by someone else")
+		err := fmt.Errorf("attempt to configure V for a team the agent does not administer")
 		log.Errorw(err.Error(), "gid", gid, "teamID", team)
 		http.Error(res, jsonError(err), http.StatusForbidden)
 		return
@@ -95,6 +95,7 @@ func vConfigureTeamRoute(res http.ResponseWriter, req *http.Request) {
 		http.Error(res, jsonError(err), http.StatusInternalServerError)
 		return
 	}
+	team.Audit(gid, model.AuditVChanged, strconv.FormatInt(vteam, 10), fmt.Sprintf("role %d", role))
 	fmt.Fprint(res, jsonStatusOK)
 }
 
@@ -0,0 +1,68 @@
+package messaging
+
+import (
+	"sort"
+)
+
+// Event is a class of notification, agents choose per bus which classes they receive
+type Event string
+
+// notification classes
+const (
+	EventAssignment Event = "assignments"
+	EventTaskStatus Event = "taskstatus"
+	EventAnnounce   Event = "announcements"
+	EventMessage    Event = "messages"
+	EventTarget     Event = "targets"
+)
+
+// Events lists every notification class
+var Events = []Event{EventAssignment, EventTaskStatus, EventAnnounce, EventMessage, EventTarget}
+
+// Filter decides if an agent wants an event delivered by the named bus; opID is empty for events not tied to an op
+type Filter func(gid GoogleID, bus string, event Event, opID OperationID) bool
+
+var filter Filter
+
+// RegisterFilter sets the function consulted before delivering an event to an agent
+func RegisterFilter(f Filter) {
+	filter = f
+}
+
+// Wants reports if the agent wants the event delivered by the named bus
+// buses which fan out team-wide events themselves use this to honor per-agent preferences
+func Wants(gid GoogleID, bus string, event Event, opID OperationID) bool {
+	if filter == nil {
+		return true
+	}
+	return filter(gid, bus, event, opID)
+}
+
+// Permit decides if one agent accepts direct messages from another
+type Permit func(fromGID GoogleID, toGID GoogleID) bool
+
+var permit Permit
+
+// RegisterPermit sets the function consulted before any bus delivers a message from one agent to another
+func RegisterPermit(p Permit) {
+	permit = p
+}
+
+// CanSendTo reports if the agent fromGID may send direct messages to toGID
+// messages from the server itself have no sender and are always allowed
+func CanSendTo(fromGID GoogleID, toGID GoogleID) bool {
+	if fromGID == "" || fromGID == toGID || permit == nil {
+		return true
+	}
+	return permit(fromGID, toGID)
+}
+
+// Buses lists the names of the registered buses, sorted
+func Buses() []string {
+	out := make([]string, 0, len(busses))
+	for name := range busses {
+		out = append(out, name)
+	}
+	sort.Strings(out)
+	return out
+}
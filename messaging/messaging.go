@@ -38,6 +38,24 @@ type Announce struct {
 	TeamID TeamID
 }
 
+// JoinRequest is the type used for the SendJoinRequest call
+type JoinRequest struct {
+	ID        string
+	TeamID    TeamID
+	TeamName  string
+	Agent     GoogleID
+	AgentName string
+	Invite    string
+}
+
+// AgentMessage is the type used for the SendAgentMessage call, the message itself is stored by the server
+type AgentMessage struct {
+	ID       string
+	From     GoogleID
+	FromName string
+	Text     string
+}
+
 // Bus is the type that services use to register with the messaging framework
 type Bus struct {
 	SendMessage          func(GoogleID, string) (bool, error)              // send a message to an individual agent
@@ -49,6 +67,9 @@ type Bus struct {
 	SendAssignment       func(GoogleID, TaskID, OperationID, string) error // Send a formatted assignment to an individual agent
 	AgentDeleteOperation func(GoogleID, OperationID) error                 // instruct a single agent to delete an operation
 	DeleteOperation      func(OperationID) error                           // instruct EVERYONE to delete an operation
+	SendJoinRequest      func(GoogleID, JoinRequest) error                 // ask a team admin to approve or deny a join request
+	SendPresence         func(GoogleID) error                              // tell an agent's teammates their presence changed
+	SendAgentMessage     func(GoogleID, AgentMessage) (bool, error)        // notify an agent of a new message in their inbox
 }
 
 var busses map[string]Bus
@@ -57,8 +78,11 @@ func init() {
 	busses = make(map[string]Bus)
 }
 
-// SendTarget is called to send target information to agents
-func SendTarget(toGID GoogleID, target Target) error {
+// ErrBlocked is returned when the recipient does not accept direct messages from the sender
+const ErrBlocked = "that agent does not accept direct messages from you"
+
+// SendTarget is called to send target information from one agent to another
+func SendTarget(fromGID GoogleID, toGID GoogleID, target Target) error {
 	if target.Name == "" {
 		err := fmt.Errorf("portal not set")
 		log.Warnw(err.Error(), "GID", toGID)
@@ -71,8 +95,14 @@ func SendTarget(toGID GoogleID, target Target) error {
 		return err
 	}
 
-	for _, bus := range busses {
-		if bus.SendTarget != nil {
+	if !CanSendTo(fromGID, toGID) {
+		err := fmt.Errorf(ErrBlocked)
+		log.Infow(err.Error(), "GID", fromGID, "to", toGID)
+		return err
+	}
+
+	for name, bus := range busses {
+		if bus.SendTarget != nil && bus.allows(fromGID, toGID) && Wants(toGID, name, EventTarget, "") {
 			if err := bus.SendTarget(toGID, target); err != nil {
 				log.Error(err)
 			}
@@ -87,7 +117,7 @@ func SendMessage(toGID GoogleID, message string) (bool, error) {
 	var sent bool
 
 	for name, bus := range busses {
-		if bus.SendMessage != nil {
+		if bus.SendMessage != nil && Wants(toGID, name, EventMessage, "") {
 			success, err := bus.SendMessage(toGID, message)
 			if err != nil {
 				log.Error(err)
@@ -103,6 +133,7 @@ func SendMessage(toGID GoogleID, message string) (bool, error) {
 
 // SendAnnounce sends a generic message to a team
 // if opID is nil, it is not used
+// buses which deliver to individual agents should check Wants for each agent
 func SendAnnounce(teamID TeamID, a Announce) {
 	for _, bus := range busses {
 		if bus.SendAnnounce != nil {
@@ -146,9 +177,15 @@ func RemoveFromRemote(gid GoogleID, teamID TeamID) {
 }
 
 // SendAssignment sends a task to an agent
+// new assignments are EventAssignment, other status changes EventTaskStatus
 func SendAssignment(gid GoogleID, taskID TaskID, opID OperationID, status string) {
-	for _, bus := range busses {
-		if bus.SendAssignment != nil {
+	event := EventTaskStatus
+	if status == "assigned" {
+		event = EventAssignment
+	}
+
+	for name, bus := range busses {
+		if bus.SendAssignment != nil && Wants(gid, name, event, opID) {
 			if err := bus.SendAssignment(gid, taskID, opID, status); err != nil {
 				log.Error(err)
 			}
@@ -177,3 +214,55 @@ func DeleteOperation(opID OperationID) {
 		}
 	}
 }
+
+// SendJoinRequest asks a team admin to approve or deny a pending join request
+func SendJoinRequest(gid GoogleID, r JoinRequest) {
+	for _, bus := range busses {
+		if bus.SendJoinRequest != nil {
+			if err := bus.SendJoinRequest(gid, r); err != nil {
+				log.Error(err)
+			}
+		}
+	}
+}
+
+// SendPresence tells an agent's teammates that the agent's presence changed
+func SendPresence(gid GoogleID) {
+	for _, bus := range busses {
+		if bus.SendPresence != nil {
+			if err := bus.SendPresence(gid); err != nil {
+				log.Error(err)
+			}
+		}
+	}
+}
+
+// SendAgentMessage notifies an agent of a new message in their inbox, it reports if any bus reached them
+func SendAgentMessage(toGID GoogleID, m AgentMessage) (bool, error) {
+	var sent bool
+
+	if !CanSendTo(m.From, toGID) {
+		err := fmt.Errorf(ErrBlocked)
+		log.Infow(err.Error(), "GID", m.From, "to", toGID)
+		return false, err
+	}
+
+	for name, bus := range busses {
+		if bus.SendAgentMessage != nil && bus.allows(m.From, toGID) && Wants(toGID, name, EventMessage, "") {
+			success, err := bus.SendAgentMessage(toGID, m)
+			if err != nil {
+				log.Error(err)
+			}
+			if success {
+				sent = true
+				log.Infow("message notification sent", "toGID", toGID, "bus", name, "messageID", m.ID)
+			}
+		}
+	}
+	return sent, nil
+}
+
+// allows consults the bus's own CanSendTo, if it has one
+func (b Bus) allows(fromGID GoogleID, toGID GoogleID) bool {
+	return b.CanSendTo == nil || b.CanSendTo(fromGID, toGID)
+}
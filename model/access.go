@@ -3,8 +3,10 @@ package model
 import (
 	"database/sql"
 	"fmt"
+	"time"
 
 	"github.com/wasabee-project/Wasabee-Server/log"
+	"github.com/wasabee-project/Wasabee-Server/messaging"
 )
 
 // PopulateTeams loads the permissions from the database into the op data
@@ -14,7 +16,8 @@ func (o *Operation) PopulateTeams() error {
 		return nil
 	}
 
-	rows, err := db.Query("SELECT teamID, permission, zone FROM permissions WHERE opID = ?", o.ID)
+	// scheduled and expired permissions are loaded so the owner can see them, but are ignored for access checks
+	rows, err := db.Query("SELECT teamID, permission, zone, notbefore, expires, "+permActive+" FROM permissions WHERE opID = ?", o.ID)
 	if err != nil && err != sql.ErrNoRows {
 		log.Error(err)
 		return err
@@ -24,21 +27,46 @@ func (o *Operation) PopulateTeams() error {
 	for rows.Next() {
 		var tid, role string
 		var zone Zone
-		err := rows.Scan(&tid, &role, &zone)
+		var notbefore, expires sql.NullString
+		var active bool
+		err := rows.Scan(&tid, &role, &zone, &notbefore, &expires, &active)
 		if err != nil {
 			log.Error(err)
 			continue
 		}
 		o.Teams = append(o.Teams, OpPermission{
-			OpID:   o.ID,
-			TeamID: TeamID(tid),
-			Role:   OpPermRole(role),
-			Zone:   zone,
+			OpID:      o.ID,
+			TeamID:    TeamID(tid),
+			Role:      OpPermRole(role),
+			Zone:      zone,
+			NotBefore: sqlTimeToRFC1123(notbefore),
+			Expires:   sqlTimeToRFC1123(expires),
+			active:    active,
 		})
 	}
 	return nil
 }
 
+// ActiveTeams returns the teams holding a permission on the op which is currently in effect, each listed once
+func (o *Operation) ActiveTeams() []TeamID {
+	var teams []TeamID
+
+	if err := o.PopulateTeams(); err != nil {
+		log.Error(err)
+		return teams
+	}
+
+	seen := make(map[TeamID]bool)
+	for _, t := range o.Teams {
+		if !t.active || seen[t.TeamID] {
+			continue
+		}
+		seen[t.TeamID] = true
+		teams = append(teams, t.TeamID)
+	}
+	return teams
+}
+
 // ReadAccess determines if an agent has read acces to an op, if zone limitations are present, return those as well
 func (o *Operation) ReadAccess(gid GoogleID) (bool, []Zone) {
 	var zones []Zone
@@ -54,12 +82,17 @@ func (o *Operation) ReadAccess(gid GoogleID) (bool, []Zone) {
 		return false, zones
 	}
 
+	// permissions granted to a parent team apply to the members of its sub-teams
+	teams := gid.effectiveTeams()
 	for _, t := range o.Teams {
+		if !t.active {
+			continue
+		}
 		switch t.Role {
 		case opPermRoleAssignedOnly:
 			continue
 		case opPermRoleRead:
-			if inteam, _ := gid.AgentInTeam(t.TeamID); inteam {
+			if teams[t.TeamID] {
 				permitted = true
 				zones = append(zones, t.Zone)
 				if t.Zone == ZoneAll {
@@ -67,7 +100,7 @@ func (o *Operation) ReadAccess(gid GoogleID) (bool, []Zone) {
 				}
 			}
 		case opPermRoleWrite:
-			if inteam, _ := gid.AgentInTeam(t.TeamID); inteam {
+			if teams[t.TeamID] {
 				permitted = true
 				zones = append(zones, ZoneAll)
 				return permitted, zones // fast-path
@@ -88,12 +121,13 @@ func (o *Operation) WriteAccess(gid GoogleID) bool {
 		return false
 	}
 
+	teams := gid.effectiveTeams()
 	for _, t := range o.Teams {
-		if t.Role != opPermRoleWrite {
+		if t.Role != opPermRoleWrite || !t.active {
 			continue
 		}
 		// write teams
-		if inteam, _ := gid.AgentInTeam(t.TeamID); inteam {
+		if teams[t.TeamID] {
 			return true
 		}
 	}
@@ -150,11 +184,12 @@ func (o *Operation) AssignedOnlyAccess(gid GoogleID) bool {
 		return false
 	}
 
+	teams := gid.effectiveTeams()
 	for _, t := range o.Teams {
-		if t.Role != opPermRoleAssignedOnly {
+		if t.Role != opPermRoleAssignedOnly || !t.active {
 			continue
 		}
-		if inteam, _ := gid.AgentInTeam(t.TeamID); inteam {
+		if teams[t.TeamID] {
 			return true
 		}
 	}
@@ -162,7 +197,8 @@ func (o *Operation) AssignedOnlyAccess(gid GoogleID) bool {
 }
 
 // AddPerm adds a new permission to an op
-func (opID OperationID) AddPerm(gid GoogleID, teamID TeamID, perm string, zone Zone) error {
+// notBefore and expires are optional, the zero time leaves that end of the window open
+func (opID OperationID) AddPerm(gid GoogleID, teamID TeamID, perm string, zone Zone, notBefore, expires time.Time) error {
 	if !opID.IsOwner(gid) {
 		err := fmt.Errorf(ErrNotOpOwner)
 		log.Errorw(err.Error(), "GID", gid, "resource", opID)
@@ -187,14 +223,30 @@ func (opID OperationID) AddPerm(gid GoogleID, teamID TeamID, perm string, zone Z
 		return err
 	}
 
+	if !expires.IsZero() && !expires.After(time.Now()) {
+		err := fmt.Errorf(ErrPermExpiresInPast)
+		log.Errorw(err.Error(), "GID", gid, "resource", opID, "expires", expires)
+		return err
+	}
+
+	if !expires.IsZero() && !notBefore.IsZero() && !expires.After(notBefore) {
+		err := fmt.Errorf(ErrPermWindowInvalid)
+		log.Errorw(err.Error(), "GID", gid, "resource", opID, "notbefore", notBefore, "expires", expires)
+		return err
+	}
+
 	// zone only applies to read access for now
 	if opp != opPermRoleRead {
 		zone = ZoneAll
 	}
-	if _, err = db.Exec("INSERT INTO permissions VALUES (?,?,?,?)", teamID, opID, opp, zone); err != nil {
+
+	// permissions which open in the future are announced by the background scheduler when they take effect
+	announced := notBefore.IsZero() || !notBefore.After(time.Now())
+	if _, err = db.Exec("INSERT INTO permissions (teamID, opID, permission, zone, notbefore, expires, announced) VALUES (?,?,?,?,?,?,?)", teamID, opID, opp, zone, makeNullTime(notBefore), makeNullTime(expires), announced); err != nil {
 		log.Error(err)
 		return err
 	}
+	teamID.Audit(gid, AuditPermAdded, string(opID), fmt.Sprintf("%s zone %d", opp, zone))
 	return nil
 }
 
@@ -217,13 +269,14 @@ func (opID OperationID) DelPerm(gid GoogleID, teamID TeamID, perm OpPermRole, zo
 			return err
 		}
 	}
+	teamID.Audit(gid, AuditPermRemoved, string(opID), fmt.Sprintf("%s zone %d", perm, zone))
 	return nil
 }
 
 // Operations returns a slice containing all the OpPermissions which reference this team
 func (teamID TeamID) Operations() ([]OpPermission, error) {
 	var perms []OpPermission
-	rows, err := db.Query("SELECT opID, permission, zone FROM permissions WHERE teamID = ?", teamID)
+	rows, err := db.Query("SELECT opID, permission, zone, notbefore, expires, "+permActive+" FROM permissions WHERE teamID = ?", teamID)
 	if err != nil && err != sql.ErrNoRows {
 		log.Error(err)
 		return perms, err
@@ -233,25 +286,30 @@ func (teamID TeamID) Operations() ([]OpPermission, error) {
 	for rows.Next() {
 		var opid, role string
 		var zone Zone
-		err := rows.Scan(&opid, &role, &zone)
+		var notbefore, expires sql.NullString
+		var active bool
+		err := rows.Scan(&opid, &role, &zone, &notbefore, &expires, &active)
 		if err != nil {
 			log.Error(err)
 			continue
 		}
 		perms = append(perms, OpPermission{
-			OpID:   OperationID(opid),
-			TeamID: teamID,
-			Role:   OpPermRole(role),
-			Zone:   zone,
+			OpID:      OperationID(opid),
+			TeamID:    teamID,
+			Role:      OpPermRole(role),
+			Zone:      zone,
+			NotBefore: sqlTimeToRFC1123(notbefore),
+			Expires:   sqlTimeToRFC1123(expires),
+			active:    active,
 		})
 	}
 	return perms, nil
 }
 
-// Teams returns a list of every team with access to this operation
+// Teams returns a list of every team with current access to this operation
 func (opID OperationID) Teams() ([]TeamID, error) {
 	var teams []TeamID
-	rows, err := db.Query("SELECT DISTINCT teamID FROM permissions WHERE opID = ?", opID)
+	rows, err := db.Query("SELECT DISTINCT teamID FROM permissions WHERE opID = ? AND "+permActive, opID)
 	if err != nil && err != sql.ErrNoRows {
 		log.Error(err)
 		return teams, err
@@ -269,3 +327,94 @@ func (opID OperationID) Teams() ([]TeamID, error) {
 	}
 	return teams, nil
 }
+
+// OpPermissionSchedule enforces the not-before and expires times on permissions; called from the background process.
+// Permissions which have just taken effect are marked as announced, expired permissions are removed and the agents on those teams are told to drop the op.
+// The opened and closed permissions are returned so the caller can notify the teams.
+func OpPermissionSchedule() ([]OpPermission, []OpPermission, error) {
+	var opened, closed []OpPermission
+
+	// one time for every query, so a permission which opens or closes while this runs is handled on the next pass rather than missed
+	now := time.Now().UTC().Format("2006-01-02 15:04:05")
+
+	tx, err := db.Begin()
+	if err != nil {
+		log.Error(err)
+		return opened, closed, err
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && err != sql.ErrTxDone {
+			log.Error(err)
+		}
+	}()
+
+	rows, err := tx.Query("SELECT teamID, opID, permission, zone, notbefore, expires FROM permissions WHERE announced = 0 AND notbefore <= ? AND (expires IS NULL OR expires > ?) FOR UPDATE", now, now)
+	if err != nil {
+		log.Error(err)
+		return opened, closed, err
+	}
+	for rows.Next() {
+		p, err := scanScheduledPerm(rows)
+		if err != nil {
+			log.Error(err)
+			continue
+		}
+		opened = append(opened, p)
+	}
+	rows.Close()
+
+	if _, err := tx.Exec("UPDATE permissions SET announced = 1 WHERE announced = 0 AND notbefore <= ?", now); err != nil {
+		log.Error(err)
+		return nil, nil, err
+	}
+
+	exrows, err := tx.Query("SELECT teamID, opID, permission, zone, notbefore, expires FROM permissions WHERE expires <= ? FOR UPDATE", now)
+	if err != nil {
+		log.Error(err)
+		return nil, nil, err
+	}
+	for exrows.Next() {
+		p, err := scanScheduledPerm(exrows)
+		if err != nil {
+			log.Error(err)
+			continue
+		}
+		closed = append(closed, p)
+	}
+	exrows.Close()
+
+	if _, err := tx.Exec("DELETE FROM permissions WHERE expires <= ?", now); err != nil {
+		log.Error(err)
+		return nil, nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		log.Error(err)
+		return nil, nil, err
+	}
+
+	for _, p := range closed {
+		p.TeamID.Audit("", AuditPermExpired, string(p.OpID), fmt.Sprintf("%s zone %d", p.Role, p.Zone))
+		// the team may still have access through another permission
+		o := Operation{ID: p.OpID}
+		for _, gid := range p.TeamID.treeAgents() {
+			if read, _ := o.ReadAccess(gid); read || o.AssignedOnlyAccess(gid) {
+				continue
+			}
+			messaging.AgentDeleteOperation(messaging.GoogleID(gid), messaging.OperationID(p.OpID))
+		}
+	}
+
+	return opened, closed, nil
+}
+
+func scanScheduledPerm(rows *sql.Rows) (OpPermission, error) {
+	var p OpPermission
+	var notbefore, expires sql.NullString
+
+	if err := rows.Scan(&p.TeamID, &p.OpID, &p.Role, &p.Zone, &notbefore, &expires); err != nil {
+		return p, err
+	}
+	p.NotBefore = sqlTimeToRFC1123(notbefore)
+	p.Expires = sqlTimeToRFC1123(expires)
+	return p, nil
+}
@@ -0,0 +1,96 @@
+package model
+
+import (
+	"database/sql"
+	"strings"
+
+	"github.com/wasabee-project/Wasabee-Server/log"
+)
+
+// AdminAgent is what server administrators see when searching for agents
+type AdminAgent struct {
+	Gid           GoogleID `json:"gid"`
+	Name          string   `json:"name"`
+	IntelName     string   `json:"intelname,omitempty"`
+	CommunityName string   `json:"communityname,omitempty"`
+	VName         string   `json:"vname,omitempty"`
+	RocksName     string   `json:"rocksname,omitempty"`
+	TelegramName  string   `json:"telegramname,omitempty"`
+	Locked        bool     `json:"locked"`
+	LastSeen      string   `json:"lastseen,omitempty"` // time.RFC1123 format
+}
+
+// ServerStats are the counts server administrators use to watch the server
+type ServerStats struct {
+	Agents       int `json:"agents"`
+	LockedAgents int `json:"lockedagents"`
+	ActiveAgents int `json:"activeagents"` // seen in the last day
+	Operations   int `json:"operations"`
+	Teams        int `json:"teams"`
+	Sessions     int `json:"sessions"` // logins which have not expired
+	APITokens    int `json:"apitokens"`
+	MergeQueue   int `json:"mergequeue"` // merge requests waiting for an administrator
+}
+
+// SearchAgents finds agents by GoogleID or any part of any of their names, for server administrators
+func SearchAgents(query string, limit int) ([]AdminAgent, error) {
+	agents := make([]AdminAgent, 0)
+
+	query = strings.TrimPrefix(strings.TrimSpace(query), "@")
+	if query == "" {
+		return agents, nil
+	}
+	like := "%" + strings.NewReplacer("\\", "\\\\", "%", "\\%", "_", "\\_").Replace(strings.ToLower(query)) + "%"
+
+	rows, err := db.Query("SELECT a.gid, a.intelname, a.communityname, v.agent, rocks.agent, telegram.telegramName, a.RISC, presence.lastseen FROM agent=a LEFT JOIN v ON a.gid = v.gid LEFT JOIN rocks ON a.gid = rocks.gid LEFT JOIN telegram ON a.gid = telegram.gid LEFT JOIN presence ON a.gid = presence.gid WHERE a.gid = ? OR LOWER(a.intelname) LIKE ? OR LOWER(a.communityname) LIKE ? OR LOWER(v.agent) LIKE ? OR LOWER(rocks.agent) LIKE ? OR LOWER(telegram.telegramName) LIKE ? ORDER BY presence.lastseen DESC LIMIT ?",
+		query, like, like, like, like, like, limit)
+	if err != nil {
+		log.Error(err)
+		return agents, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var a AdminAgent
+		var intelname, communityname, vname, rocksname, tgname, lastseen sql.NullString
+		if err := rows.Scan(&a.Gid, &intelname, &communityname, &vname, &rocksname, &tgname, &a.Locked, &lastseen); err != nil {
+			log.Error(err)
+			continue
+		}
+		a.Name = a.Gid.bestname(intelname, vname, rocksname, communityname)
+		a.IntelName = intelname.String
+		a.CommunityName = communityname.String
+		a.VName = vname.String
+		a.RocksName = rocksname.String
+		a.TelegramName = tgname.String
+		a.LastSeen = sqlTimeToRFC1123(lastseen)
+		agents = append(agents, a)
+	}
+	return agents, nil
+}
+
+// GetServerStats counts the server's agents, operations, teams and sessions
+func GetServerStats() (*ServerStats, error) {
+	var s ServerStats
+
+	counts := []struct {
+		q string
+		v *int
+	}{
+		{"SELECT COUNT(*) FROM agent", &s.Agents},
+		{"SELECT COUNT(*) FROM agent WHERE RISC = 1", &s.LockedAgents},
+		{"SELECT COUNT(*) FROM presence WHERE lastseen > DATE_SUB(UTC_TIMESTAMP(), INTERVAL 1 DAY)", &s.ActiveAgents},
+		{"SELECT COUNT(*) FROM operation", &s.Operations},
+		{"SELECT COUNT(*) FROM team", &s.Teams},
+		{"SELECT COUNT(*) FROM session WHERE expires > UTC_TIMESTAMP()", &s.Sessions},
+		{"SELECT COUNT(*) FROM apitoken WHERE expires IS NULL OR expires > UTC_TIMESTAMP()", &s.APITokens},
+		{"SELECT COUNT(*) FROM agentmerge", &s.MergeQueue},
+	}
+	for _, c := range counts {
+		if err := db.QueryRow(c.q).Scan(c.v); err != nil {
+			log.Error(err)
+			return nil, err
+		}
+	}
+	return &s, nil
+}
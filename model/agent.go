@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"fmt"
 	"strconv"
+	"time"
 
 	"github.com/wasabee-project/Wasabee-Server/config"
 	"github.com/wasabee-project/Wasabee-Server/log"
@@ -42,6 +43,22 @@ type Agent struct {
 	QueryToken   string `json:"querytoken,omitempty"`
 	VAPIkey      string `json:"vapi,omitempty"`
 	JWT          string `json:"jwt,omitempty"`
+	RefreshToken string `json:"refreshtoken,omitempty"` // exchanged at the refresh URL for a new JWT
+}
+
+// RemoveCredentials clears everything in the struct which could be used to sign in as the agent or to act for them elsewhere
+// used when the caller is a bot or integration rather than the agent
+func (a *Agent) RemoveCredentials() {
+	a.OneTimeToken = ""
+	a.QueryToken = ""
+	a.VAPIkey = ""
+	a.JWT = ""
+	a.RefreshToken = ""
+	a.Telegram.Authtoken = ""
+	for i := range a.Teams {
+		a.Teams[i].RocksKey = ""
+		a.Teams[i].JoinLinkToken = ""
+	}
 }
 
 // AdTeam is a sub-struct of Agent
@@ -54,7 +71,9 @@ type AdTeam struct {
 	ShareLoc      string `json:"State"`
 	ShareWD       string
 	LoadWD        string
+	TrackLoc      string // whether the agent's locations are kept in the team's history
 	Owner         GoogleID
+	Role          TeamRole
 	VTeam         int64 `json:"VTeam,omitempty"`
 	VTeamRole     uint8 `json:"VTeamRole,omitempty"`
 }
@@ -180,7 +199,7 @@ func (gid GoogleID) GetAgent() (*Agent, error) {
 }
 
 func adTeams(ad *Agent) error {
-	rows, err := db.Query("SELECT x.teamID, team.name, x.shareLoc, x.shareWD, x.loadWD, team.rockscomm, team.rockskey, team.owner, team.joinLinkToken, team.vteam, team.vrole FROM agentteams=x JOIN team ON x.teamID = team.teamID WHERE x.gid = ?", ad.GoogleID)
+	rows, err := db.Query("SELECT x.teamID, team.name, x.shareLoc, x.shareWD, x.loadWD, x.trackloc, team.rockscomm, team.rockskey, team.owner, team.joinLinkToken, team.vteam, team.vrole, IF(team.owner = x.gid, 'owner', x.role) FROM agentteams=x JOIN team ON x.teamID = team.teamID WHERE x.gid = ?", ad.GoogleID)
 	if err != nil {
 		log.Error(err)
 		return err
@@ -189,10 +208,10 @@ func adTeams(ad *Agent) error {
 
 	for rows.Next() {
 		var team AdTeam
-		var shareLoc, shareWD, loadWD bool
+		var shareLoc, shareWD, loadWD, trackLoc bool
 		var rc, rk, jlt sql.NullString
 
-		err := rows.Scan(&team.ID, &team.Name, &shareLoc, &shareWD, &loadWD, &rc, &rk, &team.Owner, &jlt, &team.VTeam, &team.VTeamRole)
+		err := rows.Scan(&team.ID, &team.Name, &shareLoc, &shareWD, &loadWD, &trackLoc, &rc, &rk, &team.Owner, &jlt, &team.VTeam, &team.VTeamRole, &team.Role)
 		if err != nil {
 			log.Error(err)
 			return err
@@ -202,8 +221,8 @@ func adTeams(ad *Agent) error {
 			team.RocksComm = rc.String
 		}
 
-		if rk.Valid && team.Owner == ad.GoogleID {
-			// only share RocksKey with owner
+		if rk.Valid && (team.Role == TeamRoleOwner || team.Role == TeamRoleAdmin) {
+			// only share RocksKey with owner and admins
 			team.RocksKey = rk.String
 		}
 
@@ -229,6 +248,12 @@ func adTeams(ad *Agent) error {
 			team.LoadWD = "Off"
 		}
 
+		if trackLoc {
+			team.TrackLoc = "On"
+		} else {
+			team.TrackLoc = "Off"
+		}
+
 		ad.Teams = append(ad.Teams, team)
 	}
 	return nil
@@ -277,7 +302,7 @@ func adOps(ad *Agent) error {
 		seen[op.ID] = true
 	}
 
-	rowTeam, err := db.Query("SELECT operation.ID, operation.Name, operation.Color, permissions.teamID, operation.modified, operation.lasteditid FROM agentteams JOIN permissions ON agentteams.teamID = permissions.teamID JOIN operation ON permissions.opID = operation.ID WHERE agentteams.gid = ?", ad.GoogleID)
+	rowTeam, err := db.Query("SELECT operation.ID, operation.Name, operation.Color, permissions.teamID, operation.modified, operation.lasteditid FROM agentteams JOIN permissions ON agentteams.teamID = permissions.teamID JOIN operation ON permissions.opID = operation.ID WHERE agentteams.gid = ? AND "+permActive, ad.GoogleID)
 	if err != nil {
 		log.Error(err)
 		return err
@@ -297,6 +322,43 @@ func adOps(ad *Agent) error {
 		ad.Ops = append(ad.Ops, op)
 		seen[op.ID] = true
 	}
+
+	// ops granted to the parents of the agent's teams
+	direct := make(map[TeamID]bool)
+	for _, t := range ad.Teams {
+		direct[t.ID] = true
+	}
+	for t := range ad.GoogleID.effectiveTeams() {
+		if direct[t] {
+			continue
+		}
+		if err := adInheritedOps(ad, t, seen); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func adInheritedOps(ad *Agent, teamID TeamID, seen map[OperationID]bool) error {
+	rows, err := db.Query("SELECT operation.ID, operation.Name, operation.Color, permissions.teamID, operation.modified, operation.lasteditid FROM permissions JOIN operation ON permissions.opID = operation.ID WHERE permissions.teamID = ? AND "+permActive, teamID)
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var op AdOperation
+		if err := rows.Scan(&op.ID, &op.Name, &op.Color, &op.TeamID, &op.Modified, &op.LastEditID); err != nil {
+			log.Error(err)
+			return err
+		}
+		if seen[op.ID] {
+			continue
+		}
+		ad.Ops = append(ad.Ops, op)
+		seen[op.ID] = true
+	}
 	return nil
 }
 
@@ -327,7 +389,9 @@ func (gid GoogleID) SetLocation(lat, lon string) error {
 		return err
 	}
 
-	return nil
+	gid.Seen()
+	go gid.checkGeofences(flat, flon)
+	return gid.trackLocation(flat, flon)
 }
 
 // IngressName returns an agent's name for a given GoogleID.
@@ -514,7 +578,7 @@ func (gid GoogleID) Delete() error {
 			log.Error(err)
 			continue
 		}
-		_ = teamID.RemoveAgent(gid)
+		_ = teamID.RemoveAgent(gid, gid, "account deleted")
 	}
 
 	// brute force delete everyhing else
@@ -526,34 +590,71 @@ func (gid GoogleID) Delete() error {
 
 	// the foreign key constraints should take care of these, but just in case...
 	_, _ = db.Exec("DELETE FROM locations WHERE gid = ?", gid)
+	_, _ = db.Exec("DELETE FROM locationtrack WHERE gid = ?", gid)
 	_, _ = db.Exec("DELETE FROM telegram WHERE gid = ?", gid)
 	_, _ = db.Exec("DELETE FROM firebase WHERE gid = ?", gid)
 	_, _ = db.Exec("DELETE FROM v WHERE gid = ?", gid)
 	_, _ = db.Exec("DELETE FROM rocks WHERE gid = ?", gid)
+	_, _ = db.Exec("DELETE FROM messagelog WHERE gid = ? OR sender = ?", gid, gid)
 
 	return nil
 }
 
-// Lock disables an account -- called by RISC system
+// Lock disables an account -- called by RISC system; it takes over any lock set by a server administrator
 func (gid GoogleID) Lock(reason string) error {
 	log.Infow("RISC locking", "gid", gid, "reason", reason)
-	if _, err := db.Exec("UPDATE agent SET RISC = 1 WHERE gid = ?", gid); err != nil {
+	if _, err := db.Exec("UPDATE agent SET RISC = 1, lockedby = NULL WHERE gid = ?", gid); err != nil {
 		log.Error(err)
 		return err
 	}
 	return nil
 }
 
-// Unlock enables a disabled account -- called by RISC system
+// Unlock enables an account disabled by the RISC system -- called by RISC system; locks set by server administrators stay
 func (gid GoogleID) Unlock(reason string) error {
 	log.Infow("RISC unlocking", "gid", gid, "reason", reason)
-	if _, err := db.Exec("UPDATE agent SET RISC = 0 WHERE gid = ?", gid); err != nil {
+	if _, err := db.Exec("UPDATE agent SET RISC = 0 WHERE gid = ? AND lockedby IS NULL", gid); err != nil {
 		log.Error(err)
 		return err
 	}
 	return nil
 }
 
+// AdminLock disables an account on behalf of a server administrator; an existing RISC lock stays a RISC lock
+func (gid GoogleID) AdminLock(admin GoogleID, reason string) error {
+	log.Infow("admin locking", "gid", gid, "admin", admin, "reason", reason)
+	if _, err := db.Exec("UPDATE agent SET lockedby = IF(RISC = 1 AND lockedby IS NULL, NULL, ?), RISC = 1 WHERE gid = ?", admin, gid); err != nil {
+		log.Error(err)
+		return err
+	}
+	return nil
+}
+
+// AdminUnlock enables a disabled account on behalf of a server administrator, whoever locked it
+func (gid GoogleID) AdminUnlock(admin GoogleID, reason string) error {
+	log.Infow("admin unlocking", "gid", gid, "admin", admin, "reason", reason)
+	if _, err := db.Exec("UPDATE agent SET RISC = 0, lockedby = NULL WHERE gid = ?", gid); err != nil {
+		log.Error(err)
+		return err
+	}
+	return nil
+}
+
+// LockedBy reports if the account is locked, and the server administrator who locked it; "" is a lock set by the RISC system
+func (gid GoogleID) LockedBy() (bool, GoogleID, error) {
+	var locked bool
+	var by sql.NullString
+	err := db.QueryRow("SELECT RISC, lockedby FROM agent WHERE gid = ?", gid).Scan(&locked, &by)
+	if err == sql.ErrNoRows {
+		return false, "", fmt.Errorf(ErrUnknownGID)
+	}
+	if err != nil {
+		log.Error(err)
+		return false, "", err
+	}
+	return locked, GoogleID(by.String), nil
+}
+
 // RISC checks to see if the user was marked as compromised by Google
 func (gid GoogleID) RISC() bool {
 	var RISC bool
@@ -682,35 +783,56 @@ func (gid GoogleID) FirstLogin() error {
 }
 
 // GetAgentLocations is a fast-path to get all available agent locations
+// each agent's location is shown at the finest precision any shared team's policy allows
 func (gid GoogleID) GetAgentLocations() ([]AgentLocation, error) {
 	var list []AgentLocation
-	var tmpL AgentLocation
 	var lat, lon string
 
 	var rows *sql.Rows
-	rows, err := db.Query("SELECT x.gid, Y(l.loc), X(l.loc), l.upTime "+
-		"FROM agentteams=x, locations=l "+
+	rows, err := db.Query("SELECT x.gid, Y(l.loc), X(l.loc), l.upTime, "+policyColumns("x")+" "+
+		"FROM agentteams=x JOIN team ON x.teamID = team.teamID JOIN locations=l ON x.gid = l.gid "+
 		"WHERE x.teamID IN (SELECT teamID FROM agentteams WHERE gid = ?) "+
-		"AND x.shareLoc= 1 AND x.gid = l.gid", gid)
+		"AND x.shareLoc= 1", gid)
 	if err != nil {
 		log.Error(err)
 		return list, err
 	}
 
 	defer rows.Close()
+	now := time.Now()
+	best := make(map[GoogleID]int)
+	precisions := make(map[GoogleID]LocationPrecision)
 	for rows.Next() {
-		if err := rows.Scan(&tmpL.Gid, &lat, &lon, &tmpL.Date); err != nil {
+		var tmpL AgentLocation
+		var ps policyScan
+		if err := rows.Scan(append([]interface{}{&tmpL.Gid, &lat, &lon, &tmpL.Date}, ps.dest()...)...); err != nil {
 			log.Error(err)
 			return list, err
 		}
+		precision, ok := ps.share(now)
+		if !ok {
+			continue
+		}
+
 		tmpL.Lat, _ = strconv.ParseFloat(lat, 64)
 		tmpL.Lon, _ = strconv.ParseFloat(lon, 64)
 
 		if tmpL.Lat == 0 || tmpL.Lon == 0 {
 			continue
 		}
+		tmpL.Lat, tmpL.Lon = precision.blur(tmpL.Lat, tmpL.Lon)
 
-		list = append(list, tmpL)
+		i, seen := best[tmpL.Gid]
+		if !seen {
+			best[tmpL.Gid] = len(list)
+			precisions[tmpL.Gid] = precision
+			list = append(list, tmpL)
+			continue
+		}
+		if precision.meters() < precisions[tmpL.Gid].meters() {
+			precisions[tmpL.Gid] = precision
+			list[i] = tmpL
+		}
 	}
 	return list, nil
 }
@@ -0,0 +1,237 @@
+package model
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/wasabee-project/Wasabee-Server/log"
+	"github.com/wasabee-project/Wasabee-Server/util"
+)
+
+// APITokenPrefix starts every personal access token, to tell them apart from JWTs
+const APITokenPrefix = "wpat_"
+
+// APITokenScope is a class of API routes a personal access token can use
+type APITokenScope string
+
+// personal access token scopes
+const (
+	ScopeOpsRead    APITokenScope = "ops:read"    // read operations
+	ScopeOpsWrite   APITokenScope = "ops:write"   // change operations and list their share links, includes tasks
+	ScopeTasks      APITokenScope = "tasks"       // claim, acknowledge and complete tasks
+	ScopeLocation   APITokenScope = "location"    // report and read agent locations
+	ScopeTeamsRead  APITokenScope = "teams:read"  // read teams and rosters
+	ScopeTeamsWrite APITokenScope = "teams:write" // manage teams, members, roles and invites
+)
+
+// tokens created before the teams scope was split keep read access only
+const scopeTeamsLegacy APITokenScope = "teams"
+
+// APITokenScopes lists every scope
+var APITokenScopes = []APITokenScope{ScopeOpsRead, ScopeOpsWrite, ScopeTasks, ScopeLocation, ScopeTeamsRead, ScopeTeamsWrite}
+
+// APITokenID wrapper to ensure type safety
+type APITokenID string
+
+// APIToken is a named, revocable token an agent creates for a bot or integration; the secret is only shown at creation
+type APIToken struct {
+	ID       APITokenID      `json:"id"`
+	Name     string          `json:"name"`
+	Scopes   []APITokenScope `json:"scopes"`
+	Ops      []OperationID   `json:"ops,omitempty"`   // if set, only these ops can be used
+	Teams    []TeamID        `json:"teams,omitempty"` // if set, only these teams can be used
+	Created  string          `json:"created"`         // time.RFC1123 format
+	LastUsed string          `json:"lastused,omitempty"`
+	Expires  string          `json:"expires,omitempty"`
+	Token    string          `json:"token,omitempty"` // only set when created
+}
+
+// HasScope reports if the token was granted the scope; ops:write includes tasks
+func (t *APIToken) HasScope(s APITokenScope) bool {
+	for _, v := range t.Scopes {
+		if v == s || (v == ScopeOpsWrite && s == ScopeTasks) {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsOp reports if the token may be used on the operation
+func (t *APIToken) AllowsOp(opID OperationID) bool {
+	if len(t.Ops) == 0 {
+		return true
+	}
+	for _, o := range t.Ops {
+		if o == opID {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsTeam reports if the token may be used on the team
+func (t *APIToken) AllowsTeam(teamID TeamID) bool {
+	if len(t.Teams) == 0 {
+		return true
+	}
+	for _, v := range t.Teams {
+		if v == teamID {
+			return true
+		}
+	}
+	return false
+}
+
+const apiTokenColumns = "ID, name, scopes, ops, teams, created, lastused, expires"
+
+func apiTokenScan(s interface{ Scan(...interface{}) error }) (*APIToken, error) {
+	var t APIToken
+	var scopes, ops, teams string
+	var created string
+	var lastused, expires sql.NullString
+	if err := s.Scan(&t.ID, &t.Name, &scopes, &ops, &teams, &created, &lastused, &expires); err != nil {
+		return nil, err
+	}
+	t.Scopes = make([]APITokenScope, 0)
+	for _, v := range splitList(scopes) {
+		s := APITokenScope(v)
+		if s == scopeTeamsLegacy {
+			s = ScopeTeamsRead
+		}
+		t.Scopes = append(t.Scopes, s)
+	}
+	for _, v := range splitList(ops) {
+		t.Ops = append(t.Ops, OperationID(v))
+	}
+	for _, v := range splitList(teams) {
+		t.Teams = append(t.Teams, TeamID(v))
+	}
+	t.Created = sqlTimeToRFC1123(sql.NullString{String: created, Valid: true})
+	t.LastUsed = sqlTimeToRFC1123(lastused)
+	t.Expires = sqlTimeToRFC1123(expires)
+	return &t, nil
+}
+
+// APITokens lists the agent's personal access tokens
+func (gid GoogleID) APITokens() ([]*APIToken, error) {
+	tokens := make([]*APIToken, 0)
+
+	rows, err := db.Query("SELECT "+apiTokenColumns+" FROM apitoken WHERE gid = ? ORDER BY created", gid)
+	if err != nil {
+		log.Error(err)
+		return tokens, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		t, err := apiTokenScan(rows)
+		if err != nil {
+			log.Error(err)
+			continue
+		}
+		tokens = append(tokens, t)
+	}
+	return tokens, nil
+}
+
+// NewAPIToken creates a personal access token; the returned token carries the secret, which is not stored
+func (gid GoogleID) NewAPIToken(name string, scopes []APITokenScope, ops []OperationID, teams []TeamID, expires time.Time) (*APIToken, error) {
+	name = util.Sanitize(name)
+	if name == "" || len(scopes) == 0 || (!expires.IsZero() && expires.Before(time.Now())) {
+		return nil, fmt.Errorf(ErrAPITokenInvalid)
+	}
+
+	sc := make([]string, 0, len(scopes))
+	for _, s := range scopes {
+		if !validScope(s) {
+			return nil, fmt.Errorf(ErrAPITokenInvalid)
+		}
+		sc = append(sc, string(s))
+	}
+	o := make([]string, 0, len(ops))
+	for _, v := range ops {
+		o = append(o, string(v))
+	}
+	t := make([]string, 0, len(teams))
+	for _, v := range teams {
+		t = append(t, string(v))
+	}
+
+	id := APITokenID(util.GenerateID(40))
+	secret := APITokenPrefix + util.GenerateID(48)
+	if _, err := db.Exec("INSERT INTO apitoken (ID, gid, name, hash, scopes, ops, teams, created, expires) VALUES (?, ?, ?, ?, ?, ?, ?, UTC_TIMESTAMP(), ?)",
+		id, gid, name, hashToken(secret), strings.Join(sc, ","), strings.Join(o, ","), strings.Join(t, ","), makeNullTime(expires)); err != nil {
+		log.Error(err)
+		return nil, err
+	}
+	log.Infow("api token created", "GID", gid, "token", id, "name", name, "scopes", sc)
+
+	token, err := apiTokenScan(db.QueryRow("SELECT "+apiTokenColumns+" FROM apitoken WHERE ID = ?", id))
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+	token.Token = secret
+	return token, nil
+}
+
+// RevokeAPIToken deletes one of the agent's personal access tokens
+func (gid GoogleID) RevokeAPIToken(id APITokenID) error {
+	r, err := db.Exec("DELETE FROM apitoken WHERE ID = ? AND gid = ?", id, gid)
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+	if n, _ := r.RowsAffected(); n == 0 {
+		return fmt.Errorf(ErrAPITokenNotFound)
+	}
+	log.Infow("api token revoked", "GID", gid, "token", id)
+	return nil
+}
+
+// APITokenAuth returns the agent and token for a personal access token secret, and records its use; tokens of locked agents do not work
+func APITokenAuth(secret string) (GoogleID, *APIToken, error) {
+	var gid GoogleID
+	var id APITokenID
+	var expired bool
+	err := db.QueryRow("SELECT gid, ID, IFNULL(expires < UTC_TIMESTAMP(), 0) FROM apitoken WHERE hash = ? AND gid NOT IN (SELECT gid FROM agent WHERE RISC = 1)", hashToken(secret)).Scan(&gid, &id, &expired)
+	if err == sql.ErrNoRows || (err == nil && expired) {
+		return "", nil, fmt.Errorf(ErrAPITokenNotFound)
+	}
+	if err != nil {
+		log.Error(err)
+		return "", nil, err
+	}
+
+	t, err := apiTokenScan(db.QueryRow("SELECT "+apiTokenColumns+" FROM apitoken WHERE ID = ?", id))
+	if err != nil {
+		log.Error(err)
+		return "", nil, err
+	}
+
+	if _, err := db.Exec("UPDATE apitoken SET lastused = UTC_TIMESTAMP() WHERE ID = ? AND (lastused IS NULL OR lastused < DATE_SUB(UTC_TIMESTAMP(), INTERVAL 1 MINUTE))", t.ID); err != nil {
+		log.Error(err)
+	}
+	return gid, t, nil
+}
+
+func validScope(s APITokenScope) bool {
+	for _, v := range APITokenScopes {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
+
+func splitList(in string) []string {
+	out := make([]string, 0)
+	for _, v := range strings.Split(in, ",") {
+		if v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
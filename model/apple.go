@@ -5,14 +5,21 @@ import (
 )
 
 // AppleIDtoGID returns a GoogleID for a given AppleID
-// for now this is very dumb and doesn't try to do anything other than ensure the database doesn't throw an error
-// if we want to manually map
+// AppleIDs linked to an agent sign in as that agent, others get an agent of their own
 func AppleIDtoGID(id string) (GoogleID, error) {
+	linked, err := IdentityToGID(IdentityApple, id)
+	if err != nil {
+		return "", err
+	}
+	if linked != "" {
+		return linked, nil
+	}
+
 	if len(id) > 18 {
 		id = id[:18]
 	}
 
 	faked := fmt.Sprintf("A-%s", id)
 
-	return GoogleID(faked), nil
+	return GoogleID(faked).Canonical(), nil
 }
@@ -0,0 +1,175 @@
+package model
+
+import (
+	"database/sql"
+
+	"github.com/wasabee-project/Wasabee-Server/log"
+)
+
+// TeamAuditEntry is a single record in a team's audit log
+type TeamAuditEntry struct {
+	ID        int64    `json:"id"`
+	Actor     GoogleID `json:"actor,omitempty"` // empty for changes made by the server or a sync service
+	ActorName string   `json:"actorname,omitempty"`
+	Action    string   `json:"action"`
+	Target    string   `json:"target,omitempty"`
+	Detail    string   `json:"detail,omitempty"`
+	Timestamp string   `json:"timestamp"` // time.RFC1123 format
+}
+
+// team audit log actions
+const (
+	AuditTeamCreated      = "team created"
+	AuditTeamRenamed      = "team renamed"
+	AuditOwnerChanged     = "owner changed"
+	AuditAgentAdded       = "agent added"
+	AuditAgentRemoved     = "agent removed"
+	AuditAgentLeft        = "agent left"
+	AuditAgentMerged      = "agent merged"
+	AuditCommentChanged   = "agent comment changed"
+	AuditRoleChanged      = "role changed"
+	AuditParentChanged    = "parent changed"
+	AuditTrackChanged     = "location history changed"
+	AuditLocationPolicy   = "location policy changed"
+	AuditRocksChanged     = "rocks link changed"
+	AuditVChanged         = "V link changed"
+	AuditTelegramLinked   = "telegram chat linked"
+	AuditTelegramUnlinked = "telegram chat unlinked"
+	AuditJoinKeyCreated   = "join key created"
+	AuditJoinKeyRemoved   = "join key removed"
+	AuditInviteCreated    = "invite created"
+	AuditInviteRevoked    = "invite revoked"
+	AuditJoinRequested    = "join requested"
+	AuditJoinApproved     = "join approved"
+	AuditJoinDenied       = "join denied"
+	AuditAnnouncement     = "announcement sent"
+	AuditPermAdded        = "op permission added"
+	AuditPermRemoved      = "op permission removed"
+	AuditPermExpired      = "op permission expired"
+)
+
+// Audit appends an entry to the team's audit log; failures are logged but never block the change being recorded
+func (teamID TeamID) Audit(actor GoogleID, action, target, detail string) {
+	// free-form values such as announcements are cut to fit rather than losing the entry
+	if _, err := db.Exec("INSERT INTO teamaudit (teamID, actor, action, target, detail) VALUES (?, ?, ?, LEFT(?, 128), LEFT(?, 255))", teamID, makeNullString(string(actor)), action, makeNullString(target), makeNullString(detail)); err != nil {
+		log.Errorw(err.Error(), "resource", teamID, "actor", actor, "action", action, "target", target)
+	}
+}
+
+// AuditLog returns a page of the team's audit log, newest first.
+// before is the ID of the last entry of the previous page, 0 for the first page.
+func (teamID TeamID) AuditLog(before int64, limit int) ([]TeamAuditEntry, error) {
+	entries := make([]TeamAuditEntry, 0)
+
+	var rows *sql.Rows
+	var err error
+	if before > 0 {
+		rows, err = db.Query("SELECT ID, actor, action, target, detail, ts FROM teamaudit WHERE teamID = ? AND ID < ? ORDER BY ID DESC LIMIT ?", teamID, before, limit)
+	} else {
+		rows, err = db.Query("SELECT ID, actor, action, target, detail, ts FROM teamaudit WHERE teamID = ? ORDER BY ID DESC LIMIT ?", teamID, limit)
+	}
+	if err != nil {
+		log.Error(err)
+		return entries, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var e TeamAuditEntry
+		var actor, target, detail sql.NullString
+		var ts string
+		if err := rows.Scan(&e.ID, &actor, &e.Action, &target, &detail, &ts); err != nil {
+			log.Error(err)
+			continue
+		}
+		if actor.Valid {
+			e.Actor = GoogleID(actor.String)
+			e.ActorName, _ = e.Actor.IngressName()
+		}
+		if target.Valid {
+			e.Target = target.String
+		}
+		if detail.Valid {
+			e.Detail = detail.String
+		}
+		e.Timestamp = sqlTimeToRFC1123(sql.NullString{String: ts, Valid: true})
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// AdminAuditEntry is a single record in the server administrators' audit log
+type AdminAuditEntry struct {
+	ID        int64    `json:"id"`
+	Actor     GoogleID `json:"actor"`
+	ActorName string   `json:"actorname,omitempty"`
+	Action    string   `json:"action"`
+	Target    string   `json:"target,omitempty"`
+	Detail    string   `json:"detail,omitempty"`
+	Timestamp string   `json:"timestamp"` // time.RFC1123 format
+}
+
+// server administration audit log actions
+const (
+	AdminAgentLocked    = "agent locked"
+	AdminAgentUnlocked  = "agent unlocked"
+	AdminAgentsMerged   = "agents merged"
+	AdminMergeApproved  = "merge approved"
+	AdminMergeDenied    = "merge denied"
+	AdminOpDeleted      = "op deleted"
+	AdminTeamDeleted    = "team deleted"
+	AdminScannerCleared = "scanner cleared"
+	AdminAgentsSearched = "agents searched"
+	AdminScannersListed = "scanners listed"
+	AdminStatsViewed    = "stats viewed"
+)
+
+// AdminAudit appends an entry to the server administrators' audit log, before the action is taken;
+// an action which cannot be recorded must not be taken. Long targets and details are cut to fit.
+func AdminAudit(actor GoogleID, action, target, detail string) error {
+	log.Infow("admin action", "GID", actor, "action", action, "target", target, "detail", detail)
+	if _, err := db.Exec("INSERT INTO adminaudit (actor, action, target, detail) VALUES (?, ?, LEFT(?, 128), LEFT(?, 255))", actor, action, makeNullString(target), makeNullString(detail)); err != nil {
+		log.Errorw(err.Error(), "actor", actor, "action", action, "target", target)
+		return err
+	}
+	return nil
+}
+
+// AdminAuditLog returns a page of the server administrators' audit log, newest first.
+// before is the ID of the last entry of the previous page, 0 for the first page.
+func AdminAuditLog(before int64, limit int) ([]AdminAuditEntry, error) {
+	entries := make([]AdminAuditEntry, 0)
+
+	var rows *sql.Rows
+	var err error
+	if before > 0 {
+		rows, err = db.Query("SELECT ID, actor, action, target, detail, ts FROM adminaudit WHERE ID < ? ORDER BY ID DESC LIMIT ?", before, limit)
+	} else {
+		rows, err = db.Query("SELECT ID, actor, action, target, detail, ts FROM adminaudit ORDER BY ID DESC LIMIT ?", limit)
+	}
+	if err != nil {
+		log.Error(err)
+		return entries, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var e AdminAuditEntry
+		var target, detail sql.NullString
+		var ts string
+		if err := rows.Scan(&e.ID, &e.Actor, &e.Action, &target, &detail, &ts); err != nil {
+			log.Error(err)
+			continue
+		}
+		e.ActorName, _ = e.Actor.IngressName()
+		if target.Valid {
+			e.Target = target.String
+		}
+		if detail.Valid {
+			e.Detail = detail.String
+		}
+		e.Timestamp = sqlTimeToRFC1123(sql.NullString{String: ts, Valid: true})
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
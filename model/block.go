@@ -0,0 +1,111 @@
+package model
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/wasabee-project/Wasabee-Server/log"
+	"github.com/wasabee-project/Wasabee-Server/messaging"
+)
+
+// BlockedAgent is an agent whose direct messages and targets are refused
+type BlockedAgent struct {
+	Gid     GoogleID `json:"gid"`
+	Name    string   `json:"name"`
+	Created string   `json:"created"` // time.RFC1123 format
+}
+
+// BlockList is who an agent accepts direct messages from
+type BlockList struct {
+	Blocked  []BlockedAgent `json:"blocked"`
+	TeamOnly bool           `json:"teamonly"` // only agents sharing a team may send
+}
+
+// BlockList returns the agents gid has blocked and whether direct messages are limited to teammates
+func (gid GoogleID) BlockList() (*BlockList, error) {
+	b := BlockList{
+		Blocked: make([]BlockedAgent, 0),
+	}
+
+	if err := db.QueryRow("SELECT dmteamonly FROM agent WHERE gid = ?", gid).Scan(&b.TeamOnly); err != nil && err != sql.ErrNoRows {
+		log.Error(err)
+		return nil, err
+	}
+
+	rows, err := db.Query("SELECT blocked, created FROM agentblock WHERE gid = ? ORDER BY created", gid)
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var a BlockedAgent
+		var created string
+		if err := rows.Scan(&a.Gid, &created); err != nil {
+			log.Error(err)
+			continue
+		}
+		a.Name, _ = a.Gid.IngressName()
+		a.Created = sqlTimeToRFC1123(sql.NullString{String: created, Valid: true})
+		b.Blocked = append(b.Blocked, a)
+	}
+	return &b, nil
+}
+
+// Block refuses direct messages and targets from the other agent
+func (gid GoogleID) Block(other GoogleID) error {
+	if other == gid {
+		return fmt.Errorf(ErrBlockSelf)
+	}
+
+	if _, err := db.Exec("INSERT IGNORE INTO agentblock (gid, blocked, created) VALUES (?, ?, UTC_TIMESTAMP())", gid, other); err != nil {
+		log.Error(err)
+		return err
+	}
+	log.Infow("agent blocked", "GID", gid, "blocked", other)
+	return nil
+}
+
+// Unblock accepts direct messages from the other agent again
+func (gid GoogleID) Unblock(other GoogleID) error {
+	r, err := db.Exec("DELETE FROM agentblock WHERE gid = ? AND blocked = ?", gid, other)
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+	if n, _ := r.RowsAffected(); n == 0 {
+		return fmt.Errorf(ErrBlockNotFound)
+	}
+	log.Infow("agent unblocked", "GID", gid, "unblocked", other)
+	return nil
+}
+
+// SetTeamOnlyMessages limits direct messages to agents sharing a team with gid
+func (gid GoogleID) SetTeamOnlyMessages(teamOnly bool) error {
+	if _, err := db.Exec("UPDATE agent SET dmteamonly = ? WHERE gid = ?", teamOnly, gid); err != nil {
+		log.Error(err)
+		return err
+	}
+	return nil
+}
+
+// canSendTo is registered with messaging as the Permit consulted before any direct message is delivered
+func canSendTo(fromGID messaging.GoogleID, toGID messaging.GoogleID) bool {
+	var blocked, shared int
+	var teamOnly bool
+
+	err := db.QueryRow("SELECT (SELECT COUNT(*) FROM agentblock WHERE gid = ? AND blocked = ?), (SELECT COUNT(*) FROM agentteams x JOIN agentteams y ON x.teamID = y.teamID WHERE x.gid = ? AND y.gid = ?), dmteamonly FROM agent WHERE gid = ?",
+		toGID, fromGID, toGID, fromGID, toGID).Scan(&blocked, &shared, &teamOnly)
+	if err == sql.ErrNoRows {
+		return true
+	}
+	if err != nil {
+		log.Error(err)
+		return false
+	}
+	if blocked > 0 {
+		return false
+	}
+	return !teamOnly || shared > 0
+}
@@ -0,0 +1,178 @@
+package model
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Briefing is the data used to render a printable per-agent operation briefing
+type Briefing struct {
+	OpID          OperationID
+	OpName        string
+	OpComment     string
+	ReferenceTime string // time.RFC1123 format
+	Agent         GoogleID
+	AgentName     string
+	Steps         []BriefingStep
+	Keys          []BriefingKey
+}
+
+// BriefingStep is a single task assigned to the agent
+type BriefingStep struct {
+	Order        int16
+	TaskID       TaskID
+	IsLink       bool
+	Action       string // friendly marker type, or "link"
+	Portal       BriefingPortal
+	To           BriefingPortal // only set for links
+	Comment      string
+	State        string
+	Zone         Zone
+	DependsOn    []string
+	KeysRequired int   // for links, the keys to the destination portal needed for all of the agent's links
+	KeysOnHand   int32 // for links, the keys to the destination portal the agent reported
+}
+
+// BriefingPortal is the portal information needed to find a portal on the day
+type BriefingPortal struct {
+	ID       PortalID
+	Name     string
+	Lat      string
+	Lon      string
+	Comment  string
+	Hardness string
+	MapURL   string
+	IntelURL string
+}
+
+// BriefingKey summarizes the keys the agent needs to farm before the op
+type BriefingKey struct {
+	Portal   BriefingPortal
+	Required int
+	OnHand   int32
+}
+
+// Briefing builds the briefing for an agent; the operation must already be populated
+func (o *Operation) Briefing(gid GoogleID) (*Briefing, error) {
+	name, err := gid.IngressName()
+	if err != nil {
+		return nil, err
+	}
+
+	b := Briefing{
+		OpID:          o.ID,
+		OpName:        o.Name,
+		OpComment:     o.Comment,
+		ReferenceTime: o.ReferenceTime,
+		Agent:         gid,
+		AgentName:     name,
+	}
+
+	// used to describe dependencies on tasks which may not be assigned to this agent
+	described := make(map[TaskID]string)
+	for _, m := range o.Markers {
+		p, _ := o.getPortal(m.PortalID)
+		described[m.Task.ID] = fmt.Sprintf("%d: %s %s", m.Order, NewMarkerType(m.Type), p.Name)
+	}
+	for _, l := range o.Links {
+		from, _ := o.getPortal(l.From)
+		to, _ := o.getPortal(l.To)
+		described[l.Task.ID] = fmt.Sprintf("%d: %s → %s", l.Order, from.Name, to.Name)
+	}
+
+	onhand := make(map[PortalID]int32)
+	for _, k := range o.Keys {
+		if k.Gid == gid {
+			onhand[k.ID] += k.Onhand
+		}
+	}
+
+	required := make(map[PortalID]int)
+	for _, l := range o.Links {
+		if l.IsAssignedTo(gid) {
+			required[l.To]++
+		}
+	}
+
+	for _, m := range o.Markers {
+		if !m.IsAssignedTo(gid) {
+			continue
+		}
+		p, _ := o.getPortal(m.PortalID)
+		b.Steps = append(b.Steps, BriefingStep{
+			Order:     m.Order,
+			TaskID:    m.Task.ID,
+			Action:    NewMarkerType(m.Type),
+			Portal:    briefingPortal(p),
+			Comment:   m.Comment,
+			State:     m.State,
+			Zone:      m.Zone,
+			DependsOn: describeDepends(m.DependsOn, described),
+		})
+	}
+
+	for _, l := range o.Links {
+		if !l.IsAssignedTo(gid) {
+			continue
+		}
+		from, _ := o.getPortal(l.From)
+		to, _ := o.getPortal(l.To)
+		comment := l.Comment
+		if comment == "" {
+			comment = l.Desc
+		}
+		b.Steps = append(b.Steps, BriefingStep{
+			Order:        l.Order,
+			TaskID:       l.Task.ID,
+			IsLink:       true,
+			Action:       "link",
+			Portal:       briefingPortal(from),
+			To:           briefingPortal(to),
+			Comment:      comment,
+			State:        l.State,
+			Zone:         l.Zone,
+			DependsOn:    describeDepends(l.DependsOn, described),
+			KeysRequired: required[l.To],
+			KeysOnHand:   onhand[l.To],
+		})
+	}
+
+	sort.SliceStable(b.Steps, func(i, j int) bool { return b.Steps[i].Order < b.Steps[j].Order })
+
+	for portalID, count := range required {
+		p, _ := o.getPortal(portalID)
+		b.Keys = append(b.Keys, BriefingKey{
+			Portal:   briefingPortal(p),
+			Required: count,
+			OnHand:   onhand[portalID],
+		})
+	}
+	sort.Slice(b.Keys, func(i, j int) bool { return b.Keys[i].Portal.Name < b.Keys[j].Portal.Name })
+
+	return &b, nil
+}
+
+func briefingPortal(p Portal) BriefingPortal {
+	return BriefingPortal{
+		ID:       p.ID,
+		Name:     p.Name,
+		Lat:      p.Lat,
+		Lon:      p.Lon,
+		Comment:  p.Comment,
+		Hardness: p.Hardness,
+		MapURL:   fmt.Sprintf("https://maps.google.com/?q=%s,%s", p.Lat, p.Lon),
+		IntelURL: fmt.Sprintf("https://intel.ingress.com/intel?pll=%s,%s", p.Lat, p.Lon),
+	}
+}
+
+func describeDepends(depends []TaskID, described map[TaskID]string) []string {
+	var out []string
+	for _, d := range depends {
+		if s, ok := described[d]; ok {
+			out = append(out, s)
+			continue
+		}
+		out = append(out, string(d))
+	}
+	return out
+}
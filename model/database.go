@@ -4,10 +4,12 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"time"
 
 	// need a comment here to make lint happy
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/wasabee-project/Wasabee-Server/log"
+	"github.com/wasabee-project/Wasabee-Server/messaging"
 )
 
 // db is the private global used by all relevant functions to interact with the database
@@ -33,6 +35,9 @@ func Connect(ctx context.Context, uri string) error {
 	setupTables(ctx)
 	upgradeTables(ctx)
 	optimizeTables(ctx)
+
+	messaging.RegisterFilter(notifyFilter)
+	messaging.RegisterPermit(canSendTo)
 	return nil
 }
 
@@ -50,27 +55,47 @@ var tabledefs = []struct {
 	creation  string
 }{
 	// agent must come first, team must come second, operation must come third, task fourth, the rest can be in alphabetical order
-	{"agent", `CREATE TABLE agent (gid char(21) NOT NULL, OneTimeToken varchar(64) NOT NULL DEFAULT "", RISC tinyint(1) NOT NULL DEFAULT 0, intelname varchar(16) DEFAULT NULL, intelfaction tinyint(1) NOT NULL DEFAULT -1, communityname varchar(16) DEFAULT NULL, picurl text DEFAULT NULL, PRIMARY KEY (gid), UNIQUE KEY OneTimeToken (OneTimeToken), UNIQUE KEY communityname (communityname)) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`},
-	{"team", `CREATE TABLE team (teamID varchar(64) NOT NULL, owner char(21) NOT NULL, name varchar(64) DEFAULT NULL, rockskey varchar(32) DEFAULT NULL, rockscomm varchar(32) DEFAULT NULL, joinLinkToken varchar(64) DEFAULT NULL, vteam int(11) unsigned DEFAULT 0, vrole int(11) unsigned DEFAULT 0, PRIMARY KEY (teamID), KEY fk_team_owner (owner), CONSTRAINT fk_team_owner FOREIGN KEY (owner) REFERENCES agent (gid) ON DELETE CASCADE) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`},
+	{"agent", `CREATE TABLE agent (gid char(21) NOT NULL, OneTimeToken varchar(64) NOT NULL DEFAULT "", RISC tinyint(1) NOT NULL DEFAULT 0, lockedby char(21) DEFAULT NULL, intelname varchar(16) DEFAULT NULL, intelfaction tinyint(1) NOT NULL DEFAULT -1, communityname varchar(16) DEFAULT NULL, picurl text DEFAULT NULL, dmteamonly tinyint(1) NOT NULL DEFAULT 0, PRIMARY KEY (gid), UNIQUE KEY OneTimeToken (OneTimeToken), UNIQUE KEY communityname (communityname)) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`},
+	{"team", `CREATE TABLE team (teamID varchar(64) NOT NULL, owner char(21) NOT NULL, name varchar(64) DEFAULT NULL, rockskey varchar(32) DEFAULT NULL, rockscomm varchar(32) DEFAULT NULL, joinLinkToken varchar(64) DEFAULT NULL, vteam int(11) unsigned DEFAULT 0, vrole int(11) unsigned DEFAULT 0, parent varchar(64) DEFAULT NULL, trackdays int(11) NOT NULL DEFAULT 0, locprecision varchar(8) NOT NULL DEFAULT 'exact', locstart char(5) DEFAULT NULL, locend char(5) DEFAULT NULL, locop char(40) DEFAULT NULL, PRIMARY KEY (teamID), KEY fk_team_owner (owner), CONSTRAINT fk_team_owner FOREIGN KEY (owner) REFERENCES agent (gid) ON DELETE CASCADE, KEY fk_team_parent (parent), CONSTRAINT fk_team_parent FOREIGN KEY (parent) REFERENCES team (teamID) ON DELETE SET NULL) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`},
 	{"operation", `CREATE TABLE operation (ID char(40) NOT NULL, name varchar(128) NOT NULL DEFAULT 'new op', gid char(21) NOT NULL, color varchar(16) NOT NULL DEFAULT 'purple', modified timestamp NOT NULL DEFAULT current_timestamp(), comment text DEFAULT NULL, referencetime timestamp NOT NULL DEFAULT current_timestamp(), lasteditid char(40) NOT NULL DEFAULT 'unset', PRIMARY KEY (ID), KEY gid (gid), CONSTRAINT fk_operation_agent FOREIGN KEY (gid) REFERENCES agent (gid) ON DELETE CASCADE) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`},
-	{"task", `CREATE TABLE task(ID char(40) NOT NULL, opID char(40) NOT NULL, comment text DEFAULT NULL, taskorder int(11) NOT NULL DEFAULT 0, state enum('pending','assigned','acknowledged','completed') NOT NULL DEFAULT 'pending', zone tinyint(4) NOT NULL DEFAULT 1, delta int(11) NOT NULL DEFAULT 0, PRIMARY KEY (ID,opID), KEY fk_operation_id_task (opID), CONSTRAINT fk_operation_id_task FOREIGN KEY (opID) REFERENCES operation (ID) ON DELETE CASCADE) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`},
+	{"task", `CREATE TABLE task(ID char(40) NOT NULL, opID char(40) NOT NULL, comment text DEFAULT NULL, taskorder int(11) NOT NULL DEFAULT 0, state enum('pending','assigned','acknowledged','completed') NOT NULL DEFAULT 'pending', zone tinyint(4) NOT NULL DEFAULT 1, delta int(11) NOT NULL DEFAULT 0, phase char(40) DEFAULT NULL, PRIMARY KEY (ID,opID), KEY fk_operation_id_task (opID), CONSTRAINT fk_operation_id_task FOREIGN KEY (opID) REFERENCES operation (ID) ON DELETE CASCADE) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`},
 
-	{"agentteams", `CREATE TABLE agentteams (teamID varchar(64) NOT NULL, gid char(21) NOT NULL, shareLoc tinyint(4) NOT NULL DEFAULT 0, shareWD tinyint(4) NOT NULL DEFAULT 0, loadWD tinyint(4) NOT NULL DEFAULT 0, comment varchar(32), PRIMARY KEY (teamID,gid), KEY gidkey (gid), CONSTRAINT fk_agent_teams FOREIGN KEY (gid) REFERENCES agent (gid) ON DELETE CASCADE, CONSTRAINT fk_t_teams FOREIGN KEY (teamID) REFERENCES team (teamID) ON DELETE CASCADE) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`},
+	{"adminaudit", `CREATE TABLE adminaudit (ID bigint(20) NOT NULL AUTO_INCREMENT, actor char(21) NOT NULL, action varchar(32) NOT NULL, target varchar(128) DEFAULT NULL, detail varchar(255) DEFAULT NULL, ts timestamp NOT NULL DEFAULT current_timestamp(), PRIMARY KEY (ID)) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`},
+	{"agentblock", `CREATE TABLE agentblock (gid char(21) NOT NULL, blocked char(21) NOT NULL, created timestamp NOT NULL DEFAULT current_timestamp(), PRIMARY KEY (gid,blocked), KEY blocked (blocked), CONSTRAINT fk_agentblock_agent FOREIGN KEY (gid) REFERENCES agent (gid) ON DELETE CASCADE, CONSTRAINT fk_agentblock_blocked FOREIGN KEY (blocked) REFERENCES agent (gid) ON DELETE CASCADE) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`},
+	{"agentmerge", `CREATE TABLE agentmerge (ID char(40) NOT NULL, fromgid char(21) NOT NULL, intogid char(21) NOT NULL, requested timestamp NOT NULL DEFAULT current_timestamp(), PRIMARY KEY (ID), UNIQUE KEY from_into (fromgid,intogid), KEY intogid (intogid), CONSTRAINT fk_agentmerge_from FOREIGN KEY (fromgid) REFERENCES agent (gid) ON DELETE CASCADE, CONSTRAINT fk_agentmerge_into FOREIGN KEY (intogid) REFERENCES agent (gid) ON DELETE CASCADE) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`},
+	{"agentteams", `CREATE TABLE agentteams (teamID varchar(64) NOT NULL, gid char(21) NOT NULL, shareLoc tinyint(4) NOT NULL DEFAULT 0, shareWD tinyint(4) NOT NULL DEFAULT 0, loadWD tinyint(4) NOT NULL DEFAULT 0, comment varchar(32), role enum('owner','admin','member') NOT NULL DEFAULT 'member', locprecision varchar(8) NOT NULL DEFAULT 'exact', locstart char(5) DEFAULT NULL, locend char(5) DEFAULT NULL, locop char(40) DEFAULT NULL, trackloc tinyint(1) NOT NULL DEFAULT 0, PRIMARY KEY (teamID,gid), KEY gidkey (gid), CONSTRAINT fk_agent_teams FOREIGN KEY (gid) REFERENCES agent (gid) ON DELETE CASCADE, CONSTRAINT fk_t_teams FOREIGN KEY (teamID) REFERENCES team (teamID) ON DELETE CASCADE) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`},
+	{"apitoken", `CREATE TABLE apitoken (ID char(40) NOT NULL, gid char(21) NOT NULL, name varchar(64) NOT NULL, hash char(64) NOT NULL, scopes varchar(128) NOT NULL DEFAULT '', ops text NOT NULL, teams text NOT NULL, created timestamp NOT NULL DEFAULT current_timestamp(), lastused timestamp NULL DEFAULT NULL, expires timestamp NULL DEFAULT NULL, PRIMARY KEY (ID), UNIQUE KEY hash (hash), KEY gid (gid), CONSTRAINT fk_apitoken_agent FOREIGN KEY (gid) REFERENCES agent (gid) ON DELETE CASCADE) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`},
 	{"assignments", `CREATE TABLE assignments (opID char(40) NOT NULL, taskID char(40) NOT NULL, gid char(21) NOT NULL, KEY opID (opID), KEY gid (gid), CONSTRAINT fk_assignments_gid FOREIGN KEY (gid) REFERENCES agent (gid) ON DELETE CASCADE, CONSTRAINT fk_assignments_opid FOREIGN KEY (opID) REFERENCES operation (ID) ON DELETE CASCADE, KEY taskID (taskID,opID), CONSTRAINT fk_assignments_taskid FOREIGN KEY (taskID,opID) REFERENCES task (ID, opID) ON DELETE CASCADE) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`},
 	{"defensivekeys", `CREATE TABLE defensivekeys (gid char(21) NOT NULL, portalID varchar(41) NOT NULL, capID varchar(16) DEFAULT NULL, count int(3) NOT NULL DEFAULT 0, name varchar(128) DEFAULT NULL, loc point DEFAULT NULL, PRIMARY KEY (portalID,gid), KEY fk_dk_gid (gid), CONSTRAINT fk_dk_gid FOREIGN KEY (gid) REFERENCES agent (gid) ON DELETE CASCADE) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`},
 	{"deletedops", `CREATE TABLE deletedops (opID char(40) NOT NULL, deletedate timestamp NOT NULL DEFAULT current_timestamp(), gid char(21) DEFAULT NULL, PRIMARY KEY (opID)) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`},
 	{"depends", `CREATE TABLE depends (opID char(40) NOT NULL, taskID char(40) NOT NULL, dependsOn char(40) DEFAULT NULL, KEY fk_depends_opID (opID), PRIMARY KEY key_optask (opID,taskID), CONSTRAINT fk_depends_opID FOREIGN KEY (opID) REFERENCES operation (ID) ON DELETE CASCADE, CONSTRAINT fk_depends_pk FOREIGN KEY (taskID, opID) REFERENCES task (ID, opID) ON DELETE CASCADE) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`},
 	{"firebase", `CREATE TABLE firebase (gid char(21) NOT NULL, token varchar(256) NOT NULL, KEY fk_gid (gid), CONSTRAINT fk_gid FOREIGN KEY (gid) REFERENCES agent (gid) ON DELETE CASCADE) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`},
 
+	{"geofencestate", `CREATE TABLE geofencestate (opID char(40) NOT NULL, gid char(21) NOT NULL, zone tinyint(4) NOT NULL DEFAULT 0, task char(40) DEFAULT NULL, PRIMARY KEY (opID,gid), KEY gid (gid), CONSTRAINT fk_geofencestate_op FOREIGN KEY (opID) REFERENCES operation (ID) ON DELETE CASCADE, CONSTRAINT fk_geofencestate_gid FOREIGN KEY (gid) REFERENCES agent (gid) ON DELETE CASCADE) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`},
+	{"identity", `CREATE TABLE identity (provider varchar(64) NOT NULL, subject varchar(255) NOT NULL, gid char(21) NOT NULL, name varchar(128) DEFAULT NULL, created timestamp NOT NULL DEFAULT current_timestamp(), PRIMARY KEY (provider,subject), KEY gid (gid), CONSTRAINT fk_identity_agent FOREIGN KEY (gid) REFERENCES agent (gid) ON DELETE CASCADE) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`},
 	{"link", `CREATE TABLE link (ID char(40) NOT NULL, opID char(40) NOT NULL, fromPortalID varchar(41) NOT NULL, toPortalID varchar(41) NOT NULL, color varchar(16) NOT NULL DEFAULT 'main', mu bigint(20) unsigned NOT NULL DEFAULT 0, PRIMARY KEY (ID,opID), KEY fk_operation_id_link (opID), KEY fk_task_link (ID) , CONSTRAINT fk_operation_id_link FOREIGN KEY (opID) REFERENCES operation (ID) ON DELETE CASCADE, CONSTRAINT fk_task_link FOREIGN KEY (ID) REFERENCES task (ID) ON DELETE CASCADE) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`},
 	{"locations", `CREATE TABLE locations (gid char(21) NOT NULL, upTime timestamp NOT NULL DEFAULT current_timestamp(), loc point NOT NULL, PRIMARY KEY (gid), CONSTRAINT fk_location_agent FOREIGN KEY (gid) REFERENCES agent (gid) ON DELETE CASCADE) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`},
+	{"locationtrack", `CREATE TABLE locationtrack (ID bigint(20) NOT NULL AUTO_INCREMENT, teamID varchar(64) NOT NULL, gid char(21) NOT NULL, lat double NOT NULL, lon double NOT NULL, ts timestamp NOT NULL DEFAULT current_timestamp(), PRIMARY KEY (ID), KEY team_ts (teamID,ts), KEY gid (gid), CONSTRAINT fk_locationtrack_team FOREIGN KEY (teamID) REFERENCES team (teamID) ON DELETE CASCADE, CONSTRAINT fk_locationtrack_gid FOREIGN KEY (gid) REFERENCES agent (gid) ON DELETE CASCADE) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`},
 	{"marker", `CREATE TABLE marker (ID char(40) NOT NULL, opID char(40) NOT NULL, portalID varchar(41) NOT NULL, type varchar(24) NOT NULL, PRIMARY KEY (ID,opID), KEY fk_operation_marker (opID), CONSTRAINT fk_operation_marker FOREIGN KEY (opID) REFERENCES operation (ID) ON DELETE CASCADE, KEY fk_task_marker (ID), CONSTRAINT fk_task_marker FOREIGN KEY (ID) REFERENCES task (ID) ON DELETE CASCADE) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`},
 	{"markerattributes", `CREATE TABLE markerattributes (ID char(40) NOT NULL, opID char(40) NOT NULL, markerID char(40) NOT NULL, name varchar(32) NOT NULL DEFAULT 'unset', value text DEFAULT NULL, PRIMARY KEY (ID,opID), KEY fk_makerattr_opID (opID), KEY fk_marker_attr (markerID), CONSTRAINT fk_markerattr_opID FOREIGN KEY (opID) REFERENCES operation (ID) ON DELETE CASCADE, KEY fk_marker_markerattr (ID), CONSTRAINT fk_marker_markerattr FOREIGN KEY (ID) REFERENCES marker (ID) ON DELETE CASCADE) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`},
-	{"messagelog", `CREATE TABLE messagelog (timestamp timestamp NOT NULL DEFAULT current_timestamp(), gid char(21) NOT NULL, message text NOT NULL) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`},
+	{"messagelog", `CREATE TABLE messagelog (ID bigint(20) NOT NULL AUTO_INCREMENT, timestamp timestamp NOT NULL DEFAULT current_timestamp(), sender char(21) DEFAULT NULL, gid char(21) NOT NULL, message text NOT NULL, readat timestamp NULL DEFAULT NULL, PRIMARY KEY (ID), KEY gid (gid), KEY sender (sender)) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`},
+	{"notifybus", `CREATE TABLE notifybus (gid char(21) NOT NULL, bus varchar(32) NOT NULL, events varchar(128) NOT NULL DEFAULT '', PRIMARY KEY (gid,bus), CONSTRAINT fk_notifybus_agent FOREIGN KEY (gid) REFERENCES agent (gid) ON DELETE CASCADE) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`},
+	{"notifyprefs", `CREATE TABLE notifyprefs (gid char(21) NOT NULL, quietstart char(5) DEFAULT NULL, quietend char(5) DEFAULT NULL, assignedonly tinyint(1) NOT NULL DEFAULT 0, PRIMARY KEY (gid), CONSTRAINT fk_notifyprefs_agent FOREIGN KEY (gid) REFERENCES agent (gid) ON DELETE CASCADE) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`},
+	{"opgeofence", `CREATE TABLE opgeofence (opID char(40) NOT NULL, radius int(11) NOT NULL DEFAULT 0, zones tinyint(1) NOT NULL DEFAULT 0, notifylead tinyint(1) NOT NULL DEFAULT 1, PRIMARY KEY (opID), CONSTRAINT fk_opgeofence_op FOREIGN KEY (opID) REFERENCES operation (ID) ON DELETE CASCADE) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`},
 	{"opkeys", `CREATE TABLE opkeys (opID char(40) NOT NULL, portalID varchar(41) NOT NULL, gid char(21) NOT NULL, onhand int(11) unsigned NOT NULL DEFAULT 0, capsule varchar(16) DEFAULT NULL, UNIQUE KEY key_unique (opID,portalID,gid,capsule), KEY fk_operation_id_keys (opID), CONSTRAINT fk_operation_id_keys FOREIGN KEY (opID) REFERENCES operation (ID) ON DELETE CASCADE, KEY fk_agent_keys (gid), CONSTRAINT fk_agent_keys FOREIGN KEY (gid) REFERENCES agent (gid) ON DELETE CASCADE) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`},
-	{"permissions", `CREATE TABLE permissions (teamID varchar(64) NOT NULL, opID char(40) NOT NULL, permission enum('read','write','assignedonly') NOT NULL DEFAULT 'read', zone tinyint(4) NOT NULL DEFAULT 0, KEY opID (opID), KEY teamID (teamID), CONSTRAINT fk_ops_teamID FOREIGN KEY (opID) REFERENCES operation (ID) ON DELETE CASCADE, CONSTRAINT fk_teamIDs_op FOREIGN KEY (teamID) REFERENCES team (teamID) ON DELETE CASCADE) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`},
+	{"opphase", `CREATE TABLE opphase (ID char(40) NOT NULL, opID char(40) NOT NULL, name varchar(64) NOT NULL, phaseorder int(11) NOT NULL DEFAULT 0, state enum('pending','started','finished') NOT NULL DEFAULT 'pending', PRIMARY KEY (ID,opID), KEY fk_opphase_op (opID), CONSTRAINT fk_opphase_op FOREIGN KEY (opID) REFERENCES operation (ID) ON DELETE CASCADE) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`},
+	{"opshare", `CREATE TABLE opshare (token char(40) NOT NULL, opID char(40) NOT NULL, gid char(21) NOT NULL, zone tinyint(4) NOT NULL DEFAULT 0, expires timestamp NULL DEFAULT NULL, redact tinyint(1) NOT NULL DEFAULT 0, created timestamp NOT NULL DEFAULT current_timestamp(), PRIMARY KEY (token), KEY fk_opshare_op (opID), CONSTRAINT fk_opshare_op FOREIGN KEY (opID) REFERENCES operation (ID) ON DELETE CASCADE, CONSTRAINT fk_opshare_gid FOREIGN KEY (gid) REFERENCES agent (gid) ON DELETE CASCADE) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`},
+	{"permissions", `CREATE TABLE permissions (teamID varchar(64) NOT NULL, opID char(40) NOT NULL, permission enum('read','write','assignedonly') NOT NULL DEFAULT 'read', zone tinyint(4) NOT NULL DEFAULT 0, notbefore timestamp NULL DEFAULT NULL, expires timestamp NULL DEFAULT NULL, announced tinyint(1) NOT NULL DEFAULT 1, KEY opID (opID), KEY teamID (teamID), CONSTRAINT fk_ops_teamID FOREIGN KEY (opID) REFERENCES operation (ID) ON DELETE CASCADE, CONSTRAINT fk_teamIDs_op FOREIGN KEY (teamID) REFERENCES team (teamID) ON DELETE CASCADE) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`},
 	{"portal", `CREATE TABLE portal (ID varchar(41) NOT NULL, opID char(40) NOT NULL, name varchar(128) NOT NULL, loc point NOT NULL, comment text DEFAULT NULL, hardness varchar(64) DEFAULT NULL, PRIMARY KEY (ID,opID), KEY fk_operation_id (opID), CONSTRAINT FOREIGN KEY fk_operation_id (opID) REFERENCES operation (ID) ON DELETE CASCADE) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`},
+	{"presence", `CREATE TABLE presence (gid char(21) NOT NULL, status varchar(16) DEFAULT NULL, note varchar(255) DEFAULT NULL, until datetime DEFAULT NULL, lastseen datetime DEFAULT NULL, PRIMARY KEY (gid), CONSTRAINT fk_presence_agent FOREIGN KEY (gid) REFERENCES agent (gid) ON DELETE CASCADE) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`},
+	{"refreshtoken", `CREATE TABLE refreshtoken (ID char(64) NOT NULL, family char(40) NOT NULL, gid char(21) NOT NULL, jwtid varchar(64) DEFAULT NULL, jwtexpires timestamp NULL DEFAULT NULL, created timestamp NOT NULL DEFAULT current_timestamp(), expires timestamp NOT NULL DEFAULT current_timestamp(), used timestamp NULL DEFAULT NULL, revoked tinyint(1) NOT NULL DEFAULT 0, PRIMARY KEY (ID), KEY family (family), KEY gid (gid), CONSTRAINT fk_refreshtoken_agent FOREIGN KEY (gid) REFERENCES agent (gid) ON DELETE CASCADE) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`},
+	{"revokedjwt", `CREATE TABLE revokedjwt (ID varchar(64) NOT NULL, gid char(21) DEFAULT NULL, expires timestamp NOT NULL DEFAULT current_timestamp(), revoked timestamp NOT NULL DEFAULT current_timestamp(), PRIMARY KEY (ID), KEY expires (expires)) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`},
 	{"rocks", `CREATE TABLE rocks (gid char(21) NOT NULL, tgid int(11) DEFAULT NULL, agent varchar(16) DEFAULT NULL, verified tinyint(4) NOT NULL DEFAULT 0, smurf tinyint(4) NOT NULL DEFAULT 0, fetched timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP, PRIMARY KEY (gid), CONSTRAINT fk_rocks_gid FOREIGN KEY (gid) REFERENCES agent (gid) ON DELETE CASCADE) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`},
+	{"session", `CREATE TABLE session (ID char(40) NOT NULL, gid char(21) NOT NULL, jwtid varchar(64) NOT NULL, useragent varchar(255) NOT NULL DEFAULT '', ip varchar(64) NOT NULL DEFAULT '', created timestamp NOT NULL DEFAULT current_timestamp(), lastseen timestamp NOT NULL DEFAULT current_timestamp(), expires timestamp NOT NULL DEFAULT current_timestamp(), PRIMARY KEY (ID), KEY gid (gid), KEY jwtid (jwtid), CONSTRAINT fk_session_agent FOREIGN KEY (gid) REFERENCES agent (gid) ON DELETE CASCADE) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`},
+	{"teamaudit", `CREATE TABLE teamaudit (ID bigint(20) NOT NULL AUTO_INCREMENT, teamID varchar(64) NOT NULL, actor char(21) DEFAULT NULL, action varchar(32) NOT NULL, target varchar(128) DEFAULT NULL, detail varchar(255) DEFAULT NULL, ts timestamp NOT NULL DEFAULT current_timestamp(), PRIMARY KEY (ID), KEY team_id (teamID,ID)) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`},
+	{"teaminvite", `CREATE TABLE teaminvite (token varchar(64) NOT NULL, teamID varchar(64) NOT NULL, name varchar(64) NOT NULL, gid char(21) NOT NULL, expires timestamp NULL DEFAULT NULL, maxuses int(11) NOT NULL DEFAULT 0, uses int(11) NOT NULL DEFAULT 0, approval tinyint(1) NOT NULL DEFAULT 0, created timestamp NOT NULL DEFAULT current_timestamp(), PRIMARY KEY (token), KEY fk_teaminvite_team (teamID), CONSTRAINT fk_teaminvite_team FOREIGN KEY (teamID) REFERENCES team (teamID) ON DELETE CASCADE, CONSTRAINT fk_teaminvite_gid FOREIGN KEY (gid) REFERENCES agent (gid) ON DELETE CASCADE) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`},
+	{"teamjoinrequest", `CREATE TABLE teamjoinrequest (ID char(40) NOT NULL, teamID varchar(64) NOT NULL, gid char(21) NOT NULL, invite varchar(64) NOT NULL, requested timestamp NOT NULL DEFAULT current_timestamp(), PRIMARY KEY (ID), UNIQUE KEY team_gid (teamID,gid), CONSTRAINT fk_joinrequest_team FOREIGN KEY (teamID) REFERENCES team (teamID) ON DELETE CASCADE, CONSTRAINT fk_joinrequest_gid FOREIGN KEY (gid) REFERENCES agent (gid) ON DELETE CASCADE) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`},
+	{"teamsync", `CREATE TABLE teamsync (ID bigint(20) NOT NULL AUTO_INCREMENT, teamID varchar(64) NOT NULL, source varchar(8) NOT NULL, started timestamp NOT NULL DEFAULT current_timestamp(), finished timestamp NULL DEFAULT NULL, added int(11) NOT NULL DEFAULT 0, removed int(11) NOT NULL DEFAULT 0, error varchar(255) DEFAULT NULL, PRIMARY KEY (ID), KEY team_id (teamID,ID), CONSTRAINT fk_teamsync_team FOREIGN KEY (teamID) REFERENCES team (teamID) ON DELETE CASCADE) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`},
 	{"telegram", `CREATE TABLE telegram (telegramID bigint(20) NOT NULL, telegramName varchar(32) NOT NULL, gid char(21) NOT NULL, verified tinyint(1) NOT NULL DEFAULT 0, authtoken varchar(32) DEFAULT NULL, PRIMARY KEY (telegramID), UNIQUE KEY gid (gid), CONSTRAINT fk_agent_telegram FOREIGN KEY (gid) REFERENCES agent (gid) ON DELETE CASCADE) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`},
 	{"telegramteam", `CREATE TABLE telegramteam (teamID varchar(64) NOT NULL, telegram bigint(20) NOT NULL, opID char(40) DEFAULT NULL, PRIMARY KEY (telegram), UNIQUE KEY (teamID), CONSTRAINT fk_tt_team FOREIGN KEY (teamID) REFERENCES team (teamID) ON DELETE CASCADE, KEY (opID), CONSTRAINT fk_tt_op FOREIGN KEY (opID) REFERENCES operation (ID) ON DELETE CASCADE) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`},
 	{"telegramchatmembers", `CREATE TABLE telegramchatmembers (agent bigint(20) NOT NULL, chat bigint(20) NOT NULL, PRIMARY KEY (agent,chat), KEY (chat), CONSTRAINT fk_tg_chat FOREIGN KEY (chat) REFERENCES telegramteam (telegram) ON DELETE CASCADE) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`},
@@ -136,7 +161,22 @@ func upgradeTables(ctx context.Context) {
 		test    string // a query that will fail if an upgrade is needed
 		upgrade string // the query to run to make the upgrade
 	}{
-		// none for now
+		{"SELECT COUNT(notbefore) FROM permissions", "ALTER TABLE permissions ADD notbefore timestamp NULL DEFAULT NULL, ADD expires timestamp NULL DEFAULT NULL, ADD announced tinyint(1) NOT NULL DEFAULT 1"},
+		{"SELECT COUNT(phase) FROM task", "ALTER TABLE task ADD phase char(40) DEFAULT NULL"},
+		{"SELECT COUNT(role) FROM agentteams", "ALTER TABLE agentteams ADD role enum('owner','admin','member') NOT NULL DEFAULT 'member'"},
+		// owners of teams created before roles were recorded
+		{"SELECT 1 FROM DUAL WHERE NOT EXISTS (SELECT 1 FROM agentteams JOIN team ON team.teamID = agentteams.teamID AND team.owner = agentteams.gid WHERE agentteams.role <> 'owner')", "UPDATE agentteams JOIN team ON team.teamID = agentteams.teamID AND team.owner = agentteams.gid SET agentteams.role = 'owner' WHERE agentteams.role <> 'owner'"},
+		{"SELECT COUNT(parent) FROM team", "ALTER TABLE team ADD parent varchar(64) DEFAULT NULL, ADD KEY fk_team_parent (parent), ADD CONSTRAINT fk_team_parent FOREIGN KEY (parent) REFERENCES team (teamID) ON DELETE SET NULL"},
+		{"SELECT COUNT(trackdays) FROM team", "ALTER TABLE team ADD trackdays int(11) NOT NULL DEFAULT 0"},
+		{"SELECT COUNT(locprecision) FROM team", "ALTER TABLE team ADD locprecision varchar(8) NOT NULL DEFAULT 'exact', ADD locstart char(5) DEFAULT NULL, ADD locend char(5) DEFAULT NULL, ADD locop char(40) DEFAULT NULL"},
+		{"SELECT COUNT(locprecision) FROM agentteams", "ALTER TABLE agentteams ADD locprecision varchar(8) NOT NULL DEFAULT 'exact', ADD locstart char(5) DEFAULT NULL, ADD locend char(5) DEFAULT NULL, ADD locop char(40) DEFAULT NULL"},
+		{"SELECT COUNT(ID) FROM messagelog", "ALTER TABLE messagelog ADD ID bigint(20) NOT NULL AUTO_INCREMENT PRIMARY KEY FIRST, ADD sender char(21) DEFAULT NULL AFTER timestamp, ADD readat timestamp NULL DEFAULT NULL, ADD KEY gid (gid), ADD KEY sender (sender)"},
+		{"SELECT COUNT(dmteamonly) FROM agent", "ALTER TABLE agent ADD dmteamonly tinyint(1) NOT NULL DEFAULT 0"},
+		{"SELECT COUNT(trackloc) FROM agentteams", "ALTER TABLE agentteams ADD trackloc tinyint(1) NOT NULL DEFAULT 0"},
+		{"SELECT 1 FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'identity' AND COLUMN_NAME = 'provider' AND CHARACTER_MAXIMUM_LENGTH >= 64", "ALTER TABLE identity MODIFY provider varchar(64) NOT NULL"},
+		{"SELECT COUNT(lockedby) FROM agent", "ALTER TABLE agent ADD lockedby char(21) DEFAULT NULL AFTER RISC"},
+		// refresh token chains started before sessions were recorded
+		{"SELECT 1 FROM DUAL WHERE NOT EXISTS (SELECT 1 FROM refreshtoken WHERE used IS NULL AND revoked = 0 AND expires > UTC_TIMESTAMP() AND family NOT IN (SELECT ID FROM session))", "INSERT IGNORE INTO session (ID, gid, jwtid, created, lastseen, expires) SELECT r.family, r.gid, IFNULL(r.jwtid, ''), (SELECT MIN(f.created) FROM refreshtoken f WHERE f.family = r.family), r.created, r.expires FROM refreshtoken r WHERE r.used IS NULL AND r.revoked = 0 AND r.expires > UTC_TIMESTAMP() AND r.family NOT IN (SELECT ID FROM session)"},
 	}
 
 	tx, err := db.BeginTx(ctx, nil)
@@ -195,6 +235,30 @@ func optimizeTables(ctx context.Context) {
 	}
 }
 
+// makeNullTime is used for optional timestamps, the zero time is stored as NULL
+func makeNullTime(t time.Time) sql.NullString {
+	if t.IsZero() {
+		return sql.NullString{}
+	}
+	return sql.NullString{
+		String: t.UTC().Format("2006-01-02 15:04:05"),
+		Valid:  true,
+	}
+}
+
+// sqlTimeToRFC1123 converts an optional SQL timestamp into the format the clients expect
+func sqlTimeToRFC1123(in sql.NullString) string {
+	if !in.Valid {
+		return ""
+	}
+	t, err := time.ParseInLocation("2006-01-02 15:04:05", in.String, time.UTC)
+	if err != nil {
+		log.Error(err)
+		return ""
+	}
+	return t.Format(time.RFC1123)
+}
+
 // makeNullString is used for values that may & might be inserted/updated as NULL in the database
 func makeNullString(in interface{}) sql.NullString {
 	var s string
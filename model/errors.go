@@ -2,25 +2,66 @@ package model
 
 // These error values are error strings visible to users, they need to be migrated to the translation system
 const (
-	ErrAgentNotFound        = "agent not registered with this wasabee server"
-	ErrEmptyAgent           = "empty agent request"
-	ErrGetLinkUnpopulated   = "attempt to use GetLink on unpopulated *Operation"
-	ErrGetMarkerUnpopulated = "attempt to use GetMarker on unpopulated *Operation"
-	ErrInvalidOTT           = "invalid OneTimeToken"
-	ErrKeyUnableToRemove    = "unable to remove key count for portal"
-	ErrKeyUnableToRecord    = "unable to record keys, ensure the op on the server is up-to-date"
-	ErrLinkNotFound         = "link not found"
-	ErrMarkerNotFound       = "markernot found"
-	ErrOpNotFound           = "operation not found"
-	ErrMultipleIntelname    = "multiple intelname matches found, not using intelname results"
-	ErrMultipleRocks        = "multiple rocks matches found, not using rocks results"
-	ErrMultipleV            = "multiple V matches found, not using V results"
-	ErrNameGenFailed        = "name generation failed"
-	ErrNotOnTeamAddPerm     = "you must be on a team to add it as a permission"
-	ErrNotOpOwner           = "not owner of op"
-	ErrPortalNotFound       = "portal not found"
-	ErrTaskNotFound         = "task not found"
-	ErrUnknownGID           = "unknown GoogleID"
-	ErrUnknownPermType      = "unknown permission type"
-	ErrUnknownUser          = "unknown user"
+	ErrAPITokenInvalid       = "api tokens need a name, at least one known scope, and an expiration in the future if any"
+	ErrAPITokenNotFound      = "api token not found or expired"
+	ErrAgentNotFound         = "agent not registered with this wasabee server"
+	ErrAgentNotOnTeam        = "agent is not on the team"
+	ErrBlockNotFound         = "agent is not blocked"
+	ErrBlockSelf             = "you cannot block yourself"
+	ErrCannotChangeOwnerRole = "the owner's role can only be changed by transferring ownership"
+	ErrEmptyAgent            = "empty agent request"
+	ErrEmptyMessage          = "message must not be empty"
+	ErrEmptyPhaseName        = "phase name must not be empty"
+	ErrGeofenceRadius        = "geofence radius must be between 0 and 5000 meters"
+	ErrGetLinkUnpopulated    = "attempt to use GetLink on unpopulated *Operation"
+	ErrGetMarkerUnpopulated  = "attempt to use GetMarker on unpopulated *Operation"
+	ErrIdentityIsAgent       = "that account already has an agent on this server, request a merge instead"
+	ErrIdentityLinked        = "that identity is already linked to an agent"
+	ErrIdentityNotFound      = "identity not linked to this agent"
+	ErrIdentityProvider      = "only google, apple and OpenID Connect identities can be linked here"
+	ErrInvalidOTT            = "invalid OneTimeToken"
+	ErrInvalidTeamRole       = "invalid team role"
+	ErrInviteExpiresInPast   = "invite expiration must be in the future"
+	ErrInviteNotFound        = "invite not found, expired or used up"
+	ErrJoinRequestNotFound   = "join request not found"
+	ErrKeyUnableToRemove     = "unable to remove key count for portal"
+	ErrKeyUnableToRecord     = "unable to record keys, ensure the op on the server is up-to-date"
+	ErrLinkNotFound          = "link not found"
+	ErrLocationPolicyInvalid = "location policy needs a precision of exact, 100m or 1km, and both or neither of start and end as HH:MM"
+	ErrLocationPolicyOp      = "the location policy's operation is not shared with you"
+	ErrMarkerNotFound        = "markernot found"
+	ErrMergeInvalid          = "agents cannot be merged"
+	ErrMergeNotFound         = "merge request not found"
+	ErrMessageNotFound       = "message not found"
+	ErrOpNotFound            = "operation not found"
+	ErrPermExpiresInPast     = "permission expiration must be in the future"
+	ErrPermWindowInvalid     = "permission must expire after it takes effect"
+	ErrMultipleIntelname     = "multiple intelname matches found, not using intelname results"
+	ErrMultipleRocks         = "multiple rocks matches found, not using rocks results"
+	ErrMultipleV             = "multiple V matches found, not using V results"
+	ErrNameGenFailed         = "name generation failed"
+	ErrNotOnTeamAddPerm      = "you must be on a team to add it as a permission"
+	ErrNotOpOwner            = "not owner of op"
+	ErrNotTeamAdmin          = "only team owners and admins can do that"
+	ErrNotifyPrefsInvalid    = "notification preferences need known event classes, and both or neither of quietstart and quietend as HH:MM"
+	ErrPhaseAlreadyStarted   = "phase has already been started"
+	ErrPhaseNotFound         = "phase not found"
+	ErrPhaseNotOpen          = "the task's phase has not started"
+	ErrPhaseNotStarted       = "phase has not been started"
+	ErrPhaseOutOfOrder       = "earlier phases must be started first"
+	ErrPortalNotFound        = "portal not found"
+	ErrPresenceInvalid       = "presence status must be available, busy, offline or away, and away must end in the future"
+	ErrRefreshTokenInvalid   = "refresh token invalid, expired or revoked; log in again"
+	ErrRefreshTokenReused    = "refresh token already used; every session in its chain has been logged out"
+	ErrRISCLocked            = "the account was locked by Google RISC; unlock with confirm=risc to override it"
+	ErrSessionNotFound       = "session not found"
+	ErrShareExpiresInPast    = "share expiration must be in the future"
+	ErrShareNotFound         = "share link not found or expired"
+	ErrTaskNotFound          = "task not found"
+	ErrTeamCycle             = "a team cannot be placed below itself or one of its sub-teams"
+	ErrTeamNotFound          = "team not found"
+	ErrTrackDaysInvalid      = "location history retention must be between 0 and 90 days"
+	ErrUnknownGID            = "unknown GoogleID"
+	ErrUnknownPermType       = "unknown permission type"
+	ErrUnknownUser           = "unknown user"
 )
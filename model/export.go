@@ -0,0 +1,121 @@
+package model
+
+import (
+	"database/sql"
+
+	"github.com/wasabee-project/Wasabee-Server/log"
+)
+
+// ExportRecords are rows from one table, column name to value
+type ExportRecords []map[string]interface{}
+
+// AgentExport is everything the server holds about an agent
+type AgentExport struct {
+	Records    map[string]ExportRecords // keyed by section name
+	Operations []*Operation             // ops owned by the agent, in full
+}
+
+// the sections of an export; credentials (one-time tokens, V API keys, telegram auth tokens, token hashes) are left out
+var exportQueries = []struct {
+	section string
+	query   string
+}{
+	{"agent", "SELECT gid, intelname, intelfaction, communityname, picurl, RISC, dmteamonly FROM agent WHERE gid = ?"},
+	{"v", "SELECT gid, enlid, vlevel, vpoints, agent, level, quarantine, active, blacklisted, verified, flagged, banned, cellid, telegram, telegramID, startlat, startlon, distance, fetched FROM v WHERE gid = ?"},
+	{"rocks", "SELECT gid, tgid, agent, verified, smurf, fetched FROM rocks WHERE gid = ?"},
+	{"telegram", "SELECT telegramID, telegramName, gid, verified FROM telegram WHERE gid = ?"},
+	{"identities", "SELECT provider, subject, name, created FROM identity WHERE gid = ?"},
+	{"teams", "SELECT agentteams.teamID, team.name, IF(team.owner = agentteams.gid, 'owner', agentteams.role) AS role, agentteams.comment, agentteams.shareLoc, agentteams.shareWD, agentteams.loadWD, agentteams.locprecision, agentteams.locstart, agentteams.locend, agentteams.locop, agentteams.trackloc FROM agentteams JOIN team ON agentteams.teamID = team.teamID WHERE agentteams.gid = ?"},
+	{"teamsowned", "SELECT teamID, name, rockscomm, vteam, vrole, parent, trackdays FROM team WHERE owner = ?"},
+	{"operations", "SELECT ID, name, color, modified, comment, referencetime FROM operation WHERE gid = ?"},
+	{"assignments", "SELECT assignments.opID, operation.name AS opname, assignments.taskID, task.state FROM assignments JOIN operation ON assignments.opID = operation.ID JOIN task ON assignments.taskID = task.ID AND assignments.opID = task.opID WHERE assignments.gid = ?"},
+	{"opkeys", "SELECT opID, portalID, onhand, capsule FROM opkeys WHERE gid = ?"},
+	{"defensivekeys", "SELECT portalID, capID, count, name, Y(loc) AS lat, X(loc) AS lon FROM defensivekeys WHERE gid = ?"},
+	{"firebase", "SELECT token FROM firebase WHERE gid = ?"},
+	{"location", "SELECT Y(loc) AS lat, X(loc) AS lon, upTime FROM locations WHERE gid = ?"},
+	{"locationhistory", "SELECT teamID, lat, lon, ts FROM locationtrack WHERE gid = ? ORDER BY ts"},
+	{"notifyprefs", "SELECT quietstart, quietend, assignedonly FROM notifyprefs WHERE gid = ?"},
+	{"notifybus", "SELECT bus, events FROM notifybus WHERE gid = ?"},
+	{"presence", "SELECT status, note, until, lastseen FROM presence WHERE gid = ?"},
+	{"geofencestate", "SELECT opID, zone, task FROM geofencestate WHERE gid = ?"},
+	{"sessions", "SELECT ID, useragent, ip, created, lastseen, expires FROM session WHERE gid = ?"},
+	{"refreshtokens", "SELECT family, created, expires, used, revoked FROM refreshtoken WHERE gid = ?"},
+	{"apitokens", "SELECT ID, name, scopes, ops, teams, created, lastused, expires FROM apitoken WHERE gid = ?"},
+	{"blocks", "SELECT blocked, created FROM agentblock WHERE gid = ?"},
+	{"messages", "SELECT ID, timestamp, sender, gid AS recipient, message, readat FROM messagelog WHERE ? IN (gid, sender) ORDER BY ID"},
+	{"opshares", "SELECT opID, zone, expires, redact, created FROM opshare WHERE gid = ?"},
+	{"invites", "SELECT teamID, name, expires, maxuses, uses, approval, created FROM teaminvite WHERE gid = ?"},
+	{"joinrequests", "SELECT teamID, invite, requested FROM teamjoinrequest WHERE gid = ?"},
+	{"teamaudit", "SELECT teamID, actor, action, target, detail, ts FROM teamaudit WHERE ? IN (actor, target) ORDER BY ts"},
+}
+
+// Export gathers everything the server holds about the agent, for privacy requests
+func (gid GoogleID) Export() (*AgentExport, error) {
+	e := AgentExport{
+		Records:    make(map[string]ExportRecords),
+		Operations: make([]*Operation, 0),
+	}
+
+	for _, q := range exportQueries {
+		records, err := exportRows(q.query, gid)
+		if err != nil {
+			return nil, err
+		}
+		e.Records[q.section] = records
+	}
+
+	for _, o := range e.Records["operations"] {
+		id, ok := o["ID"].(string)
+		if !ok {
+			continue
+		}
+		op := Operation{ID: OperationID(id)}
+		if err := op.Populate(gid); err != nil {
+			log.Error(err)
+			continue
+		}
+		e.Operations = append(e.Operations, &op)
+	}
+	return &e, nil
+}
+
+// exportRows reads every row of the query into column name to value maps; NULL becomes nil
+func exportRows(query string, args ...interface{}) (ExportRecords, error) {
+	records := make(ExportRecords, 0)
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		log.Error(err)
+		return records, err
+	}
+	defer rows.Close()
+
+	cols, err := rows.Columns()
+	if err != nil {
+		log.Error(err)
+		return records, err
+	}
+
+	for rows.Next() {
+		values := make([]sql.NullString, len(cols))
+		dest := make([]interface{}, len(cols))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			log.Error(err)
+			continue
+		}
+
+		r := make(map[string]interface{}, len(cols))
+		for i, c := range cols {
+			if values[i].Valid {
+				r[c] = values[i].String
+			} else {
+				r[c] = nil
+			}
+		}
+		records = append(records, r)
+	}
+	return records, nil
+}
@@ -121,14 +121,41 @@ type TeamToken struct {
 }
 
 // FirebaserLocationTokens returns a list all tokens for the agents on the teams with which this agent is sharing location
+// teams whose location policy window is closed are skipped
 // instead of sending to the team topics, we do the fanout manually -- to avoid hitting the (small) fanout quota
 func (gid GoogleID) FirebaseLocationTokens() ([]TeamToken, error) {
 	var out []TeamToken
 
-	rows, err := db.Query("SELECT DISTINCT teamid, token FROM firebase JOIN agentteams ON firebase.gid = agentteams.gid WHERE agentteams.teamID IN (SELECT teamID FROM agentteams WHERE gid = ? AND shareLoc = 1)", gid)
-	if err != nil && err == sql.ErrNoRows {
-		return out, nil
+	teams, err := gid.sharingTeams()
+	if err != nil {
+		return out, err
+	}
+
+	for teamID := range teams {
+		rows, err := db.Query("SELECT DISTINCT token FROM firebase JOIN agentteams ON firebase.gid = agentteams.gid WHERE agentteams.teamID = ?", teamID)
+		if err != nil {
+			log.Error(err)
+			return out, err
+		}
+
+		for rows.Next() {
+			tt := TeamToken{TeamID: teamID}
+			if err := rows.Scan(&tt.Token); err != nil {
+				log.Error(err)
+				continue
+			}
+			out = append(out, tt)
+		}
+		rows.Close()
 	}
+	return out, nil
+}
+
+// FirebaseTokensByAgent returns the tokens of every agent on the team, by agent
+func (teamID TeamID) FirebaseTokensByAgent() (map[GoogleID][]string, error) {
+	out := make(map[GoogleID][]string)
+
+	rows, err := db.Query("SELECT firebase.gid, firebase.token FROM firebase JOIN agentteams ON firebase.gid = agentteams.gid WHERE agentteams.teamID = ?", teamID)
 	if err != nil {
 		log.Error(err)
 		return out, err
@@ -136,12 +163,13 @@ func (gid GoogleID) FirebaseLocationTokens() ([]TeamToken, error) {
 	defer rows.Close()
 
 	for rows.Next() {
-		var tt TeamToken
-		if err := rows.Scan(&tt.TeamID, &tt.Token); err != nil {
+		var gid GoogleID
+		var token string
+		if err := rows.Scan(&gid, &token); err != nil {
 			log.Error(err)
 			continue
 		}
-		out = append(out, tt)
+		out[gid] = append(out[gid], token)
 	}
 	return out, nil
 }
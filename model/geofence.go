@@ -0,0 +1,322 @@
+package model
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+
+	"github.com/wasabee-project/Wasabee-Server/log"
+	"github.com/wasabee-project/Wasabee-Server/messaging"
+)
+
+// Geofence holds an operation's location alert rules
+type Geofence struct {
+	OpID       OperationID `json:"opid"`
+	Radius     int         `json:"radius"`     // meters from the agent's next assigned portal to alert on arrival, 0 is off
+	Zones      bool        `json:"zones"`      // alert when an agent enters or leaves a zone
+	NotifyLead bool        `json:"notifylead"` // also alert the op owner
+}
+
+// MaxGeofenceRadius is the largest arrival radius, in meters
+const MaxGeofenceRadius = 5000
+
+const earthRadius = 6371000.0 // meters
+
+// Geofence returns the op's location alert rules, all off if none are set
+func (opID OperationID) Geofence() (*Geofence, error) {
+	g := Geofence{OpID: opID}
+
+	err := db.QueryRow("SELECT radius, zones, notifylead FROM opgeofence WHERE opID = ?", opID).Scan(&g.Radius, &g.Zones, &g.NotifyLead)
+	if err != nil && err != sql.ErrNoRows {
+		log.Error(err)
+		return &g, err
+	}
+	return &g, nil
+}
+
+// SetGeofence saves the op's location alert rules, turning everything off removes them
+// does not check op permissions -- caller should take care of authorization
+func (opID OperationID) SetGeofence(radius int, zones, notifyLead bool) error {
+	if radius < 0 || radius > MaxGeofenceRadius {
+		err := fmt.Errorf(ErrGeofenceRadius)
+		log.Warnw(err.Error(), "resource", opID, "radius", radius)
+		return err
+	}
+
+	if radius == 0 && !zones {
+		if _, err := db.Exec("DELETE FROM opgeofence WHERE opID = ?", opID); err != nil {
+			log.Error(err)
+			return err
+		}
+		if _, err := db.Exec("DELETE FROM geofencestate WHERE opID = ?", opID); err != nil {
+			log.Error(err)
+			return err
+		}
+		return nil
+	}
+
+	if _, err := db.Exec("INSERT INTO opgeofence (opID, radius, zones, notifylead) VALUES (?, ?, ?, ?) ON DUPLICATE KEY UPDATE radius = ?, zones = ?, notifylead = ?", opID, radius, zones, notifyLead, radius, zones, notifyLead); err != nil {
+		log.Error(err)
+		return err
+	}
+	return nil
+}
+
+// checkGeofences evaluates the rules of every op the agent is working on against a new location
+// only ops shared with a team which can see the agent's location right now are checked
+// it runs many queries, so call it in its own goroutine
+func (gid GoogleID) checkGeofences(lat, lon float64) {
+	if lat == 0 && lon == 0 {
+		return
+	}
+
+	sharing, err := gid.sharingTeams()
+	if err != nil || len(sharing) == 0 {
+		return
+	}
+
+	ops, err := gid.geofencedOps()
+	if err != nil {
+		return
+	}
+
+	for _, opID := range ops {
+		// the op sees the location no more precisely than its teams do
+		precision, ok := opID.sharePrecision(sharing)
+		if !ok {
+			continue
+		}
+		blat, blon := precision.blur(lat, lon)
+
+		g, err := opID.Geofence()
+		if err != nil {
+			continue
+		}
+		stat, err := opID.Stat()
+		if err != nil {
+			continue
+		}
+
+		var zone Zone
+		var lastTask sql.NullString
+		known := true
+		err = db.QueryRow("SELECT zone, task FROM geofencestate WHERE opID = ? AND gid = ?", opID, gid).Scan(&zone, &lastTask)
+		if err == sql.ErrNoRows {
+			known = false
+		} else if err != nil {
+			log.Error(err)
+			continue
+		}
+
+		newZone := zone
+		if g.Zones {
+			newZone = opID.zoneAt(blat, blon)
+			if known && newZone != zone {
+				if zone != 0 {
+					g.alert(gid, stat, fmt.Sprintf("left zone %s", opID.zoneName(zone)))
+				}
+				if newZone != 0 {
+					g.alert(gid, stat, fmt.Sprintf("entered zone %s", opID.zoneName(newZone)))
+				}
+			}
+		}
+
+		newTask := lastTask.String
+		if g.Radius > 0 {
+			// each task only alerts once
+			if p, ok := gid.nextAssignedPortal(opID); ok && string(p.task) != lastTask.String {
+				if distance(blat, blon, p.lat, p.lon) <= float64(g.Radius) {
+					g.alert(gid, stat, fmt.Sprintf("arrived within %dm of %s", g.Radius, p.name))
+					newTask = string(p.task)
+				}
+			}
+		}
+
+		if _, err := db.Exec("INSERT INTO geofencestate (opID, gid, zone, task) VALUES (?, ?, ?, ?) ON DUPLICATE KEY UPDATE zone = ?, task = ?", opID, gid, newZone, makeNullString(newTask), newZone, makeNullString(newTask)); err != nil {
+			log.Error(err)
+		}
+	}
+}
+
+// geofencedOps lists the ops with alert rules on which the agent has an assignment or which are shared with one of the agent's teams
+func (gid GoogleID) geofencedOps() ([]OperationID, error) {
+	var ops []OperationID
+	seen := make(map[OperationID]bool)
+
+	rows, err := db.Query("SELECT DISTINCT opgeofence.opID FROM opgeofence JOIN assignments ON opgeofence.opID = assignments.opID WHERE assignments.gid = ?", gid)
+	if err != nil {
+		log.Error(err)
+		return ops, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var opID OperationID
+		if err := rows.Scan(&opID); err != nil {
+			log.Error(err)
+			continue
+		}
+		seen[opID] = true
+		ops = append(ops, opID)
+	}
+
+	teams := gid.effectiveTeams()
+	prows, err := db.Query("SELECT DISTINCT opgeofence.opID, permissions.teamID FROM opgeofence JOIN permissions ON opgeofence.opID = permissions.opID WHERE " + permActive)
+	if err != nil {
+		log.Error(err)
+		return ops, err
+	}
+	defer prows.Close()
+	for prows.Next() {
+		var opID OperationID
+		var teamID TeamID
+		if err := prows.Scan(&opID, &teamID); err != nil {
+			log.Error(err)
+			continue
+		}
+		if teams[teamID] && !seen[opID] {
+			seen[opID] = true
+			ops = append(ops, opID)
+		}
+	}
+	return ops, nil
+}
+
+// sharePrecision reports if any of the teams has access to the op now, directly or through a parent team
+// and returns the finest precision among those teams
+func (opID OperationID) sharePrecision(teams map[TeamID]LocationPrecision) (LocationPrecision, bool) {
+	var precision LocationPrecision
+	shared := false
+
+	o := Operation{ID: opID}
+	for _, t := range o.AnnounceTeams() {
+		p, ok := teams[t]
+		if !ok {
+			continue
+		}
+		if !shared || p.meters() < precision.meters() {
+			precision = p
+		}
+		shared = true
+	}
+	return precision, shared
+}
+
+// geofencePortal is the portal an agent is headed to
+type geofencePortal struct {
+	task TaskID
+	name string
+	lat  float64
+	lon  float64
+}
+
+// nextAssignedPortal finds the portal of the agent's lowest-ordered open task on the op; links start at their from portal
+// tasks in phases which have not started are skipped
+// no access checks, agents with assigned-only access still get alerts
+func (gid GoogleID) nextAssignedPortal(opID OperationID) (*geofencePortal, bool) {
+	var p geofencePortal
+
+	err := db.QueryRow("SELECT task.ID, portal.name, Y(portal.loc), X(portal.loc) FROM assignments "+
+		"JOIN task ON assignments.taskID = task.ID AND assignments.opID = task.opID "+
+		"LEFT JOIN marker ON marker.ID = task.ID AND marker.opID = task.opID "+
+		"LEFT JOIN link ON link.ID = task.ID AND link.opID = task.opID "+
+		"JOIN portal ON portal.opID = task.opID AND portal.ID = COALESCE(marker.portalID, link.fromPortalID) "+
+		"LEFT JOIN opphase ON opphase.ID = task.phase AND opphase.opID = task.opID "+
+		"WHERE assignments.gid = ? AND assignments.opID = ? AND task.state IN ('assigned', 'acknowledged') AND (opphase.state IS NULL OR opphase.state != ?) ORDER BY task.taskorder LIMIT 1", gid, opID, PhasePending).Scan(&p.task, &p.name, &p.lat, &p.lon)
+	if err == sql.ErrNoRows {
+		return nil, false
+	}
+	if err != nil {
+		log.Error(err)
+		return nil, false
+	}
+	return &p, true
+}
+
+// zonePolygon is a zone's outline, in point order
+type zonePolygon struct {
+	zone   Zone
+	points []zonepoint
+}
+
+// zoneAt returns the lowest numbered zone whose polygon contains the point, 0 if none does
+func (opID OperationID) zoneAt(lat, lon float64) Zone {
+	rows, err := db.Query("SELECT zoneID, X(point), Y(point) FROM zonepoints WHERE opID = ? ORDER BY zoneID, position", opID)
+	if err != nil {
+		log.Error(err)
+		return 0
+	}
+	defer rows.Close()
+
+	var polygons []zonePolygon
+	for rows.Next() {
+		var z Zone
+		var p zonepoint
+		if err := rows.Scan(&z, &p.Lat, &p.Lon); err != nil {
+			log.Error(err)
+			continue
+		}
+		if len(polygons) == 0 || polygons[len(polygons)-1].zone != z {
+			polygons = append(polygons, zonePolygon{zone: z})
+		}
+		polygons[len(polygons)-1].points = append(polygons[len(polygons)-1].points, p)
+	}
+	return zoneContaining(lat, lon, polygons)
+}
+
+// zoneContaining returns the first zone, in the order given, whose polygon contains the point, 0 if none does
+func zoneContaining(lat, lon float64, polygons []zonePolygon) Zone {
+	for _, p := range polygons {
+		if inPolygon(lat, lon, p.points) {
+			return p.zone
+		}
+	}
+	return 0
+}
+
+func (opID OperationID) zoneName(z Zone) string {
+	var name string
+	if err := db.QueryRow("SELECT name FROM zone WHERE opID = ? AND ID = ?", opID, z).Scan(&name); err != nil {
+		return fmt.Sprint(z)
+	}
+	return name
+}
+
+// alert lets the agent, and if configured the op owner, know what happened
+func (g *Geofence) alert(gid GoogleID, stat *OpStat, what string) {
+	name, _ := gid.IngressName()
+	log.Infow("geofence", "resource", g.OpID, "GID", gid, "alert", what)
+
+	_, _ = messaging.SendMessage(messaging.GoogleID(gid), fmt.Sprintf("%s: you %s", stat.Name, what))
+	if g.NotifyLead && stat.Gid != gid {
+		_, _ = messaging.SendMessage(messaging.GoogleID(stat.Gid), fmt.Sprintf("%s: %s %s", stat.Name, name, what))
+	}
+}
+
+// inPolygon is a ray-casting test; polygons with fewer than three points contain nothing
+func inPolygon(lat, lon float64, poly []zonepoint) bool {
+	if len(poly) < 3 {
+		return false
+	}
+
+	in := false
+	j := len(poly) - 1
+	for i := range poly {
+		if (poly[i].Lon > lon) != (poly[j].Lon > lon) &&
+			lat < (poly[j].Lat-poly[i].Lat)*(lon-poly[i].Lon)/(poly[j].Lon-poly[i].Lon)+poly[i].Lat {
+			in = !in
+		}
+		j = i
+	}
+	return in
+}
+
+// distance is the haversine distance between two points, in meters
+func distance(lat1, lon1, lat2, lon2 float64) float64 {
+	rlat1 := lat1 * math.Pi / 180
+	rlat2 := lat2 * math.Pi / 180
+	dlat := (lat2 - lat1) * math.Pi / 180
+	dlon := (lon2 - lon1) * math.Pi / 180
+
+	a := math.Sin(dlat/2)*math.Sin(dlat/2) + math.Cos(rlat1)*math.Cos(rlat2)*math.Sin(dlon/2)*math.Sin(dlon/2)
+	return 2 * earthRadius * math.Asin(math.Sqrt(a))
+}
@@ -0,0 +1,104 @@
+package model
+
+import (
+	"math"
+	"testing"
+)
+
+func square(lat0, lon0, lat1, lon1 float64) []zonepoint {
+	return []zonepoint{{Lat: lat0, Lon: lon0}, {Lat: lat0, Lon: lon1}, {Lat: lat1, Lon: lon1}, {Lat: lat1, Lon: lon0}}
+}
+
+func TestInPolygon(t *testing.T) {
+	diamond := []zonepoint{{Lat: 1, Lon: 0}, {Lat: 0, Lon: 1}, {Lat: -1, Lon: 0}, {Lat: 0, Lon: -1}}
+	// a U opening to the north, the notch is lat 1..3, lon 1..2
+	u := []zonepoint{{Lat: 0, Lon: 0}, {Lat: 0, Lon: 3}, {Lat: 3, Lon: 3}, {Lat: 3, Lon: 2}, {Lat: 1, Lon: 2}, {Lat: 1, Lon: 1}, {Lat: 3, Lon: 1}, {Lat: 3, Lon: 0}}
+	closed := append(square(0, 0, 1, 1), zonepoint{Lat: 0, Lon: 0})
+
+	tests := []struct {
+		name     string
+		lat, lon float64
+		poly     []zonepoint
+		want     bool
+	}{
+		{"inside square", 0.5, 0.5, square(0, 0, 1, 1), true},
+		{"outside square", 1.5, 0.5, square(0, 0, 1, 1), false},
+		{"beside square", 0.5, -0.5, square(0, 0, 1, 1), false},
+		{"ray through a vertex, inside", 0, 0, diamond, true},
+		{"ray through a vertex, above", 2, 0, diamond, false},
+		{"ray through a vertex, below", -2, 0, diamond, false},
+		{"concave, in the notch", 2, 1.5, u, false},
+		{"concave, in an arm", 2, 0.5, u, true},
+		{"concave, in the base", 0.5, 1.5, u, true},
+		{"closing point repeated", 0.5, 0.5, closed, true},
+		{"negative coordinates", -33.9, 151.2, square(-34, 151, -33, 152), true},
+		{"collinear points", 0, 1, []zonepoint{{Lat: 0, Lon: 0}, {Lat: 0, Lon: 1}, {Lat: 0, Lon: 2}}, false},
+		{"two points", 0, 0.5, []zonepoint{{Lat: -1, Lon: 0}, {Lat: 1, Lon: 1}}, false},
+		{"one point", 0, 0, []zonepoint{{Lat: 0, Lon: 0}}, false},
+		{"no points", 0, 0, nil, false},
+	}
+	for _, tc := range tests {
+		if got := inPolygon(tc.lat, tc.lon, tc.poly); got != tc.want {
+			t.Errorf("%s: got %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestDistance(t *testing.T) {
+	degree := 2 * math.Pi * earthRadius / 360
+
+	tests := []struct {
+		name                   string
+		lat1, lon1, lat2, lon2 float64
+		want                   float64
+	}{
+		{"same point", 52.5, 13.4, 52.5, 13.4, 0},
+		{"one degree of latitude", 0, 0, 1, 0, degree},
+		{"one degree of longitude at the equator", 0, 0, 0, 1, degree},
+		{"one degree of longitude at 60N", 60, 0, 60, 1, degree / 2},
+		{"across the antimeridian", 0, 179.5, 0, -179.5, degree},
+		{"antipodes", 0, 0, 0, 180, math.Pi * earthRadius},
+	}
+	for _, tc := range tests {
+		got := distance(tc.lat1, tc.lon1, tc.lat2, tc.lon2)
+		if math.Abs(got-tc.want) > 0.01*tc.want+0.001 {
+			t.Errorf("%s: got %.1fm, want %.1fm", tc.name, got, tc.want)
+		}
+		if back := distance(tc.lat2, tc.lon2, tc.lat1, tc.lon1); math.Abs(back-got) > 0.001 {
+			t.Errorf("%s: not symmetric, %.3f and %.3f", tc.name, got, back)
+		}
+	}
+}
+
+func TestZoneContaining(t *testing.T) {
+	// zone 1 covers zone 2, zoneAt lists them in zone order
+	polygons := []zonePolygon{
+		{zone: 1, points: square(0, 0, 10, 10)},
+		{zone: 2, points: square(2, 2, 4, 4)},
+		{zone: 3, points: square(20, 20, 21, 21)[:2]},
+		{zone: 4, points: square(20, 20, 21, 21)},
+	}
+
+	tests := []struct {
+		name     string
+		lat, lon float64
+		want     Zone
+	}{
+		{"only in the first", 1, 1, 1},
+		{"in both, the lower zone wins", 3, 3, 1},
+		{"a zone with two points is skipped", 20.5, 20.5, 4},
+		{"in none", 50, 50, 0},
+	}
+	for _, tc := range tests {
+		if got := zoneContaining(tc.lat, tc.lon, polygons); got != tc.want {
+			t.Errorf("%s: got zone %d, want %d", tc.name, got, tc.want)
+		}
+	}
+
+	if got := zoneContaining(3, 3, []zonePolygon{polygons[1], polygons[0]}); got != 2 {
+		t.Errorf("first listed zone not preferred: got %d", got)
+	}
+	if got := zoneContaining(3, 3, nil); got != 0 {
+		t.Errorf("no zones: got %d", got)
+	}
+}
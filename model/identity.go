@@ -0,0 +1,374 @@
+package model
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/wasabee-project/Wasabee-Server/config"
+	"github.com/wasabee-project/Wasabee-Server/log"
+	"github.com/wasabee-project/Wasabee-Server/messaging"
+	"github.com/wasabee-project/Wasabee-Server/util"
+)
+
+// IdentityProvider is a service an agent can sign in with
+type IdentityProvider string
+
+// identity providers
+const (
+	IdentityGoogle    IdentityProvider = "google"
+	IdentityApple     IdentityProvider = "apple"
+	IdentityTelegram  IdentityProvider = "telegram"  // kept in the telegram table
+	IdentityCommunity IdentityProvider = "community" // kept as the agent's community name
+	IdentityMerged    IdentityProvider = "merged"    // the subject is a GoogleID merged into this agent
+	// OpenID Connect providers are "oidc:" and the provider's configured name, see IdentityOIDC
+)
+
+// Identity is a sign-in identity linked to an agent
+type Identity struct {
+	Provider IdentityProvider `json:"provider"`
+	Subject  string           `json:"subject"`
+	Name     string           `json:"name,omitempty"`
+	Created  string           `json:"created,omitempty"` // time.RFC1123 format
+	Primary  bool             `json:"primary,omitempty"` // the agent's own GoogleID, cannot be unlinked
+}
+
+// AgentMergeID wrapper to ensure type safety
+type AgentMergeID string
+
+// AgentMerge is a pending request to merge one agent into another
+type AgentMerge struct {
+	ID        AgentMergeID `json:"id"`
+	From      GoogleID     `json:"from"`
+	FromName  string       `json:"fromname"`
+	Into      GoogleID     `json:"into"`
+	IntoName  string       `json:"intoname"`
+	Requested string       `json:"requested"` // time.RFC1123 format
+}
+
+// IdentityToGID returns the agent an identity is linked to, "" if it is not linked
+func IdentityToGID(provider IdentityProvider, subject string) (GoogleID, error) {
+	var gid GoogleID
+	err := db.QueryRow("SELECT gid FROM identity WHERE provider = ? AND subject = ?", provider, subject).Scan(&gid)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		log.Error(err)
+		return "", err
+	}
+	return gid, nil
+}
+
+// Canonical returns the agent a GoogleID signs in as, following links and merges
+func (gid GoogleID) Canonical() GoogleID {
+	for _, p := range []IdentityProvider{IdentityMerged, IdentityGoogle} {
+		if linked, _ := IdentityToGID(p, string(gid)); linked != "" {
+			return linked
+		}
+	}
+	return gid
+}
+
+// Identities lists every sign-in identity linked to the agent
+func (gid GoogleID) Identities() ([]Identity, error) {
+	ids := make([]Identity, 0)
+
+	// agents created by Apple or OpenID Connect logins have no Google account
+	if !strings.HasPrefix(string(gid), "A-") && !strings.HasPrefix(string(gid), "O-") {
+		ids = append(ids, Identity{Provider: IdentityGoogle, Subject: string(gid), Primary: true})
+	}
+
+	rows, err := db.Query("SELECT provider, subject, name, created FROM identity WHERE gid = ? ORDER BY created", gid)
+	if err != nil {
+		log.Error(err)
+		return ids, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var i Identity
+		var name sql.NullString
+		var created string
+		if err := rows.Scan(&i.Provider, &i.Subject, &name, &created); err != nil {
+			log.Error(err)
+			continue
+		}
+		i.Name = name.String
+		i.Created = sqlTimeToRFC1123(sql.NullString{String: created, Valid: true})
+		ids = append(ids, i)
+	}
+
+	if tgid, _ := gid.TelegramID(); tgid != 0 {
+		name, _ := gid.TelegramName()
+		ids = append(ids, Identity{Provider: IdentityTelegram, Subject: tgid.String(), Name: name})
+	}
+
+	var community sql.NullString
+	if err := db.QueryRow("SELECT communityname FROM agent WHERE gid = ?", gid).Scan(&community); err != nil && err != sql.ErrNoRows {
+		log.Error(err)
+	}
+	if community.Valid && community.String != "" {
+		ids = append(ids, Identity{Provider: IdentityCommunity, Subject: community.String, Name: community.String})
+	}
+	return ids, nil
+}
+
+// LinkIdentity lets the agent sign in with another identity; the caller must have verified the agent controls it
+// a Google account which already has an agent cannot be linked, it needs a merge instead
+func (gid GoogleID) LinkIdentity(provider IdentityProvider, subject, name string) error {
+	if provider != IdentityGoogle && provider != IdentityApple && !strings.HasPrefix(string(provider), "oidc:") {
+		return fmt.Errorf(ErrIdentityProvider)
+	}
+	if subject == "" || subject == string(gid) {
+		return fmt.Errorf(ErrIdentityLinked)
+	}
+
+	linked, err := IdentityToGID(provider, subject)
+	if err != nil {
+		return err
+	}
+	if linked == gid {
+		return nil
+	}
+	if linked != "" {
+		err := fmt.Errorf(ErrIdentityLinked)
+		log.Warnw(err.Error(), "GID", gid, "provider", provider, "subject", subject, "linked", linked)
+		return err
+	}
+	if provider == IdentityGoogle && GoogleID(subject).Valid() {
+		return fmt.Errorf(ErrIdentityIsAgent)
+	}
+
+	if _, err := db.Exec("INSERT INTO identity (provider, subject, gid, name, created) VALUES (?, ?, ?, ?, UTC_TIMESTAMP())", provider, subject, gid, makeNullString(util.Sanitize(name))); err != nil {
+		log.Error(err)
+		return err
+	}
+	log.Infow("identity linked", "GID", gid, "provider", provider, "subject", subject)
+	return nil
+}
+
+// UnlinkIdentity removes a sign-in identity from the agent
+func (gid GoogleID) UnlinkIdentity(provider IdentityProvider, subject string) error {
+	switch provider {
+	case IdentityTelegram:
+		if tgid, _ := gid.TelegramID(); tgid.String() != subject {
+			return fmt.Errorf(ErrIdentityNotFound)
+		}
+		return gid.RemoveTelegramID()
+	case IdentityCommunity:
+		return gid.ClearCommunityName()
+	}
+
+	r, err := db.Exec("DELETE FROM identity WHERE provider = ? AND subject = ? AND gid = ?", provider, subject, gid)
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+	if n, _ := r.RowsAffected(); n == 0 {
+		return fmt.Errorf(ErrIdentityNotFound)
+	}
+	log.Infow("identity unlinked", "GID", gid, "provider", provider, "subject", subject)
+	return nil
+}
+
+// RequestMerge asks the server administrators to merge the agent from into gid; the caller must have verified gid controls from
+func (gid GoogleID) RequestMerge(from GoogleID) (AgentMergeID, error) {
+	if from == gid || !from.Valid() {
+		return "", fmt.Errorf(ErrMergeInvalid)
+	}
+
+	id := AgentMergeID(util.GenerateID(40))
+	if _, err := db.Exec("INSERT INTO agentmerge (ID, fromgid, intogid, requested) VALUES (?, ?, ?, UTC_TIMESTAMP()) ON DUPLICATE KEY UPDATE requested = UTC_TIMESTAMP()", id, from, gid); err != nil {
+		log.Error(err)
+		return "", err
+	}
+	if err := db.QueryRow("SELECT ID FROM agentmerge WHERE fromgid = ? AND intogid = ?", from, gid).Scan(&id); err != nil {
+		log.Error(err)
+		return "", err
+	}
+
+	fromName, _ := from.IngressName()
+	intoName, _ := gid.IngressName()
+	log.Infow("agent merge requested", "GID", gid, "from", from, "request", id)
+	for _, admin := range config.Get().Admins {
+		_, _ = messaging.SendMessage(messaging.GoogleID(admin), fmt.Sprintf("%s asks to merge the agent %s (%s) into their account (%s)", intoName, fromName, from, gid))
+	}
+	return id, nil
+}
+
+// AgentMerges lists the pending merge requests
+func AgentMerges() ([]AgentMerge, error) {
+	merges := make([]AgentMerge, 0)
+
+	rows, err := db.Query("SELECT ID, fromgid, intogid, requested FROM agentmerge ORDER BY requested")
+	if err != nil {
+		log.Error(err)
+		return merges, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var m AgentMerge
+		var requested string
+		if err := rows.Scan(&m.ID, &m.From, &m.Into, &requested); err != nil {
+			log.Error(err)
+			continue
+		}
+		m.FromName, _ = m.From.IngressName()
+		m.IntoName, _ = m.Into.IngressName()
+		m.Requested = sqlTimeToRFC1123(sql.NullString{String: requested, Valid: true})
+		merges = append(merges, m)
+	}
+	return merges, nil
+}
+
+// Approve performs the requested merge; it returns the IDs of the access JWTs revoked so other servers can be told
+func (id AgentMergeID) Approve() ([]string, error) {
+	var from, into GoogleID
+	err := db.QueryRow("SELECT fromgid, intogid FROM agentmerge WHERE ID = ?", id).Scan(&from, &into)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf(ErrMergeNotFound)
+	}
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+	return MergeAgents(from, into)
+}
+
+// Deny discards the merge request
+func (id AgentMergeID) Deny() error {
+	r, err := db.Exec("DELETE FROM agentmerge WHERE ID = ?", id)
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+	if n, _ := r.RowsAffected(); n == 0 {
+		return fmt.Errorf(ErrMergeNotFound)
+	}
+	return nil
+}
+
+// MergeAgents moves everything belonging to from onto into, then removes from; signing in as from afterwards signs in as into
+// where both agents hold the same thing (team membership, V or Telegram link, ...) into's is kept
+// from's sessions are revoked first, since into could not see or end them; it returns the IDs of the access JWTs revoked so other servers can be told
+func MergeAgents(from, into GoogleID) ([]string, error) {
+	if from == into || !from.Valid() || !into.Valid() {
+		return nil, fmt.Errorf(ErrMergeInvalid)
+	}
+
+	jwts, err := from.RevokeSessions()
+	if err != nil {
+		return jwts, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		log.Error(err)
+		return jwts, err
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && err != sql.ErrTxDone {
+			log.Error(err)
+		}
+	}()
+
+	teams := make([]TeamID, 0)
+	rows, err := tx.Query("SELECT teamID FROM agentteams WHERE gid = ?", from)
+	if err != nil {
+		log.Error(err)
+		return jwts, err
+	}
+	for rows.Next() {
+		var teamID TeamID
+		if err := rows.Scan(&teamID); err != nil {
+			log.Error(err)
+			continue
+		}
+		teams = append(teams, teamID)
+	}
+	rows.Close()
+
+	steps := []string{
+		// memberships and ownership
+		"UPDATE IGNORE agentteams SET gid = ? WHERE gid = ?",
+		"UPDATE team SET owner = ? WHERE owner = ?",
+		"UPDATE teaminvite SET gid = ? WHERE gid = ?",
+		"UPDATE IGNORE teamjoinrequest SET gid = ? WHERE gid = ?",
+		// ops
+		"UPDATE operation SET gid = ? WHERE gid = ?",
+		"UPDATE opshare SET gid = ? WHERE gid = ?",
+		"UPDATE assignments SET gid = ? WHERE gid = ?",
+		// keys
+		"UPDATE IGNORE defensivekeys SET gid = ? WHERE gid = ?",
+		// linked services, only when into has none
+		"UPDATE IGNORE telegram SET gid = ? WHERE gid = ?",
+		"UPDATE IGNORE v SET gid = ? WHERE gid = ?",
+		"UPDATE IGNORE rocks SET gid = ? WHERE gid = ?",
+		"UPDATE firebase SET gid = ? WHERE gid = ?",
+		"UPDATE apitoken SET gid = ? WHERE gid = ?",
+		// history
+		"UPDATE locationtrack SET gid = ? WHERE gid = ?",
+		"UPDATE messagelog SET gid = ? WHERE gid = ?",
+		"UPDATE messagelog SET sender = ? WHERE sender = ?",
+		"UPDATE identity SET gid = ? WHERE gid = ?",
+		// blocks both ways
+		"UPDATE IGNORE agentblock SET gid = ? WHERE gid = ?",
+		"UPDATE IGNORE agentblock SET blocked = ? WHERE blocked = ?",
+	}
+	// the same task assigned to both would be duplicated
+	if _, err := tx.Exec("DELETE x FROM assignments x JOIN assignments y ON x.opID = y.opID AND x.taskID = y.taskID WHERE x.gid = ? AND y.gid = ?", from, into); err != nil {
+		log.Error(err)
+		return jwts, err
+	}
+	for _, q := range steps {
+		if _, err := tx.Exec(q, into, from); err != nil {
+			log.Errorw(err.Error(), "query", q, "from", from, "into", into)
+			return jwts, err
+		}
+	}
+	// keys on hand are added together; the unique key does not match a NULL capsule, so those rows are summed by hand
+	if _, err := tx.Exec("UPDATE opkeys x JOIN opkeys y ON x.opID = y.opID AND x.portalID = y.portalID SET x.onhand = x.onhand + y.onhand WHERE x.gid = ? AND y.gid = ? AND x.capsule IS NULL AND y.capsule IS NULL", into, from); err != nil {
+		log.Error(err)
+		return jwts, err
+	}
+	if _, err := tx.Exec("DELETE y FROM opkeys y JOIN opkeys x ON x.opID = y.opID AND x.portalID = y.portalID WHERE x.gid = ? AND y.gid = ? AND x.capsule IS NULL AND y.capsule IS NULL", into, from); err != nil {
+		log.Error(err)
+		return jwts, err
+	}
+	if _, err := tx.Exec("INSERT INTO opkeys (opID, portalID, gid, onhand, capsule) SELECT opID, portalID, ?, onhand, capsule FROM opkeys WHERE gid = ? ON DUPLICATE KEY UPDATE onhand = opkeys.onhand + VALUES(onhand)", into, from); err != nil {
+		log.Error(err)
+		return jwts, err
+	}
+
+	// into cannot have blocked itself
+	if _, err := tx.Exec("DELETE FROM agentblock WHERE gid = ? AND blocked = ?", into, into); err != nil {
+		log.Error(err)
+		return jwts, err
+	}
+
+	// whatever was not moved goes with the agent
+	if _, err := tx.Exec("DELETE FROM agent WHERE gid = ?", from); err != nil {
+		log.Error(err)
+		return jwts, err
+	}
+	if _, err := tx.Exec("DELETE FROM agentmerge WHERE fromgid = ? OR intogid = ?", from, from); err != nil {
+		log.Error(err)
+		return jwts, err
+	}
+	if _, err := tx.Exec("INSERT INTO identity (provider, subject, gid, created) VALUES (?, ?, ?, UTC_TIMESTAMP()) ON DUPLICATE KEY UPDATE gid = ?", IdentityMerged, from, into, into); err != nil {
+		log.Error(err)
+		return jwts, err
+	}
+	if err := tx.Commit(); err != nil {
+		log.Error(err)
+		return jwts, err
+	}
+
+	for _, teamID := range teams {
+		teamID.Audit("", AuditAgentMerged, string(into), string(from))
+	}
+	log.Infow("agents merged", "from", from, "into", into)
+	return jwts, nil
+}
@@ -0,0 +1,321 @@
+package model
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/wasabee-project/Wasabee-Server/log"
+	"github.com/wasabee-project/Wasabee-Server/messaging"
+	"github.com/wasabee-project/Wasabee-Server/util"
+)
+
+// TeamInvite is a named join link for a team
+type TeamInvite struct {
+	Token    string   `json:"token"`
+	Name     string   `json:"name"`
+	Creator  GoogleID `json:"creator"`
+	Expires  string   `json:"expires,omitempty"` // time.RFC1123 format, unset means never
+	MaxUses  int      `json:"maxuses"`           // 0 is unlimited
+	Uses     int      `json:"uses"`
+	Approval bool     `json:"approval"` // joins wait for an admin to approve them
+	Created  string   `json:"created"`  // time.RFC1123 format
+}
+
+// JoinRequestID wrapper to ensure type safety
+type JoinRequestID string
+
+// JoinRequest is an agent waiting for a team admin to approve their join
+type JoinRequest struct {
+	ID        JoinRequestID `json:"id"`
+	TeamID    TeamID        `json:"teamID"`
+	Gid       GoogleID      `json:"gid"`
+	Name      string        `json:"name"`
+	Invite    string        `json:"invite"` // the name of the invite used
+	Requested string        `json:"requested"`
+}
+
+// NewInvite creates a new invite link for the team
+// expires is optional, the zero time never expires; maxUses of 0 is unlimited
+func (teamID TeamID) NewInvite(gid GoogleID, name string, expires time.Time, maxUses int, approval bool) (*TeamInvite, error) {
+	if !expires.IsZero() && !expires.After(time.Now()) {
+		err := fmt.Errorf(ErrInviteExpiresInPast)
+		log.Warnw(err.Error(), "GID", gid, "resource", teamID, "expires", expires)
+		return nil, err
+	}
+	if maxUses < 0 {
+		maxUses = 0
+	}
+
+	token, err := GenerateSafeName()
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+
+	name = util.Sanitize(name)
+	if name == "" {
+		name = token
+	}
+
+	i := TeamInvite{
+		Token:    token,
+		Name:     name,
+		Creator:  gid,
+		MaxUses:  maxUses,
+		Approval: approval,
+		Created:  time.Now().UTC().Format(time.RFC1123),
+	}
+	if !expires.IsZero() {
+		i.Expires = expires.UTC().Format(time.RFC1123)
+	}
+
+	if _, err := db.Exec("INSERT INTO teaminvite (token, teamID, name, gid, expires, maxuses, approval, created) VALUES (?, ?, ?, ?, ?, ?, ?, UTC_TIMESTAMP())", i.Token, teamID, i.Name, gid, makeNullTime(expires), i.MaxUses, i.Approval); err != nil {
+		log.Error(err)
+		return nil, err
+	}
+	teamID.Audit(gid, AuditInviteCreated, i.Name, "")
+	return &i, nil
+}
+
+// Invites lists all of the team's invite links, including used-up and expired ones
+func (teamID TeamID) Invites() ([]TeamInvite, error) {
+	invites := make([]TeamInvite, 0)
+
+	rows, err := db.Query("SELECT token, name, gid, expires, maxuses, uses, approval, created FROM teaminvite WHERE teamID = ? ORDER BY created", teamID)
+	if err != nil {
+		log.Error(err)
+		return invites, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var i TeamInvite
+		var expires sql.NullString
+		var created string
+		if err := rows.Scan(&i.Token, &i.Name, &i.Creator, &expires, &i.MaxUses, &i.Uses, &i.Approval, &created); err != nil {
+			log.Error(err)
+			continue
+		}
+		i.Expires = sqlTimeToRFC1123(expires)
+		i.Created = sqlTimeToRFC1123(sql.NullString{String: created, Valid: true})
+		invites = append(invites, i)
+	}
+	return invites, nil
+}
+
+// DeleteInvite revokes an invite link, pending requests made with it are kept
+func (teamID TeamID) DeleteInvite(token string) error {
+	r, err := db.Exec("DELETE FROM teaminvite WHERE teamID = ? AND token = ?", teamID, token)
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+	if n, _ := r.RowsAffected(); n == 0 {
+		return fmt.Errorf(ErrInviteNotFound)
+	}
+	return nil
+}
+
+// useInvite consumes one use of an invite link; if the invite requires approval a join request is created and true is returned
+func (teamID TeamID) useInvite(gid GoogleID, token string) (bool, error) {
+	var name string
+	var approval bool
+
+	err := db.QueryRow("SELECT name, approval FROM teaminvite WHERE teamID = ? AND token = ? AND (expires IS NULL OR expires > UTC_TIMESTAMP()) AND (maxuses = 0 OR uses < maxuses)", teamID, token).Scan(&name, &approval)
+	if err == sql.ErrNoRows {
+		err = fmt.Errorf(ErrInviteNotFound)
+		log.Warnw(err.Error(), "resource", teamID, "GID", gid)
+		return false, err
+	}
+	if err != nil {
+		log.Error(err)
+		return false, err
+	}
+
+	// do not burn a use on agents already on the team, or already waiting for approval
+	if inteam, _ := gid.AgentInTeam(teamID); inteam {
+		return false, nil
+	}
+	var waiting int
+	if err := db.QueryRow("SELECT COUNT(*) FROM teamjoinrequest WHERE teamID = ? AND gid = ?", teamID, gid).Scan(&waiting); err != nil {
+		log.Error(err)
+		return false, err
+	}
+	if waiting > 0 {
+		return true, nil
+	}
+
+	// guard against racing the last use
+	r, err := db.Exec("UPDATE teaminvite SET uses = uses + 1 WHERE teamID = ? AND token = ? AND (maxuses = 0 OR uses < maxuses)", teamID, token)
+	if err != nil {
+		log.Error(err)
+		return false, err
+	}
+	if n, _ := r.RowsAffected(); n == 0 {
+		return false, fmt.Errorf(ErrInviteNotFound)
+	}
+
+	if !approval {
+		if err := teamID.AddAgent(gid, gid, "invite "+name); err != nil {
+			return false, err
+		}
+		if err := teamID.SetComment(gid, "joined via "+name); err != nil {
+			return false, err
+		}
+		return false, nil
+	}
+
+	if err := teamID.newJoinRequest(gid, name); err != nil {
+		return false, err
+	}
+	teamID.Audit(gid, AuditJoinRequested, string(gid), "invite "+name)
+	return true, nil
+}
+
+func (teamID TeamID) newJoinRequest(gid GoogleID, invite string) error {
+	id := JoinRequestID(util.GenerateID(40))
+
+	// an agent only has one pending request per team, re-using an invite just refreshes it
+	if _, err := db.Exec("INSERT INTO teamjoinrequest (ID, teamID, gid, invite, requested) VALUES (?, ?, ?, ?, UTC_TIMESTAMP()) ON DUPLICATE KEY UPDATE invite = ?, requested = UTC_TIMESTAMP()", id, teamID, gid, invite, invite); err != nil {
+		log.Error(err)
+		return err
+	}
+	if err := db.QueryRow("SELECT ID FROM teamjoinrequest WHERE teamID = ? AND gid = ?", teamID, gid).Scan(&id); err != nil {
+		log.Error(err)
+		return err
+	}
+
+	teamName, _ := teamID.Name()
+	agentName, _ := gid.IngressName()
+	log.Infow("join request", "resource", teamID, "GID", gid, "invite", invite)
+
+	for _, admin := range teamID.admins() {
+		messaging.SendJoinRequest(messaging.GoogleID(admin), messaging.JoinRequest{
+			ID:        string(id),
+			TeamID:    messaging.TeamID(teamID),
+			TeamName:  teamName,
+			Agent:     messaging.GoogleID(gid),
+			AgentName: agentName,
+			Invite:    invite,
+		})
+	}
+	return nil
+}
+
+// JoinRequests lists the team's pending join requests
+func (teamID TeamID) JoinRequests() ([]JoinRequest, error) {
+	requests := make([]JoinRequest, 0)
+
+	rows, err := db.Query("SELECT ID, gid, invite, requested FROM teamjoinrequest WHERE teamID = ? ORDER BY requested", teamID)
+	if err != nil {
+		log.Error(err)
+		return requests, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		r := JoinRequest{TeamID: teamID}
+		var requested string
+		if err := rows.Scan(&r.ID, &r.Gid, &r.Invite, &requested); err != nil {
+			log.Error(err)
+			continue
+		}
+		r.Requested = sqlTimeToRFC1123(sql.NullString{String: requested, Valid: true})
+		r.Name, _ = r.Gid.IngressName()
+		requests = append(requests, r)
+	}
+	return requests, nil
+}
+
+// admins returns the owner and admins of a team
+func (teamID TeamID) admins() []GoogleID {
+	var out []GoogleID
+
+	rows, err := db.Query("SELECT owner FROM team WHERE teamID = ? UNION SELECT gid FROM agentteams WHERE teamID = ? AND role IN ('owner', 'admin')", teamID, teamID)
+	if err != nil {
+		log.Error(err)
+		return out
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var gid GoogleID
+		if err := rows.Scan(&gid); err != nil {
+			log.Error(err)
+			continue
+		}
+		out = append(out, gid)
+	}
+	return out
+}
+
+// Team returns the team a join request is for
+func (r JoinRequestID) Team() (TeamID, error) {
+	var teamID TeamID
+
+	err := db.QueryRow("SELECT teamID FROM teamjoinrequest WHERE ID = ?", r).Scan(&teamID)
+	if err == sql.ErrNoRows {
+		return "", fmt.Errorf(ErrJoinRequestNotFound)
+	}
+	if err != nil {
+		log.Error(err)
+		return "", err
+	}
+	return teamID, nil
+}
+
+// Approve adds the requesting agent to the team, gid must be a team owner or admin
+func (r JoinRequestID) Approve(gid GoogleID) error {
+	return r.resolve(gid, true)
+}
+
+// Deny discards the join request, gid must be a team owner or admin
+func (r JoinRequestID) Deny(gid GoogleID) error {
+	return r.resolve(gid, false)
+}
+
+func (r JoinRequestID) resolve(gid GoogleID, approve bool) error {
+	var teamID TeamID
+	var agent GoogleID
+	var invite string
+
+	err := db.QueryRow("SELECT teamID, gid, invite FROM teamjoinrequest WHERE ID = ?", r).Scan(&teamID, &agent, &invite)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf(ErrJoinRequestNotFound)
+	}
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+
+	if admin, _ := gid.AdminsTeam(teamID); !admin {
+		err := fmt.Errorf(ErrNotTeamAdmin)
+		log.Warnw(err.Error(), "GID", gid, "resource", teamID, "request", r)
+		return err
+	}
+
+	if _, err := db.Exec("DELETE FROM teamjoinrequest WHERE ID = ?", r); err != nil {
+		log.Error(err)
+		return err
+	}
+
+	teamName, _ := teamID.Name()
+	if !approve {
+		log.Infow("join request denied", "resource", teamID, "GID", gid, "agent", agent)
+		teamID.Audit(gid, AuditJoinDenied, string(agent), "invite "+invite)
+		_, _ = messaging.SendMessage(messaging.GoogleID(agent), fmt.Sprintf("Your request to join %s was declined", teamName))
+		return nil
+	}
+
+	if err := teamID.AddAgent(agent, gid, "invite "+invite); err != nil {
+		return err
+	}
+	if err := teamID.SetComment(agent, "joined via "+invite); err != nil {
+		return err
+	}
+	log.Infow("join request approved", "resource", teamID, "GID", gid, "agent", agent)
+	teamID.Audit(gid, AuditJoinApproved, string(agent), "invite "+invite)
+	_, _ = messaging.SendMessage(messaging.GoogleID(agent), fmt.Sprintf("Your request to join %s was approved", teamName))
+	return nil
+}
@@ -173,9 +173,9 @@ func (opID OperationID) updateLink(l Link, tx *sql.Tx) error {
 
 // PopulateLinks fills in the Links list for the Operation.
 func (o *Operation) populateLinks(zones []Zone, inGid GoogleID, assignments map[TaskID][]GoogleID, depends map[TaskID][]TaskID) error {
-	var description sql.NullString
+	var description, phase sql.NullString
 
-	rows, err := db.Query("SELECT link.ID, link.fromPortalID, link.toPortalID, task.comment, task.taskorder, task.state, link.color, task.zone, task.delta FROM link JOIN task ON link.ID = task.ID WHERE task.opID = ? AND link.opID = task.opID", o.ID)
+	rows, err := db.Query("SELECT link.ID, link.fromPortalID, link.toPortalID, task.comment, task.taskorder, task.state, link.color, task.zone, task.delta, task.phase FROM link JOIN task ON link.ID = task.ID WHERE task.opID = ? AND link.opID = task.opID", o.ID)
 	if err != nil {
 		log.Error(err)
 		return err
@@ -186,7 +186,7 @@ func (o *Operation) populateLinks(zones []Zone, inGid GoogleID, assignments map[
 		tmpLink := Link{}
 		tmpLink.opID = o.ID
 
-		err := rows.Scan(&tmpLink.ID, &tmpLink.From, &tmpLink.To, &description, &tmpLink.Order, &tmpLink.State, &tmpLink.Color, &tmpLink.Zone, &tmpLink.DeltaMinutes)
+		err := rows.Scan(&tmpLink.ID, &tmpLink.From, &tmpLink.To, &description, &tmpLink.Order, &tmpLink.State, &tmpLink.Color, &tmpLink.Zone, &tmpLink.DeltaMinutes, &phase)
 		if err != nil {
 			log.Error(err)
 			continue
@@ -200,6 +200,10 @@ func (o *Operation) populateLinks(zones []Zone, inGid GoogleID, assignments map[
 
 		tmpLink.ThrowOrder = tmpLink.Order
 
+		if phase.Valid {
+			tmpLink.Phase = PhaseID(phase.String)
+		}
+
 		if a, ok := assignments[tmpLink.Task.ID]; ok {
 			tmpLink.Assignments = a
 			tmpLink.AssignedTo = a[0]
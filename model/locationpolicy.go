@@ -0,0 +1,280 @@
+package model
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/wasabee-project/Wasabee-Server/log"
+)
+
+// LocationPrecision is how exactly a location is shown to teammates
+type LocationPrecision string
+
+// location precisions, from finest to coarsest
+const (
+	LocationExact LocationPrecision = "exact"
+	Location100m  LocationPrecision = "100m"
+	Location1km   LocationPrecision = "1km"
+)
+
+// LocationPolicy limits how and when a location is shared with a team
+// a team sets one for all its agents, and each agent may set a stricter one for themselves
+type LocationPolicy struct {
+	Precision LocationPrecision `json:"precision"`
+	Start     string            `json:"start,omitempty"` // daily window, "15:04" UTC; may wrap past midnight
+	End       string            `json:"end,omitempty"`
+	OpID      OperationID       `json:"op,omitempty"` // only while one of this op's phases is started
+}
+
+// policyColumns are the columns scanned by policyScan, agentteams is the table name or alias used in the query
+func policyColumns(agentteams string) string {
+	return fmt.Sprintf("team.locprecision, team.locstart, team.locend, team.locop, %[1]s.locprecision, %[1]s.locstart, %[1]s.locend, %[1]s.locop", agentteams)
+}
+
+type policyScan [8]sql.NullString
+
+// Valid reports if the precision is a known one
+func (p LocationPrecision) Valid() bool {
+	switch p {
+	case LocationExact, Location100m, Location1km:
+		return true
+	}
+	return false
+}
+
+func (p LocationPrecision) meters() float64 {
+	switch p {
+	case Location100m:
+		return 100
+	case Location1km:
+		return 1000
+	}
+	return 0
+}
+
+// coarsest returns the less precise of the two
+func (p LocationPrecision) coarsest(o LocationPrecision) LocationPrecision {
+	if o.meters() > p.meters() {
+		return o
+	}
+	return p
+}
+
+// blur snaps the point to the center of its grid cell
+func (p LocationPrecision) blur(lat, lon float64) (float64, float64) {
+	m := p.meters()
+	if m == 0 {
+		return lat, lon
+	}
+
+	latStep := m / 111320.0
+	lat = (math.Floor(lat/latStep) + 0.5) * latStep
+	lonStep := m / (111320.0 * math.Max(math.Cos(lat*math.Pi/180), 0.01))
+	lon = (math.Floor(lon/lonStep) + 0.5) * lonStep
+	return lat, lon
+}
+
+func (ps *policyScan) dest() []interface{} {
+	out := make([]interface{}, len(ps))
+	for i := range ps {
+		out[i] = &ps[i]
+	}
+	return out
+}
+
+func (ps *policyScan) policies() (LocationPolicy, LocationPolicy) {
+	p := func(n []sql.NullString) LocationPolicy {
+		lp := LocationPolicy{Precision: LocationExact}
+		if n[0].Valid && LocationPrecision(n[0].String).Valid() {
+			lp.Precision = LocationPrecision(n[0].String)
+		}
+		lp.Start = n[1].String
+		lp.End = n[2].String
+		lp.OpID = OperationID(n[3].String)
+		return lp
+	}
+	return p(ps[0:4]), p(ps[4:8])
+}
+
+// share combines the policies and reports if the location is shared now, and how precisely
+func (ps *policyScan) share(now time.Time) (LocationPrecision, bool) {
+	team, agent := ps.policies()
+	if !team.active(now) || !agent.active(now) {
+		return "", false
+	}
+	return team.Precision.coarsest(agent.Precision), true
+}
+
+// inDailyWindow reports if now falls in the daily window from start to end, "15:04" UTC, which may wrap past midnight
+// an unset or invalid window is always open
+func inDailyWindow(now time.Time, start, end string) bool {
+	if start == "" || end == "" {
+		return true
+	}
+	st, err1 := time.Parse("15:04", start)
+	et, err2 := time.Parse("15:04", end)
+	if err1 != nil || err2 != nil {
+		return true
+	}
+
+	n := now.UTC().Hour()*60 + now.UTC().Minute()
+	s := st.Hour()*60 + st.Minute()
+	e := et.Hour()*60 + et.Minute()
+	if s <= e {
+		return n >= s && n < e
+	}
+	return n >= s || n < e
+}
+
+// validDailyWindow reports if start and end are both unset, or both "15:04"
+func validDailyWindow(start, end string) bool {
+	if (start == "") != (end == "") {
+		return false
+	}
+	for _, t := range []string{start, end} {
+		if t == "" {
+			continue
+		}
+		if _, err := time.Parse("15:04", t); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// active reports if the policy's windows are open
+func (lp LocationPolicy) active(now time.Time) bool {
+	if !inDailyWindow(now, lp.Start, lp.End) {
+		return false
+	}
+
+	if lp.OpID != "" {
+		var count int
+		if err := db.QueryRow("SELECT COUNT(*) FROM opphase WHERE opID = ? AND state = 'started'", lp.OpID).Scan(&count); err != nil {
+			log.Error(err)
+			return false
+		}
+		if count == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (lp *LocationPolicy) check() error {
+	if lp.Precision == "" {
+		lp.Precision = LocationExact
+	}
+	if !lp.Precision.Valid() {
+		return fmt.Errorf(ErrLocationPolicyInvalid)
+	}
+	if !validDailyWindow(lp.Start, lp.End) {
+		return fmt.Errorf(ErrLocationPolicyInvalid)
+	}
+	return nil
+}
+
+// LocationPolicy returns the team's location sharing policy
+func (teamID TeamID) LocationPolicy() (*LocationPolicy, error) {
+	var ps policyScan
+	if err := db.QueryRow("SELECT locprecision, locstart, locend, locop FROM team WHERE teamID = ?", teamID).Scan(ps.dest()[0:4]...); err != nil {
+		log.Error(err)
+		return nil, err
+	}
+	lp, _ := ps.policies()
+	return &lp, nil
+}
+
+// SetLocationPolicy sets the location sharing policy for every agent on the team
+// does not check team ownership -- caller should take care of authorization
+func (teamID TeamID) SetLocationPolicy(lp LocationPolicy) error {
+	if err := lp.check(); err != nil {
+		log.Warnw(err.Error(), "resource", teamID, "policy", lp)
+		return err
+	}
+	// the policy follows the op's phases, so the op must be one the team can read
+	if lp.OpID != "" {
+		if _, ok := lp.OpID.sharePrecision(map[TeamID]LocationPrecision{teamID: LocationExact}); !ok {
+			err := fmt.Errorf(ErrLocationPolicyOp)
+			log.Warnw(err.Error(), "resource", teamID, "policy", lp)
+			return err
+		}
+	}
+
+	if _, err := db.Exec("UPDATE team SET locprecision = ?, locstart = ?, locend = ?, locop = ? WHERE teamID = ?", lp.Precision, makeNullString(lp.Start), makeNullString(lp.End), makeNullString(string(lp.OpID)), teamID); err != nil {
+		log.Error(err)
+		return err
+	}
+	return nil
+}
+
+// LocationPolicy returns the agent's own location sharing policy for a team
+func (gid GoogleID) LocationPolicy(teamID TeamID) (*LocationPolicy, error) {
+	var ps policyScan
+	err := db.QueryRow("SELECT locprecision, locstart, locend, locop FROM agentteams WHERE gid = ? AND teamID = ?", gid, teamID).Scan(ps.dest()[0:4]...)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf(ErrAgentNotOnTeam)
+	}
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+	lp, _ := ps.policies()
+	return &lp, nil
+}
+
+// SetLocationPolicy sets the agent's own location sharing policy for a team; the stricter of this and the team's policy applies
+func (gid GoogleID) SetLocationPolicy(teamID TeamID, lp LocationPolicy) error {
+	if err := lp.check(); err != nil {
+		log.Warnw(err.Error(), "resource", teamID, "GID", gid, "policy", lp)
+		return err
+	}
+	if lp.OpID != "" {
+		o := Operation{ID: lp.OpID}
+		if read, _ := o.ReadAccess(gid); !read {
+			err := fmt.Errorf(ErrLocationPolicyOp)
+			log.Warnw(err.Error(), "resource", teamID, "GID", gid, "policy", lp)
+			return err
+		}
+	}
+
+	r, err := db.Exec("UPDATE agentteams SET locprecision = ?, locstart = ?, locend = ?, locop = ? WHERE gid = ? AND teamID = ?", lp.Precision, makeNullString(lp.Start), makeNullString(lp.End), makeNullString(string(lp.OpID)), gid, teamID)
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+	if n, _ := r.RowsAffected(); n == 0 {
+		if inteam, _ := gid.AgentInTeam(teamID); !inteam {
+			return fmt.Errorf(ErrAgentNotOnTeam)
+		}
+	}
+	return nil
+}
+
+// sharingTeams returns the teams which can see the agent's location right now, and at what precision
+func (gid GoogleID) sharingTeams() (map[TeamID]LocationPrecision, error) {
+	teams := make(map[TeamID]LocationPrecision)
+
+	rows, err := db.Query("SELECT x.teamID, "+policyColumns("x")+" FROM agentteams=x JOIN team ON x.teamID = team.teamID WHERE x.gid = ? AND x.shareLoc = 1", gid)
+	if err != nil {
+		log.Error(err)
+		return teams, err
+	}
+	defer rows.Close()
+
+	now := time.Now()
+	for rows.Next() {
+		var teamID TeamID
+		var ps policyScan
+		if err := rows.Scan(append([]interface{}{&teamID}, ps.dest()...)...); err != nil {
+			log.Error(err)
+			continue
+		}
+		if precision, ok := ps.share(now); ok {
+			teams[teamID] = precision
+		}
+	}
+	return teams, nil
+}
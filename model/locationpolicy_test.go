@@ -0,0 +1,66 @@
+package model
+
+import (
+	"testing"
+	"time"
+)
+
+func TestInDailyWindow(t *testing.T) {
+	at := func(hm string) time.Time {
+		tm, err := time.Parse("15:04", hm)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return time.Date(2024, 3, 1, tm.Hour(), tm.Minute(), 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name       string
+		now        string
+		start, end string
+		want       bool
+	}{
+		{"inside", "12:00", "09:00", "17:00", true},
+		{"at the start", "09:00", "09:00", "17:00", true},
+		{"at the end", "17:00", "09:00", "17:00", false},
+		{"before", "08:59", "09:00", "17:00", false},
+		{"wrapped, late evening", "23:30", "22:00", "06:00", true},
+		{"wrapped, at midnight", "00:00", "22:00", "06:00", true},
+		{"wrapped, early morning", "05:59", "22:00", "06:00", true},
+		{"wrapped, at the end", "06:00", "22:00", "06:00", false},
+		{"wrapped, midday", "12:00", "22:00", "06:00", false},
+		{"empty window", "12:00", "12:00", "12:00", false},
+		{"unset", "12:00", "", "", true},
+		{"invalid", "12:00", "noon", "17:00", true},
+	}
+	for _, tc := range tests {
+		if got := inDailyWindow(at(tc.now), tc.start, tc.end); got != tc.want {
+			t.Errorf("%s: %s in %s-%s got %v, want %v", tc.name, tc.now, tc.start, tc.end, got, tc.want)
+		}
+	}
+
+	// the window is UTC whatever the zone of now
+	berlin := time.FixedZone("CET", 60*60)
+	if !inDailyWindow(time.Date(2024, 3, 1, 0, 30, 0, 0, berlin), "23:00", "00:00") {
+		t.Error("00:30 CET is not 23:30 UTC")
+	}
+}
+
+func TestValidDailyWindow(t *testing.T) {
+	tests := []struct {
+		start, end string
+		want       bool
+	}{
+		{"", "", true},
+		{"22:00", "06:00", true},
+		{"22:00", "", false},
+		{"", "06:00", false},
+		{"25:00", "06:00", false},
+		{"10pm", "06:00", false},
+	}
+	for _, tc := range tests {
+		if got := validDailyWindow(tc.start, tc.end); got != tc.want {
+			t.Errorf("%q-%q: got %v, want %v", tc.start, tc.end, got, tc.want)
+		}
+	}
+}
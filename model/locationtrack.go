@@ -0,0 +1,148 @@
+package model
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/wasabee-project/Wasabee-Server/log"
+)
+
+// MaxTrackDays is the longest a team may keep its location history
+const MaxTrackDays = 90
+
+// TrackPoint is one recorded agent location
+type TrackPoint struct {
+	Lat  float64 `json:"lat"`
+	Lon  float64 `json:"lng"`
+	Time string  `json:"time"` // time.RFC3339 format
+}
+
+// AgentTrack is the location history of one agent on a team
+type AgentTrack struct {
+	Gid    GoogleID     `json:"gid"`
+	Name   string       `json:"name"`
+	Points []TrackPoint `json:"points"`
+}
+
+// TrackDays returns how many days of location history the team keeps, 0 means history is not recorded
+func (teamID TeamID) TrackDays() (int, error) {
+	var days int
+	if err := db.QueryRow("SELECT trackdays FROM team WHERE teamID = ?", teamID).Scan(&days); err != nil {
+		log.Error(err)
+		return 0, err
+	}
+	return days, nil
+}
+
+// SetTrackDays sets the retention of the team's location history, 0 stops recording and discards the history
+// does not check team ownership -- caller should take care of authorization
+func (teamID TeamID) SetTrackDays(days int) error {
+	if days < 0 || days > MaxTrackDays {
+		err := fmt.Errorf(ErrTrackDaysInvalid)
+		log.Warnw(err.Error(), "resource", teamID, "days", days)
+		return err
+	}
+
+	if _, err := db.Exec("UPDATE team SET trackdays = ? WHERE teamID = ?", days, teamID); err != nil {
+		log.Error(err)
+		return err
+	}
+	if days == 0 {
+		if _, err := db.Exec("DELETE FROM locationtrack WHERE teamID = ?", teamID); err != nil {
+			log.Error(err)
+			return err
+		}
+	}
+	return nil
+}
+
+// SetTrackLoc sets whether the agent's locations are kept in the team's history, turning it off discards the agent's history on the team
+func (gid GoogleID) SetTrackLoc(teamID TeamID, state bool) error {
+	if _, err := db.Exec("UPDATE agentteams SET trackloc = ? WHERE gid = ? AND teamID = ?", state, gid, teamID); err != nil {
+		log.Error(err)
+		return err
+	}
+	if !state {
+		return gid.purgeLocationTrack(teamID)
+	}
+	return nil
+}
+
+// purgeLocationTrack discards the agent's location history on the team
+func (gid GoogleID) purgeLocationTrack(teamID TeamID) error {
+	if _, err := db.Exec("DELETE FROM locationtrack WHERE teamID = ? AND gid = ?", teamID, gid); err != nil {
+		log.Error(err)
+		return err
+	}
+	return nil
+}
+
+// trackLocation adds a point to the history of every team which records history, with which the agent shares location and to whose history the agent has opted in
+// the point is recorded with the same precision the team would see it
+func (gid GoogleID) trackLocation(lat, lon float64) error {
+	if lat == 0 && lon == 0 {
+		return nil
+	}
+
+	teams, err := gid.sharingTeams()
+	if err != nil {
+		return err
+	}
+
+	for teamID, precision := range teams {
+		blat, blon := precision.blur(lat, lon)
+		if _, err := db.Exec("INSERT INTO locationtrack (teamID, gid, lat, lon, ts) SELECT team.teamID, x.gid, ?, ?, UTC_TIMESTAMP() FROM team JOIN agentteams=x ON team.teamID = x.teamID WHERE team.teamID = ? AND team.trackdays > 0 AND x.gid = ? AND x.trackloc = 1", blat, blon, teamID, gid); err != nil {
+			log.Error(err)
+			return err
+		}
+	}
+	return nil
+}
+
+// LocationTrack returns the team's location history between start and end, grouped by agent
+// if agent is set, only that agent's history is returned
+func (teamID TeamID) LocationTrack(start, end time.Time, agent GoogleID) ([]AgentTrack, error) {
+	tracks := make([]AgentTrack, 0)
+
+	q := "SELECT gid, lat, lon, ts FROM locationtrack WHERE teamID = ? AND ts >= ? AND ts <= ?"
+	args := []interface{}{teamID, start.UTC(), end.UTC()}
+	if agent != "" {
+		q = q + " AND gid = ?"
+		args = append(args, agent)
+	}
+	q = q + " ORDER BY gid, ts"
+
+	rows, err := db.Query(q, args...)
+	if err != nil {
+		log.Error(err)
+		return tracks, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var gid GoogleID
+		var p TrackPoint
+		var ts string
+		if err := rows.Scan(&gid, &p.Lat, &p.Lon, &ts); err != nil {
+			log.Error(err)
+			continue
+		}
+		if t, err := time.ParseInLocation("2006-01-02 15:04:05", ts, time.UTC); err == nil {
+			p.Time = t.Format(time.RFC3339)
+		}
+
+		if len(tracks) == 0 || tracks[len(tracks)-1].Gid != gid {
+			name, _ := gid.IngressName()
+			tracks = append(tracks, AgentTrack{Gid: gid, Name: name})
+		}
+		tracks[len(tracks)-1].Points = append(tracks[len(tracks)-1].Points, p)
+	}
+	return tracks, nil
+}
+
+// LocationTrackClean removes location history older than each team's retention
+func LocationTrackClean() {
+	if _, err := db.Exec("DELETE locationtrack FROM locationtrack JOIN team ON locationtrack.teamID = team.teamID WHERE locationtrack.ts < DATE_SUB(UTC_TIMESTAMP(), INTERVAL team.trackdays DAY)"); err != nil {
+		log.Error(err)
+	}
+}
@@ -170,9 +170,9 @@ func (opID OperationID) deleteMarker(mid MarkerID, tx *sql.Tx) error {
 
 // PopulateMarkers fills in the Markers list for the Operation.
 func (o *Operation) populateMarkers(zones []Zone, gid GoogleID, assignments map[TaskID][]GoogleID, depends map[TaskID][]TaskID) error {
-	var comment sql.NullString
+	var comment, phase sql.NullString
 
-	rows, err := db.Query("SELECT marker.ID, marker.PortalID, marker.type, task.comment, task.state, task.taskorder, task.zone, task.delta FROM marker JOIN task ON marker.ID = task.ID WHERE marker.opID = ? AND marker.opID = task.opID", o.ID)
+	rows, err := db.Query("SELECT marker.ID, marker.PortalID, marker.type, task.comment, task.state, task.taskorder, task.zone, task.delta, task.phase FROM marker JOIN task ON marker.ID = task.ID WHERE marker.opID = ? AND marker.opID = task.opID", o.ID)
 	if err != nil {
 		log.Error(err)
 		return err
@@ -183,7 +183,7 @@ func (o *Operation) populateMarkers(zones []Zone, gid GoogleID, assignments map[
 		tmpMarker := Marker{}
 		tmpMarker.opID = o.ID
 
-		err := rows.Scan(&tmpMarker.ID, &tmpMarker.PortalID, &tmpMarker.Type, &comment, &tmpMarker.State, &tmpMarker.Order, &tmpMarker.Zone, &tmpMarker.DeltaMinutes)
+		err := rows.Scan(&tmpMarker.ID, &tmpMarker.PortalID, &tmpMarker.Type, &comment, &tmpMarker.State, &tmpMarker.Order, &tmpMarker.Zone, &tmpMarker.DeltaMinutes, &phase)
 		if err != nil {
 			log.Error(err)
 			continue
@@ -210,6 +210,10 @@ func (o *Operation) populateMarkers(zones []Zone, gid GoogleID, assignments map[
 			tmpMarker.Comment = ""
 		}
 
+		if phase.Valid {
+			tmpMarker.Phase = PhaseID(phase.String)
+		}
+
 		// if the marker is not in the zones with which we are concerned AND not assigned to me, skip
 		if !tmpMarker.Zone.inZones(zones) && !tmpMarker.IsAssignedTo(gid) {
 			continue
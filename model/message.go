@@ -0,0 +1,157 @@
+package model
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/wasabee-project/Wasabee-Server/log"
+	"github.com/wasabee-project/Wasabee-Server/messaging"
+	"github.com/wasabee-project/Wasabee-Server/util"
+)
+
+// AgentMessage is a stored agent-to-agent message
+type AgentMessage struct {
+	ID       int64    `json:"id"`
+	From     GoogleID `json:"from,omitempty"` // unset for messages from the server
+	FromName string   `json:"fromname,omitempty"`
+	To       GoogleID `json:"to"`
+	ToName   string   `json:"toname"`
+	Message  string   `json:"message"`
+	Sent     string   `json:"sent"`           // time.RFC1123 format
+	Read     string   `json:"read,omitempty"` // time.RFC1123 format, unset while unread
+}
+
+// SendAgentMessage stores a message in the recipient's inbox and notifies them on every bus they use;
+// delivered is false if no bus could notify them, the message is still stored
+func (gid GoogleID) SendAgentMessage(to GoogleID, message string) (*AgentMessage, bool, error) {
+	message = util.Sanitize(message)
+	if message == "" {
+		return nil, false, fmt.Errorf(ErrEmptyMessage)
+	}
+	if !messaging.CanSendTo(messaging.GoogleID(gid), messaging.GoogleID(to)) {
+		err := fmt.Errorf(messaging.ErrBlocked)
+		log.Infow(err.Error(), "GID", gid, "to", to)
+		return nil, false, err
+	}
+
+	r, err := db.Exec("INSERT INTO messagelog (timestamp, sender, gid, message) VALUES (UTC_TIMESTAMP(), ?, ?, ?)", makeNullString(string(gid)), to, message)
+	if err != nil {
+		log.Error(err)
+		return nil, false, err
+	}
+	id, err := r.LastInsertId()
+	if err != nil {
+		log.Error(err)
+		return nil, false, err
+	}
+
+	m, err := gid.message(id)
+	if err != nil {
+		return nil, false, err
+	}
+
+	delivered, _ := messaging.SendAgentMessage(messaging.GoogleID(to), messaging.AgentMessage{
+		ID:       fmt.Sprint(m.ID),
+		From:     messaging.GoogleID(m.From),
+		FromName: m.FromName,
+		Text:     m.Message,
+	})
+	return m, delivered, nil
+}
+
+// message loads a single message the agent sent or received
+func (gid GoogleID) message(id int64) (*AgentMessage, error) {
+	messages, err := messageQuery("WHERE ID = ? AND (gid = ? OR sender = ?)", id, gid, gid)
+	if err != nil {
+		return nil, err
+	}
+	if len(messages) == 0 {
+		return nil, fmt.Errorf(ErrMessageNotFound)
+	}
+	return &messages[0], nil
+}
+
+// Inbox returns a page of messages sent to the agent, newest first.
+// before is the ID of the last message of the previous page, 0 for the first page.
+func (gid GoogleID) Inbox(before int64, limit int, unreadOnly bool) ([]AgentMessage, error) {
+	where := "WHERE gid = ?"
+	if unreadOnly {
+		where += " AND readat IS NULL"
+	}
+	if before > 0 {
+		return messageQuery(where+" AND ID < ? ORDER BY ID DESC LIMIT ?", gid, before, limit)
+	}
+	return messageQuery(where+" ORDER BY ID DESC LIMIT ?", gid, limit)
+}
+
+// Outbox returns a page of messages sent by the agent, newest first.
+func (gid GoogleID) Outbox(before int64, limit int) ([]AgentMessage, error) {
+	if before > 0 {
+		return messageQuery("WHERE sender = ? AND ID < ? ORDER BY ID DESC LIMIT ?", gid, before, limit)
+	}
+	return messageQuery("WHERE sender = ? ORDER BY ID DESC LIMIT ?", gid, limit)
+}
+
+// UnreadMessages returns the number of unread messages in the agent's inbox
+func (gid GoogleID) UnreadMessages() (int, error) {
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM messagelog WHERE gid = ? AND readat IS NULL", gid).Scan(&count); err != nil {
+		log.Error(err)
+		return 0, err
+	}
+	return count, nil
+}
+
+// MarkMessageRead marks a message in the agent's inbox as read
+func (gid GoogleID) MarkMessageRead(id int64) error {
+	r, err := db.Exec("UPDATE messagelog SET readat = COALESCE(readat, UTC_TIMESTAMP()) WHERE ID = ? AND gid = ?", id, gid)
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+	if n, _ := r.RowsAffected(); n == 0 {
+		if _, err := gid.message(id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MarkAllMessagesRead marks every message in the agent's inbox as read
+func (gid GoogleID) MarkAllMessagesRead() error {
+	if _, err := db.Exec("UPDATE messagelog SET readat = UTC_TIMESTAMP() WHERE gid = ? AND readat IS NULL", gid); err != nil {
+		log.Error(err)
+		return err
+	}
+	return nil
+}
+
+func messageQuery(where string, args ...interface{}) ([]AgentMessage, error) {
+	messages := make([]AgentMessage, 0)
+
+	rows, err := db.Query("SELECT ID, sender, gid, message, timestamp, readat FROM messagelog "+where, args...)
+	if err != nil {
+		log.Error(err)
+		return messages, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var m AgentMessage
+		var sender, readat sql.NullString
+		var sent string
+		if err := rows.Scan(&m.ID, &sender, &m.To, &m.Message, &sent, &readat); err != nil {
+			log.Error(err)
+			continue
+		}
+		if sender.Valid {
+			m.From = GoogleID(sender.String)
+			m.FromName, _ = m.From.IngressName()
+		}
+		m.ToName, _ = m.To.IngressName()
+		m.Sent = sqlTimeToRFC1123(sql.NullString{String: sent, Valid: true})
+		m.Read = sqlTimeToRFC1123(readat)
+		messages = append(messages, m)
+	}
+	return messages, nil
+}
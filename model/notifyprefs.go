@@ -0,0 +1,171 @@
+package model
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/wasabee-project/Wasabee-Server/log"
+	"github.com/wasabee-project/Wasabee-Server/messaging"
+)
+
+// NotifyPrefs are an agent's choices of which notifications reach them, and by which bus
+type NotifyPrefs struct {
+	Buses        map[string][]messaging.Event `json:"buses"`                // bus name to the events it delivers; buses not listed deliver everything
+	QuietStart   string                       `json:"quietstart,omitempty"` // daily window with no notifications, "15:04" UTC; may wrap past midnight
+	QuietEnd     string                       `json:"quietend,omitempty"`
+	AssignedOnly bool                         `json:"assignedonly"` // op notifications only for ops with a task assigned to the agent
+}
+
+// NotifyPrefs returns the agent's notification preferences, every registered bus is listed
+func (gid GoogleID) NotifyPrefs() (*NotifyPrefs, error) {
+	p := NotifyPrefs{
+		Buses: make(map[string][]messaging.Event),
+	}
+
+	var start, end sql.NullString
+	err := db.QueryRow("SELECT quietstart, quietend, assignedonly FROM notifyprefs WHERE gid = ?", gid).Scan(&start, &end, &p.AssignedOnly)
+	if err != nil && err != sql.ErrNoRows {
+		log.Error(err)
+		return nil, err
+	}
+	p.QuietStart = start.String
+	p.QuietEnd = end.String
+
+	for _, bus := range messaging.Buses() {
+		p.Buses[bus] = messaging.Events
+	}
+
+	rows, err := db.Query("SELECT bus, events FROM notifybus WHERE gid = ?", gid)
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var bus, events string
+		if err := rows.Scan(&bus, &events); err != nil {
+			log.Error(err)
+			continue
+		}
+		p.Buses[bus] = splitEvents(events)
+	}
+	return &p, nil
+}
+
+// SetNotifyPrefs replaces the agent's notification preferences
+func (gid GoogleID) SetNotifyPrefs(p NotifyPrefs) error {
+	if !validDailyWindow(p.QuietStart, p.QuietEnd) {
+		err := fmt.Errorf(ErrNotifyPrefsInvalid)
+		log.Warnw(err.Error(), "GID", gid, "quietstart", p.QuietStart, "quietend", p.QuietEnd)
+		return err
+	}
+	for bus, events := range p.Buses {
+		for _, e := range events {
+			if !validEvent(e) {
+				err := fmt.Errorf(ErrNotifyPrefsInvalid)
+				log.Warnw(err.Error(), "GID", gid, "bus", bus, "event", e)
+				return err
+			}
+		}
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && err != sql.ErrTxDone {
+			log.Error(err)
+		}
+	}()
+
+	if _, err := tx.Exec("INSERT INTO notifyprefs (gid, quietstart, quietend, assignedonly) VALUES (?, ?, ?, ?) ON DUPLICATE KEY UPDATE quietstart = ?, quietend = ?, assignedonly = ?",
+		gid, makeNullString(p.QuietStart), makeNullString(p.QuietEnd), p.AssignedOnly,
+		makeNullString(p.QuietStart), makeNullString(p.QuietEnd), p.AssignedOnly); err != nil {
+		log.Error(err)
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM notifybus WHERE gid = ?", gid); err != nil {
+		log.Error(err)
+		return err
+	}
+	for bus, events := range p.Buses {
+		e := make([]string, 0, len(events))
+		for _, ev := range events {
+			e = append(e, string(ev))
+		}
+		if _, err := tx.Exec("INSERT INTO notifybus (gid, bus, events) VALUES (?, ?, ?)", gid, bus, strings.Join(e, ",")); err != nil {
+			log.Error(err)
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// notifyFilter is registered with the messaging system to apply each agent's preferences
+func notifyFilter(g messaging.GoogleID, bus string, event messaging.Event, opID messaging.OperationID) bool {
+	gid := GoogleID(g)
+
+	var start, end, events sql.NullString
+	var assignedOnly sql.NullBool
+	err := db.QueryRow("SELECT notifyprefs.quietstart, notifyprefs.quietend, notifyprefs.assignedonly, notifybus.events FROM agent LEFT JOIN notifyprefs ON agent.gid = notifyprefs.gid LEFT JOIN notifybus ON agent.gid = notifybus.gid AND notifybus.bus = ? WHERE agent.gid = ?", bus, gid).Scan(&start, &end, &assignedOnly, &events)
+	if err != nil {
+		// unknown agents and database trouble should not swallow notifications
+		if err != sql.ErrNoRows {
+			log.Error(err)
+		}
+		return true
+	}
+
+	if start.Valid && end.Valid && inDailyWindow(time.Now(), start.String, end.String) {
+		return false
+	}
+
+	if events.Valid {
+		wanted := false
+		for _, e := range splitEvents(events.String) {
+			if e == event {
+				wanted = true
+				break
+			}
+		}
+		if !wanted {
+			return false
+		}
+	}
+
+	if assignedOnly.Bool && opID != "" {
+		var count int
+		if err := db.QueryRow("SELECT COUNT(*) FROM assignments WHERE opID = ? AND gid = ?", opID, gid).Scan(&count); err != nil {
+			log.Error(err)
+			return true
+		}
+		if count == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func validEvent(e messaging.Event) bool {
+	for _, v := range messaging.Events {
+		if e == v {
+			return true
+		}
+	}
+	return false
+}
+
+func splitEvents(in string) []messaging.Event {
+	out := make([]messaging.Event, 0)
+	for _, e := range strings.Split(in, ",") {
+		if e != "" {
+			out = append(out, messaging.Event(e))
+		}
+	}
+	return out
+}
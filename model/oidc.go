@@ -0,0 +1,47 @@
+package model
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/wasabee-project/Wasabee-Server/log"
+	"github.com/wasabee-project/Wasabee-Server/util"
+)
+
+// IdentityOIDC is the identity provider for the configured OpenID Connect provider of that name
+func IdentityOIDC(name string) IdentityProvider {
+	return IdentityProvider(fmt.Sprintf("oidc:%s", name))
+}
+
+// OIDCtoGID returns a GoogleID for an OpenID Connect identity
+// identities linked to an agent sign in as that agent, others get an agent of their own
+func OIDCtoGID(provider, subject string) (GoogleID, error) {
+	linked, err := IdentityToGID(IdentityOIDC(provider), subject)
+	if err != nil {
+		return "", err
+	}
+	if linked != "" {
+		return linked, nil
+	}
+
+	// subjects are only unique per provider and can be long, derive a stable ID that fits
+	h := sha256.Sum256([]byte(provider + "\x00" + subject))
+	faked := fmt.Sprintf("O-%s", hex.EncodeToString(h[:])[:19])
+
+	return GoogleID(faked).Canonical(), nil
+}
+
+// SetOIDCName names the agent from its OpenID Connect profile, unless it already has a name from intel
+func (gid GoogleID) SetOIDCName(name string) error {
+	name = util.Sanitize(name)
+	if name == "" {
+		return nil
+	}
+
+	if _, err := db.Exec("UPDATE agent SET intelname = LEFT(?, 15) WHERE gid = ? AND intelname IS NULL", name, gid); err != nil {
+		log.Error(err)
+		return err
+	}
+	return nil
+}
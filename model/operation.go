@@ -33,6 +33,7 @@ type Operation struct {
 	Keys          []KeyOnHand       `json:"keysonhand"`
 	Fetched       string            `json:"fetched"` // time.RFC1123 format
 	Zones         []ZoneListElement `json:"zones"`
+	Phases        []Phase           `json:"phases,omitempty"`
 }
 
 // OpStat is a minimal struct to determine if the op has been updated
@@ -446,25 +447,36 @@ func (o *Operation) Delete(gid GoogleID) error {
 		log.Error(err)
 		return err
 	}
+	return o.ID.delete(gid)
+}
+
+// AdminDelete removes an operation and all associated data regardless of ownership -- caller must be a server administrator
+func (o *Operation) AdminDelete(gid GoogleID) error {
+	if !o.ID.Valid() {
+		return fmt.Errorf(ErrOpNotFound)
+	}
+	return o.ID.delete(gid)
+}
 
-	_, err := db.Exec("INSERT INTO deletedops (opID, deletedate, gid) VALUES (?, UTC_TIMESTAMP(), ?)", o.ID, gid)
+func (opID OperationID) delete(gid GoogleID) error {
+	_, err := db.Exec("INSERT INTO deletedops (opID, deletedate, gid) VALUES (?, UTC_TIMESTAMP(), ?)", opID, gid)
 	if err != nil {
 		log.Error(err)
 		// carry on
 	}
 
-	_, err = db.Exec("DELETE FROM operation WHERE ID = ?", o.ID)
+	_, err = db.Exec("DELETE FROM operation WHERE ID = ?", opID)
 	if err != nil {
 		log.Error(err)
 		return err
 	}
 
 	// the foreign key constraints should take care of these, but just in case...
-	tables := []string{"marker", "link", "portal", "opkeys", "permissions"}
+	tables := []string{"marker", "link", "portal", "opkeys", "opgeofence", "geofencestate", "opphase", "opshare", "permissions"}
 	for _, v := range tables {
 		// #nosec
 		q := fmt.Sprintf("DELETE FROM %s WHERE opID = ?", v)
-		if _, err = db.Exec(q, o.ID); err != nil {
+		if _, err = db.Exec(q, opID); err != nil {
 			log.Info(err)
 			// carry on
 		}
@@ -561,6 +573,15 @@ func (o *Operation) Populate(gid GoogleID) error {
 		return err
 	}
 
+	// tasks in phases which have not started are only visible to those who can change the op
+	if err = o.populatePhases(); err != nil {
+		log.Error(err)
+		return err
+	}
+	if !o.WriteAccess(gid) {
+		o.filterPhases()
+	}
+
 	if err = o.populateAnchors(); err != nil {
 		log.Error(err)
 		return err
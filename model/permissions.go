@@ -2,12 +2,18 @@ package model
 
 // OpPermission is the form of permission
 type OpPermission struct {
-	OpID   OperationID `json:"opid"`
-	TeamID TeamID      `json:"teamid"`
-	Role   OpPermRole  `json:"role"`
-	Zone   Zone        `json:"zone"`
+	OpID      OperationID `json:"opid"`
+	TeamID    TeamID      `json:"teamid"`
+	Role      OpPermRole  `json:"role"`
+	Zone      Zone        `json:"zone"`
+	NotBefore string      `json:"notbefore,omitempty"` // time.RFC1123 format, unset means immediately
+	Expires   string      `json:"expires,omitempty"`   // time.RFC1123 format, unset means never
+	active    bool        // set by the database, false if outside the not-before/expires window
 }
 
+// permActive is the SQL clause used to limit queries to permissions which are currently in effect
+const permActive = "(permissions.notbefore IS NULL OR permissions.notbefore <= UTC_TIMESTAMP()) AND (permissions.expires IS NULL OR permissions.expires > UTC_TIMESTAMP())"
+
 // OpPermRole is just a convenience class for the permission string
 type OpPermRole string
 
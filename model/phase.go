@@ -0,0 +1,248 @@
+package model
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/wasabee-project/Wasabee-Server/log"
+	"github.com/wasabee-project/Wasabee-Server/util"
+)
+
+// PhaseID wrapper to ensure type safety
+type PhaseID string
+
+// Phase is a named, ordered stage of an operation (e.g. clear, link, field)
+type Phase struct {
+	ID    PhaseID `json:"ID"`
+	Name  string  `json:"name"`
+	Order int16   `json:"order"`
+	State string  `json:"state"` // pending, started, finished
+}
+
+// phase states
+const (
+	PhasePending  = "pending"
+	PhaseStarted  = "started"
+	PhaseFinished = "finished"
+)
+
+// String returns the string version of a PhaseID
+func (p PhaseID) String() string {
+	return string(p)
+}
+
+// open reports if the tasks in the phase are visible and workable
+func (p Phase) open() bool {
+	return p.State == PhaseStarted || p.State == PhaseFinished
+}
+
+// AddPhase creates a new phase for an operation
+func (opID OperationID) AddPhase(name string, order int16) (*Phase, error) {
+	name = util.Sanitize(name)
+	if name == "" {
+		err := fmt.Errorf(ErrEmptyPhaseName)
+		log.Warnw(err.Error(), "resource", opID)
+		return nil, err
+	}
+
+	p := Phase{
+		ID:    PhaseID(util.GenerateID(40)),
+		Name:  name,
+		Order: order,
+		State: PhasePending,
+	}
+
+	if _, err := db.Exec("INSERT INTO opphase (ID, opID, name, phaseorder, state) VALUES (?, ?, ?, ?, ?)", p.ID, opID, p.Name, p.Order, p.State); err != nil {
+		log.Error(err)
+		return nil, err
+	}
+	return &p, nil
+}
+
+// Phases returns the phases of an operation, in order
+func (opID OperationID) Phases() ([]Phase, error) {
+	phases := make([]Phase, 0)
+
+	rows, err := db.Query("SELECT ID, name, phaseorder, state FROM opphase WHERE opID = ? ORDER BY phaseorder", opID)
+	if err != nil {
+		log.Error(err)
+		return phases, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var p Phase
+		if err := rows.Scan(&p.ID, &p.Name, &p.Order, &p.State); err != nil {
+			log.Error(err)
+			continue
+		}
+		phases = append(phases, p)
+	}
+	return phases, nil
+}
+
+// Phase returns a single phase of an operation
+func (opID OperationID) Phase(phaseID PhaseID) (*Phase, error) {
+	var p Phase
+
+	err := db.QueryRow("SELECT ID, name, phaseorder, state FROM opphase WHERE opID = ? AND ID = ?", opID, phaseID).Scan(&p.ID, &p.Name, &p.Order, &p.State)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf(ErrPhaseNotFound)
+	}
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+	return &p, nil
+}
+
+// UpdatePhase changes the name and order of a phase
+func (opID OperationID) UpdatePhase(phaseID PhaseID, name string, order int16) error {
+	name = util.Sanitize(name)
+	if name == "" {
+		return fmt.Errorf(ErrEmptyPhaseName)
+	}
+
+	if _, err := opID.Phase(phaseID); err != nil {
+		return err
+	}
+
+	if _, err := db.Exec("UPDATE opphase SET name = ?, phaseorder = ? WHERE opID = ? AND ID = ?", name, order, opID, phaseID); err != nil {
+		log.Error(err)
+		return err
+	}
+	return nil
+}
+
+// DeletePhase removes a phase from an operation, the phase's tasks are no longer gated
+func (opID OperationID) DeletePhase(phaseID PhaseID) error {
+	if _, err := db.Exec("UPDATE task SET phase = NULL WHERE opID = ? AND phase = ?", opID, phaseID); err != nil {
+		log.Error(err)
+		return err
+	}
+
+	if _, err := db.Exec("DELETE FROM opphase WHERE opID = ? AND ID = ?", opID, phaseID); err != nil {
+		log.Error(err)
+		return err
+	}
+	return nil
+}
+
+// StartPhase opens a phase, making its tasks visible to the agents.
+// Phases open in order: every earlier phase must already have been started.
+func (opID OperationID) StartPhase(phaseID PhaseID) (*Phase, error) {
+	p, err := opID.Phase(phaseID)
+	if err != nil {
+		return nil, err
+	}
+	if p.State != PhasePending {
+		return nil, fmt.Errorf(ErrPhaseAlreadyStarted)
+	}
+
+	var earlier int
+	if err := db.QueryRow("SELECT COUNT(*) FROM opphase WHERE opID = ? AND phaseorder < ? AND state = ?", opID, p.Order, PhasePending).Scan(&earlier); err != nil {
+		log.Error(err)
+		return nil, err
+	}
+	if earlier > 0 {
+		err := fmt.Errorf(ErrPhaseOutOfOrder)
+		log.Warnw(err.Error(), "resource", opID, "phase", phaseID)
+		return nil, err
+	}
+
+	if _, err := db.Exec("UPDATE opphase SET state = ? WHERE opID = ? AND ID = ?", PhaseStarted, opID, phaseID); err != nil {
+		log.Error(err)
+		return nil, err
+	}
+	p.State = PhaseStarted
+	return p, nil
+}
+
+// FinishPhase marks a started phase as finished; its tasks remain visible
+func (opID OperationID) FinishPhase(phaseID PhaseID) (*Phase, error) {
+	p, err := opID.Phase(phaseID)
+	if err != nil {
+		return nil, err
+	}
+	if p.State != PhaseStarted {
+		return nil, fmt.Errorf(ErrPhaseNotStarted)
+	}
+
+	if _, err := db.Exec("UPDATE opphase SET state = ? WHERE opID = ? AND ID = ?", PhaseFinished, opID, phaseID); err != nil {
+		log.Error(err)
+		return nil, err
+	}
+	p.State = PhaseFinished
+	return p, nil
+}
+
+// SetPhase puts a task in a phase, an empty phaseID removes it from any phase
+func (t *Task) SetPhase(phaseID PhaseID) error {
+	if phaseID == "" {
+		if _, err := db.Exec("UPDATE task SET phase = NULL WHERE ID = ? AND opID = ?", t.ID, t.opID); err != nil {
+			log.Error(err)
+			return err
+		}
+		return nil
+	}
+
+	if _, err := t.opID.Phase(phaseID); err != nil {
+		return err
+	}
+
+	if _, err := db.Exec("UPDATE task SET phase = ? WHERE ID = ? AND opID = ?", phaseID, t.ID, t.opID); err != nil {
+		log.Error(err)
+		return err
+	}
+	return nil
+}
+
+// PhaseOpen reports if the task's phase has been started, tasks with no phase are always open
+func (t *Task) PhaseOpen() bool {
+	var closed int
+
+	err := db.QueryRow("SELECT COUNT(*) FROM task JOIN opphase ON task.phase = opphase.ID AND task.opID = opphase.opID WHERE task.ID = ? AND task.opID = ? AND opphase.state = ?", t.ID, t.opID, PhasePending).Scan(&closed)
+	if err != nil {
+		log.Error(err)
+		return false
+	}
+	return closed == 0
+}
+
+func (o *Operation) populatePhases() error {
+	phases, err := o.ID.Phases()
+	if err != nil {
+		return err
+	}
+	o.Phases = phases
+	return nil
+}
+
+// filterPhases removes the tasks in phases which have not yet started
+func (o *Operation) filterPhases() {
+	closed := make(map[PhaseID]bool)
+	for _, p := range o.Phases {
+		if !p.open() {
+			closed[p.ID] = true
+		}
+	}
+	if len(closed) == 0 {
+		return
+	}
+
+	markers := make([]Marker, 0, len(o.Markers))
+	for _, m := range o.Markers {
+		if !closed[m.Phase] {
+			markers = append(markers, m)
+		}
+	}
+	o.Markers = markers
+
+	links := make([]Link, 0, len(o.Links))
+	for _, l := range o.Links {
+		if !closed[l.Phase] {
+			links = append(links, l)
+		}
+	}
+	o.Links = links
+}
@@ -0,0 +1,248 @@
+package model
+
+import (
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/wasabee-project/Wasabee-Server/log"
+	"github.com/wasabee-project/Wasabee-Server/messaging"
+	"github.com/wasabee-project/Wasabee-Server/util"
+)
+
+// PresenceStatus is an agent's availability for tasks
+type PresenceStatus string
+
+// presence statuses
+const (
+	PresenceAvailable PresenceStatus = "available"
+	PresenceBusy      PresenceStatus = "busy"
+	PresenceOffline   PresenceStatus = "offline"
+	PresenceAway      PresenceStatus = "away"
+)
+
+// an agent with no activity for this long is considered offline
+const presenceTimeout = 15 * time.Minute
+
+// activity is only written to the database this often per agent
+const presenceSeenInterval = time.Minute
+
+// Presence is an agent's availability, either set by the agent or derived from their activity
+type Presence struct {
+	Status   PresenceStatus `json:"status"`
+	Note     string         `json:"note,omitempty"`
+	Until    string         `json:"until,omitempty"`    // time.RFC1123 format, only for away
+	LastSeen string         `json:"lastseen,omitempty"` // time.RFC1123 format
+	Auto     bool           `json:"auto"`               // derived from activity, not set by the agent
+}
+
+var presenceSeen sync.Map
+
+// presenceSwept is when PresenceSweep last ran, only the background task uses it
+var presenceSwept = time.Now()
+
+// presenceColumns are the columns scanned by presenceScan
+const presenceColumns = "presence.status, presence.note, presence.until, presence.lastseen"
+
+type presenceScan [4]sql.NullString
+
+// Valid reports if the status is a known one
+func (s PresenceStatus) Valid() bool {
+	switch s {
+	case PresenceAvailable, PresenceBusy, PresenceOffline, PresenceAway:
+		return true
+	}
+	return false
+}
+
+func (ps *presenceScan) dest() []interface{} {
+	out := make([]interface{}, len(ps))
+	for i := range ps {
+		out[i] = &ps[i]
+	}
+	return out
+}
+
+// presence resolves the stored values into the current presence
+func (ps *presenceScan) presence(now time.Time) *Presence {
+	p := Presence{
+		LastSeen: sqlTimeToRFC1123(ps[3]),
+	}
+
+	status := PresenceStatus(ps[0].String)
+	if status == PresenceAway && ps[2].Valid {
+		until, err := time.ParseInLocation("2006-01-02 15:04:05", ps[2].String, time.UTC)
+		if err == nil && until.Before(now) {
+			// back from away, fall through to the derived status
+			status = ""
+		}
+	}
+
+	if ps[0].Valid && status.Valid() {
+		p.Status = status
+		p.Note = ps[1].String
+		if status == PresenceAway {
+			p.Until = sqlTimeToRFC1123(ps[2])
+		}
+		return &p
+	}
+
+	p.Auto = true
+	p.Status = PresenceOffline
+	if ps[3].Valid {
+		seen, err := time.ParseInLocation("2006-01-02 15:04:05", ps[3].String, time.UTC)
+		if err == nil && now.Sub(seen) < presenceTimeout {
+			p.Status = PresenceAvailable
+		}
+	}
+	return &p
+}
+
+// Presence returns the agent's current presence
+func (gid GoogleID) Presence() (*Presence, error) {
+	var ps presenceScan
+	err := db.QueryRow("SELECT "+presenceColumns+" FROM presence WHERE gid = ?", gid).Scan(ps.dest()...)
+	if err != nil && err != sql.ErrNoRows {
+		log.Error(err)
+		return nil, err
+	}
+	return ps.presence(time.Now()), nil
+}
+
+// SetPresence sets the agent's status; until is only used for away, the zero time means until changed
+// an empty status clears it, and the presence is derived from activity again
+func (gid GoogleID) SetPresence(status PresenceStatus, note string, until time.Time) error {
+	if status != "" && !status.Valid() {
+		err := fmt.Errorf(ErrPresenceInvalid)
+		log.Warnw(err.Error(), "GID", gid, "status", status)
+		return err
+	}
+	if status != PresenceAway {
+		until = time.Time{}
+	}
+	if !until.IsZero() && !until.After(time.Now()) {
+		err := fmt.Errorf(ErrPresenceInvalid)
+		log.Warnw(err.Error(), "GID", gid, "until", until)
+		return err
+	}
+
+	note = util.Sanitize(note)
+	if len(note) > 255 {
+		note = note[:255]
+	}
+
+	if _, err := db.Exec("INSERT INTO presence (gid, status, note, until, lastseen) VALUES (?, ?, ?, ?, UTC_TIMESTAMP()) ON DUPLICATE KEY UPDATE status = ?, note = ?, until = ?, lastseen = UTC_TIMESTAMP()",
+		gid, makeNullString(string(status)), makeNullString(note), makeNullTime(until),
+		makeNullString(string(status)), makeNullString(note), makeNullTime(until)); err != nil {
+		log.Error(err)
+		return err
+	}
+	presenceSeen.Store(gid, time.Now())
+
+	messaging.SendPresence(messaging.GoogleID(gid))
+	return nil
+}
+
+// Seen records activity by the agent, from which their presence is derived when they have not set one
+// teammates are told when the agent comes back online
+func (gid GoogleID) Seen() {
+	now := time.Now()
+	if last, ok := presenceSeen.Load(gid); ok && now.Sub(last.(time.Time)) < presenceSeenInterval {
+		return
+	}
+	presenceSeen.Store(gid, now)
+
+	p, err := gid.Presence()
+	if err != nil {
+		return
+	}
+
+	if _, err := db.Exec("INSERT INTO presence (gid, lastseen) VALUES (?, UTC_TIMESTAMP()) ON DUPLICATE KEY UPDATE lastseen = UTC_TIMESTAMP()", gid); err != nil {
+		log.Error(err)
+		return
+	}
+
+	if p.Auto && p.Status == PresenceOffline {
+		messaging.SendPresence(messaging.GoogleID(gid))
+	}
+}
+
+// Unavailable returns the agents whose presence is anything but available, so planners can be warned when assigning them tasks
+func Unavailable(gids []GoogleID) []GoogleID {
+	var out []GoogleID
+	for _, gid := range gids {
+		if gid == "" {
+			continue
+		}
+		p, err := gid.Presence()
+		if err != nil {
+			continue
+		}
+		if p.Status != PresenceAvailable {
+			out = append(out, gid)
+		}
+	}
+	return out
+}
+
+// PresenceSweep tells teammates about the presence changes nobody made since the last sweep:
+// agents whose activity timed out and agents whose away time ended
+func PresenceSweep() {
+	now := time.Now()
+	last := presenceSwept
+	presenceSwept = now
+
+	const f = "2006-01-02 15:04:05"
+	rows, err := db.Query("SELECT gid FROM presence WHERE (status IS NULL AND lastseen > ? AND lastseen <= ?) OR (status = ? AND until > ? AND until <= ?)",
+		last.Add(-presenceTimeout).UTC().Format(f), now.Add(-presenceTimeout).UTC().Format(f), PresenceAway, last.UTC().Format(f), now.UTC().Format(f))
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var gid GoogleID
+		if err := rows.Scan(&gid); err != nil {
+			log.Error(err)
+			continue
+		}
+		messaging.SendPresence(messaging.GoogleID(gid))
+	}
+
+	presenceSeenClean()
+}
+
+// presenceSeenClean forgets agents who have not been active recently, their next activity is written through
+func presenceSeenClean() {
+	now := time.Now()
+	presenceSeen.Range(func(k, v interface{}) bool {
+		if now.Sub(v.(time.Time)) > presenceSeenInterval {
+			presenceSeen.Delete(k)
+		}
+		return true
+	})
+}
+
+// FirebasePresenceTokens returns the tokens of every agent who shares a team with this agent
+func (gid GoogleID) FirebasePresenceTokens() ([]string, error) {
+	var out []string
+
+	rows, err := db.Query("SELECT DISTINCT token FROM firebase JOIN agentteams ON firebase.gid = agentteams.gid WHERE agentteams.teamID IN (SELECT teamID FROM agentteams WHERE gid = ?) AND firebase.gid != ?", gid, gid)
+	if err != nil {
+		log.Error(err)
+		return out, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var token string
+		if err := rows.Scan(&token); err != nil {
+			log.Error(err)
+			continue
+		}
+		out = append(out, token)
+	}
+	return out, nil
+}
@@ -0,0 +1,169 @@
+package model
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/wasabee-project/Wasabee-Server/log"
+	"github.com/wasabee-project/Wasabee-Server/util"
+)
+
+// RefreshTokenLifetime is how long a refresh token can be used; each use replaces it with a new one
+const RefreshTokenLifetime = time.Hour * 24 * 30
+
+// only a hash of each refresh token or API token is stored
+func hashToken(token string) string {
+	h := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(h[:])
+}
+
+// NewRefreshToken starts a new chain of refresh tokens for the agent, paired with the access JWT issued at login.
+// Each chain is one session, recorded with the client which logged in.
+func (gid GoogleID) NewRefreshToken(jwtID string, jwtExpires time.Time, useragent, ip string) (string, error) {
+	token := util.GenerateID(64)
+	family := util.GenerateID(40)
+	expires := makeNullTime(time.Now().Add(RefreshTokenLifetime))
+
+	tx, err := db.Begin()
+	if err != nil {
+		log.Error(err)
+		return "", err
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && err != sql.ErrTxDone {
+			log.Error(err)
+		}
+	}()
+
+	if _, err := tx.Exec("INSERT INTO session (ID, gid, jwtid, useragent, ip, created, lastseen, expires) VALUES (?, ?, ?, LEFT(?, 255), LEFT(?, 64), UTC_TIMESTAMP(), UTC_TIMESTAMP(), ?)",
+		family, gid, jwtID, useragent, ip, expires); err != nil {
+		log.Error(err)
+		return "", err
+	}
+	if _, err := tx.Exec("INSERT INTO refreshtoken (ID, family, gid, jwtid, jwtexpires, created, expires) VALUES (?, ?, ?, ?, ?, UTC_TIMESTAMP(), ?)",
+		hashToken(token), family, gid, jwtID, makeNullTime(jwtExpires), expires); err != nil {
+		log.Error(err)
+		return "", err
+	}
+	if err := tx.Commit(); err != nil {
+		log.Error(err)
+		return "", err
+	}
+	return token, nil
+}
+
+// RotateRefreshToken exchanges a refresh token for the next one in its chain, paired with a new access JWT.
+// Each refresh token works once; presenting a used one means it was copied, so the whole chain and its access JWTs are revoked.
+func RotateRefreshToken(token, jwtID string, jwtExpires time.Time) (GoogleID, string, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		log.Error(err)
+		return "", "", err
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && err != sql.ErrTxDone {
+			log.Error(err)
+		}
+	}()
+
+	var gid GoogleID
+	var family string
+	var used sql.NullString
+	var revoked, expired bool
+	err = tx.QueryRow("SELECT gid, family, used, revoked, expires < UTC_TIMESTAMP() FROM refreshtoken WHERE ID = ? FOR UPDATE", hashToken(token)).Scan(&gid, &family, &used, &revoked, &expired)
+	if err == sql.ErrNoRows {
+		return "", "", fmt.Errorf(ErrRefreshTokenInvalid)
+	}
+	if err != nil {
+		log.Error(err)
+		return "", "", err
+	}
+	if revoked || expired {
+		return "", "", fmt.Errorf(ErrRefreshTokenInvalid)
+	}
+	if used.Valid {
+		if err := revokeRefreshFamily(tx, family); err != nil {
+			return "", "", err
+		}
+		if err := tx.Commit(); err != nil {
+			log.Error(err)
+			return "", "", err
+		}
+		err := fmt.Errorf(ErrRefreshTokenReused)
+		log.Warnw(err.Error(), "GID", gid, "family", family, "used", used.String)
+		return "", "", err
+	}
+
+	if _, err := tx.Exec("UPDATE refreshtoken SET used = UTC_TIMESTAMP() WHERE ID = ?", hashToken(token)); err != nil {
+		log.Error(err)
+		return "", "", err
+	}
+	next := util.GenerateID(64)
+	expires := makeNullTime(time.Now().Add(RefreshTokenLifetime))
+	if _, err := tx.Exec("INSERT INTO refreshtoken (ID, family, gid, jwtid, jwtexpires, created, expires) VALUES (?, ?, ?, ?, ?, UTC_TIMESTAMP(), ?)",
+		hashToken(next), family, gid, jwtID, makeNullTime(jwtExpires), expires); err != nil {
+		log.Error(err)
+		return "", "", err
+	}
+	// chains started before sessions were recorded get their session now
+	if _, err := tx.Exec("INSERT INTO session (ID, gid, jwtid, created, lastseen, expires) VALUES (?, ?, ?, UTC_TIMESTAMP(), UTC_TIMESTAMP(), ?) ON DUPLICATE KEY UPDATE jwtid = VALUES(jwtid), lastseen = VALUES(lastseen), expires = VALUES(expires)",
+		family, gid, jwtID, expires); err != nil {
+		log.Error(err)
+		return "", "", err
+	}
+	if err := tx.Commit(); err != nil {
+		log.Error(err)
+		return "", "", err
+	}
+	return gid, next, nil
+}
+
+// RevokeRefreshToken ends the agent's session the refresh token belongs to; it returns the IDs of the access JWTs revoked so other servers can be told
+func (gid GoogleID) RevokeRefreshToken(token string) ([]string, error) {
+	var family string
+	err := db.QueryRow("SELECT family FROM refreshtoken WHERE ID = ? AND gid = ? AND revoked = 0", hashToken(token), gid).Scan(&family)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf(ErrRefreshTokenInvalid)
+	}
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+	return gid.RevokeSession(SessionID(family))
+}
+
+// execer is satisfied by both *sql.DB and *sql.Tx
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// revokeRefreshFamily marks every refresh token in the chain revoked, revokes the access JWTs they were paired with, and ends the session
+func revokeRefreshFamily(e execer, family string) error {
+	if _, err := e.Exec("UPDATE refreshtoken SET revoked = 1 WHERE family = ?", family); err != nil {
+		log.Error(err)
+		return err
+	}
+	if _, err := e.Exec("INSERT IGNORE INTO revokedjwt (ID, gid, expires, revoked) SELECT jwtid, gid, jwtexpires, UTC_TIMESTAMP() FROM refreshtoken WHERE family = ? AND jwtid IS NOT NULL AND jwtexpires > UTC_TIMESTAMP()", family); err != nil {
+		log.Error(err)
+		return err
+	}
+	if _, err := e.Exec("DELETE FROM session WHERE ID = ?", family); err != nil {
+		log.Error(err)
+		return err
+	}
+	return nil
+}
+
+// RefreshTokenClean removes refresh tokens, and the sessions they kept going, which have expired
+func RefreshTokenClean() {
+	if _, err := db.Exec("DELETE FROM refreshtoken WHERE expires < UTC_TIMESTAMP()"); err != nil {
+		log.Error(err)
+	}
+	if _, err := db.Exec("DELETE FROM session WHERE expires < UTC_TIMESTAMP()"); err != nil {
+		log.Error(err)
+	}
+	sessionSeenClean()
+}
@@ -1,15 +1,33 @@
 package model
 
 import (
-	"github.com/wasabee-project/Wasabee-Server/util"
+	"time"
+
+	"github.com/wasabee-project/Wasabee-Server/log"
 )
 
-// LoadRevokedJWT does nothing yet
-func LoadRevokedJWT() *util.Safemap {
-	return util.NewSafemap()
+// RevokeJWT records a revoked JWT ID; the record is kept until the token would have expired anyway
+func RevokeJWT(tokenID string, gid GoogleID, expires time.Time) error {
+	if _, err := db.Exec("INSERT INTO revokedjwt (ID, gid, expires, revoked) VALUES (?, ?, ?, UTC_TIMESTAMP()) ON DUPLICATE KEY UPDATE expires = GREATEST(expires, VALUES(expires))", tokenID, makeNullString(string(gid)), makeNullTime(expires)); err != nil {
+		log.Error(err)
+		return err
+	}
+	return nil
+}
+
+// IsRevokedJWT checks if a JWT ID has been revoked; callers must treat an error as revoked
+func IsRevokedJWT(tokenID string) (bool, error) {
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM revokedjwt WHERE ID = ?", tokenID).Scan(&count); err != nil {
+		log.Error(err)
+		return true, err
+	}
+	return count > 0, nil
 }
 
-// StoreRevokedJWT does nothing yet
-func StoreRevokedJWT(r *util.Safemap) {
-	return
+// RevokedJWTClean removes revocations of tokens which have since expired
+func RevokedJWTClean() {
+	if _, err := db.Exec("DELETE FROM revokedjwt WHERE expires < UTC_TIMESTAMP()"); err != nil {
+		log.Error(err)
+	}
 }
@@ -0,0 +1,120 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/wasabee-project/Wasabee-Server/log"
+)
+
+// RosterImportEntry is a single resolved line of a roster import
+type RosterImportEntry struct {
+	Input string   `json:"input"`
+	Gid   GoogleID `json:"gid"`
+}
+
+// RosterImport reports the outcome of a roster import
+type RosterImport struct {
+	Added     []RosterImportEntry `json:"added"`
+	OnTeam    []RosterImportEntry `json:"onteam"`    // already members, nothing done
+	Ambiguous []string            `json:"ambiguous"` // matched more than one agent
+	Unknown   []string            `json:"unknown"`
+}
+
+// ImportRoster resolves each identifier (GoogleID, EnlID, agent name or @telegram name) and adds the matches to the team
+// does not check team ownership -- caller should take care of authorization
+func (teamID TeamID) ImportRoster(actor GoogleID, agents []string) (*RosterImport, error) {
+	r := RosterImport{
+		Added:     make([]RosterImportEntry, 0),
+		OnTeam:    make([]RosterImportEntry, 0),
+		Ambiguous: make([]string, 0),
+		Unknown:   make([]string, 0),
+	}
+	seen := make(map[GoogleID]bool)
+
+	for _, in := range agents {
+		in = strings.TrimSpace(in)
+		if in == "" {
+			continue
+		}
+
+		gid, err := resolveRosterAgent(in)
+		if err != nil {
+			switch err.Error() {
+			case ErrAgentNotFound:
+				r.Unknown = append(r.Unknown, in)
+			case ErrMultipleV, ErrMultipleRocks, ErrMultipleIntelname:
+				r.Ambiguous = append(r.Ambiguous, in)
+			default:
+				return &r, err
+			}
+			continue
+		}
+
+		e := RosterImportEntry{Input: in, Gid: gid}
+		if seen[gid] {
+			continue
+		}
+		seen[gid] = true
+
+		if inteam, _ := gid.AgentInTeam(teamID); inteam {
+			r.OnTeam = append(r.OnTeam, e)
+			continue
+		}
+		if err := teamID.AddAgent(gid, actor, "roster import"); err != nil {
+			log.Error(err)
+			return &r, err
+		}
+		r.Added = append(r.Added, e)
+	}
+	return &r, nil
+}
+
+// resolveRosterAgent is ToGid, but reports names which match several agents instead of skipping them
+func resolveRosterAgent(in string) (GoogleID, error) {
+	// ToGid does not check that a GoogleID is registered
+	if len(in) == 21 {
+		if GoogleID(in).Valid() {
+			return GoogleID(in), nil
+		}
+		return "", fmt.Errorf(ErrAgentNotFound)
+	}
+
+	if len(in) == 40 {
+		gid, err := GetGIDFromEnlID(in)
+		if err != nil {
+			return "", err
+		}
+		if gid != "" {
+			return gid, nil
+		}
+	}
+
+	gid, err := ToGid(in)
+	if err == nil {
+		return gid, nil
+	}
+	if err.Error() != ErrAgentNotFound {
+		return "", err
+	}
+
+	// SearchAgentName skips over names that are not unique, find out if that is why there was no match
+	for _, q := range []struct {
+		query string
+		err   string
+	}{
+		{"SELECT COUNT(gid) FROM v WHERE LOWER(agent) = LOWER(?)", ErrMultipleV},
+		{"SELECT COUNT(gid) FROM rocks WHERE LOWER(agent) = LOWER(?)", ErrMultipleRocks},
+		{"SELECT COUNT(gid) FROM agent WHERE LOWER(intelname) = LOWER(?)", ErrMultipleIntelname},
+	} {
+		var count int
+		if err := db.QueryRow(q.query, in).Scan(&count); err != nil {
+			log.Error(err)
+			return "", err
+		}
+		if count > 1 {
+			return "", fmt.Errorf(q.err)
+		}
+	}
+	return "", fmt.Errorf(ErrAgentNotFound)
+}
@@ -0,0 +1,158 @@
+package model
+
+import (
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/wasabee-project/Wasabee-Server/log"
+)
+
+// SessionID wrapper to ensure type safety
+type SessionID string
+
+// Session is one login of an agent, kept going with refresh tokens
+type Session struct {
+	ID        SessionID `json:"id"`
+	JwtID     string    `json:"jti"` // the access JWT currently issued to the session
+	UserAgent string    `json:"useragent"`
+	IP        string    `json:"ip"`
+	Created   string    `json:"created"`  // time.RFC1123 format
+	LastSeen  string    `json:"lastseen"` // time.RFC1123 format
+	Expires   string    `json:"expires"`  // when the session ends if it is not refreshed
+	Current   bool      `json:"current,omitempty"`
+}
+
+const sessionSeenInterval = time.Minute
+
+var sessionSeen sync.Map
+
+// Sessions lists the agent's sessions, most recently used first
+func (gid GoogleID) Sessions() ([]Session, error) {
+	sessions := make([]Session, 0)
+
+	rows, err := db.Query("SELECT ID, jwtid, useragent, ip, created, lastseen, expires FROM session WHERE gid = ? AND expires > UTC_TIMESTAMP() ORDER BY lastseen DESC", gid)
+	if err != nil {
+		log.Error(err)
+		return sessions, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var s Session
+		var created, lastseen, expires string
+		if err := rows.Scan(&s.ID, &s.JwtID, &s.UserAgent, &s.IP, &created, &lastseen, &expires); err != nil {
+			log.Error(err)
+			continue
+		}
+		s.Created = sqlTimeToRFC1123(sql.NullString{String: created, Valid: true})
+		s.LastSeen = sqlTimeToRFC1123(sql.NullString{String: lastseen, Valid: true})
+		s.Expires = sqlTimeToRFC1123(sql.NullString{String: expires, Valid: true})
+		sessions = append(sessions, s)
+	}
+	return sessions, nil
+}
+
+// RevokeSession ends one of the agent's sessions; it returns the IDs of the access JWTs revoked so other servers can be told
+func (gid GoogleID) RevokeSession(id SessionID) ([]string, error) {
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM session WHERE ID = ? AND gid = ?", id, gid).Scan(&count); err != nil {
+		log.Error(err)
+		return nil, err
+	}
+	if count == 0 {
+		return nil, fmt.Errorf(ErrSessionNotFound)
+	}
+
+	jwts, err := sessionJWTs(string(id))
+	if err != nil {
+		return nil, err
+	}
+	if err := revokeRefreshFamily(db, string(id)); err != nil {
+		return nil, err
+	}
+	log.Infow("session revoked", "GID", gid, "session", id)
+	return jwts, nil
+}
+
+// RevokeSessions ends every session the agent holds; it returns the IDs of the access JWTs revoked so other servers can be told
+func (gid GoogleID) RevokeSessions() ([]string, error) {
+	rows, err := db.Query("SELECT DISTINCT family FROM refreshtoken WHERE gid = ? AND revoked = 0", gid)
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	families := make([]string, 0)
+	for rows.Next() {
+		var family string
+		if err := rows.Scan(&family); err != nil {
+			log.Error(err)
+			continue
+		}
+		families = append(families, family)
+	}
+	rows.Close()
+
+	revoked := make([]string, 0)
+	for _, family := range families {
+		jwts, err := sessionJWTs(family)
+		if err != nil {
+			return revoked, err
+		}
+		if err := revokeRefreshFamily(db, family); err != nil {
+			return revoked, err
+		}
+		revoked = append(revoked, jwts...)
+	}
+	log.Infow("sessions revoked", "GID", gid, "count", len(families))
+	return revoked, nil
+}
+
+// sessionJWTs lists the access JWTs issued to a session which have not yet expired
+func sessionJWTs(family string) ([]string, error) {
+	jwts := make([]string, 0)
+
+	rows, err := db.Query("SELECT jwtid FROM refreshtoken WHERE family = ? AND jwtid IS NOT NULL AND jwtexpires > UTC_TIMESTAMP()", family)
+	if err != nil {
+		log.Error(err)
+		return jwts, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var jwtID string
+		if err := rows.Scan(&jwtID); err != nil {
+			log.Error(err)
+			continue
+		}
+		jwts = append(jwts, jwtID)
+	}
+	return jwts, nil
+}
+
+// SessionSeen records the use of an access JWT on its session, at most once a minute
+func SessionSeen(jwtID, ip string) {
+	now := time.Now()
+	if last, ok := sessionSeen.Load(jwtID); ok && now.Sub(last.(time.Time)) < sessionSeenInterval {
+		return
+	}
+	sessionSeen.Store(jwtID, now)
+
+	if _, err := db.Exec("UPDATE session SET lastseen = UTC_TIMESTAMP(), ip = LEFT(?, 64) WHERE jwtid = ?", ip, jwtID); err != nil {
+		log.Error(err)
+	}
+}
+
+// sessionSeenClean forgets access JWTs which have not been used recently, they are replaced every hour
+func sessionSeenClean() {
+	now := time.Now()
+	sessionSeen.Range(func(k, v interface{}) bool {
+		if now.Sub(v.(time.Time)) > sessionSeenInterval {
+			sessionSeen.Delete(k)
+		}
+		return true
+	})
+}
@@ -0,0 +1,229 @@
+package model
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/wasabee-project/Wasabee-Server/log"
+	"github.com/wasabee-project/Wasabee-Server/util"
+)
+
+// ShareToken is the secret used to view an operation without logging in
+type ShareToken string
+
+// OpShare is a read-only link to an operation for agents who are not on any of the op's teams
+type OpShare struct {
+	Token   ShareToken  `json:"token"`
+	OpID    OperationID `json:"opid"`
+	Zone    Zone        `json:"zone"`              // ZoneAll for the entire op
+	Expires string      `json:"expires,omitempty"` // time.RFC1123 format, unset means never
+	Redact  bool        `json:"redact"`            // remove agent identities and key counts
+	Creator GoogleID    `json:"creator"`
+	Created string      `json:"created"` // time.RFC1123 format
+}
+
+func (s ShareToken) String() string {
+	return string(s)
+}
+
+// NewShare creates a new share token for an operation, only the op owner may create them
+func (opID OperationID) NewShare(gid GoogleID, zone Zone, expires time.Time, redact bool) (*OpShare, error) {
+	if !opID.IsOwner(gid) {
+		err := fmt.Errorf(ErrNotOpOwner)
+		log.Errorw(err.Error(), "GID", gid, "resource", opID)
+		return nil, err
+	}
+
+	if !expires.IsZero() && !expires.After(time.Now()) {
+		err := fmt.Errorf(ErrShareExpiresInPast)
+		log.Errorw(err.Error(), "GID", gid, "resource", opID, "expires", expires)
+		return nil, err
+	}
+
+	if !zone.Valid() {
+		zone = ZoneAll
+	}
+
+	s := OpShare{
+		Token:   ShareToken(util.GenerateID(40)),
+		OpID:    opID,
+		Zone:    zone,
+		Redact:  redact,
+		Creator: gid,
+		Created: time.Now().UTC().Format(time.RFC1123),
+	}
+	if !expires.IsZero() {
+		s.Expires = expires.UTC().Format(time.RFC1123)
+	}
+
+	if _, err := db.Exec("INSERT INTO opshare (token, opID, gid, zone, expires, redact, created) VALUES (?, ?, ?, ?, ?, ?, UTC_TIMESTAMP())", s.Token, opID, gid, zone, makeNullTime(expires), redact); err != nil {
+		log.Error(err)
+		return nil, err
+	}
+	return &s, nil
+}
+
+// Shares lists all the share tokens for an operation, only the op owner may see them
+func (opID OperationID) Shares(gid GoogleID) ([]OpShare, error) {
+	var shares []OpShare
+
+	if !opID.IsOwner(gid) {
+		err := fmt.Errorf(ErrNotOpOwner)
+		log.Errorw(err.Error(), "GID", gid, "resource", opID)
+		return shares, err
+	}
+
+	rows, err := db.Query("SELECT token, zone, expires, redact, gid, created FROM opshare WHERE opID = ?", opID)
+	if err != nil && err != sql.ErrNoRows {
+		log.Error(err)
+		return shares, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var s OpShare
+		var expires, created sql.NullString
+		if err := rows.Scan(&s.Token, &s.Zone, &expires, &s.Redact, &s.Creator, &created); err != nil {
+			log.Error(err)
+			continue
+		}
+		s.OpID = opID
+		s.Expires = sqlTimeToRFC1123(expires)
+		s.Created = sqlTimeToRFC1123(created)
+		shares = append(shares, s)
+	}
+	return shares, nil
+}
+
+// DeleteShare revokes a share token, only the op owner may revoke them
+func (opID OperationID) DeleteShare(gid GoogleID, token ShareToken) error {
+	if !opID.IsOwner(gid) {
+		err := fmt.Errorf(ErrNotOpOwner)
+		log.Errorw(err.Error(), "GID", gid, "resource", opID)
+		return err
+	}
+
+	if _, err := db.Exec("DELETE FROM opshare WHERE opID = ? AND token = ?", opID, token); err != nil {
+		log.Error(err)
+		return err
+	}
+	return nil
+}
+
+// Share looks up an unexpired share token
+func (token ShareToken) Share() (*OpShare, error) {
+	var s OpShare
+	var expires, created sql.NullString
+
+	err := db.QueryRow("SELECT token, opID, zone, expires, redact, gid, created FROM opshare WHERE token = ? AND (expires IS NULL OR expires > UTC_TIMESTAMP())", token).Scan(&s.Token, &s.OpID, &s.Zone, &expires, &s.Redact, &s.Creator, &created)
+	if err == sql.ErrNoRows {
+		err := fmt.Errorf(ErrShareNotFound)
+		log.Infow(err.Error(), "token", token)
+		return nil, err
+	}
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+	s.Expires = sqlTimeToRFC1123(expires)
+	s.Created = sqlTimeToRFC1123(created)
+	return &s, nil
+}
+
+// Populate fills in a sanitized copy of the shared operation
+// team permissions are never shown; if Redact is set, assignments, the creator and key counts are removed as well
+func (s *OpShare) Populate() (*Operation, error) {
+	o := Operation{ID: s.OpID}
+	var comment sql.NullString
+
+	err := db.QueryRow("SELECT name, gid, color, modified, comment, lasteditid, referencetime FROM operation WHERE ID = ?", o.ID).Scan(&o.Name, &o.Gid, &o.Color, &o.Modified, &comment, &o.LastEditID, &o.ReferenceTime)
+	if err == sql.ErrNoRows {
+		err = fmt.Errorf(ErrOpNotFound)
+		log.Errorw(err.Error(), "resource", o.ID, "token", s.Token)
+		return nil, err
+	}
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+
+	o.Fetched = fmt.Sprint(time.Now().UTC().Format(time.RFC1123))
+	st, err := time.ParseInLocation("2006-01-02 15:04:05", o.ReferenceTime, time.UTC)
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+	o.ReferenceTime = st.Format(time.RFC1123)
+	if comment.Valid {
+		o.Comment = comment.String
+	}
+
+	zones := []Zone{s.Zone}
+
+	assignments := make(map[TaskID][]GoogleID)
+	if !s.Redact {
+		if assignments, err = o.ID.assignmentPrecache(); err != nil {
+			log.Error(err)
+			return nil, err
+		}
+	}
+
+	depends, err := o.ID.dependsPrecache()
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+
+	if err = o.populatePortals(); err != nil {
+		log.Error(err)
+		return nil, err
+	}
+
+	// no agent is logged in, so nothing is shown because of an assignment
+	if err = o.populateMarkers(zones, "", assignments, depends); err != nil {
+		log.Error(err)
+		return nil, err
+	}
+
+	if err = o.populateLinks(zones, "", assignments, depends); err != nil {
+		log.Error(err)
+		return nil, err
+	}
+
+	// share links never see tasks in phases which have not started
+	if err = o.populatePhases(); err != nil {
+		log.Error(err)
+		return nil, err
+	}
+	o.filterPhases()
+
+	if err = o.populateAnchors(); err != nil {
+		log.Error(err)
+		return nil, err
+	}
+
+	if !s.Redact {
+		if err = o.populateKeys(); err != nil {
+			log.Error(err)
+			return nil, err
+		}
+	} else {
+		o.Gid = ""
+	}
+
+	if !ZoneAll.inZones(zones) {
+		if err = o.filterPortals(); err != nil {
+			log.Error(err)
+			return nil, err
+		}
+	}
+
+	if err = o.populateZones(); err != nil {
+		log.Error(err)
+		return nil, err
+	}
+
+	o.Teams = nil
+	return &o, nil
+}
@@ -32,6 +32,7 @@ type Task struct {
 	State        string     `json:"state"`
 	Comment      string     `json:"comment"`
 	Order        int16      `json:"order"`
+	Phase        PhaseID    `json:"phase,omitempty"`
 	opID         OperationID
 }
 
@@ -289,6 +290,10 @@ func (t *Task) IsAssignedTo(gid GoogleID) bool {
 
 // Claim assignes a task to the calling agent
 func (t *Task) Claim(gid GoogleID) error {
+	if !t.PhaseOpen() {
+		return fmt.Errorf(ErrPhaseNotOpen)
+	}
+
 	if _, err := db.Exec("INSERT IGNORE INTO assignments (opID, taskID, gid) VALUES (?,?,?)", t.opID, t.ID, gid); err != nil {
 		log.Error(err)
 		return err
@@ -302,6 +307,10 @@ func (t *Task) Claim(gid GoogleID) error {
 
 // Complete marks as task as completed
 func (t *Task) Complete() error {
+	if !t.PhaseOpen() {
+		return fmt.Errorf(ErrPhaseNotOpen)
+	}
+
 	if _, err := db.Exec("UPDATE task SET state = 'completed' WHERE ID = ? AND opID = ?", t.ID, t.opID); err != nil {
 		log.Error(err)
 		return err
@@ -320,6 +329,10 @@ func (t *Task) Incomplete() error {
 
 // Acknowledge marks a task as acknowledged
 func (t *Task) Acknowledge() error {
+	if !t.PhaseOpen() {
+		return fmt.Errorf(ErrPhaseNotOpen)
+	}
+
 	if _, err := db.Exec("UPDATE task SET state = 'acknowledged' WHERE ID = ? AND opID = ?", t.ID, t.opID); err != nil {
 		log.Error(err)
 		return err
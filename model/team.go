@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"fmt"
 	"strconv"
+	"time"
 
 	"github.com/wasabee-project/Wasabee-Server/log"
 	"github.com/wasabee-project/Wasabee-Server/messaging"
@@ -15,39 +16,46 @@ type TeamID string
 
 // TeamData is the wrapper type containing all the team info
 type TeamData struct {
-	Name          string       `json:"name"`
-	ID            TeamID       `json:"id"`
-	TeamMembers   []TeamMember `json:"agents"`
-	RocksComm     string       `json:"rc,omitempty"`
-	RocksKey      string       `json:"rk,omitempty"`
-	JoinLinkToken string       `json:"jlt,omitempty"`
-	VTeam         int64        `json:"vt,omitempty"`
-	VRole         int8         `json:"vr,omitempty"`
+	Name          string        `json:"name"`
+	ID            TeamID        `json:"id"`
+	TeamMembers   []TeamMember  `json:"agents"`
+	RocksComm     string        `json:"rc,omitempty"`
+	RocksKey      string        `json:"rk,omitempty"`
+	JoinLinkToken string        `json:"jlt,omitempty"`
+	VTeam         int64         `json:"vt,omitempty"`
+	VRole         int8          `json:"vr,omitempty"`
+	Parent        TeamID        `json:"parent,omitempty"`
+	TrackDays     int           `json:"trackdays"`              // days of location history kept, 0 is off
+	Invites       []TeamInvite  `json:"invites,omitempty"`      // only shown to owners and admins
+	JoinRequests  []JoinRequest `json:"joinrequests,omitempty"` // only shown to owners and admins
 }
 
 // TeamMember is the light version of AgentData, containing visible information exported to teams
 type TeamMember struct {
-	Gid           GoogleID `json:"id"`
-	Name          string   `json:"name"`
-	VName         string   `json:"vname,omitempty"`
-	RocksName     string   `json:"rocksname,omitempty"`
-	IntelName     string   `json:"intelname,omitempty"`
-	CommunityName string   `json:"communityname,omitempty"`
-	Level         uint8    `json:"level,omitempty"`
-	EnlID         string   `json:"enlid,omitempty"`
-	PictureURL    string   `json:"pic,omitempty"`
-	Verified      bool     `json:"Vverified"`
-	Blacklisted   bool     `json:"blacklisted"`
-	RocksVerified bool     `json:"rocks"`
-	RocksSmurf    bool     `json:"smurf"`
-	IntelFaction  string   `json:"intelfaction"`
-	Comment       string   `json:"squad,omitempty"`
-	ShareLocation bool     `json:"state"`
-	Lat           float64  `json:"lat,omitempty"`
-	Lon           float64  `json:"lng,omitempty"`
-	Date          string   `json:"date"`
-	ShareWD       bool     `json:"shareWD"`
-	LoadWD        bool     `json:"loadWD"`
+	Gid           GoogleID  `json:"id"`
+	Name          string    `json:"name"`
+	VName         string    `json:"vname,omitempty"`
+	RocksName     string    `json:"rocksname,omitempty"`
+	IntelName     string    `json:"intelname,omitempty"`
+	CommunityName string    `json:"communityname,omitempty"`
+	Level         uint8     `json:"level,omitempty"`
+	EnlID         string    `json:"enlid,omitempty"`
+	PictureURL    string    `json:"pic,omitempty"`
+	Verified      bool      `json:"Vverified"`
+	Blacklisted   bool      `json:"blacklisted"`
+	RocksVerified bool      `json:"rocks"`
+	RocksSmurf    bool      `json:"smurf"`
+	IntelFaction  string    `json:"intelfaction"`
+	Comment       string    `json:"squad,omitempty"`
+	ShareLocation bool      `json:"state"`
+	Lat           float64   `json:"lat,omitempty"`
+	Lon           float64   `json:"lng,omitempty"`
+	Date          string    `json:"date"`
+	ShareWD       bool      `json:"shareWD"`
+	LoadWD        bool      `json:"loadWD"`
+	Role          TeamRole  `json:"role"`
+	Team          TeamID    `json:"team,omitempty"` // only set in merged sub-team views
+	Presence      *Presence `json:"presence,omitempty"`
 }
 
 // AgentInTeam checks to see if a agent is in a team and enabled.
@@ -70,14 +78,15 @@ func (teamID TeamID) FetchTeam() (*TeamData, error) {
 	var teamList TeamData
 	// var rows *sql.Rows
 
-	rows, err := db.Query("SELECT agentteams.gid, v.Agent, agent.IntelName, rocks.Agent, agentteams.comment, agentteams.shareLoc, Y(locations.loc), X(locations.loc), locations.upTime, v.Verified, v.Blacklisted, v.EnlID, rocks.verified, rocks.smurf, agentteams.sharewd, agentteams.loadwd, agent.intelfaction, agent.communityname, agent.picurl "+
-		" FROM agentteams JOIN team ON agentteams.teamID = team.teamID JOIN agent ON agentteams.gid = agent.gid JOIN locations ON agentteams.gid = locations.gid LEFT JOIN v ON agentteams.gid = v.gid LEFT JOIN rocks ON agentteams.gid = rocks.gid WHERE agentteams.teamID = ?", teamID)
+	rows, err := db.Query("SELECT agentteams.gid, v.Agent, agent.IntelName, rocks.Agent, agentteams.comment, agentteams.shareLoc, Y(locations.loc), X(locations.loc), locations.upTime, v.Verified, v.Blacklisted, v.EnlID, rocks.verified, rocks.smurf, agentteams.sharewd, agentteams.loadwd, agent.intelfaction, agent.communityname, agent.picurl, IF(team.owner = agentteams.gid, 'owner', agentteams.role), "+policyColumns("agentteams")+", "+presenceColumns+
+		" FROM agentteams JOIN team ON agentteams.teamID = team.teamID JOIN agent ON agentteams.gid = agent.gid JOIN locations ON agentteams.gid = locations.gid LEFT JOIN v ON agentteams.gid = v.gid LEFT JOIN rocks ON agentteams.gid = rocks.gid LEFT JOIN presence ON agentteams.gid = presence.gid WHERE agentteams.teamID = ?", teamID)
 	if err != nil {
 		log.Error(err)
 		return &teamList, err
 	}
 	defer rows.Close()
 
+	now := time.Now()
 	for rows.Next() {
 		agent := TeamMember{}
 		var lat, lon string
@@ -85,13 +94,18 @@ func (teamID TeamID) FetchTeam() (*TeamData, error) {
 		var vverified, vblacklisted, rocksverified, rockssmurf sql.NullBool
 		var intelname, communityname, enlID, vname, rocksname, picurl, comment sql.NullString
 
-		err := rows.Scan(&agent.Gid, &vname, &intelname, &rocksname, &comment, &agent.ShareLocation, &lat, &lon, &agent.Date, &vverified, &vblacklisted, &enlID, &rocksverified, &rockssmurf, &agent.ShareWD, &agent.LoadWD, &faction, &communityname, &picurl)
+		var ps policyScan
+		var pres presenceScan
+
+		dest := append([]interface{}{&agent.Gid, &vname, &intelname, &rocksname, &comment, &agent.ShareLocation, &lat, &lon, &agent.Date, &vverified, &vblacklisted, &enlID, &rocksverified, &rockssmurf, &agent.ShareWD, &agent.LoadWD, &faction, &communityname, &picurl, &agent.Role}, ps.dest()...)
+		err := rows.Scan(append(dest, pres.dest()...)...)
 		if err != nil {
 			log.Error(err)
 			return &teamList, err
 		}
 
 		agent.Name = agent.Gid.bestname(intelname, vname, rocksname, communityname)
+		agent.Presence = pres.presence(now)
 
 		if intelname.Valid {
 			agent.IntelName = intelname.String
@@ -133,9 +147,10 @@ func (teamID TeamID) FetchTeam() (*TeamData, error) {
 			agent.RocksSmurf = rockssmurf.Bool
 		}
 
-		if agent.ShareLocation {
+		if precision, ok := ps.share(now); agent.ShareLocation && ok {
 			agent.Lat, _ = strconv.ParseFloat(lat, 64)
 			agent.Lon, _ = strconv.ParseFloat(lon, 64)
+			agent.Lat, agent.Lon = precision.blur(agent.Lat, agent.Lon)
 		} else {
 			agent.Lat = 0
 			agent.Lon = 0
@@ -149,8 +164,8 @@ func (teamID TeamID) FetchTeam() (*TeamData, error) {
 		teamList.TeamMembers = append(teamList.TeamMembers, agent)
 	}
 
-	var rockscomm, rockskey, joinlinktoken sql.NullString
-	if err := db.QueryRow("SELECT name, rockscomm, rockskey, joinLinkToken, vteam, vrole FROM team WHERE teamID = ?", teamID).Scan(&teamList.Name, &rockscomm, &rockskey, &joinlinktoken, &teamList.VTeam, &teamList.VRole); err != nil {
+	var rockscomm, rockskey, joinlinktoken, parent sql.NullString
+	if err := db.QueryRow("SELECT name, rockscomm, rockskey, joinLinkToken, vteam, vrole, parent, trackdays FROM team WHERE teamID = ?", teamID).Scan(&teamList.Name, &rockscomm, &rockskey, &joinlinktoken, &teamList.VTeam, &teamList.VRole, &parent, &teamList.TrackDays); err != nil {
 		log.Error(err)
 		return &teamList, err
 	}
@@ -164,10 +179,26 @@ func (teamID TeamID) FetchTeam() (*TeamData, error) {
 	if joinlinktoken.Valid {
 		teamList.JoinLinkToken = joinlinktoken.String
 	}
+	if parent.Valid {
+		teamList.Parent = TeamID(parent.String)
+	}
 
 	return &teamList, nil
 }
 
+// PopulateInvites loads the team's invite links and pending join requests; only for owners and admins
+func (t *TeamData) PopulateInvites() error {
+	var err error
+
+	if t.Invites, err = t.ID.Invites(); err != nil {
+		return err
+	}
+	if t.JoinRequests, err = t.ID.JoinRequests(); err != nil {
+		return err
+	}
+	return nil
+}
+
 // Owner returns the owner of the team
 func (teamID TeamID) Owner() (GoogleID, error) {
 	var owner GoogleID
@@ -197,6 +228,80 @@ func (gid GoogleID) OwnsTeam(teamID TeamID) (bool, error) {
 	return true, nil
 }
 
+// TeamRole is an agent's role on a team
+type TeamRole string
+
+// team roles: owners can do everything, admins everything but delete or chown the team
+const (
+	TeamRoleOwner  TeamRole = "owner"
+	TeamRoleAdmin  TeamRole = "admin"
+	TeamRoleMember TeamRole = "member"
+)
+
+// Valid reports if the role is one of the known roles
+func (r TeamRole) Valid() bool {
+	return r == TeamRoleOwner || r == TeamRoleAdmin || r == TeamRoleMember
+}
+
+// TeamRole returns the agent's role on a team, empty if not on the team.
+// The team's owner column is authoritative for the owner role.
+func (gid GoogleID) TeamRole(teamID TeamID) (TeamRole, error) {
+	var owner GoogleID
+	var role sql.NullString
+
+	err := db.QueryRow("SELECT team.owner, agentteams.role FROM team LEFT JOIN agentteams ON team.teamID = agentteams.teamID AND agentteams.gid = ? WHERE team.teamID = ?", gid, teamID).Scan(&owner, &role)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		log.Error(err)
+		return "", err
+	}
+
+	if owner == gid {
+		return TeamRoleOwner, nil
+	}
+	if !role.Valid {
+		return "", nil
+	}
+	return TeamRole(role.String), nil
+}
+
+// AdminsTeam returns true if the GoogleID is the owner or an admin of the team identified by teamID
+func (gid GoogleID) AdminsTeam(teamID TeamID) (bool, error) {
+	role, err := gid.TeamRole(teamID)
+	if err != nil {
+		return false, err
+	}
+	return role == TeamRoleOwner || role == TeamRoleAdmin, nil
+}
+
+// SetRole sets an agent's role on the team; the owner role can only be changed with Chown
+func (teamID TeamID) SetRole(gid GoogleID, role TeamRole) error {
+	if role != TeamRoleAdmin && role != TeamRoleMember {
+		err := fmt.Errorf(ErrInvalidTeamRole)
+		log.Warnw(err.Error(), "resource", teamID, "GID", gid, "role", role)
+		return err
+	}
+
+	current, err := gid.TeamRole(teamID)
+	if err != nil {
+		return err
+	}
+	if current == "" {
+		return fmt.Errorf(ErrAgentNotOnTeam)
+	}
+	if current == TeamRoleOwner {
+		return fmt.Errorf(ErrCannotChangeOwnerRole)
+	}
+
+	if _, err := db.Exec("UPDATE agentteams SET role = ? WHERE teamID = ? AND gid = ?", role, teamID, gid); err != nil {
+		log.Error(err)
+		return err
+	}
+	return nil
+}
+
 // NewTeam initializes a new team and returns a teamID
 // the creating gid is added and enabled on that team by default
 func (gid GoogleID) NewTeam(name string) (TeamID, error) {
@@ -218,11 +323,12 @@ func (gid GoogleID) NewTeam(name string) (TeamID, error) {
 		log.Error(err)
 		return "", err
 	}
-	_, err = db.Exec("INSERT INTO agentteams (teamID, gid, shareLoc, comment, shareWD, loadWD) VALUES (?,?,0,'owner',0,0)", team, gid)
+	_, err = db.Exec("INSERT INTO agentteams (teamID, gid, shareLoc, comment, shareWD, loadWD, role) VALUES (?,?,0,'owner',0,0,'owner')", team, gid)
 	if err != nil {
 		log.Error(err)
 		return TeamID(team), err
 	}
+	TeamID(team).Audit(gid, AuditTeamCreated, "", name)
 	return TeamID(team), nil
 }
 
@@ -261,7 +367,7 @@ func (teamID TeamID) Delete() error {
 			log.Warn(err)
 			continue
 		}
-		err = teamID.RemoveAgent(gid)
+		_, err = teamID.removeAgent(gid)
 		if err != nil {
 			log.Warn(err)
 			continue
@@ -281,19 +387,22 @@ func (teamID TeamID) Delete() error {
 	return nil
 }
 
-// AddAgent adds a agent to a team
-func (teamID TeamID) AddAgent(in AgentID) error {
+// AddAgent adds a agent to a team; the actor (empty for sync services) and detail are recorded in the team's audit log
+func (teamID TeamID) AddAgent(in AgentID, actor GoogleID, detail string) error {
 	gid, err := in.Gid()
 	if err != nil {
 		log.Error(err)
 		return err
 	}
 
-	_, err = db.Exec("INSERT IGNORE INTO agentteams (teamID, gid, shareLoc, comment, shareWD, loadWD) VALUES (?, ?, 0, 'agents', 0, 0)", teamID, gid)
+	r, err := db.Exec("INSERT IGNORE INTO agentteams (teamID, gid, shareLoc, comment, shareWD, loadWD) VALUES (?, ?, 0, 'agents', 0, 0)", teamID, gid)
 	if err != nil {
 		log.Error(err)
 		return err
 	}
+	if n, _ := r.RowsAffected(); n > 0 {
+		teamID.Audit(actor, AuditAgentAdded, string(gid), detail)
+	}
 
 	messaging.AddToRemote(messaging.GoogleID(gid), messaging.TeamID(teamID))
 	// log.Infow("adding agent to team", "GID", gid, "resource", teamID, "message", "adding agent to team")
@@ -301,18 +410,40 @@ func (teamID TeamID) AddAgent(in AgentID) error {
 }
 
 // RemoveAgent removes a agent (identified by location share key, GoogleID, agent name, or EnlID) from a team.
-func (teamID TeamID) RemoveAgent(in AgentID) error {
+// The actor (empty for sync services) and detail are recorded in the team's audit log, agents removing themselves are recorded as leaving.
+func (teamID TeamID) RemoveAgent(in AgentID, actor GoogleID, detail string) error {
 	gid, err := in.Gid()
 	if err != nil {
 		log.Error(err)
 		return err
 	}
 
-	_, err = db.Exec("DELETE FROM agentteams WHERE teamID = ? AND gid = ?", teamID, gid)
+	removed, err := teamID.removeAgent(gid)
 	if err != nil {
-		log.Error(err)
 		return err
 	}
+	if removed {
+		action := AuditAgentRemoved
+		if actor == gid {
+			action = AuditAgentLeft
+		}
+		teamID.Audit(actor, action, string(gid), detail)
+	}
+	return nil
+}
+
+// removeAgent takes the agent off the team without recording it, used when the whole team is deleted
+func (teamID TeamID) removeAgent(gid GoogleID) (bool, error) {
+	r, err := db.Exec("DELETE FROM agentteams WHERE teamID = ? AND gid = ?", teamID, gid)
+	if err != nil {
+		log.Error(err)
+		return false, err
+	}
+	removed, _ := r.RowsAffected()
+
+	if err := gid.purgeLocationTrack(teamID); err != nil {
+		return removed > 0, err
+	}
 
 	messaging.RemoveFromRemote(messaging.GoogleID(gid), messaging.TeamID(teamID))
 
@@ -321,7 +452,7 @@ func (teamID TeamID) RemoveAgent(in AgentID) error {
 	rows, err := db.Query("SELECT opID FROM permissions WHERE teamID = ?", teamID)
 	if err != nil && err != sql.ErrNoRows {
 		log.Error(err)
-		return err
+		return removed > 0, err
 	}
 	defer rows.Close()
 
@@ -336,7 +467,7 @@ func (teamID TeamID) RemoveAgent(in AgentID) error {
 	}
 
 	// log.Debugw("removing agent from team", "GID", gid, "resource", teamID, "message", "removing agent from team")
-	return nil
+	return removed > 0, nil
 }
 
 // Chown changes a team's ownership
@@ -348,10 +479,40 @@ func (teamID TeamID) Chown(to AgentID) error {
 		return err
 	}
 
-	_, err = db.Exec("UPDATE team SET owner = ? WHERE teamID = ?", gid, teamID)
+	tx, err := db.Begin()
 	if err != nil {
 		log.Error(err)
-		return (err)
+		return err
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && err != sql.ErrTxDone {
+			log.Error(err)
+		}
+	}()
+
+	// the team's owner column is authoritative, older teams have the default role on the owner's row
+	var previous GoogleID
+	if err := tx.QueryRow("SELECT owner FROM team WHERE teamID = ? FOR UPDATE", teamID).Scan(&previous); err != nil {
+		log.Error(err)
+		return err
+	}
+	if _, err := tx.Exec("UPDATE team SET owner = ? WHERE teamID = ?", gid, teamID); err != nil {
+		log.Error(err)
+		return err
+	}
+
+	// the previous owner stays on as an admin
+	if _, err := tx.Exec("UPDATE agentteams SET role = 'admin' WHERE teamID = ? AND (gid = ? OR role = 'owner')", teamID, previous); err != nil {
+		log.Error(err)
+		return err
+	}
+	if _, err := tx.Exec("UPDATE agentteams SET role = 'owner' WHERE teamID = ? AND gid = ?", teamID, gid); err != nil {
+		log.Error(err)
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		log.Error(err)
+		return err
 	}
 	return nil
 }
@@ -360,12 +521,15 @@ func (teamID TeamID) String() string {
 	return string(teamID)
 }
 
-// SetTeamState updates the agent's shareLoc the team
+// SetTeamState updates the agent's shareLoc the team, turning it off discards the agent's location history on the team
 func (gid GoogleID) SetTeamState(teamID TeamID, state bool) error {
 	if _, err := db.Exec("UPDATE agentteams SET shareLoc = ? WHERE gid = ? AND teamID = ?", state, gid, teamID); err != nil {
 		log.Error(err)
 		return err
 	}
+	if !state {
+		return gid.purgeLocationTrack(teamID)
+	}
 	return nil
 }
 
@@ -459,25 +623,52 @@ func FetchAgent(id AgentID, caller GoogleID) (*TeamMember, error) {
 		tm.PictureURL = picurl.String
 	}
 
-	// XXX make this a distinct function?
-	var count int
-	if err = db.QueryRow("SELECT COUNT(*) FROM agentteams=x, agentteams=y WHERE x.gid = ? AND x.shareLoc = 1 AND y.gid = ?", id, caller).Scan(&count); err != nil {
+	// presence is only shown to teammates
+	var shared int
+	if err = db.QueryRow("SELECT COUNT(*) FROM agentteams=x JOIN agentteams=y ON x.teamID = y.teamID WHERE x.gid = ? AND y.gid = ?", gid, caller).Scan(&shared); err != nil {
+		log.Error(err)
+		return nil, err
+	}
+	if shared > 0 || gid == caller {
+		if tm.Presence, err = gid.Presence(); err != nil {
+			return nil, err
+		}
+	}
+
+	// the finest precision allowed by any team the two share
+	rows, err := db.Query("SELECT "+policyColumns("x")+" FROM agentteams=x JOIN agentteams=y ON x.teamID = y.teamID JOIN team ON x.teamID = team.teamID WHERE x.gid = ? AND x.shareLoc = 1 AND y.gid = ?", gid, caller)
+	if err != nil {
 		log.Error(err)
 		return nil, err
 	}
+	defer rows.Close()
+
+	var precision LocationPrecision
+	now := time.Now()
+	for rows.Next() {
+		var ps policyScan
+		if err := rows.Scan(ps.dest()...); err != nil {
+			log.Error(err)
+			continue
+		}
+		if p, ok := ps.share(now); ok && (precision == "" || p.meters() < precision.meters()) {
+			precision = p
+		}
+	}
 
 	// no sharing location with this agent
-	if count < 1 {
+	if precision == "" {
 		return &tm, nil
 	}
 
 	var lat, lon string
-	if err = db.QueryRow("SELECT Y(loc), X(loc) FROM locations WHERE gid = ?", id).Scan(&lat, &lon); err != nil {
+	if err = db.QueryRow("SELECT Y(loc), X(loc) FROM locations WHERE gid = ?", gid).Scan(&lat, &lon); err != nil {
 		log.Error(err)
 		return nil, err
 	}
 	tm.Lat, _ = strconv.ParseFloat(lat, 64)
 	tm.Lon, _ = strconv.ParseFloat(lon, 64)
+	tm.Lat, tm.Lon = precision.blur(tm.Lat, tm.Lon)
 	return &tm, nil
 }
 
@@ -514,6 +705,28 @@ func (gid GoogleID) teamList() []TeamID {
 	return x
 }
 
+// agents returns the GoogleIDs of every agent on the team
+func (teamID TeamID) agents() []GoogleID {
+	var gid GoogleID
+	var x []GoogleID
+
+	rows, err := db.Query("SELECT gid FROM agentteams WHERE teamID = ?", teamID)
+	if err != nil {
+		log.Error(err)
+		return x
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		if err := rows.Scan(&gid); err != nil {
+			log.Error(err)
+			continue
+		}
+		x = append(x, gid)
+	}
+	return x
+}
+
 // TeamListEnabled is used for getting a list of agent's enabled teams
 func (gid GoogleID) TeamListEnabled() []TeamID {
 	var tid TeamID
@@ -574,35 +787,34 @@ func (teamID TeamID) DeleteJoinToken() error {
 	return nil
 }
 
-// JoinToken verifies a join link
-func (teamID TeamID) JoinToken(gid GoogleID, key string) error {
+// JoinToken verifies a join link, either the team's legacy join link or one of its invites.
+// Returns true if the join is waiting on approval by a team admin.
+func (teamID TeamID) JoinToken(gid GoogleID, key string) (bool, error) {
 	var count string
 
 	err := db.QueryRow("SELECT COUNT(*) FROM team WHERE teamID = ? AND joinLinkToken= ?", teamID, key).Scan(&count)
 	if err != nil {
-		return err
+		return false, err
 	}
 
 	i, err := strconv.ParseInt(count, 10, 32)
 	if err != nil {
-		return err
+		return false, err
 	}
 	if i != 1 {
-		err = fmt.Errorf("invalid team join token")
-		log.Errorw(err.Error(), "resource", teamID, "GID", gid)
-		return err
+		return teamID.useInvite(gid, key)
 	}
 
-	err = teamID.AddAgent(gid)
+	err = teamID.AddAgent(gid, gid, "join link")
 	if err != nil {
-		return err
+		return false, err
 	}
 	err = teamID.SetComment(gid, "joined via link")
 	if err != nil {
-		return err
+		return false, err
 	}
 
-	return nil
+	return false, nil
 }
 
 func (teamID TeamID) FetchFBTokens() ([]string, error) {
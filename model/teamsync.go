@@ -0,0 +1,115 @@
+package model
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/wasabee-project/Wasabee-Server/log"
+)
+
+// TeamSync is the result of one pull of a team's membership from V or enl.rocks
+type TeamSync struct {
+	ID       int64  `json:"id"`
+	Source   string `json:"source"`  // "V" or "rocks"
+	Started  string `json:"started"` // time.RFC1123 format
+	Finished string `json:"finished"`
+	Added    int    `json:"added"`
+	Removed  int    `json:"removed"`
+	Error    string `json:"error,omitempty"`
+}
+
+// sources of team syncs
+const (
+	SyncSourceV     = "V"
+	SyncSourceRocks = "rocks"
+)
+
+// how long sync results are kept
+const teamSyncRetention = 30 * 24 * time.Hour
+
+// RecordSync saves the result of a sync; failures are logged but otherwise ignored
+func (teamID TeamID) RecordSync(source string, started time.Time, added, removed int, syncErr error) {
+	var e sql.NullString
+	if syncErr != nil {
+		e = makeNullString(syncErr.Error())
+	}
+
+	if _, err := db.Exec("INSERT INTO teamsync (teamID, source, started, finished, added, removed, error) VALUES (?, ?, ?, UTC_TIMESTAMP(), ?, ?, LEFT(?, 255))", teamID, source, started.UTC(), added, removed, e); err != nil {
+		log.Errorw(err.Error(), "resource", teamID, "source", source)
+	}
+}
+
+// MemberSyncError combines the errors adding or removing single agents during a sync, nil if there were none
+func MemberSyncError(errs []error) error {
+	switch len(errs) {
+	case 0:
+		return nil
+	case 1:
+		return errs[0]
+	}
+	return fmt.Errorf("%d agents could not be synced, first: %w", len(errs), errs[0])
+}
+
+// SyncLog returns the most recent sync results for the team, newest first
+func (teamID TeamID) SyncLog(limit int) ([]TeamSync, error) {
+	syncs := make([]TeamSync, 0)
+
+	rows, err := db.Query("SELECT ID, source, started, finished, added, removed, error FROM teamsync WHERE teamID = ? ORDER BY ID DESC LIMIT ?", teamID, limit)
+	if err != nil {
+		log.Error(err)
+		return syncs, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var s TeamSync
+		var started, finished, e sql.NullString
+		if err := rows.Scan(&s.ID, &s.Source, &started, &finished, &s.Added, &s.Removed, &e); err != nil {
+			log.Error(err)
+			continue
+		}
+		s.Started = sqlTimeToRFC1123(started)
+		s.Finished = sqlTimeToRFC1123(finished)
+		if e.Valid {
+			s.Error = e.String
+		}
+		syncs = append(syncs, s)
+	}
+	return syncs, nil
+}
+
+// SyncedTeams lists the teams linked to a V team and those linked to a rocks community
+func SyncedTeams() ([]TeamID, []TeamID, error) {
+	var vteams, rocksteams []TeamID
+
+	rows, err := db.Query("SELECT teamID, vteam != 0, rockskey IS NOT NULL AND rockskey != '' FROM team WHERE vteam != 0 OR (rockskey IS NOT NULL AND rockskey != '')")
+	if err != nil {
+		log.Error(err)
+		return vteams, rocksteams, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var teamID TeamID
+		var v, rocks bool
+		if err := rows.Scan(&teamID, &v, &rocks); err != nil {
+			log.Error(err)
+			continue
+		}
+		if v {
+			vteams = append(vteams, teamID)
+		}
+		if rocks {
+			rocksteams = append(rocksteams, teamID)
+		}
+	}
+	return vteams, rocksteams, nil
+}
+
+// TeamSyncClean removes old sync results
+func TeamSyncClean() {
+	if _, err := db.Exec("DELETE FROM teamsync WHERE started < ?", time.Now().Add(-teamSyncRetention).UTC()); err != nil {
+		log.Error(err)
+	}
+}
@@ -0,0 +1,247 @@
+package model
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/wasabee-project/Wasabee-Server/log"
+)
+
+// TeamTree is a team and all of its sub-teams
+type TeamTree struct {
+	ID       TeamID     `json:"id"`
+	Name     string     `json:"name"`
+	Children []TeamTree `json:"children,omitempty"`
+}
+
+// Parent returns the team's parent, empty for a top-level team
+func (teamID TeamID) Parent() (TeamID, error) {
+	var parent sql.NullString
+
+	err := db.QueryRow("SELECT parent FROM team WHERE teamID = ?", teamID).Scan(&parent)
+	if err != nil && err != sql.ErrNoRows {
+		log.Error(err)
+		return "", err
+	}
+	if !parent.Valid {
+		return "", nil
+	}
+	return TeamID(parent.String), nil
+}
+
+// SetParent places the team under a parent team, an empty parent makes it a top-level team again
+func (teamID TeamID) SetParent(parent TeamID) error {
+	if parent == "" {
+		if _, err := db.Exec("UPDATE team SET parent = NULL WHERE teamID = ?", teamID); err != nil {
+			log.Error(err)
+			return err
+		}
+		return nil
+	}
+
+	if !parent.Valid() {
+		return fmt.Errorf(ErrTeamNotFound)
+	}
+
+	if parent == teamID {
+		return fmt.Errorf(ErrTeamCycle)
+	}
+	for _, d := range teamID.descendants() {
+		if d == parent {
+			err := fmt.Errorf(ErrTeamCycle)
+			log.Warnw(err.Error(), "resource", teamID, "parent", parent)
+			return err
+		}
+	}
+
+	if _, err := db.Exec("UPDATE team SET parent = ? WHERE teamID = ?", parent, teamID); err != nil {
+		log.Error(err)
+		return err
+	}
+	return nil
+}
+
+// Children returns the team's direct sub-teams
+func (teamID TeamID) Children() ([]TeamID, error) {
+	var children []TeamID
+
+	rows, err := db.Query("SELECT teamID FROM team WHERE parent = ?", teamID)
+	if err != nil {
+		log.Error(err)
+		return children, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var t TeamID
+		if err := rows.Scan(&t); err != nil {
+			log.Error(err)
+			continue
+		}
+		children = append(children, t)
+	}
+	return children, nil
+}
+
+// descendants returns every sub-team below the team, not including the team itself
+func (teamID TeamID) descendants() []TeamID {
+	var out []TeamID
+	seen := map[TeamID]bool{teamID: true}
+
+	queue := []TeamID{teamID}
+	for len(queue) > 0 {
+		children, _ := queue[0].Children()
+		queue = queue[1:]
+		for _, c := range children {
+			if seen[c] {
+				continue
+			}
+			seen[c] = true
+			out = append(out, c)
+			queue = append(queue, c)
+		}
+	}
+	return out
+}
+
+// ancestors returns every team above the team, nearest first
+func (teamID TeamID) ancestors() []TeamID {
+	var out []TeamID
+	seen := map[TeamID]bool{teamID: true}
+
+	for t := teamID; ; {
+		parent, err := t.Parent()
+		if err != nil || parent == "" || seen[parent] {
+			break
+		}
+		seen[parent] = true
+		out = append(out, parent)
+		t = parent
+	}
+	return out
+}
+
+// Tree returns the team and all its sub-teams
+func (teamID TeamID) Tree() (*TeamTree, error) {
+	return teamID.tree(make(map[TeamID]bool))
+}
+
+func (teamID TeamID) tree(seen map[TeamID]bool) (*TeamTree, error) {
+	seen[teamID] = true
+
+	name, err := teamID.Name()
+	if err != nil {
+		return nil, err
+	}
+	t := TeamTree{ID: teamID, Name: name}
+
+	children, err := teamID.Children()
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range children {
+		if seen[c] {
+			continue
+		}
+		ct, err := c.tree(seen)
+		if err != nil {
+			log.Error(err)
+			continue
+		}
+		t.Children = append(t.Children, *ct)
+	}
+	return &t, nil
+}
+
+// effectiveTeams returns the teams an agent is on, plus every ancestor of those teams; op permissions granted to any of them apply to the agent
+// this is called on every access check, so the tree is walked in a single query
+func (gid GoogleID) effectiveTeams() map[TeamID]bool {
+	teams := make(map[TeamID]bool)
+
+	rows, err := db.Query("WITH RECURSIVE tree (teamID, parent) AS ("+
+		"SELECT team.teamID, team.parent FROM agentteams JOIN team ON agentteams.teamID = team.teamID WHERE agentteams.gid = ? "+
+		"UNION SELECT team.teamID, team.parent FROM team JOIN tree ON team.teamID = tree.parent"+
+		") SELECT teamID FROM tree", gid)
+	if err != nil {
+		log.Error(err)
+		return teams
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var t TeamID
+		if err := rows.Scan(&t); err != nil {
+			log.Error(err)
+			continue
+		}
+		teams[t] = true
+	}
+	return teams
+}
+
+// AdminsTeamTree reports if the agent is an owner or admin of the team or of any team above it
+func (gid GoogleID) AdminsTeamTree(teamID TeamID) bool {
+	for _, t := range append([]TeamID{teamID}, teamID.ancestors()...) {
+		if admin, _ := gid.AdminsTeam(t); admin {
+			return true
+		}
+	}
+	return false
+}
+
+// treeAgents returns the agents on the team and all of its sub-teams
+func (teamID TeamID) treeAgents() []GoogleID {
+	var out []GoogleID
+	seen := make(map[GoogleID]bool)
+
+	for _, t := range append([]TeamID{teamID}, teamID.descendants()...) {
+		for _, gid := range t.agents() {
+			if seen[gid] {
+				continue
+			}
+			seen[gid] = true
+			out = append(out, gid)
+		}
+	}
+	return out
+}
+
+// AnnounceTeams returns every team whose agents can currently see the op: the teams holding a permission in effect and all of their sub-teams
+func (o *Operation) AnnounceTeams() []TeamID {
+	var teams []TeamID
+	seen := make(map[TeamID]bool)
+
+	for _, t := range o.ActiveTeams() {
+		for _, d := range append([]TeamID{t}, t.descendants()...) {
+			if seen[d] {
+				continue
+			}
+			seen[d] = true
+			teams = append(teams, d)
+		}
+	}
+	return teams
+}
+
+// MergedMembers returns the members of the team and all of its sub-teams, each agent listed once
+func (teamID TeamID) MergedMembers() ([]TeamMember, error) {
+	members := make([]TeamMember, 0)
+	seen := make(map[GoogleID]bool)
+
+	for _, t := range append([]TeamID{teamID}, teamID.descendants()...) {
+		td, err := t.FetchTeam()
+		if err != nil {
+			log.Error(err)
+			return members, err
+		}
+		for _, m := range td.TeamMembers {
+			if seen[m.Gid] {
+				continue
+			}
+			seen[m.Gid] = true
+			m.Team = t
+			members = append(members, m)
+		}
+	}
+	return members, nil
+}
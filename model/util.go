@@ -34,6 +34,11 @@ func GenerateSafeName() (string, error) {
 			return "", err
 		}
 		total += i
+		err = db.QueryRow("SELECT COUNT(token) FROM teaminvite WHERE token = ?", name).Scan(&i)
+		if err != nil {
+			return "", err
+		}
+		total += i
 		rows = total
 	}
 
@@ -3,6 +3,7 @@ package rocks
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
@@ -64,6 +65,7 @@ func addToRemote(gid messaging.GoogleID, teamID messaging.TeamID) error {
 		if rr.Error == "Invalid key" {
 			c, _ := t.RocksCommunity()
 			_ = t.SetRocks("", c) // unlink
+			t.Audit("", model.AuditRocksChanged, c, "unlinked: invalid key")
 		}
 	}
 	return nil
@@ -115,11 +117,12 @@ func removeFromRemote(gid messaging.GoogleID, teamID messaging.TeamID) error {
 	}
 
 	if !rr.Success {
-		err = fmt.Errorf(rr.Error)
+		err = errors.New(rr.Error)
 		log.Error(err)
 		if rr.Error == "Invalid key" {
 			c, _ := t.RocksCommunity()
 			_ = t.SetRocks("", c) // unlink
+			t.Audit("", model.AuditRocksChanged, c, "unlinked: invalid key")
 		}
 		return err
 	}
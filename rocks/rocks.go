@@ -3,6 +3,7 @@ package rocks
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"time"
@@ -127,7 +128,7 @@ func CommunitySync(msg json.RawMessage) error {
 		if inteam, err := rc.User.Gid.AgentInTeam(teamID); err != nil || inteam {
 			return err // if already on the team, this is nil
 		}
-		if err := teamID.AddAgent(rc.User.Gid); err != nil {
+		if err := teamID.AddAgent(rc.User.Gid, rc.User.Gid, "rocks community join"); err != nil {
 			return err
 		}
 		owner, err := teamID.Owner()
@@ -138,7 +139,7 @@ func CommunitySync(msg json.RawMessage) error {
 		team, _ := teamID.Name()
 		messaging.SendMessage(messaging.GoogleID(owner), fmt.Sprintf("added %s to %s via rocks community join", agent, team))
 	} else {
-		if err := teamID.RemoveAgent(rc.User.Gid); err != nil {
+		if err := teamID.RemoveAgent(rc.User.Gid, rc.User.Gid, "rocks community leave"); err != nil {
 			return err
 		}
 	}
@@ -153,7 +154,8 @@ func CommunitySync(msg json.RawMessage) error {
 }
 
 // CommunityMemberPull grabs the member list from the associated community at enl.rocks and adds each agent to the team
-func CommunityMemberPull(teamID model.TeamID) error {
+// the result is recorded in the team's sync log
+func CommunityMemberPull(teamID model.TeamID) (err error) {
 	cid, err := teamID.RocksKey()
 	if err != nil {
 		log.Error(err)
@@ -163,6 +165,17 @@ func CommunityMemberPull(teamID model.TeamID) error {
 		return nil
 	}
 
+	started := time.Now()
+	var added int
+	var failed []error // single agents, these do not stop the sync
+	defer func() {
+		recorded := err
+		if recorded == nil {
+			recorded = model.MemberSyncError(failed)
+		}
+		teamID.RecordSync(model.SyncSourceRocks, started, added, 0, recorded)
+	}()
+
 	ctx, cancel := context.WithTimeout(context.Background(), holdtime)
 	defer cancel()
 	if err := limiter.Wait(ctx); err != nil {
@@ -195,7 +208,8 @@ func CommunityMemberPull(teamID model.TeamID) error {
 		return err
 	}
 	if rr.Error != "" {
-		log.Error(rr.Error)
+		err = errors.New(rr.Error)
+		log.Error(err)
 		return err
 	}
 	// log.Debugw("rocks sync", "response", rr)
@@ -205,9 +219,12 @@ func CommunityMemberPull(teamID model.TeamID) error {
 			continue
 		}
 		log.Debugw("rocks sync", "adding", gid)
-		if err := teamID.AddAgent(gid); err != nil {
+		if err := teamID.AddAgent(gid, "", "rocks sync"); err != nil {
 			log.Info(err)
+			failed = append(failed, err)
+			continue
 		}
+		added++
 	}
 	return nil
 }
@@ -0,0 +1,13 @@
+package templates
+
+import (
+	"github.com/wasabee-project/Wasabee-Server/model"
+)
+
+// Briefing renders a printable briefing for an agent, format is either "html" or "text"
+func Briefing(b *model.Briefing, lang, format string) (string, error) {
+	if format == "text" {
+		return ExecuteTextLang("briefingText", lang, b)
+	}
+	return ExecuteLang("briefingHTML", lang, b)
+}
@@ -2,10 +2,12 @@ package templates
 
 import (
 	"bytes"
+	"embed"
 	"html/template"
 	"io/ioutil"
 	"path"
 	"path/filepath"
+	ttemplate "text/template"
 
 	"github.com/wasabee-project/Wasabee-Server/config"
 	"github.com/wasabee-project/Wasabee-Server/log"
@@ -22,6 +24,12 @@ var funcMap = template.FuncMap{
 	"IngressName":     model.IngressName,
 }
 
+// plain text output (*.txt) is not HTML-escaped
+var tts map[string]*ttemplate.Template
+
+//go:embed builtin
+var builtin embed.FS // the built-in templates, loaded before the frontend so they can be overridden per-language
+
 // Start should be called once from main to establish the templates.
 func Start(frontendPath string) error {
 	fp, err := filepath.Abs(frontendPath)
@@ -31,6 +39,7 @@ func Start(frontendPath string) error {
 	}
 
 	templateSet := make(map[string]*template.Template)
+	textSet := make(map[string]*ttemplate.Template)
 
 	log.Debugw("startup", "frontend template directory", fp)
 	files, err := ioutil.ReadDir(fp)
@@ -43,6 +52,21 @@ func Start(frontendPath string) error {
 		lang := f.Name()
 		if f.IsDir() && len(lang) == 2 {
 			templateSet[lang] = template.New("").Funcs(funcMap) // one funcMap for all languages
+			if _, err := templateSet[lang].ParseFS(builtin, "builtin/*.html"); err != nil {
+				log.Error(err)
+			}
+			textSet[lang] = ttemplate.New("").Funcs(ttemplate.FuncMap(funcMap))
+			if _, err := textSet[lang].ParseFS(builtin, "builtin/*.txt"); err != nil {
+				log.Error(err)
+			}
+			for _, dir := range []string{"master", lang} {
+				textpath := path.Join(fp, dir, "*.txt")
+				if m, _ := filepath.Glob(textpath); len(m) > 0 {
+					if _, err := textSet[lang].ParseGlob(textpath); err != nil {
+						log.Error(err)
+					}
+				}
+			}
 			// load the masters
 			masterpath := path.Join(fp, "master", "*")
 			_, err = templateSet[lang].ParseGlob(masterpath)
@@ -60,6 +84,7 @@ func Start(frontendPath string) error {
 	}
 
 	ts = templateSet
+	tts = textSet
 	return nil
 }
 
@@ -82,3 +107,18 @@ func ExecuteLang(name, lang string, data interface{}) (string, error) {
 	}
 	return tpBuffer.String(), nil
 }
+
+// ExecuteTextLang runs a given plain text template in a specified language
+func ExecuteTextLang(name, lang string, data interface{}) (string, error) {
+	var tpBuffer bytes.Buffer
+
+	if _, ok := tts[lang]; !ok {
+		lang = "en"
+	}
+
+	if err := tts[lang].ExecuteTemplate(&tpBuffer, name, data); err != nil {
+		log.Info(err)
+		return "", err
+	}
+	return tpBuffer.String(), nil
+}
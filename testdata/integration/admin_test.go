@@ -0,0 +1,115 @@
+package integration_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/wasabee-project/Wasabee-Server/config"
+	wasabeehttps "github.com/wasabee-project/Wasabee-Server/http"
+	"github.com/wasabee-project/Wasabee-Server/model"
+)
+
+func TestAdminAuthorization(t *testing.T) {
+	c := config.Get()
+	saved := c.Admins
+	c.Admins = []string{"999000000000000000001"}
+	defer func() { c.Admins = saved }()
+
+	if !config.IsAdmin("999000000000000000001") {
+		t.Error("configured administrator refused")
+	}
+	for _, gid := range []string{"999000000000000000002", ""} {
+		if config.IsAdmin(gid) {
+			t.Errorf("%q accepted as an administrator", gid)
+		}
+	}
+
+	// personal access tokens never reach the administration routes, whatever their scopes
+	for _, r := range []struct{ method, tpl string }{
+		{"GET", "/admin/merge"},
+		{"POST", "/admin/merge"},
+		{"PUT", "/admin/merge/{id}"},
+		{"GET", "/admin/agents"},
+		{"PUT", "/admin/agent/{gid}/lock"},
+		{"DELETE", "/admin/agent/{gid}/lock"},
+		{"DELETE", "/admin/op/{opID}"},
+		{"DELETE", "/admin/team/{team}"},
+		{"GET", "/admin/stats"},
+		{"GET", "/admin/scanners"},
+		{"DELETE", "/admin/scanners/{ip}"},
+		{"GET", "/admin/audit"},
+	} {
+		if scope, ok := wasabeehttps.RouteScope(r.method, r.tpl, nil); ok {
+			t.Errorf("%s %s allowed for API tokens with %s", r.method, r.tpl, scope)
+		}
+	}
+}
+
+func TestAdminLock(t *testing.T) {
+	needDB(t)
+
+	admin := newAgent(t)
+	gid := newAgent(t)
+
+	if err := gid.AdminLock(admin, "test"); err != nil {
+		t.Fatal(err)
+	}
+	if locked, by, err := gid.LockedBy(); err != nil || !locked || by != admin {
+		t.Errorf("admin lock: locked %v by %q, %v", locked, by, err)
+	}
+	// a RISC account-enabled event does not clear an administrator's lock
+	if err := gid.Unlock("RISC enabled"); err != nil {
+		t.Fatal(err)
+	}
+	if !gid.RISC() {
+		t.Error("RISC unlock cleared an administrator's lock")
+	}
+	if err := gid.AdminUnlock(admin, "test"); err != nil {
+		t.Fatal(err)
+	}
+	if locked, _, _ := gid.LockedBy(); locked {
+		t.Error("administrator unlock left the account locked")
+	}
+
+	// a RISC lock is reported as such, and stays one when an administrator locks too
+	if err := gid.Lock("RISC disabled"); err != nil {
+		t.Fatal(err)
+	}
+	if err := gid.AdminLock(admin, "test"); err != nil {
+		t.Fatal(err)
+	}
+	if locked, by, err := gid.LockedBy(); err != nil || !locked || by != "" {
+		t.Errorf("RISC lock: locked %v by %q, %v", locked, by, err)
+	}
+	if err := gid.Unlock("RISC enabled"); err != nil {
+		t.Fatal(err)
+	}
+	if gid.RISC() {
+		t.Error("RISC unlock left its own lock")
+	}
+}
+
+func TestAdminAuditTruncates(t *testing.T) {
+	needDB(t)
+
+	admin := newAgent(t)
+	reason := strings.Repeat("x", 1000)
+	if err := model.AdminAudit(admin, model.AdminAgentLocked, strings.Repeat("t", 200), reason); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := model.AdminAuditLog(0, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		if e.Actor != admin {
+			continue
+		}
+		if len(e.Detail) != 255 || len(e.Target) != 128 {
+			t.Errorf("audit entry not cut to fit: target %d, detail %d", len(e.Target), len(e.Detail))
+		}
+		return
+	}
+	t.Error("long audit entry not recorded")
+}
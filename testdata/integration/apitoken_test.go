@@ -0,0 +1,124 @@
+package integration_test
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/wasabee-project/Wasabee-Server/auth"
+	wasabeehttps "github.com/wasabee-project/Wasabee-Server/http"
+	"github.com/wasabee-project/Wasabee-Server/model"
+	"github.com/wasabee-project/Wasabee-Server/util"
+)
+
+func TestAPITokenRouteScope(t *testing.T) {
+	tests := []struct {
+		method string
+		tpl    string
+		query  url.Values
+		scope  model.APITokenScope
+		ok     bool
+	}{
+		{"GET", "/me", nil, "", true},
+		{"GET", "/me", url.Values{"lat": {"1"}, "lon": {"2"}}, model.ScopeLocation, true},
+		{"GET", "/me/tokens", nil, "", false},
+		{"POST", "/me/tokens", nil, "", false},
+		{"GET", "/me/sessions", nil, "", false},
+		{"GET", "/team/{team}", nil, model.ScopeTeamsRead, true},
+		{"POST", "/teams", nil, model.ScopeTeamsRead, true},
+		{"DELETE", "/team/{team}", nil, model.ScopeTeamsWrite, true},
+		{"PUT", "/team/{team}/role", nil, model.ScopeTeamsWrite, true},
+		{"GET", "/team/{team}/chown", nil, model.ScopeTeamsWrite, true},
+		{"GET", "/team/{team}/invite", nil, model.ScopeTeamsWrite, true},
+		{"GET", "/team/{team}/genJoinKey", nil, model.ScopeTeamsWrite, true},
+		{"GET", "/team/{team}/join/{key}", nil, model.ScopeTeamsWrite, true},
+		{"GET", "/team/{team}/track", nil, model.ScopeLocation, true},
+		{"GET", "/draw/{opID}", nil, model.ScopeOpsRead, true},
+		{"GET", "/draw/{opID}/share", nil, model.ScopeOpsWrite, true},
+		{"GET", "/draw/{opID}/delete", nil, model.ScopeOpsWrite, true},
+		{"PUT", "/draw/{opID}/task/{taskID}/complete", nil, model.ScopeTasks, true},
+		{"GET", "/admin/agents", nil, "", false},
+	}
+
+	for _, tt := range tests {
+		scope, ok := wasabeehttps.RouteScope(tt.method, tt.tpl, tt.query)
+		if scope != tt.scope || ok != tt.ok {
+			t.Errorf("%s %s: got %q %v, expected %q %v", tt.method, tt.tpl, scope, ok, tt.scope, tt.ok)
+		}
+	}
+}
+
+func TestAPITokenHasScope(t *testing.T) {
+	tok := model.APIToken{Scopes: []model.APITokenScope{model.ScopeOpsWrite, model.ScopeTeamsRead}}
+	if !tok.HasScope(model.ScopeTasks) {
+		t.Error("ops:write should include tasks")
+	}
+	if tok.HasScope(model.ScopeTeamsWrite) {
+		t.Error("teams:read should not include teams:write")
+	}
+	if tok.HasScope(model.ScopeLocation) {
+		t.Error("location was not granted")
+	}
+}
+
+func TestAPITokenAgentCredentials(t *testing.T) {
+	needDB(t)
+
+	gid := newAgent(t)
+	if _, err := gid.NewAPIToken("integration test", []model.APITokenScope{"teams"}, nil, nil, time.Time{}); err == nil {
+		t.Error("the former teams scope can no longer be granted")
+	}
+	tok, err := gid.NewAPIToken("integration test", []model.APITokenScope{model.ScopeTeamsRead}, nil, nil, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, got, err := model.APITokenAuth(tok.Token); err != nil || !got.HasScope(model.ScopeTeamsRead) {
+		t.Errorf("token auth: %v", err)
+	}
+
+	agent, err := gid.GetAgent()
+	if err != nil {
+		t.Fatal(err)
+	}
+	agent.RemoveCredentials()
+	if agent.OneTimeToken != "" || agent.VAPIkey != "" || agent.Telegram.Authtoken != "" || agent.QueryToken != "" {
+		t.Error("credentials left in the agent")
+	}
+}
+
+func TestAPITokenAuthorize(t *testing.T) {
+	needDB(t)
+
+	gid := newAgent(t)
+	if ok, err := auth.AuthorizeToken(gid); !ok {
+		t.Fatalf("agent refused: %v", err)
+	}
+
+	// a denial is never remembered, the agent is refused until fixed
+	res := newAgent(t)
+	if err := res.SetIntelData("res"+util.GenerateID(8), "RESISTANCE"); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if ok, _ := auth.AuthorizeToken(res); ok {
+			t.Errorf("self-identified RES agent authorized on check %d", i)
+		}
+	}
+	if err := res.SetIntelData("enl"+util.GenerateID(8), "ENLIGHTENED"); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := auth.AuthorizeToken(res); !ok {
+		t.Errorf("agent refused after changing faction: %v", err)
+	}
+
+	// an authorized agent is not checked again for a minute
+	if err := gid.SetIntelData("res"+util.GenerateID(8), "RESISTANCE"); err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := auth.AuthorizeToken(gid); !ok {
+		t.Error("recently authorized agent checked again")
+	}
+	if ok, _ := auth.Authorize(gid); ok {
+		t.Error("self-identified RES agent authorized")
+	}
+}
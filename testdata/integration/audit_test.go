@@ -0,0 +1,49 @@
+package integration_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/wasabee-project/Wasabee-Server/model"
+)
+
+func TestTeamAuditMembership(t *testing.T) {
+	needDB(t)
+
+	owner := newAgent(t)
+	agent := newAgent(t)
+	teamID := newTeam(t, owner)
+
+	if err := teamID.AddAgent(agent, owner, "test"); err != nil {
+		t.Fatal(err)
+	}
+	// already on the team, nothing changes so nothing is recorded
+	if err := teamID.AddAgent(agent, owner, "test"); err != nil {
+		t.Fatal(err)
+	}
+	if err := teamID.RemoveAgent(agent, agent, ""); err != nil {
+		t.Fatal(err)
+	}
+	teamID.Audit(owner, model.AuditAnnouncement, "", strings.Repeat("x", 1000))
+
+	entries, err := teamID.AuditLog(0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	count := make(map[string]int)
+	for _, e := range entries {
+		count[e.Action]++
+		if e.Action == model.AuditAnnouncement && len(e.Detail) != 255 {
+			t.Errorf("long detail stored as %d characters, expected 255", len(e.Detail))
+		}
+	}
+	if count[model.AuditAgentAdded] != 1 {
+		t.Errorf("%d agent added entries, expected 1", count[model.AuditAgentAdded])
+	}
+	if count[model.AuditAgentLeft] != 1 {
+		t.Errorf("%d agent left entries, expected 1", count[model.AuditAgentLeft])
+	}
+	if count[model.AuditAnnouncement] != 1 {
+		t.Error("long announcement was not recorded")
+	}
+}
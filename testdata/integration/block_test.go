@@ -0,0 +1,112 @@
+package integration_test
+
+import (
+	"testing"
+
+	"github.com/wasabee-project/Wasabee-Server/messaging"
+	"github.com/wasabee-project/Wasabee-Server/model"
+)
+
+// logged counts the messages stored from one agent to another
+func logged(t *testing.T, from, to model.GoogleID) int {
+	t.Helper()
+
+	var count int
+	if err := rawdb.QueryRow("SELECT COUNT(*) FROM messagelog WHERE sender = ? AND gid = ?", from, to).Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	return count
+}
+
+func TestBlockRefusesMessages(t *testing.T) {
+	needDB(t)
+
+	recipient := newAgent(t)
+	sender := newAgent(t)
+
+	if err := recipient.Block(recipient); err == nil || err.Error() != model.ErrBlockSelf {
+		t.Errorf("blocked self: %v", err)
+	}
+	if err := recipient.Block(sender); err != nil {
+		t.Fatal(err)
+	}
+	if err := recipient.Block(sender); err != nil {
+		t.Errorf("blocking twice: %v", err)
+	}
+
+	if _, _, err := sender.SendAgentMessage(recipient, "hello"); err == nil || err.Error() != messaging.ErrBlocked {
+		t.Errorf("message to an agent who blocked the sender: %v", err)
+	}
+	if n := logged(t, sender, recipient); n != 0 {
+		t.Errorf("%d refused messages stored", n)
+	}
+	// blocking is one way
+	if _, _, err := recipient.SendAgentMessage(sender, "hello"); err != nil {
+		t.Errorf("the blocking agent could not send: %v", err)
+	}
+
+	b, err := recipient.BlockList()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(b.Blocked) != 1 || b.Blocked[0].Gid != sender {
+		t.Errorf("block list: %+v", b.Blocked)
+	}
+
+	if err := recipient.Unblock(sender); err != nil {
+		t.Fatal(err)
+	}
+	if err := recipient.Unblock(sender); err == nil || err.Error() != model.ErrBlockNotFound {
+		t.Errorf("unblocking twice: %v", err)
+	}
+	if _, _, err := sender.SendAgentMessage(recipient, "hello"); err != nil {
+		t.Errorf("message after unblocking: %v", err)
+	}
+	if n := logged(t, sender, recipient); n != 1 {
+		t.Errorf("%d messages stored after unblocking, want 1", n)
+	}
+}
+
+func TestTeamOnlyMessages(t *testing.T) {
+	needDB(t)
+
+	recipient := newAgent(t)
+	teammate := newAgent(t)
+	stranger := newAgent(t)
+	newTeam(t, recipient, teammate)
+
+	if err := recipient.SetTeamOnlyMessages(true); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := recipient.BlockList(); b == nil || !b.TeamOnly {
+		t.Errorf("team only not set: %+v", b)
+	}
+
+	if _, _, err := stranger.SendAgentMessage(recipient, "hello"); err == nil || err.Error() != messaging.ErrBlocked {
+		t.Errorf("message from an agent on no shared team: %v", err)
+	}
+	if n := logged(t, stranger, recipient); n != 0 {
+		t.Errorf("%d refused messages stored", n)
+	}
+	if _, _, err := teammate.SendAgentMessage(recipient, "hello"); err != nil {
+		t.Errorf("message from a teammate: %v", err)
+	}
+
+	// a block applies to teammates too
+	if err := recipient.Block(teammate); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := teammate.SendAgentMessage(recipient, "again"); err == nil || err.Error() != messaging.ErrBlocked {
+		t.Errorf("message from a blocked teammate: %v", err)
+	}
+	if n := logged(t, teammate, recipient); n != 1 {
+		t.Errorf("%d messages stored from the teammate, want 1", n)
+	}
+
+	if err := recipient.SetTeamOnlyMessages(false); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := stranger.SendAgentMessage(recipient, "hello"); err != nil {
+		t.Errorf("message with team only cleared: %v", err)
+	}
+}
@@ -0,0 +1,46 @@
+package integration_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/wasabee-project/Wasabee-Server/model"
+	"github.com/wasabee-project/Wasabee-Server/templates"
+)
+
+func TestBriefingTemplates(t *testing.T) {
+	if err := templates.Start("../templates"); err != nil {
+		t.Fatal(err)
+	}
+
+	b := model.Briefing{
+		OpName:    "Fish & <Chips>",
+		AgentName: "deviousness",
+		Steps: []model.BriefingStep{{
+			Order:  1,
+			Action: "destroy",
+			Portal: model.BriefingPortal{Name: "O'Brien's \"Pub\""},
+		}},
+	}
+
+	text, err := templates.Briefing(&b, "en", "text")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(text, "Fish & <Chips>") || !strings.Contains(text, "O'Brien's \"Pub\"") {
+		t.Errorf("text briefing was escaped:\n%s", text)
+	}
+
+	html, err := templates.Briefing(&b, "en", "html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(html, "<Chips>") || !strings.Contains(html, "Fish &amp; &lt;Chips&gt;") {
+		t.Errorf("html briefing was not escaped:\n%s", html)
+	}
+
+	// languages without their own templates fall back to English
+	if _, err := templates.Briefing(&b, "xx", "text"); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,36 @@
+package integration_test
+
+import (
+	"testing"
+
+	"github.com/wasabee-project/Wasabee-Server/model"
+)
+
+func TestExportSections(t *testing.T) {
+	needDB(t)
+
+	owner := newAgent(t)
+	agent := newAgent(t)
+	newTeam(t, owner, agent)
+
+	e, err := agent.Export()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, section := range []string{"sessions", "refreshtokens", "apitokens", "geofencestate", "teamaudit"} {
+		if _, ok := e.Records[section]; !ok {
+			t.Errorf("export has no %s section", section)
+		}
+	}
+
+	// the owner added the agent, the agent's export still has the entry
+	found := false
+	for _, r := range e.Records["teamaudit"] {
+		if r["action"] == model.AuditAgentAdded && r["target"] == string(agent) {
+			found = true
+		}
+	}
+	if !found {
+		t.Error("team audit entries targeting the agent are not exported")
+	}
+}
@@ -0,0 +1,142 @@
+package integration_test
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/wasabee-project/Wasabee-Server/messaging"
+	"github.com/wasabee-project/Wasabee-Server/model"
+	"github.com/wasabee-project/Wasabee-Server/util"
+)
+
+// alertRecorder is a message bus which keeps the messages sent to one agent
+type alertRecorder struct {
+	mu   sync.Mutex
+	to   messaging.GoogleID
+	sent []string
+}
+
+func (a *alertRecorder) send(gid messaging.GoogleID, msg string) (bool, error) {
+	if gid != a.to {
+		return false, nil
+	}
+	a.mu.Lock()
+	a.sent = append(a.sent, msg)
+	a.mu.Unlock()
+	return true, nil
+}
+
+func (a *alertRecorder) count() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return len(a.sent)
+}
+
+// after waits for the alerts checked in the background to reach want, and a little longer for any extra ones
+func (a *alertRecorder) after(want int) []string {
+	deadline := time.Now().Add(3 * time.Second)
+	for a.count() < want && time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
+	}
+	time.Sleep(300 * time.Millisecond)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return append([]string(nil), a.sent...)
+}
+
+func TestGeofenceAlertsOncePerTask(t *testing.T) {
+	needDB(t)
+
+	owner := newAgent(t)
+	agent := newAgent(t)
+	teamID := newTeam(t, owner, agent)
+	if err := agent.SetTeamState(teamID, true); err != nil {
+		t.Fatal(err)
+	}
+
+	near := model.Portal{ID: model.PortalID("1956808f69fc4d889bc1861315149fa2.16"), Name: "near portal", Lat: "52.5", Lon: "13.4"}
+	far := model.Portal{ID: model.PortalID("2956808f69fc4d889bc1861315149fa2.16"), Name: "far portal", Lat: "52.6", Lon: "13.4"}
+	first := model.Marker{ID: model.MarkerID(util.GenerateID(40)), PortalID: near.ID, Type: "DestroyPortalAlert", Task: model.Task{Order: 1}}
+	second := model.Marker{ID: model.MarkerID(util.GenerateID(40)), PortalID: far.ID, Type: "DestroyPortalAlert", Task: model.Task{Order: 2}}
+	op := model.Operation{
+		ID:        model.OperationID(util.GenerateID(40)),
+		Name:      "geofence test",
+		Color:     "groupa",
+		OpPortals: []model.Portal{near, far},
+		Markers:   []model.Marker{first, second},
+	}
+	if err := model.DrawInsert(context.Background(), &op, owner); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = op.Delete(owner)
+	})
+	if err := op.ID.AddPerm(owner, teamID, "read", model.ZoneAll, time.Time{}, time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range []model.Marker{first, second} {
+		task, err := op.GetTask(model.TaskID(m.ID))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := task.Claim(agent); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := op.ID.SetGeofence(200, false, false); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := &alertRecorder{to: messaging.GoogleID(agent)}
+	messaging.RegisterMessageBus("geofence test", messaging.Bus{SendMessage: rec.send})
+	defer messaging.RemoveMessageBus("geofence test")
+
+	// arriving at the first task's portal alerts
+	if err := agent.SetLocation("52.5001", "13.4001"); err != nil {
+		t.Fatal(err)
+	}
+	if sent := rec.after(1); len(sent) != 1 || !strings.Contains(sent[0], "near portal") {
+		t.Fatalf("arrival alerts: %q", sent)
+	}
+
+	// staying there does not alert again
+	if err := agent.SetLocation("52.5002", "13.4"); err != nil {
+		t.Fatal(err)
+	}
+	if sent := rec.after(1); len(sent) != 1 {
+		t.Errorf("second update at the same task alerted again: %q", sent)
+	}
+
+	var task string
+	if err := rawdb.QueryRow("SELECT task FROM geofencestate WHERE opID = ? AND gid = ?", op.ID, agent).Scan(&task); err != nil {
+		t.Fatal(err)
+	}
+	if task != string(first.ID) {
+		t.Errorf("geofence state task %q, want %q", task, first.ID)
+	}
+
+	// with the first task done, the next alert is for the second task's portal
+	t1, err := op.GetTask(model.TaskID(first.ID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := t1.Complete(); err != nil {
+		t.Fatal(err)
+	}
+	if err := agent.SetLocation("52.5", "13.4"); err != nil {
+		t.Fatal(err)
+	}
+	if sent := rec.after(1); len(sent) != 1 {
+		t.Errorf("alerted while far from the next task: %q", sent)
+	}
+	if err := agent.SetLocation("52.6", "13.4001"); err != nil {
+		t.Fatal(err)
+	}
+	if sent := rec.after(2); len(sent) != 2 || !strings.Contains(sent[1], "far portal") {
+		t.Errorf("arrival at the next task: %q", sent)
+	}
+}
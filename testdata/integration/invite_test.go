@@ -0,0 +1,111 @@
+package integration_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/wasabee-project/Wasabee-Server/model"
+)
+
+func inviteUses(t *testing.T, teamID model.TeamID, token string) int {
+	t.Helper()
+
+	invites, err := teamID.Invites()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, i := range invites {
+		if i.Token == token {
+			return i.Uses
+		}
+	}
+	t.Fatalf("invite %s not found", token)
+	return 0
+}
+
+func TestInviteUses(t *testing.T) {
+	needDB(t)
+
+	owner := newAgent(t)
+	first := newAgent(t)
+	second := newAgent(t)
+	teamID := newTeam(t, owner)
+
+	invite, err := teamID.NewInvite(owner, "once", time.Time{}, 1, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pending, err := teamID.JoinToken(first, invite.Token); err != nil || pending {
+		t.Fatalf("join failed: pending %v, %v", pending, err)
+	}
+	if inteam, _ := first.AgentInTeam(teamID); !inteam {
+		t.Error("agent not added by the invite")
+	}
+
+	// members following the link again do not use it up
+	if _, err := teamID.JoinToken(first, invite.Token); err != nil {
+		t.Error(err)
+	}
+	if uses := inviteUses(t, teamID, invite.Token); uses != 1 {
+		t.Errorf("invite used %d times, expected 1", uses)
+	}
+
+	// and it is now used up
+	if _, err := teamID.JoinToken(second, invite.Token); err == nil {
+		t.Error("invite past its maximum uses was accepted")
+	}
+}
+
+func TestInviteApproval(t *testing.T) {
+	needDB(t)
+
+	owner := newAgent(t)
+	agent := newAgent(t)
+	teamID := newTeam(t, owner)
+
+	invite, err := teamID.NewInvite(owner, "approval", time.Time{}, 2, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		pending, err := teamID.JoinToken(agent, invite.Token)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !pending {
+			t.Error("join did not wait for approval")
+		}
+	}
+	if uses := inviteUses(t, teamID, invite.Token); uses != 1 {
+		t.Errorf("repeated requests used the invite %d times, expected 1", uses)
+	}
+
+	requests, err := teamID.JoinRequests()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(requests) != 1 {
+		t.Fatalf("%d join requests, expected 1", len(requests))
+	}
+	if err := requests[0].ID.Approve(agent); err == nil {
+		t.Error("agent approved their own join request")
+	}
+	if err := requests[0].ID.Approve(owner); err != nil {
+		t.Fatal(err)
+	}
+	if inteam, _ := agent.AgentInTeam(teamID); !inteam {
+		t.Error("approved agent not on the team")
+	}
+
+	// invites and requests are not part of the plain team data
+	td, err := teamID.FetchTeam()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if td.Invites != nil {
+		t.Error("FetchTeam loaded the invites")
+	}
+	if err := td.PopulateInvites(); err != nil || len(td.Invites) != 1 {
+		t.Errorf("PopulateInvites: %d invites, %v", len(td.Invites), err)
+	}
+}
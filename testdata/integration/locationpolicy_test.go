@@ -0,0 +1,36 @@
+package integration_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/wasabee-project/Wasabee-Server/model"
+)
+
+func TestLocationPolicyOp(t *testing.T) {
+	needDB(t)
+
+	owner := newAgent(t)
+	agent := newAgent(t)
+	teamID := newTeam(t, agent)
+	op := newOp(t, owner)
+
+	// an op the agent cannot read may not be used, or its phases could be probed
+	lp := model.LocationPolicy{OpID: op.ID}
+	if err := agent.SetLocationPolicy(teamID, lp); err == nil || err.Error() != model.ErrLocationPolicyOp {
+		t.Errorf("agent policy on an unreadable op: %v", err)
+	}
+	if err := teamID.SetLocationPolicy(lp); err == nil || err.Error() != model.ErrLocationPolicyOp {
+		t.Errorf("team policy on an op not shared with the team: %v", err)
+	}
+
+	if err := op.ID.AddPerm(owner, teamID, "read", model.ZoneAll, time.Time{}, time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := agent.SetLocationPolicy(teamID, lp); err != nil {
+		t.Errorf("agent policy on a shared op: %v", err)
+	}
+	if err := teamID.SetLocationPolicy(lp); err != nil {
+		t.Errorf("team policy on a shared op: %v", err)
+	}
+}
@@ -0,0 +1,79 @@
+package integration_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/wasabee-project/Wasabee-Server/model"
+)
+
+func trackPoints(t *testing.T, teamID model.TeamID, gid model.GoogleID) int {
+	t.Helper()
+
+	tracks, err := teamID.LocationTrack(time.Now().Add(-time.Hour), time.Now().Add(time.Hour), gid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := 0
+	for _, tr := range tracks {
+		n += len(tr.Points)
+	}
+	return n
+}
+
+func TestLocationTrackOptIn(t *testing.T) {
+	needDB(t)
+
+	owner := newAgent(t)
+	agent := newAgent(t)
+	teamID := newTeam(t, owner, agent)
+	if err := teamID.SetTrackDays(1); err != nil {
+		t.Fatal(err)
+	}
+	if err := agent.SetTeamState(teamID, true); err != nil {
+		t.Fatal(err)
+	}
+
+	// sharing location with the team is not enough, the agent must opt in to the history
+	if err := agent.SetLocation("1.5", "2.5"); err != nil {
+		t.Fatal(err)
+	}
+	if n := trackPoints(t, teamID, agent); n != 0 {
+		t.Errorf("%d points recorded without opting in", n)
+	}
+
+	if err := agent.SetTrackLoc(teamID, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := agent.SetLocation("1.5", "2.5"); err != nil {
+		t.Fatal(err)
+	}
+	if n := trackPoints(t, teamID, agent); n != 1 {
+		t.Errorf("%d points recorded after opting in, expected 1", n)
+	}
+
+	// turning location sharing off discards the history
+	if err := agent.SetTeamState(teamID, false); err != nil {
+		t.Fatal(err)
+	}
+	if n := trackPoints(t, teamID, agent); n != 0 {
+		t.Errorf("%d points kept after location sharing was turned off", n)
+	}
+
+	// so does leaving the team
+	if err := agent.SetTeamState(teamID, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := agent.SetLocation("1.5", "2.5"); err != nil {
+		t.Fatal(err)
+	}
+	if n := trackPoints(t, teamID, agent); n != 1 {
+		t.Fatalf("%d points recorded after sharing was turned back on, expected 1", n)
+	}
+	if err := teamID.RemoveAgent(agent, agent, ""); err != nil {
+		t.Fatal(err)
+	}
+	if n := trackPoints(t, teamID, agent); n != 0 {
+		t.Errorf("%d points kept after leaving the team", n)
+	}
+}
@@ -0,0 +1,114 @@
+package integration_test
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"fmt"
+	"math/big"
+	"os"
+	"testing"
+
+	"github.com/wasabee-project/Wasabee-Server/log"
+	"github.com/wasabee-project/Wasabee-Server/model"
+	"github.com/wasabee-project/Wasabee-Server/util"
+)
+
+// these tests are not picked up by go test ./... since they live under testdata
+// run them with: DATABASE="user:pass@tcp(localhost)/wasabee_test" go test ./testdata/integration
+// tests which need the database are skipped when DATABASE is not set
+
+var connected bool
+
+// rawdb is a second connection to the same database, for setting up rows the model API never writes, such as those left by older versions
+var rawdb *sql.DB
+
+func TestMain(m *testing.M) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	log.Start(ctx, &log.Configuration{
+		Console: true,
+	})
+
+	if uri := os.Getenv("DATABASE"); uri != "" {
+		if err := model.Connect(ctx, uri); err != nil {
+			log.Error(err)
+		} else {
+			connected = true
+		}
+		var err error
+		if rawdb, err = sql.Open("mysql", uri); err != nil {
+			log.Error(err)
+			connected = false
+		}
+	}
+
+	exitCode := m.Run()
+	if connected {
+		model.Disconnect()
+		rawdb.Close()
+	}
+	cancel()
+	os.Exit(exitCode)
+}
+
+func needDB(t *testing.T) {
+	t.Helper()
+	if !connected {
+		t.Skip("DATABASE not set")
+	}
+}
+
+// newAgent creates an agent with a random GoogleID and removes it when the test ends
+func newAgent(t *testing.T) model.GoogleID {
+	t.Helper()
+
+	n, err := rand.Int(rand.Reader, big.NewInt(1e18))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gid := model.GoogleID(fmt.Sprintf("999%018d", n))
+	if err := gid.FirstLogin(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := gid.Delete(); err != nil {
+			t.Error(err)
+		}
+	})
+	return gid
+}
+
+// newTeam creates a team owned by gid with the other agents as members
+func newTeam(t *testing.T, gid model.GoogleID, members ...model.GoogleID) model.TeamID {
+	t.Helper()
+
+	teamID, err := gid.NewTeam("integration test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range members {
+		if err := teamID.AddAgent(m, gid, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return teamID
+}
+
+// newOp uploads an empty op owned by gid
+func newOp(t *testing.T, gid model.GoogleID) *model.Operation {
+	t.Helper()
+
+	op := model.Operation{
+		ID:    model.OperationID(util.GenerateID(40)),
+		Name:  "integration test",
+		Color: "groupa",
+	}
+	if err := model.DrawInsert(context.Background(), &op, gid); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = op.Delete(gid)
+	})
+	return &op
+}
@@ -0,0 +1,38 @@
+package integration_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/wasabee-project/Wasabee-Server/model"
+	"github.com/wasabee-project/Wasabee-Server/util"
+)
+
+func TestMergeRevokesSessions(t *testing.T) {
+	needDB(t)
+
+	from := newAgent(t)
+	into := newAgent(t)
+
+	jwtID := util.GenerateID(16)
+	if _, err := from.NewRefreshToken(jwtID, time.Now().Add(time.Hour), "integration test", "127.0.0.1"); err != nil {
+		t.Fatal(err)
+	}
+
+	jwts, err := model.MergeAgents(from, into)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, j := range jwts {
+		if j == jwtID {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("merge did not return the merged agent's access JWT: %v", jwts)
+	}
+	if revoked, err := model.IsRevokedJWT(jwtID); err != nil || !revoked {
+		t.Error("the merged agent's access JWT is still valid")
+	}
+}
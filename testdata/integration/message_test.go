@@ -0,0 +1,108 @@
+package integration_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/wasabee-project/Wasabee-Server/model"
+)
+
+func TestInboxPagesAndRead(t *testing.T) {
+	needDB(t)
+
+	sender := newAgent(t)
+	recipient := newAgent(t)
+
+	var ids []int64
+	for i := 0; i < 5; i++ {
+		m, _, err := sender.SendAgentMessage(recipient, fmt.Sprintf("message %d", i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, m.ID)
+	}
+	if _, _, err := sender.SendAgentMessage(recipient, "  "); err == nil || err.Error() != model.ErrEmptyMessage {
+		t.Errorf("empty message: %v", err)
+	}
+
+	// newest first, each page starts below the last ID of the previous one
+	var paged []int64
+	var before int64
+	for page := 0; page < 4; page++ {
+		inbox, err := recipient.Inbox(before, 2, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(inbox) == 0 {
+			break
+		}
+		for _, m := range inbox {
+			if m.From != sender || m.To != recipient {
+				t.Errorf("inbox message %d from %s to %s", m.ID, m.From, m.To)
+			}
+			paged = append(paged, m.ID)
+		}
+		before = inbox[len(inbox)-1].ID
+	}
+	if len(paged) != 5 {
+		t.Fatalf("paged through %v, want 5 messages", paged)
+	}
+	for i, id := range paged {
+		if id != ids[4-i] {
+			t.Errorf("page order %v, want newest first of %v", paged, ids)
+			break
+		}
+	}
+
+	outbox, err := sender.Outbox(ids[3], 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(outbox) != 3 || outbox[0].ID != ids[2] {
+		t.Errorf("outbox before %d: %+v", ids[3], outbox)
+	}
+	if inbox, _ := sender.Inbox(0, 10, false); len(inbox) != 0 {
+		t.Errorf("sent messages in the sender's inbox: %+v", inbox)
+	}
+
+	// marking read
+	if n, _ := recipient.UnreadMessages(); n != 5 {
+		t.Errorf("%d unread, want 5", n)
+	}
+	if err := recipient.MarkMessageRead(ids[0]); err != nil {
+		t.Fatal(err)
+	}
+	if err := recipient.MarkMessageRead(ids[0]); err != nil {
+		t.Errorf("marking a read message again: %v", err)
+	}
+	if n, _ := recipient.UnreadMessages(); n != 4 {
+		t.Errorf("%d unread after marking one, want 4", n)
+	}
+	unread, err := recipient.Inbox(0, 10, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range unread {
+		if m.ID == ids[0] || m.Read != "" {
+			t.Errorf("read message %d listed as unread", m.ID)
+		}
+	}
+
+	other := newAgent(t)
+	if err := other.MarkMessageRead(ids[1]); err == nil || err.Error() != model.ErrMessageNotFound {
+		t.Errorf("another agent marked a message read: %v", err)
+	}
+	if err := sender.MarkMessageRead(ids[1]); err != nil {
+		t.Error(err)
+	}
+	if n, _ := recipient.UnreadMessages(); n != 4 {
+		t.Errorf("the sender marked the recipient's message read, %d unread", n)
+	}
+
+	if err := recipient.MarkAllMessagesRead(); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := recipient.UnreadMessages(); n != 0 {
+		t.Errorf("%d unread after marking all", n)
+	}
+}
@@ -0,0 +1,127 @@
+package integration_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/wasabee-project/Wasabee-Server/messaging"
+	"github.com/wasabee-project/Wasabee-Server/model"
+	"github.com/wasabee-project/Wasabee-Server/util"
+)
+
+// hm formats now moved by d as a quiet hours bound
+func hm(d time.Duration) string {
+	return time.Now().UTC().Add(d).Format("15:04")
+}
+
+func TestNotifyFilter(t *testing.T) {
+	needDB(t)
+
+	agent := newAgent(t)
+	gid := messaging.GoogleID(agent)
+	const bus = "filter test"
+
+	// no preferences, everything is delivered
+	if !messaging.Wants(gid, bus, messaging.EventAnnounce, "") {
+		t.Error("agent without preferences filtered")
+	}
+	if !messaging.Wants(messaging.GoogleID(util.GenerateID(21)), bus, messaging.EventAnnounce, "") {
+		t.Error("unknown agent filtered")
+	}
+
+	// per-bus event lists, other buses deliver everything
+	if err := agent.SetNotifyPrefs(model.NotifyPrefs{
+		Buses: map[string][]messaging.Event{bus: {messaging.EventMessage, messaging.EventAssignment}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if !messaging.Wants(gid, bus, messaging.EventMessage, "") || !messaging.Wants(gid, bus, messaging.EventAssignment, "") {
+		t.Error("listed event filtered")
+	}
+	if messaging.Wants(gid, bus, messaging.EventAnnounce, "") {
+		t.Error("unlisted event delivered")
+	}
+	if !messaging.Wants(gid, "other bus", messaging.EventAnnounce, "") {
+		t.Error("event filtered on a bus without a list")
+	}
+	if err := agent.SetNotifyPrefs(model.NotifyPrefs{Buses: map[string][]messaging.Event{bus: {}}}); err != nil {
+		t.Fatal(err)
+	}
+	if messaging.Wants(gid, bus, messaging.EventMessage, "") {
+		t.Error("event delivered on a bus with an empty list")
+	}
+	if err := agent.SetNotifyPrefs(model.NotifyPrefs{Buses: map[string][]messaging.Event{bus: {"bogus"}}}); err == nil || err.Error() != model.ErrNotifyPrefsInvalid {
+		t.Errorf("unknown event accepted: %v", err)
+	}
+
+	// quiet hours, wrapped past midnight unless now is within an hour of it
+	quiet := []struct {
+		name       string
+		start, end string
+		want       bool
+	}{
+		{"in the window", hm(-time.Hour), hm(time.Hour), false},
+		{"outside the window", hm(time.Hour), hm(2 * time.Hour), true},
+		{"wrapped, in the window", hm(-time.Minute), hm(-2 * time.Minute), false},
+		{"wrapped, outside the window", hm(time.Hour), hm(-time.Hour), true},
+	}
+	for _, q := range quiet {
+		if err := agent.SetNotifyPrefs(model.NotifyPrefs{QuietStart: q.start, QuietEnd: q.end}); err != nil {
+			t.Fatal(err)
+		}
+		if got := messaging.Wants(gid, bus, messaging.EventMessage, ""); got != q.want {
+			t.Errorf("%s %s-%s: got %v, want %v", q.name, q.start, q.end, got, q.want)
+		}
+	}
+	if err := agent.SetNotifyPrefs(model.NotifyPrefs{QuietStart: "22:00"}); err == nil || err.Error() != model.ErrNotifyPrefsInvalid {
+		t.Errorf("quiet hours without an end accepted: %v", err)
+	}
+
+	// assigned only applies to op notifications
+	portal := model.Portal{ID: model.PortalID("3956808f69fc4d889bc1861315149fa2.16"), Name: "notify portal", Lat: "52.5", Lon: "13.4"}
+	marker := model.Marker{ID: model.MarkerID(util.GenerateID(40)), PortalID: portal.ID, Type: "DestroyPortalAlert"}
+	assigned := model.Operation{
+		ID:        model.OperationID(util.GenerateID(40)),
+		Name:      "notify test",
+		Color:     "groupa",
+		OpPortals: []model.Portal{portal},
+		Markers:   []model.Marker{marker},
+	}
+	if err := model.DrawInsert(context.Background(), &assigned, agent); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = assigned.Delete(agent)
+	})
+	task, err := assigned.GetTask(model.TaskID(marker.ID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := task.Claim(agent); err != nil {
+		t.Fatal(err)
+	}
+	other := newOp(t, agent)
+
+	if err := agent.SetNotifyPrefs(model.NotifyPrefs{AssignedOnly: true}); err != nil {
+		t.Fatal(err)
+	}
+	if !messaging.Wants(gid, bus, messaging.EventTaskStatus, messaging.OperationID(assigned.ID)) {
+		t.Error("notification for an op with an assigned task filtered")
+	}
+	if messaging.Wants(gid, bus, messaging.EventTaskStatus, messaging.OperationID(other.ID)) {
+		t.Error("notification for an op without an assigned task delivered")
+	}
+	if !messaging.Wants(gid, bus, messaging.EventMessage, "") {
+		t.Error("notification not tied to an op filtered")
+	}
+
+	// read back as set
+	p, err := agent.NotifyPrefs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !p.AssignedOnly || p.QuietStart != "" {
+		t.Errorf("preferences read back: %+v", p)
+	}
+}
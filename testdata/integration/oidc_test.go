@@ -0,0 +1,181 @@
+package integration_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jwk"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+
+	"github.com/wasabee-project/Wasabee-Server/auth"
+)
+
+// mockIssuer serves discovery, JWKS and a token endpoint that answers the code "good" with idToken
+type mockIssuer struct {
+	srv     *httptest.Server
+	key     jwk.Key
+	idToken string
+}
+
+func newMockIssuer(t *testing.T) *mockIssuer {
+	t.Helper()
+
+	raw, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := jwk.FromRaw(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = key.Set(jwk.KeyIDKey, "test")
+	_ = key.Set(jwk.AlgorithmKey, jwa.RS256)
+	pub, err := jwk.PublicKeyOf(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	set := jwk.NewSet()
+	_ = set.AddKey(pub)
+
+	m := &mockIssuer{key: key}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(res http.ResponseWriter, req *http.Request) {
+		json.NewEncoder(res).Encode(auth.OIDCDiscovery{
+			Issuer:                m.srv.URL,
+			AuthorizationEndpoint: m.srv.URL + "/authorize",
+			TokenEndpoint:         m.srv.URL + "/token",
+			JWKSURI:               m.srv.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(res http.ResponseWriter, req *http.Request) {
+		json.NewEncoder(res).Encode(set)
+	})
+	mux.HandleFunc("/token", func(res http.ResponseWriter, req *http.Request) {
+		if req.FormValue("code") != "good" {
+			http.Error(res, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		res.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(res).Encode(map[string]string{
+			"access_token": "access",
+			"token_type":   "Bearer",
+			"id_token":     m.idToken,
+		})
+	})
+	m.srv = httptest.NewServer(mux)
+	t.Cleanup(m.srv.Close)
+	return m
+}
+
+func (m *mockIssuer) provider() *auth.OIDCProvider {
+	return &auth.OIDCProvider{
+		Name:         "mock",
+		Issuer:       m.srv.URL,
+		ClientID:     "wasabee",
+		ClientSecret: "secret",
+		Scopes:       []string{"openid", "profile"},
+		SubjectClaim: "sub",
+		NameClaim:    "preferred_username",
+		PictureClaim: "picture",
+	}
+}
+
+func (m *mockIssuer) sign(t *testing.T, issuer string, aud []string, azp string, exp time.Time) string {
+	t.Helper()
+
+	b := jwt.NewBuilder().
+		Issuer(issuer).
+		Audience(aud).
+		Subject("subject-1").
+		IssuedAt(exp.Add(-time.Hour)).
+		Expiration(exp).
+		Claim("preferred_username", "MockAgent")
+	if azp != "" {
+		b = b.Claim("azp", azp)
+	}
+	tok, err := b.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed, err := jwt.Sign(tok, jwt.WithKey(jwa.RS256, m.key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(signed)
+}
+
+func TestOIDCVerify(t *testing.T) {
+	m := newMockIssuer(t)
+	p := m.provider()
+	ctx := context.Background()
+	later := time.Now().Add(time.Hour)
+
+	tests := []struct {
+		name  string
+		token string
+		ok    bool
+	}{
+		{"valid", m.sign(t, m.srv.URL, []string{"wasabee"}, "", later), true},
+		{"valid with azp", m.sign(t, m.srv.URL, []string{"wasabee", "other"}, "wasabee", later), true},
+		{"wrong issuer", m.sign(t, "https://elsewhere.example", []string{"wasabee"}, "", later), false},
+		{"wrong audience", m.sign(t, m.srv.URL, []string{"other"}, "", later), false},
+		{"other client", m.sign(t, m.srv.URL, []string{"wasabee", "other"}, "other", later), false},
+		{"shared audience without azp", m.sign(t, m.srv.URL, []string{"wasabee", "other"}, "", later), false},
+		{"expired", m.sign(t, m.srv.URL, []string{"wasabee"}, "", time.Now().Add(-time.Hour)), false},
+	}
+	for _, tc := range tests {
+		id, err := p.Verify(ctx, tc.token)
+		if tc.ok != (err == nil) {
+			t.Errorf("%s: accepted %v, err %v", tc.name, err == nil, err)
+			continue
+		}
+		if tc.ok && (id.Subject != "subject-1" || id.Name != "MockAgent") {
+			t.Errorf("%s: identity %+v", tc.name, id)
+		}
+	}
+}
+
+func TestOIDCExchange(t *testing.T) {
+	m := newMockIssuer(t)
+	p := m.provider()
+	ctx := context.Background()
+	m.idToken = m.sign(t, m.srv.URL, []string{"wasabee"}, "wasabee", time.Now().Add(time.Hour))
+
+	idToken, err := p.Exchange(ctx, "good", "https://client.example/cb", "verifier")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id, err := p.Verify(ctx, idToken); err != nil || id.Subject != "subject-1" {
+		t.Errorf("exchanged token: %+v %v", id, err)
+	}
+	if _, err := p.Exchange(ctx, "bad", "https://client.example/cb", ""); err == nil {
+		t.Error("rejected code exchanged")
+	}
+}
+
+func TestOIDCDiscoveryBackoff(t *testing.T) {
+	var hits int32
+	srv := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		http.Error(res, "down", http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	p := auth.OIDCProvider{Name: "down", Issuer: srv.URL, ClientID: "wasabee"}
+	for i := 0; i < 3; i++ {
+		if _, err := p.Discover(context.Background()); err == nil {
+			t.Fatal("failed discovery accepted")
+		}
+	}
+	if n := atomic.LoadInt32(&hits); n != 1 {
+		t.Errorf("failed discovery fetched %d times, want 1", n)
+	}
+}
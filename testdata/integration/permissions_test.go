@@ -0,0 +1,60 @@
+package integration_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/wasabee-project/Wasabee-Server/model"
+)
+
+func TestPermissionWindow(t *testing.T) {
+	needDB(t)
+
+	owner := newAgent(t)
+	agent := newAgent(t)
+	teamID := newTeam(t, owner, agent)
+	op := newOp(t, owner)
+
+	// not yet open
+	if err := op.ID.AddPerm(owner, teamID, "read", model.ZoneAll, time.Now().Add(time.Hour), time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	o := model.Operation{ID: op.ID}
+	if read, _ := o.ReadAccess(agent); read {
+		t.Error("read access granted before notbefore")
+	}
+	if teams := o.ActiveTeams(); len(teams) != 0 {
+		t.Errorf("scheduled permission announced to %v", teams)
+	}
+
+	// an expiry in the past is refused
+	if err := op.ID.AddPerm(owner, teamID, "write", model.ZoneAll, time.Time{}, time.Now().Add(-time.Minute)); err == nil {
+		t.Error("permission which has already expired was accepted")
+	}
+
+	// open now, closing shortly
+	if err := op.ID.AddPerm(owner, teamID, "write", model.ZoneAll, time.Time{}, time.Now().Add(2*time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	o = model.Operation{ID: op.ID}
+	if !o.WriteAccess(agent) {
+		t.Error("write access not granted inside the window")
+	}
+	if teams := o.ActiveTeams(); len(teams) != 1 || teams[0] != teamID {
+		t.Errorf("active teams: got %v, expected [%s]", teams, teamID)
+	}
+
+	time.Sleep(3 * time.Second)
+	o = model.Operation{ID: op.ID}
+	if o.WriteAccess(agent) {
+		t.Error("write access granted after expiry")
+	}
+	if teams := o.ActiveTeams(); len(teams) != 0 {
+		t.Errorf("expired permission announced to %v", teams)
+	}
+	if _, closed, err := model.OpPermissionSchedule(); err != nil {
+		t.Error(err)
+	} else if len(closed) == 0 {
+		t.Error("expired permission not removed by the scheduler")
+	}
+}
@@ -0,0 +1,159 @@
+package integration_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/wasabee-project/Wasabee-Server/model"
+	"github.com/wasabee-project/Wasabee-Server/util"
+)
+
+// newPhasedOp uploads an op with one marker and places the marker in a phase which has not started
+func newPhasedOp(t *testing.T, gid model.GoogleID) (*model.Operation, model.TaskID, model.PhaseID) {
+	t.Helper()
+
+	portal := model.Portal{
+		ID:   model.PortalID("1956808f69fc4d889bc1861315149fa2.16"),
+		Name: "test portal",
+		Lat:  "52.5",
+		Lon:  "13.4",
+	}
+	marker := model.Marker{
+		ID:       model.MarkerID(util.GenerateID(40)),
+		PortalID: portal.ID,
+		Type:     "DestroyPortalAlert",
+	}
+	op := model.Operation{
+		ID:        model.OperationID(util.GenerateID(40)),
+		Name:      "integration test",
+		Color:     "groupa",
+		OpPortals: []model.Portal{portal},
+		Markers:   []model.Marker{marker},
+	}
+	if err := model.DrawInsert(context.Background(), &op, gid); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = op.Delete(gid)
+	})
+
+	phase, err := op.ID.AddPhase("clear", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	task, err := op.GetTask(model.TaskID(marker.ID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := task.SetPhase(phase.ID); err != nil {
+		t.Fatal(err)
+	}
+	return &op, model.TaskID(marker.ID), phase.ID
+}
+
+func TestSharePhaseGating(t *testing.T) {
+	needDB(t)
+
+	owner := newAgent(t)
+	op, _, phaseID := newPhasedOp(t, owner)
+
+	share, err := op.ID.NewShare(owner, model.ZoneAll, time.Time{}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := share.Token.Share()
+	if err != nil {
+		t.Fatal(err)
+	}
+	shared, err := s.Populate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(shared.Markers) != 0 {
+		t.Error("share link shows a marker in a phase which has not started")
+	}
+
+	if _, err := op.ID.StartPhase(phaseID); err != nil {
+		t.Fatal(err)
+	}
+	shared, err = s.Populate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(shared.Markers) != 1 {
+		t.Errorf("share link shows %d markers after the phase started, expected 1", len(shared.Markers))
+	}
+}
+
+func TestTaskPhaseGating(t *testing.T) {
+	needDB(t)
+
+	owner := newAgent(t)
+	agent := newAgent(t)
+	teamID := newTeam(t, owner, agent)
+	op, taskID, phaseID := newPhasedOp(t, owner)
+
+	if err := op.ID.AddPerm(owner, teamID, "read", model.ZoneAll, time.Time{}, time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the owner can plan the phase
+	o := model.Operation{ID: op.ID}
+	if err := o.Populate(owner); err != nil {
+		t.Fatal(err)
+	}
+	task, err := o.GetTask(taskID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if task.PhaseOpen() {
+		t.Error("task in a pending phase reported open")
+	}
+	if err := task.Claim(agent); err == nil {
+		t.Error("task in a pending phase was claimed")
+	}
+
+	// read-only agents do not see it at all
+	o = model.Operation{ID: op.ID}
+	if err := o.Populate(agent); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := o.GetTask(taskID); err == nil {
+		t.Error("read-only agent can fetch a task in a pending phase")
+	}
+	if _, err := o.GetMarker(model.MarkerID(taskID)); err == nil {
+		t.Error("read-only agent can fetch a marker in a pending phase")
+	}
+
+	if _, err := op.ID.StartPhase(phaseID); err != nil {
+		t.Fatal(err)
+	}
+	o = model.Operation{ID: op.ID}
+	if err := o.Populate(agent); err != nil {
+		t.Fatal(err)
+	}
+	task, err = o.GetTask(taskID)
+	if err != nil {
+		t.Fatalf("task not visible after the phase started: %s", err)
+	}
+	if !task.PhaseOpen() {
+		t.Error("task in a started phase reported closed")
+	}
+
+	// sub-teams of a permitted team are told about phase changes
+	sub := newTeam(t, owner)
+	if err := sub.SetParent(teamID); err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, a := range o.AnnounceTeams() {
+		if a == sub {
+			found = true
+		}
+	}
+	if !found {
+		t.Error("sub-team of a permitted team is not announced to")
+	}
+}
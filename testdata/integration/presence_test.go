@@ -0,0 +1,38 @@
+package integration_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/wasabee-project/Wasabee-Server/model"
+)
+
+func TestPresenceUnavailable(t *testing.T) {
+	needDB(t)
+
+	busy := newAgent(t)
+	active := newAgent(t)
+	idle := newAgent(t)
+
+	active.Seen()
+	if err := busy.SetPresence(model.PresenceBusy, "", time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+
+	got := model.Unavailable([]model.GoogleID{busy, active, idle})
+	want := map[model.GoogleID]bool{busy: true, idle: true}
+	if len(got) != len(want) {
+		t.Fatalf("unavailable %v, expected %v", got, want)
+	}
+	for _, gid := range got {
+		if !want[gid] {
+			t.Errorf("%s listed as unavailable", gid)
+		}
+	}
+
+	// the sweep only notifies, it must not change anyone's presence
+	model.PresenceSweep()
+	if p, err := active.Presence(); err != nil || p.Status != model.PresenceAvailable {
+		t.Errorf("active agent after sweep: %v %v", p, err)
+	}
+}
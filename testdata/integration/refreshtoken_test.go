@@ -0,0 +1,44 @@
+package integration_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/wasabee-project/Wasabee-Server/model"
+	"github.com/wasabee-project/Wasabee-Server/util"
+)
+
+func TestRefreshTokenRotation(t *testing.T) {
+	needDB(t)
+
+	gid := newAgent(t)
+	expires := time.Now().Add(time.Hour)
+
+	first := util.GenerateID(16)
+	token, err := gid.NewRefreshToken(first, expires, "integration test", "127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	second := util.GenerateID(16)
+	owner, next, err := model.RotateRefreshToken(token, second, expires)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if owner != gid || next == "" || next == token {
+		t.Fatalf("rotation returned %s %q", owner, next)
+	}
+
+	// the used token was copied, the whole chain goes
+	if _, _, err := model.RotateRefreshToken(token, util.GenerateID(16), expires); err == nil || err.Error() != model.ErrRefreshTokenReused {
+		t.Errorf("reused refresh token: %v", err)
+	}
+	for _, j := range []string{first, second} {
+		if revoked, err := model.IsRevokedJWT(j); err != nil || !revoked {
+			t.Errorf("access JWT %s not revoked after reuse: %v", j, err)
+		}
+	}
+	if _, _, err := model.RotateRefreshToken(next, util.GenerateID(16), expires); err == nil || err.Error() != model.ErrRefreshTokenInvalid {
+		t.Errorf("refresh token after its chain was revoked: %v", err)
+	}
+}
@@ -0,0 +1,103 @@
+package integration_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	wasabeehttps "github.com/wasabee-project/Wasabee-Server/http"
+	"github.com/wasabee-project/Wasabee-Server/model"
+	"github.com/wasabee-project/Wasabee-Server/util"
+)
+
+func TestReadRosterCSV(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want []string
+	}{
+		{"plain list", "Agent1\nAgent2\n", []string{"Agent1", "Agent2"}},
+		{"export header", "id,name,vname\n123456789012345678901,Agent1,V1\n", []string{"123456789012345678901"}},
+		{"header in capitals", "ID,Name\nAgent1,x\n", []string{"Agent1"}},
+		{"uneven lines", "Agent1,a,b\nAgent2\n  Agent3,c\n", []string{"Agent1", "Agent2", "Agent3"}},
+		{"empty", "", []string{}},
+	}
+	for _, tc := range tests {
+		got, err := wasabeehttps.ReadRosterCSV(strings.NewReader(tc.in))
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: got %q, want %q", tc.name, got, tc.want)
+		}
+	}
+
+	if _, err := wasabeehttps.ReadRosterCSV(strings.NewReader("\"unterminated\n")); err == nil {
+		t.Error("malformed CSV accepted")
+	}
+}
+
+func TestImportRoster(t *testing.T) {
+	needDB(t)
+
+	owner := newAgent(t)
+	member := newAgent(t)
+	byGID := newAgent(t)
+	byEnlID := newAgent(t)
+	byName := newAgent(t)
+	dupA := newAgent(t)
+	dupB := newAgent(t)
+	teamID := newTeam(t, owner, member)
+
+	enlID := util.GenerateID(40)
+	if _, err := rawdb.Exec("INSERT INTO v (gid, enlid) VALUES (?, ?)", byEnlID, enlID); err != nil {
+		t.Fatal(err)
+	}
+	unique := "ru" + util.GenerateID(10)
+	if err := byName.SetIntelData(unique, "ENLIGHTENED"); err != nil {
+		t.Fatal(err)
+	}
+	dup := "rd" + util.GenerateID(10)
+	for _, gid := range []model.GoogleID{dupA, dupB} {
+		if err := gid.SetIntelData(dup, "ENLIGHTENED"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	unknown := "rx" + util.GenerateID(10)
+
+	r, err := teamID.ImportRoster(owner, []string{string(byGID), enlID, strings.ToUpper(unique), dup, unknown, string(member), string(byGID), " "})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	added := make(map[model.GoogleID]string)
+	for _, e := range r.Added {
+		added[e.Gid] = e.Input
+	}
+	for _, gid := range []model.GoogleID{byGID, byEnlID, byName} {
+		if _, ok := added[gid]; !ok {
+			t.Errorf("%s not added: %+v", gid, r.Added)
+		}
+		if in, _ := gid.AgentInTeam(teamID); !in {
+			t.Errorf("%s not on the team after import", gid)
+		}
+	}
+	if len(r.Added) != 3 {
+		t.Errorf("added %+v, want 3 agents once each", r.Added)
+	}
+	if len(r.OnTeam) != 1 || r.OnTeam[0].Gid != member {
+		t.Errorf("already on the team: %+v", r.OnTeam)
+	}
+	if !reflect.DeepEqual(r.Ambiguous, []string{dup}) {
+		t.Errorf("ambiguous: %q", r.Ambiguous)
+	}
+	if !reflect.DeepEqual(r.Unknown, []string{unknown}) {
+		t.Errorf("unknown: %q", r.Unknown)
+	}
+	for _, gid := range []model.GoogleID{dupA, dupB} {
+		if in, _ := gid.AgentInTeam(teamID); in {
+			t.Errorf("agent with a shared name %s added", gid)
+		}
+	}
+}
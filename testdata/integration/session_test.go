@@ -0,0 +1,94 @@
+package integration_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/wasabee-project/Wasabee-Server/model"
+	"github.com/wasabee-project/Wasabee-Server/util"
+)
+
+func TestSessionRevocation(t *testing.T) {
+	needDB(t)
+
+	gid := newAgent(t)
+	other := newAgent(t)
+	expires := time.Now().Add(time.Hour)
+
+	phoneJWT, laptopJWT := util.GenerateID(16), util.GenerateID(16)
+	phone, err := gid.NewRefreshToken(phoneJWT, expires, "phone", "127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	laptop, err := gid.NewRefreshToken(laptopJWT, expires, "laptop", "127.0.0.2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// rotation keeps the session, now with the new access JWT
+	rotatedJWT := util.GenerateID(16)
+	if _, phone, err = model.RotateRefreshToken(phone, rotatedJWT, expires); err != nil {
+		t.Fatal(err)
+	}
+
+	sessions, err := gid.Sessions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 2 {
+		t.Fatalf("%d sessions, want 2", len(sessions))
+	}
+	var phoneSession model.SessionID
+	for _, s := range sessions {
+		if s.JwtID == rotatedJWT {
+			phoneSession = s.ID
+		}
+	}
+	if phoneSession == "" {
+		t.Fatalf("rotated access JWT not on its session: %+v", sessions)
+	}
+
+	// another agent cannot end it
+	if _, err := other.RevokeSession(phoneSession); err == nil || err.Error() != model.ErrSessionNotFound {
+		t.Errorf("other agent revoked the session: %v", err)
+	}
+
+	jwts, err := gid.RevokeSession(phoneSession)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jwts) != 2 {
+		t.Errorf("revoked %v, want both of the session's access JWTs", jwts)
+	}
+	for _, j := range []string{phoneJWT, rotatedJWT} {
+		if revoked, err := model.IsRevokedJWT(j); err != nil || !revoked {
+			t.Errorf("access JWT %s not revoked: %v", j, err)
+		}
+	}
+	if _, _, err := model.RotateRefreshToken(phone, util.GenerateID(16), expires); err == nil || err.Error() != model.ErrRefreshTokenInvalid {
+		t.Errorf("refresh token of a revoked session: %v", err)
+	}
+
+	// the other session is untouched
+	if revoked, err := model.IsRevokedJWT(laptopJWT); err != nil || revoked {
+		t.Errorf("access JWT of another session revoked: %v", err)
+	}
+	if sessions, err := gid.Sessions(); err != nil || len(sessions) != 1 {
+		t.Errorf("sessions after revoking one: %+v %v", sessions, err)
+	}
+
+	// logging out with a refresh token ends its session and reports the JWTs to federate
+	if _, err := other.RevokeRefreshToken(laptop); err == nil {
+		t.Error("other agent revoked a refresh token")
+	}
+	jwts, err = gid.RevokeRefreshToken(laptop)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jwts) != 1 || jwts[0] != laptopJWT {
+		t.Errorf("logout revoked %v, want %s", jwts, laptopJWT)
+	}
+	if sessions, err := gid.Sessions(); err != nil || len(sessions) != 0 {
+		t.Errorf("sessions after logout: %+v %v", sessions, err)
+	}
+}
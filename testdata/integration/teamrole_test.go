@@ -0,0 +1,74 @@
+package integration_test
+
+import (
+	"testing"
+
+	"github.com/wasabee-project/Wasabee-Server/model"
+)
+
+func TestTeamRolePromoteDemote(t *testing.T) {
+	needDB(t)
+
+	owner := newAgent(t)
+	agent := newAgent(t)
+	outsider := newAgent(t)
+	teamID := newTeam(t, owner, agent)
+
+	if err := teamID.SetRole(agent, model.TeamRoleAdmin); err != nil {
+		t.Fatal(err)
+	}
+	if admins, _ := agent.AdminsTeam(teamID); !admins {
+		t.Error("promoted agent does not admin the team")
+	}
+	if owns, _ := agent.OwnsTeam(teamID); owns {
+		t.Error("promoted agent owns the team")
+	}
+
+	if err := teamID.SetRole(agent, model.TeamRoleMember); err != nil {
+		t.Fatal(err)
+	}
+	if admins, _ := agent.AdminsTeam(teamID); admins {
+		t.Error("demoted agent still admins the team")
+	}
+
+	if err := teamID.SetRole(owner, model.TeamRoleMember); err == nil || err.Error() != model.ErrCannotChangeOwnerRole {
+		t.Errorf("owner demoted: %v", err)
+	}
+	if err := teamID.SetRole(agent, model.TeamRoleOwner); err == nil || err.Error() != model.ErrInvalidTeamRole {
+		t.Errorf("owner role set without chown: %v", err)
+	}
+	if err := teamID.SetRole(outsider, model.TeamRoleAdmin); err == nil || err.Error() != model.ErrAgentNotOnTeam {
+		t.Errorf("agent not on the team promoted: %v", err)
+	}
+}
+
+func TestTeamChownLegacyOwner(t *testing.T) {
+	needDB(t)
+
+	owner := newAgent(t)
+	agent := newAgent(t)
+	teamID := newTeam(t, owner, agent)
+
+	// teams created before roles were recorded have the default role on the owner's row
+	if _, err := rawdb.Exec("UPDATE agentteams SET role = 'member' WHERE teamID = ? AND gid = ?", teamID, owner); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := teamID.Chown(agent); err != nil {
+		t.Fatal(err)
+	}
+	if role, err := owner.TeamRole(teamID); err != nil || role != model.TeamRoleAdmin {
+		t.Errorf("previous owner's role: %q %v, want admin", role, err)
+	}
+	if role, err := agent.TeamRole(teamID); err != nil || role != model.TeamRoleOwner {
+		t.Errorf("new owner's role: %q %v, want owner", role, err)
+	}
+
+	var owners int
+	if err := rawdb.QueryRow("SELECT COUNT(*) FROM agentteams WHERE teamID = ? AND role = 'owner'", teamID).Scan(&owners); err != nil {
+		t.Fatal(err)
+	}
+	if owners != 1 {
+		t.Errorf("%d owner rows after chown", owners)
+	}
+}
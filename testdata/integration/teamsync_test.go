@@ -0,0 +1,76 @@
+package integration_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/wasabee-project/Wasabee-Server/background"
+	"github.com/wasabee-project/Wasabee-Server/config"
+	"github.com/wasabee-project/Wasabee-Server/model"
+)
+
+func TestMemberSyncError(t *testing.T) {
+	if err := model.MemberSyncError(nil); err != nil {
+		t.Errorf("no failures: %v", err)
+	}
+	one := fmt.Errorf("agent not found")
+	if err := model.MemberSyncError([]error{one}); err != one {
+		t.Errorf("one failure: %v", err)
+	}
+	err := model.MemberSyncError([]error{one, fmt.Errorf("second")})
+	if err == nil || !strings.HasPrefix(err.Error(), "2 agents could not be synced") {
+		t.Errorf("two failures: %v", err)
+	}
+}
+
+func TestTeamSyncRecordsFailures(t *testing.T) {
+	needDB(t)
+
+	running := config.IsVRunning()
+	config.SetVRunning(true)
+	defer config.SetVRunning(running)
+
+	owner := newAgent(t)
+	a := newTeam(t, owner)
+	b := newTeam(t, owner)
+	for i, teamID := range []model.TeamID{a, b} {
+		if err := teamID.VConfigure(int64(900000+i), 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	vteams, _, err := model.SyncedTeams()
+	if err != nil {
+		t.Fatal(err)
+	}
+	linked := make(map[model.TeamID]bool)
+	for _, teamID := range vteams {
+		linked[teamID] = true
+	}
+	if !linked[a] || !linked[b] {
+		t.Fatalf("linked teams not listed for sync: %v", vteams)
+	}
+
+	// the owner has no V API key, each team records its own failure
+	for _, teamID := range []model.TeamID{a, b} {
+		background.SyncTeam(context.Background(), teamID, model.SyncSourceV)
+	}
+	for _, teamID := range []model.TeamID{a, b} {
+		syncs, err := teamID.SyncLog(10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(syncs) != 1 || syncs[0].Source != model.SyncSourceV || syncs[0].Error == "" {
+			t.Errorf("team %s sync log: %+v", teamID, syncs)
+		}
+	}
+
+	// nothing is attempted, or recorded, for an integration which is not running
+	config.SetVRunning(false)
+	background.SyncTeam(context.Background(), a, model.SyncSourceV)
+	if syncs, _ := a.SyncLog(10); len(syncs) != 1 {
+		t.Errorf("sync recorded with V not running: %+v", syncs)
+	}
+}
@@ -0,0 +1,46 @@
+package integration_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/wasabee-project/Wasabee-Server/model"
+)
+
+func TestTeamTreeAccess(t *testing.T) {
+	needDB(t)
+
+	owner := newAgent(t)
+	child := newAgent(t)
+	sibling := newAgent(t)
+
+	parent := newTeam(t, owner)
+	a := newTeam(t, owner, child)
+	b := newTeam(t, owner, sibling)
+	for _, sub := range []model.TeamID{a, b} {
+		if err := sub.SetParent(parent); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := parent.SetParent(a); err == nil {
+		t.Error("team cycle accepted")
+	}
+
+	// permissions on the parent flow down to the sub-teams
+	op := newOp(t, owner)
+	if err := op.ID.AddPerm(owner, parent, "read", model.ZoneAll, time.Time{}, time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	o := model.Operation{ID: op.ID}
+	if read, _ := o.ReadAccess(child); !read {
+		t.Error("sub-team agent has no access to an op shared with the parent")
+	}
+
+	// but sub-team agents do not administer the parent, nor see their siblings
+	if child.AdminsTeamTree(parent) || child.AdminsTeamTree(b) {
+		t.Error("sub-team member reported as admin of the tree")
+	}
+	if !owner.AdminsTeamTree(b) {
+		t.Error("parent owner does not administer the sub-team")
+	}
+}
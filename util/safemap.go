@@ -57,6 +57,24 @@ func (sm *Safemap) SetBool(key string, value bool) {
 	sm.m.Unlock()
 }
 
+// Delete removes a key from the map
+func (sm *Safemap) Delete(key string) {
+	sm.m.Lock()
+	delete(sm.d, key)
+	sm.m.Unlock()
+}
+
+// Copy returns a snapshot of the map's contents
+func (sm *Safemap) Copy() map[string]uint64 {
+	sm.m.RLock()
+	out := make(map[string]uint64, len(sm.d))
+	for k, v := range sm.d {
+		out[k] = v
+	}
+	sm.m.RUnlock()
+	return out
+}
+
 // NewSafemap returns an initialized pointer to a Safemap
 func NewSafemap() *Safemap {
 	var n Safemap
@@ -176,8 +176,8 @@ func (vteamID vTeamID) getTeamFromV(key string) (*teamResult, error) {
 	return &vt, nil
 }
 
-// Sync pulls a team (and role) from V to sync with a Wasabee team
-func Sync(ctx context.Context, teamID model.TeamID, key string) error {
+// Sync pulls a team (and role) from V to sync with a Wasabee team, the result is recorded in the team's sync log
+func Sync(ctx context.Context, teamID model.TeamID, key string) (err error) {
 	// XXX put ctx.Done() checks in the loops....
 
 	x, role, err := teamID.VTeam()
@@ -189,6 +189,17 @@ func Sync(ctx context.Context, teamID model.TeamID, key string) error {
 		return nil
 	}
 
+	started := time.Now()
+	var added, removed int
+	var failed []error // single agents, these do not stop the sync
+	defer func() {
+		recorded := err
+		if recorded == nil {
+			recorded = model.MemberSyncError(failed)
+		}
+		teamID.RecordSync(model.SyncSourceV, started, added, removed, recorded)
+	}()
+
 	if key == "" {
 		err := fmt.Errorf("cannot sync V team if no V API key set")
 		log.Error(err)
@@ -217,11 +228,13 @@ func Sync(ctx context.Context, teamID model.TeamID, key string) error {
 			log.Infow("Importing previously unknown agent", "GID", agent.Gid)
 			if err := agent.Gid.FirstLogin(); err != nil {
 				log.Error(err)
+				failed = append(failed, err)
 				continue
 			}
 			// #nosec -- model.VToDB isn't async, aliasing doesn't matter here
 			if err := model.VToDB(&agent); err != nil {
 				log.Error(err)
+				failed = append(failed, err)
 				continue
 			}
 		}
@@ -241,6 +254,7 @@ func Sync(ctx context.Context, teamID model.TeamID, key string) error {
 		in, err := agent.Gid.AgentInTeam(teamID)
 		if err != nil {
 			log.Info(err)
+			failed = append(failed, err)
 			continue
 		}
 		if in {
@@ -250,10 +264,12 @@ func Sync(ctx context.Context, teamID model.TeamID, key string) error {
 
 		if _, ok := atv[agent.Gid]; ok {
 			// log.Infow("adding agent to team via V pull", "GID", agent.Gid, "team", teamID)
-			if err := teamID.AddAgent(agent.Gid); err != nil {
+			if err := teamID.AddAgent(agent.Gid, "", "V sync"); err != nil {
 				log.Info(err)
+				failed = append(failed, err)
 				continue
 			}
+			added++
 		}
 	}
 
@@ -271,9 +287,12 @@ func Sync(ctx context.Context, teamID model.TeamID, key string) error {
 			err := fmt.Errorf("agent in wasabee team but not in V team/role, removing")
 			log.Infow(err.Error(), "GID", a.Gid, "wteam", teamID, "vteam", vteamID, "role", role)
 
-			if err = teamID.RemoveAgent(a.Gid); err != nil {
+			if err = teamID.RemoveAgent(a.Gid, "", "V sync"); err != nil {
 				log.Error(err)
+				failed = append(failed, err)
+				continue
 			}
+			removed++
 		}
 	}
 	return nil